@@ -1,14 +1,478 @@
 package main
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 	"github.com/richgrove/validation/rule"
+	"github.com/richgrove/validation/util"
 )
 
+// wordListFlag collects the repeated -word-list name=file options
+type wordListFlag map[string]string
+
+func (f wordListFlag) String() string {
+	return fmt.Sprint(map[string]string(f))
+}
+func (f wordListFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+		return fmt.Errorf("expect <name>=<file>, got %s", value)
+	}
+	f[kv[0]] = kv[1]
+	return nil
+}
+
+// exportRules runs the export command, and returns the exit code
+func exportRules(args []string) int {
+	export := flag.NewFlagSet("export", flag.ExitOnError)
+	format := export.String("format", rule.ExportJSONSchema, "export format: jsonschema, openapi or proto")
+	ruleset := export.String("ruleset", "", "ruleset of the exported rules, empty exports the common rules")
+	protoFields := export.String("proto-fields", "", "JSON file keeping the protobuf field numbers across the exports, updated by the proto export")
+	export.Parse(args)
+	if len(*protoFields) > 0 {
+		if err := rule.LoadProtoFieldNumbers(*protoFields); err != nil {
+			log.Print(err)
+			return 2
+		}
+	}
+	if err := rule.ExportRules(*format, *ruleset, os.Stdout); err != nil {
+		log.Print(err)
+		return 2
+	}
+	if len(*protoFields) > 0 && *format == rule.ExportProto {
+		if err := rule.SaveProtoFieldNumbers(*protoFields); err != nil {
+			log.Print(err)
+			return 2
+		}
+	}
+	return 0
+}
+
+// generateSamples runs the samples command, prints the generated documents,
+// or the negative samples, as JSON Lines, and returns the exit code
+func generateSamples(args []string) int {
+	samples := flag.NewFlagSet("samples", flag.ExitOnError)
+	ruleset := samples.String("ruleset", "", "ruleset of the documents, empty applies the common rules")
+	count := samples.Int("count", 1, "number of the generated documents")
+	seed := samples.Int64("seed", 0, "seed of the generation, the same seed generates the same documents")
+	negative := samples.Bool("negative", false, "generate a document failing each rule alone, or the -rule")
+	ruleName := samples.String("rule", "", "rule of the -negative document, empty is each rule")
+	samples.Parse(args)
+	if *negative {
+		report, err := rule.GenerateNegativeSamples(*ruleset, *ruleName, *seed)
+		if err != nil {
+			log.Print(err)
+			return 2
+		}
+		for _, sample := range report.Samples {
+			data, _ := json.Marshal(sample)
+			fmt.Println(string(data))
+		}
+		if len(report.Unviolated) > 0 {
+			log.Printf("samples: no document fails the rules alone %v", report.Unviolated)
+			return 1
+		}
+		return 0
+	}
+	report, err := rule.GenerateSamples(*ruleset, *count, *seed)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	for _, doc := range report.Documents {
+		data, _ := json.Marshal(doc)
+		fmt.Println(string(data))
+	}
+	if len(report.Unsatisfied) > 0 {
+		log.Printf("samples: the documents fail the rules %v", report.Unsatisfied)
+		return 1
+	}
+	return 0
+}
+
+// validateJSONLines runs the validate-jsonl command, and returns the exit
+// code
+func validateJSONLines(args []string) int {
+	command := flag.NewFlagSet("validate-jsonl", flag.ExitOnError)
+	ruleset := command.String("ruleset", "", "ruleset of the validation, empty applies the common rules")
+	progress := command.Duration("progress", 10*time.Second, "interval of the progress log, 0 disables it")
+	command.Parse(args)
+	if command.NArg() != 1 {
+		log.Print("validate-jsonl: expect one JSON Lines file, - is stdin, .gz is gzipped")
+		return 2
+	}
+	if err := rule.CheckRuleset(*ruleset); err != nil {
+		log.Print(err)
+		return 2
+	}
+	var in io.Reader = os.Stdin
+	if path := command.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Print(err)
+			return 2
+		}
+		defer f.Close()
+		in = f
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				log.Print(err)
+				return 2
+			}
+			defer gz.Close()
+			in = gz
+		}
+	}
+	report, err := rule.ValidateJSONLines(in, *ruleset, *progress, func(p rule.JSONLProgress) {
+		log.Printf("validate-jsonl: %d lines, %d bytes read, %d failed", p.Lines, p.Bytes, p.Failed)
+	})
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	data, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(data))
+	if report.Failed > 0 || report.Invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// verifyGoldenCorpus runs the verify command, and returns the exit code
+func verifyGoldenCorpus(args []string) int {
+	verify := flag.NewFlagSet("verify", flag.ExitOnError)
+	update := verify.Bool("update", false, "rewrite the golden verdicts with the current ones")
+	verify.Parse(args)
+	dir := "testdata/golden"
+	if verify.NArg() > 0 {
+		dir = verify.Arg(0)
+	}
+	failures, err := rule.VerifyGoldenCorpus(dir, *update, os.Stdout)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
 func main() {
+	schedulerWorkers := flag.Int("scheduler-workers", 0, "worker pool size of the stream, batch and JSONL validations and the concurrent executor, 0 runs them in their own goroutines")
+	schedulerBatchWorkers := flag.Int("scheduler-batch-workers", 0, "workers running batch work at the same time, 0 is all workers")
+	schedulerJobWorkers := flag.Int("scheduler-job-workers", 0, "workers running the work of one batch job, 0 is all batch workers")
+	chaosConfig := flag.String("chaos-config", "", "TEST ONLY: JSON file of the injected faults, enables chaos mode")
+	counterStore := flag.String("counter-store", "", "file to persist the per-rule counters, empty keeps them in memory")
+	counterFlush := flag.Duration("counter-flush", time.Minute, "per-rule counters flush interval")
+	flag.Var(wordListFlag(rule.WordListFiles), "word-list", "word list `name=file` for IN_DICTIONARY/NOT_IN_BLOCKLIST, repeatable")
+	messageCatalog := flag.String("message-catalog", "", "JSON file of the violation message translations, per rule and locale, picked by Accept-Language")
+	redactionConfig := flag.String("redaction-config", "", "JSON file of the per-field redaction of the echoed values")
+	ruleIDGenerator := flag.String("rule-id-generator", "random", "ID of a rule created without \"id\": random (random UUID) or name (name-based UUID), the rules.json rules are name-based")
+	zeroRulePolicy := flag.String("zero-rule-policy", "pass", "result of an input matching no rule: pass, fail or warn")
+	nullPolicy := flag.String("null-policy", "evaluate", "rule result of a null field: pass, fail, empty (evaluated with \"\") or evaluate (with null)")
+	missingPolicy := flag.String("missing-policy", "pass", "rule result of an absent primary field: pass, fail or empty (evaluated with \"\")")
+	quarantineConfig := flag.String("quarantine-config", "", "JSON file of the failure sampling into the quarantine")
+	streamBuffer := flag.Int("stream-buffer", rule.StreamBufferSize, "documents of a stream parsed ahead of the evaluation")
+	streamWorkers := flag.Int("stream-workers", rule.StreamWorkers, "workers evaluating the documents of a stream")
+	jsonlMaxBytes := flag.Int64("jsonl-max-bytes", rule.MaxJSONLBytes, "maximum body of POST /api/validation/jsonl")
+	jsonlMaxLine := flag.Int("jsonl-max-line", rule.MaxJSONLLineBytes, "maximum line of a JSON Lines validation, a longer line fails it")
+	adhocMaxRules := flag.Int("adhoc-max-rules", rule.MaxAdhocRules, "maximum inline rules of an ad hoc validation")
+	rulesetConfig := flag.String("ruleset-config", "", "JSON file of the ruleset settings, e.g. the per-ruleset zero-rule policy")
+	webhookConfig := flag.String("webhook-config", "", "JSON file of the webhooks posted the validation outcomes, and of the allowed X-Callback-URL prefixes")
+	discriminatorConfig := flag.String("discriminator-config", "", "JSON file of the ruleset selection by a type field of the document, without ?ruleset=")
+	namespaceConfig := flag.String("namespace-config", "", "JSON file of the per-namespace resource limits")
+	operatorPacks := flag.String("operator-packs", "", "comma-separated operator packs to enable, e.g. finance,identity,geo")
+	metricsBackend := flag.String("metrics", "prometheus", "metrics backend: prometheus (GET /metrics), statsd, datadog or none")
+	metricsAddr := flag.String("metrics-addr", "127.0.0.1:8125", "StatsD/DogStatsD agent address of the statsd and datadog metrics")
+	environment := flag.String("environment", "", "deployment environment, e.g. prod, only the rules without \"environments\" or targeting it are loaded")
+	requireApproval := flag.Bool("require-approval", false, "create the rules of POST /admin/rule as drafts, published by the approval of another user")
+	regressionConfig := flag.String("regression-config", "", "JSON file of the document corpus checked by the rule changes of the admin API")
+	enforceExamples := flag.Bool("enforce-examples", false, "reject the rules which fail their \"examples\", in rules.json and the API")
+	readOnly := flag.Bool("read-only", false, "reject the rule changes of the admin endpoints, the rules change by the deployed rule files only")
+	failFast := flag.String("fail-fast", "off", "evaluation stop of an input: off, field (at the first failure of a field) or global (at the first error severity failure)")
+	samplingSeed := flag.String("sampling-seed", "", "seed of the sampling hash, the replicas must share it")
+	samplingKey := flag.String("sampling-key", "", "input field sampled by its hash, e.g. user_id, empty samples by the hash of the payload")
+	operatorCacheConfig := flag.String("operator-cache-config", "", "JSON file of the per-operator result caches, LOOKUP is cached for 5 minutes by default")
+	uniqueStore := flag.String("unique-store", "memory", "store of the values seen by UNIQUE_IN_SCOPE: memory, redis://[:password@]host:port[/db][?pool=8] shared by the instances, or sqlite:///path/to/file.db")
+	recoverPanics := flag.Bool("recover-panics", true, "respond HTTP 500 to a panic of a request, with the request ID, and log its stack, false crashes the service")
+	failureDetails := flag.Bool("failure-details", false, "list the failing field, message and redacted value of each failure, without ?details=")
+	panicDetails := flag.Bool("panic-details", false, "add the panic value and the rule to the HTTP 500 response, for the development instances")
+	sweepInterval := flag.Duration("sweep-interval", 0, "interval of the expired rule sweeper, 0 disables it")
+	expiredRuleRetention := flag.Duration("expired-rule-retention", 0, "time an expired on-expiry delete rule is kept after its valid-until")
+	ruleVersionRetention := flag.Duration("rule-version-retention", 0, "time a replaced rule version is kept by the sweeper, 0 keeps it")
+	auditRetention := flag.Duration("audit-retention", 0, "time a rule change is kept in the audit log by the sweeper, 0 keeps it")
+	readinessConfig := flag.String("readiness-config", "", "JSON file of the minimum rule coverage of GET /readyz, the required rules and rule counts")
+	formatRules := flag.String("format", "", "print the rules JSON file in the canonical form, and exit")
+	importCSV := flag.String("import-csv", "", "print the rules of the CSV file as a rules JSON file, and exit")
+	lookupAllow := flag.String("lookup-allow", "", "comma-separated URL prefixes LOOKUP may call, e.g. https://codes.internal/v1/, none by default")
+	flag.Parse()
+
+	if len(*lookupAllow) > 0 {
+		if err := rule.SetLookupAllowlist(strings.Split(*lookupAllow, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(*operatorPacks) > 0 {
+		if err := rule.EnableOperatorPacks(strings.Split(*operatorPacks, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(*formatRules) > 0 {
+		if err := rule.FormatRulesFile(*formatRules, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(*importCSV) > 0 {
+		if err := rule.ImportRulesCSVFile(*importCSV, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if policy, err := rule.ParseZeroRulePolicy(*zeroRulePolicy); err != nil {
+		log.Fatal(err)
+	} else {
+		rule.DefaultZeroRulePolicy = policy
+	}
+	if policy, err := rule.ParseNullPolicy(*nullPolicy); err != nil {
+		log.Fatal(err)
+	} else {
+		rule.DefaultNullPolicy = policy
+	}
+	if policy, err := rule.ParseMissingPolicy(*missingPolicy); err != nil {
+		log.Fatal(err)
+	} else {
+		rule.DefaultMissingPolicy = policy
+	}
+	if mode, err := rule.ParseFailFastMode(*failFast); err != nil {
+		log.Fatal(err)
+	} else {
+		rule.DefaultFailFast = mode
+	}
+
+	rule.StreamBufferSize = *streamBuffer
+	rule.StreamWorkers = *streamWorkers
+	rule.MaxAdhocRules = *adhocMaxRules
+	rule.MaxJSONLBytes = *jsonlMaxBytes
+	rule.MaxJSONLLineBytes = *jsonlMaxLine
+	rule.SamplingSeed = *samplingSeed
+	rule.SamplingKeyField = *samplingKey
+	rule.ReadOnly = *readOnly
+	rule.RequireApproval = *requireApproval
+	rule.Environment = *environment
+	rule.EnforceRuleExamples = *enforceExamples
+	rule.ExpiredRuleRetention = *expiredRuleRetention
+	rule.RuleVersionRetention = *ruleVersionRetention
+	rule.AuditRetention = *auditRetention
+	rule.RecoverPanics = *recoverPanics
+	rule.PanicDetails = *panicDetails
+	rule.DefaultFailureDetails = *failureDetails
+
+	if err := rule.ConfigureMetrics(*metricsBackend, *metricsAddr); err != nil {
+		log.Fatal(err)
+	}
+
+	switch *ruleIDGenerator {
+	case "random":
+		rule.RuleIDGenerator = rule.RandomIDGenerator{}
+	case "name":
+		rule.RuleIDGenerator = rule.NameBasedIDGenerator{}
+	default:
+		log.Fatalf("unknown rule ID generator, %s", *ruleIDGenerator)
+	}
+
+	if *schedulerWorkers > 0 {
+		util.DefaultScheduler = util.NewScheduler(*schedulerWorkers, *schedulerBatchWorkers, *schedulerJobWorkers)
+	}
+
+	if len(*rulesetConfig) > 0 {
+		if err := rule.LoadRulesetConfig(*rulesetConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(*webhookConfig) > 0 {
+		if err := rule.LoadWebhookConfig(*webhookConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(*operatorCacheConfig) > 0 {
+		if err := rule.LoadOperatorCacheConfig(*operatorCacheConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if store, err := rule.OpenUniqueStore(*uniqueStore); err != nil {
+		log.Fatal(err)
+	} else {
+		rule.UniqueValues = store
+	}
+	if len(*namespaceConfig) > 0 {
+		if err := rule.LoadNamespaceConfig(*namespaceConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// system initialization: load the system rules
+	if err := rule.LoadSystemRules(); err != nil {
+		log.Fatal(err)
+	}
+	if len(*discriminatorConfig) > 0 {
+		if err := rule.LoadDiscriminatorConfig(*discriminatorConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(*regressionConfig) > 0 {
+		if err := rule.LoadRegressionConfig(*regressionConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(*readinessConfig) > 0 {
+		if err := rule.LoadReadinessConfig(*readinessConfig); err != nil {
+			log.Fatal(err)
+		}
+		for _, unmet := range rule.CheckReadiness() {
+			log.Printf("WARNING: not ready, %s", unmet)
+		}
+	}
+
+	if len(*chaosConfig) > 0 {
+		if err := rule.EnableChaos(*chaosConfig); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("WARNING: chaos mode is enabled with %s, faults are injected", *chaosConfig)
+	}
+	if len(*messageCatalog) > 0 {
+		if err := rule.LoadMessageCatalog(*messageCatalog); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(*redactionConfig) > 0 {
+		if err := rule.LoadRedactionConfig(*redactionConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// the commands don't sample nor count the payloads
+	verifying := flag.Arg(0) == "verify"
+	exporting := flag.Arg(0) == "export"
+	validatingJSONL := flag.Arg(0) == "validate-jsonl"
+	sampling := flag.Arg(0) == "samples"
+	offline := verifying || exporting || validatingJSONL || sampling
+	if len(*quarantineConfig) > 0 && !offline {
+		if err := rule.EnableQuarantine(*quarantineConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// the background jobs stopped at the shutdown
+	stops := []func(){}
+	if len(*counterStore) > 0 && !offline {
+		store := &rule.FileCounterStore{Path: *counterStore}
+		stop, err := rule.StartRuleCounterFlush(store, *counterFlush)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stops = append(stops, stop)
+	}
+	if err := rule.LoadWordLists(); err != nil {
+		log.Fatal(err)
+	}
+
+	// validation verify [-update] <corpus-dir>, check the golden verdicts
+	if verifying {
+		os.Exit(verifyGoldenCorpus(flag.Args()[1:]))
+	}
+	// validation export -format=<format> [-ruleset=<ruleset>], the rule contracts
+	if exporting {
+		os.Exit(exportRules(flag.Args()[1:]))
+	}
+	// validation validate-jsonl [-ruleset=<ruleset>] <file>, the summary of a log archive
+	if validatingJSONL {
+		os.Exit(validateJSONLines(flag.Args()[1:]))
+	}
+	// validation samples [-negative] [-ruleset=<ruleset>] [-count=<n>] [-seed=<seed>], the generated documents
+	if sampling {
+		os.Exit(generateSamples(flag.Args()[1:]))
+	}
+	if *sweepInterval > 0 {
+		stops = append(stops, rule.StartRuleSweeper(*sweepInterval))
+	}
+
+	// startup banner
+	info := rule.GetVersionInfo()
+	log.Printf("validation service %s (commit %s, %s): %d rules loaded, registry hash %s",
+		info.Version, info.Commit, info.GoVersion, info.RuleCount, info.RegistryHash)
+	log.Printf("enabled features: %v", info.Features)
+
 	// serve at port 8000 for API services:
 	//  POST /api/validation   validate a JSON
+	//  POST /api/validation/stream       validate a JSON array or NDJSON
+	//  POST /api/validation/batch        validate a JSON array or NDJSON, in one response
+	//  POST /api/validation/field        validate a form field by its rules
+	//  POST /api/validation/adhoc        validate a JSON by inline rules
+	//  POST /api/validation/patch        validate a JSON Patch by the patched document
+	//  POST /api/validation/diff         validate a document change, old and new
+	//  POST /api/validation/jsonl        validate a JSON Lines archive in background
+	//  GET /api/validation/jsonl/{id}    progress and report of the JSONL job
+	//  GET /api/validation/requirements  constraints per field
+	//  GET /api/validation/bundle        offline evaluation bundle
+	//  GET /admin/rule?page=1&limit=50   list the rules, by field and name prefix
 	//  POST /admin/rule                  create a rule
+	//  POST /admin/rule/format           canonical form of a rule
+	//  POST /admin/rule/dryrun           evaluate a rule on a document, unregistered
+	//  GET /admin/rule/<rule-name>       rule definition
+	//  PUT /admin/rule/<rule-name>       update a rule, by If-Match version
 	//  DELETE /admin/rule/<rule-name>    delete a rule
-	http.ListenAndServe(":8000", rule.Handlers())
+	//  PATCH /admin/rule/<rule-name>/status  enable or disable a rule
+	//  POST /admin/rule/<rule-name>/approve  submit, approve or retire a rule
+	//  POST /admin/rule/<rule-name>/test     evaluate the rule examples
+	//  GET /version                      build and registry info
+	//  GET /readyz                       readiness by the rule coverage
+	//  GET /metrics                      Prometheus metrics
+	//  GET /admin/stats                  per-rule counters
+	//  GET /admin/operators              available operators
+	//  GET /admin/quarantine             sampled failed payloads
+	//  GET /admin/rules/duplicates       duplicate rule report
+	//  POST /admin/rules/merge           merge the duplicate rules
+	//  POST /admin/rules/import          import the rules of a CSV file
+	//  GET /admin/rules?tag=<tag>        list the rules, by tag
+	//  DELETE /admin/rules?tag=<tag>     delete the rules with the tag
+	//  GET /admin/rules/docs             rule catalogue in Markdown or HTML
+	//  GET /admin/rules/export           registered rules as a rules.json file
+	//  GET /admin/rules/graph            rule and field coverage graph
+	//  GET /admin/samples                generated documents of a ruleset
+	//  GET /admin/samples/negative       documents failing one rule each
+	//  GET /admin/namespaces             namespace consumption and limits
+	//  POST /admin/wordlists/reload      re-read the word list files
+	//  GET /admin/audit                  rule changes
+	//  GET /admin/rule/<rule-name>/versions  replaced versions of a rule
+	// with -read-only the rule changes respond HTTP 423
+	server := &http.Server{Addr: ":8000", Handler: rule.Handlers()}
+	go func() {
+		// SIGINT or SIGTERM drains the requests, then stops the background
+		// jobs, the counters are flushed a last time
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		server.Shutdown(context.Background())
+	}()
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Print(err)
+	}
+	for _, stop := range stops {
+		stop()
+	}
 }
@@ -1,30 +1,109 @@
 package rule
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"text/template"
+	"time"
 )
 
 var ParseRuleOperatorError = errors.New("rule parser: incorrect operands")
 var ParseRuleJsonDecodingError = errors.New("rule parser: JSON unmarshal invalid object value")
 var ParseRuleUnknownOperatorError = errors.New("rule parser: JSON unmarshal unknown operator")
+var ParseRuleResultTypeError = errors.New("rule parser: the rule doesn't evaluate to bool")
+var EvalFieldMissingError = errors.New("rule evaluation: referenced field is missing in the input")
+var EvalResultTypeError = errors.New("rule evaluation: the rule result is not bool")
 
 // evaluation context: keep the run-time state
 type EvalContext interface {
 	GetFieldValue() interface{}
+	// the value of any input field, for the cross-field rules
+	GetNamedFieldValue(name string) (interface{}, bool)
+	// the whole input document, <fieldName, fieldValue>, for the document rules
+	GetDocument() map[string]interface{}
 }
 
-// run-time field evaluation context
+// DocumentField is the field target of the document rules, evaluated as
+// the whole input document
+const DocumentField = "$document"
+
+// run-time field evaluation context.  Field is the primary field of the
+// rule, which triggers it, and Fields is the whole input field map.  For a
+// wildcard rule, Pattern is its primary field, e.g. "addresses[*].zip_code",
+// Field is the matched path, e.g. "addresses[1].zip_code", and indices
+// are the array indices bound to the [*].
 type FieldEvalContext struct {
+	RuleID     string
 	RuleName   string
-	FieldValue string
+	Field      string
+	FieldValue interface{}
+	Fields     map[string]interface{}
 	Rule       Operand
+	Pattern    string
+	indices    []string
+
+	// the violation message template of the rule, nil without "message"
+	message *template.Template
+	// the evaluation order and the failure severity, for fail-fast
+	priority int
+	severity string
+	// the null field policy of the rule, and the null or absent fields
+	// read as "" by the empty policy
+	nullPolicy  FieldPolicy
+	emptyFields bool
+	// the error code of the rule, "" without "error-code"
+	code string
+	// the enforcement percentage of the rule and its key field, nil is
+	// enforced for all
+	enforcement    *float64
+	enforcementKey string
+	// the evaluation of an isolated registry, the stateful operators don't
+	// record the values
+	isolated bool
+	// the values claimed by UNIQUE_IN_SCOPE, recorded once the validation
+	// passes, nil looks the values up only
+	claims *uniqueClaims
+	// the input fields of the old version of the document, nil without it
+	previous map[string]interface{}
 }
 
 func (context *FieldEvalContext) GetFieldValue() interface{} {
 	return context.FieldValue
 }
 
+// GetNamedFieldValue resolves a field name in the input field map.  A
+// context without the field map resolves every name to FieldValue, the
+// single-field rule.  A wildcard name resolves in the array item of the
+// matched path, or else to the first matching field, e.g. "..email".
+func (context *FieldEvalContext) GetNamedFieldValue(name string) (interface{}, bool) {
+	if name == context.Field || name == context.Pattern || context.Fields == nil {
+		return context.FieldValue, true
+	}
+	if len(context.indices) > 0 && isWildcardPath(name) {
+		name = bindWildcardPath(name, context.indices)
+	}
+	if isWildcardPath(name) {
+		field, ok := firstWildcardMatch(name, context.Fields)
+		if !ok && context.emptyFields {
+			return "", true
+		} else if !ok {
+			return nil, false
+		}
+		name = field
+	}
+	v, ok := context.Fields[name]
+	if context.emptyFields && v == nil {
+		return "", true
+	}
+	return v, ok
+}
+
+func (context *FieldEvalContext) GetDocument() map[string]interface{} {
+	return context.Fields
+}
+
 // rule operator functor, evaluates []interface{} data to
 // generate a single value, interface{}
 type OperatorFn func([]interface{}) (interface{}, error)
@@ -38,7 +117,81 @@ const (
 	GreaterThanOperator OperatorType = "GREATER_THAN"
 	OrOperator          OperatorType = "OR"
 	AndOperator         OperatorType = "AND"
-	RegexMatchOperator  OperatorType = "REGEX_MATCH"
+	MatchesOperator     OperatorType = "MATCHES"
+
+	IsSemverOperator          OperatorType = "IS_SEMVER"
+	SemverGreaterThanOperator OperatorType = "SEMVER_GREATER_THAN"
+
+	Sha256EqualsOperator OperatorType = "SHA256_EQUALS"
+	Crc32EqualsOperator  OperatorType = "CRC32_EQUALS"
+
+	LookupOperator OperatorType = "LOOKUP"
+
+	UniqueInScopeOperator OperatorType = "UNIQUE_IN_SCOPE"
+
+	InDictionaryOperator   OperatorType = "IN_DICTIONARY"
+	NotInBlocklistOperator OperatorType = "NOT_IN_BLOCKLIST"
+
+	IsTimezoneOperator OperatorType = "IS_TIMEZONE"
+
+	BetweenOperator OperatorType = "BETWEEN"
+
+	RegexExtractOperator OperatorType = "REGEX_EXTRACT"
+
+	DateFormatOperator OperatorType = "DATE_FORMAT"
+
+	ContentTypeIsOperator OperatorType = "CONTENT_TYPE_IS"
+
+	IfOperator OperatorType = "IF"
+
+	RequiredOperator OperatorType = "REQUIRED"
+
+	FieldCountOperator OperatorType = "FIELD_COUNT"
+	HasFieldOperator   OperatorType = "HAS_FIELD"
+
+	DocumentDepthOperator  OperatorType = "DOCUMENT_DEPTH"
+	DocumentLengthOperator OperatorType = "DOCUMENT_LENGTH"
+
+	RequiredIfOperator  OperatorType = "REQUIRED_IF"
+	ForbiddenIfOperator OperatorType = "FORBIDDEN_IF"
+
+	OldOperator           OperatorType = "OLD"
+	ChangedOperator       OperatorType = "CHANGED"
+	ChangePercentOperator OperatorType = "CHANGE_PERCENT"
+
+	ExactlyOneOfOperator OperatorType = "EXACTLY_ONE_OF"
+	AtMostOneOfOperator  OperatorType = "AT_MOST_ONE_OF"
+
+	SumOperator   OperatorType = "SUM"
+	MinOperator   OperatorType = "MIN"
+	MaxOperator   OperatorType = "MAX"
+	CountOperator OperatorType = "COUNT"
+
+	DateAfterOperator OperatorType = "DATE_AFTER"
+
+	// operator packs, available when the pack is enabled
+	// geo
+	IsLatitudeOperator  OperatorType = "IS_LATITUDE"
+	IsLongitudeOperator OperatorType = "IS_LONGITUDE"
+	WithinBboxOperator  OperatorType = "WITHIN_BBOX"
+	// finance
+	IsIbanOperator         OperatorType = "IS_IBAN"
+	LuhnValidOperator      OperatorType = "LUHN_VALID"
+	IsCurrencyCodeOperator OperatorType = "IS_CURRENCY_CODE"
+	// identity
+	IsSsnOperator          OperatorType = "IS_SSN"
+	PassportFormatOperator OperatorType = "PASSPORT_FORMAT"
+)
+
+// deprecated operator names, see OperatorAliases
+const (
+	RegexMatchOperator OperatorType = "REGEX_MATCH" // renamed to MATCHES
+)
+
+// operator evaluation mode, "mode" in the TermOperand JSON block
+const (
+	// compare the values in the arbitrary-precision decimal
+	OperatorModeDecimal = "decimal"
 )
 
 // Operand has the capability to be evaluated by Evaluate() function,
@@ -64,15 +217,24 @@ func (*FieldOperand) GetOperator() *OperatorFn {
 func (*FieldOperand) GetOperands() []Operand {
 	return nil
 }
-func (*FieldOperand) Evaluate(cx EvalContext) (interface{}, error) {
-	return cx.GetFieldValue(), nil
+func (f *FieldOperand) Evaluate(cx EvalContext) (interface{}, error) {
+	if f.Name == DocumentField {
+		return cx.GetDocument(), nil
+	}
+	if v, ok := cx.GetNamedFieldValue(f.Name); ok {
+		return v, nil
+	}
+	return nil, EvalFieldMissingError
 }
 
 // ValueOperand defines an operand to evaluate the value literal,
 // which is recorded when parse JSON block like,
 //       { "value": _value_literal_ }
+// The literal keeps its JSON type, and is passed natively to the operators:
+// string, int64 or *big.Int (integer), float64, bool, nil (null)
+// and []interface{} (array).
 type ValueOperand struct {
-	Value string `json:"value"`
+	Value interface{} `json:"value"`
 }
 
 func (*ValueOperand) GetOperator() *OperatorFn {
@@ -87,14 +249,23 @@ func (v *ValueOperand) Evaluate(cx EvalContext) (interface{}, error) {
 
 // TermOperand as a function definition, OperatorFn( OperandList ).
 // When TermOperand is parsed, the JSON block like,
-//    { "operator": OperatorType, "operands":  [ _operand_, ...]
+//    { "operator": OperatorType, "operands":  [ _operand_, ...], "mode": _mode_ }
 // JSON unmarshalJSON records the parsed result in []Term slice.
+// The optional "mode" selects the operator variant, e.g. "decimal".
 // Evaluate() is executed when all OperandList items are evaluated.
 type TermOperand struct {
 	ParseOperator string `json:"operator"`
 	ParseOperands []Term `json:"operands"`
+	ParseMode     string `json:"mode,omitempty"`
 	OperatorFn    *OperatorFn
 	OperandList   []Operand
+
+	// set when ParseOperator is a macro, expanded by ConstructOperandListHelper
+	macro *OperatorMacro
+	// the referenced rule name of RULE_REF, resolved by ConstructOperandListHelper
+	ruleRef string
+	// the deprecated operator alias in the rule JSON, resolved to ParseOperator
+	deprecatedAlias string
 }
 
 func (t *TermOperand) GetOperator() *OperatorFn {
@@ -104,12 +275,18 @@ func (t *TermOperand) GetOperands() []Operand {
 	return t.OperandList
 }
 func (t *TermOperand) Evaluate(cx EvalContext) (interface{}, error) {
+	if lazy, ok := lazyOperators[OperatorType(t.ParseOperator)]; ok {
+		// the operator evaluates its operands on demand
+		return lazy(cx, t.GetOperands())
+	}
+
 	length := len(t.GetOperands())
 	if length == 0 {
 		// no operands evaluated
 		return nil, nil
 	}
 
+	sig, typed := OperatorSignatures[OperatorType(t.ParseOperator)]
 	evalResult := make([]interface{}, length)
 	for i, ops := range t.GetOperands() {
 		if v, e := ops.Evaluate(cx); e != nil {
@@ -118,8 +295,19 @@ func (t *TermOperand) Evaluate(cx EvalContext) (interface{}, error) {
 		} else {
 			evalResult[i] = v
 		}
+		// a string operand of a number or bool field value is its JSON text
+		if _, ok := ops.(*FieldOperand); ok && typed && sig.operandType(i) == TypeString {
+			switch evalResult[i].(type) {
+			case string, nil:
+			default:
+				evalResult[i] = fieldText(evalResult[i])
+			}
+		}
 	}
 
+	if cache := operatorCacheOf(OperatorType(t.ParseOperator)); cache != nil {
+		return cache.call(t.ParseMode, *t.GetOperator(), evalResult)
+	}
 	return (*(t.GetOperator()))(evalResult)
 }
 
@@ -131,21 +319,92 @@ type Term struct {
 	Value interface{}
 }
 
-// RuleNode is used to parse one validation rule with "name" and "rule" content
+// RuleNode is used to parse one validation rule with "name" and "rule" content,
+// the optional immutable "id", the optional "primary-field" of a
+// cross-field rule, "required" when the primary field must be present, and
+// the "message" template of the violation, and the "rulesets" the rule
+// belongs to, a rule without "rulesets" applies to every validation.
+// "addressing", "path" or "pointer", selects the field name format, and
+// "namespace" is the tenant accounted for the rule resources.  "on-expiry"
+// is the sweeper action once the rule is past its "valid-until", and
+// "null-policy" and "missing-policy" override the system field policies.
+// "description", "owner" and "documentation" tell what the rule enforces,
+// and "error-code" is the stable code of its failure for the clients.
+// "enforcement" is the percentage of the inputs its failure fails, keyed
+// on the "enforcement-key" field, for a gradual rollout, and "state" is
+// the lifecycle state, only a "published" rule, the default, is evaluated.
+// "environments" are the deployment environments which load the rule.
+// "expression" is the infix form of "rule", compiled into it.
+// "examples" are the inputs the rule is expected to pass and to fail.
 type RuleNode struct {
-	Name        string `json:"name"`
-	RuleContent Term   `json:"rule"`
+	ID             string        `json:"id,omitempty"`
+	Name           string        `json:"name"`
+	Namespace      string        `json:"namespace,omitempty"`
+	Addressing     string        `json:"addressing,omitempty"`
+	PrimaryField   string        `json:"primary-field,omitempty"`
+	Rulesets       []string      `json:"rulesets,omitempty"`
+	Tags           []string      `json:"tags,omitempty"`
+	Required       bool          `json:"required,omitempty"`
+	Priority       int           `json:"priority,omitempty"`
+	Severity       string        `json:"severity,omitempty"`
+	Enabled        *bool         `json:"enabled,omitempty"`
+	ValidFrom      *time.Time    `json:"valid-from,omitempty"`
+	ValidUntil     *time.Time    `json:"valid-until,omitempty"`
+	OnExpiry       string        `json:"on-expiry,omitempty"`
+	NullPolicy     string        `json:"null-policy,omitempty"`
+	MissingPolicy  string        `json:"missing-policy,omitempty"`
+	Message        string        `json:"message,omitempty"`
+	ErrorCode      string        `json:"error-code,omitempty"`
+	Description    string        `json:"description,omitempty"`
+	Owner          string        `json:"owner,omitempty"`
+	Documentation  string        `json:"documentation,omitempty"`
+	Enforcement    *float64      `json:"enforcement,omitempty"`
+	EnforcementKey string        `json:"enforcement-key,omitempty"`
+	State          string        `json:"state,omitempty"`
+	Environments   []string      `json:"environments,omitempty"`
+	Expression     string        `json:"expression,omitempty"`
+	Examples       *RuleExamples `json:"examples,omitempty"`
+	RuleContent    Term          `json:"rule"`
+
+	// the user creating the rule by the API, the author of the rule
+	author string
 }
 
 // Customized Term decoding to handle,
-//   FieldOperand,  { "field": ... }
-//   ValueOperand,  { "value": ... }
-//   TermOperand,   { "operator": ..., "operands": [ ... ] }
+//   FieldOperand,     { "field": ... }
+//   ValueOperand,     { "value": ... }
+//   TermOperand,      { "operator": ..., "operands": [ ... ] }
+//   MacroArgOperand,  { "arg": ... }, only in a macro body
+//   FragmentOperand,  { "fragment": ... }
 func (t *Term) UnmarshalJSON(data []byte) error {
 	var f interface{}
 	json.Unmarshal(data, &f)
 	m := f.(map[string]interface{})
 
+	if _, ok := m["fragment"]; ok {
+		// parse fragment reference,
+		// { "fragment": _fragment_name_ }
+		fragment := FragmentOperand{}
+		if err := json.Unmarshal(data, &fragment); err != nil {
+			// failed to parse "fragment"
+			return ParseRuleJsonDecodingError
+		}
+		t.Value = fragment
+		return nil
+	}
+
+	if _, ok := m["arg"]; ok {
+		// parse macro argument placeholder,
+		// { "arg": _argument_index_ }
+		arg := MacroArgOperand{}
+		if err := json.Unmarshal(data, &arg); err != nil {
+			// failed to parse "arg"
+			return ParseRuleJsonDecodingError
+		}
+		t.Value = arg
+		return nil
+	}
+
 	if _, ok := m["field"]; ok {
 		// parse field operand,
 		// { "field": _field_name_ }
@@ -162,10 +421,17 @@ func (t *Term) UnmarshalJSON(data []byte) error {
 		// parse value operand,
 		// { "value": _value_literal_ }
 		value := ValueOperand{}
-		if err := json.Unmarshal(data, &value); err != nil {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
 			// failed to parse "value"
 			return ParseRuleJsonDecodingError
 		}
+		literal, err := typedLiteral(value.Value)
+		if err != nil {
+			return err
+		}
+		value.Value = literal
 		t.Value = value
 		return nil
 	}
@@ -178,11 +444,53 @@ func (t *Term) UnmarshalJSON(data []byte) error {
 			// failed to parse "operator"
 			return ParseRuleJsonDecodingError
 		}
-		// check the _operator_literal_ registered or not
+		// resolve the operator alias
+		if alias, ok := OperatorAliases[OperatorType(term.ParseOperator)]; ok {
+			if alias.Deprecated {
+				term.deprecatedAlias = term.ParseOperator
+			}
+			term.ParseOperator = string(alias.Target)
+		}
+		// check the _operator_literal_ registered or not, and its operand count
+		if sig, ok := OperatorSignatures[OperatorType(term.ParseOperator)]; ok {
+			if err := sig.checkArity(term.ParseOperator, len(term.ParseOperands)); err != nil {
+				return err
+			}
+		}
+		if OperatorType(term.ParseOperator) == RuleRefOperator {
+			name, err := parseRuleRef(&term)
+			if err != nil {
+				return err
+			}
+			term.ruleRef = name
+			t.Value = term
+			return nil
+		}
+		if len(term.ParseMode) > 0 {
+			// the operator variant of the mode
+			if term.ParseMode != OperatorModeDecimal {
+				return fmt.Errorf("rule parser: unknown operator mode, %s", term.ParseMode)
+			}
+			if fn, ok := RegisteredDecimalOperators[OperatorType(term.ParseOperator)]; ok {
+				term.OperatorFn = &fn
+				t.Value = term
+				return nil
+			}
+			return fmt.Errorf("rule parser: operator %s has no %s mode", term.ParseOperator, term.ParseMode)
+		}
 		if fn, ok := RegisteredOperators[OperatorType(term.ParseOperator)]; ok {
 			term.OperatorFn = &fn
 			t.Value = term
 			return nil
+		} else if macro := getOperatorMacro(term.ParseOperator); macro != nil {
+			if len(term.ParseOperands) != macro.Params {
+				return fmt.Errorf("rule parser: macro %s expects %d operands, got %d", macro.Name, macro.Params, len(term.ParseOperands))
+			}
+			term.macro = macro
+			t.Value = term
+			return nil
+		} else if pack := operatorPackOf(OperatorType(term.ParseOperator)); len(pack) > 0 {
+			return fmt.Errorf("rule parser: operator %s is in the operator pack %s, which is not enabled, enable it by -operator-packs=%s", term.ParseOperator, pack, pack)
 		} else {
 			return ParseRuleUnknownOperatorError
 		}
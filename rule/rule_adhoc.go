@@ -0,0 +1,245 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// the maximum rules of an ad hoc validation request
+var MaxAdhocRules = 100
+
+// the operators an ad hoc rule can't use, LOOKUP calls out from the server
+// and UNIQUE_IN_SCOPE reads the values seen by the registered rules
+var adhocForbiddenOperators = map[OperatorType]bool{
+	LookupOperator:        true,
+	UniqueInScopeOperator: true,
+}
+
+// AdhocRequest is a one-off validation, the document is validated by the
+// rules of the request only.  The rules are never registered, and their
+// evaluations are not counted.
+type AdhocRequest struct {
+	Document map[string]interface{} `json:"document"`
+	Rules    []RuleNode             `json:"rules"`
+	Ruleset  string                 `json:"ruleset,omitempty"`
+}
+
+// newAdhocRegistry parses the rules into an isolated registry, a rule
+// referencing a macro uses the registered macros.  The rules are checked
+// against the limits of their namespaces like registered rules, the usage
+// of the request only.
+func newAdhocRegistry(nodes []RuleNode) (ruleRegistry, error) {
+	reg := newIsolatedRegistry()
+	if len(nodes) == 0 {
+		return reg, fmt.Errorf("adhoc validation: no rule")
+	}
+	if len(nodes) > MaxAdhocRules {
+		return reg, fmt.Errorf("adhoc validation: %d rules, more than %d", len(nodes), MaxAdhocRules)
+	}
+	usage := map[string]*NamespaceUsage{}
+	for i := range nodes {
+		entry, fieldList, err := parseRuleNode(&nodes[i])
+		if err != nil {
+			return reg, err
+		}
+		if op, ok := usedOperator(entry.Rule, adhocForbiddenOperators); ok {
+			return reg, fmt.Errorf("adhoc validation: rule name, %s, uses the operator %s, not allowed in an ad hoc rule", entry.Name, op)
+		}
+		if err := resolveRuleFields(entry, fieldList); err != nil {
+			return reg, err
+		}
+		if usage[entry.Namespace] == nil {
+			usage[entry.Namespace] = &NamespaceUsage{}
+		}
+		RegRuleLock.RLock()
+		err = checkUsageLimits(entry, usage[entry.Namespace])
+		RegRuleLock.RUnlock()
+		if err != nil {
+			return reg, fmt.Errorf("adhoc validation: %s", err.Error())
+		}
+		usage[entry.Namespace].add(entry, 1)
+		if err := reg.add(entry); err != nil {
+			return reg, fmt.Errorf("adhoc validation: %s", err.Error())
+		}
+	}
+	return reg, nil
+}
+
+// usedOperator returns an operator of ops used in the operand tree
+func usedOperator(op Operand, ops map[OperatorType]bool) (OperatorType, bool) {
+	used := map[string]bool{}
+	collectOperators(op, used)
+	for name := range used {
+		if ops[OperatorType(name)] {
+			return OperatorType(name), true
+		}
+	}
+	return "", false
+}
+
+// newIsolatedRegistry returns an empty registry, isolated from the
+// registered rules
+func newIsolatedRegistry() ruleRegistry {
+	return ruleRegistry{rules: map[string]RegisteredRule{}, required: map[string]*RuleEntry{}, wildcards: map[string]bool{}, isolated: true}
+}
+
+// add saves the parsed rule entry to the isolated registry
+func (reg *ruleRegistry) add(entry *RuleEntry) error {
+	rules, exists := reg.rules[entry.Field]
+	if !exists {
+		rules = RegisteredRule{}
+		reg.rules[entry.Field] = rules
+		if isWildcardPath(entry.Field) {
+			reg.wildcards[entry.Field] = true
+		}
+	} else if _, exists := rules[entry.Name]; exists {
+		return fmt.Errorf("rule name, %s, is duplicated in the field name, %s", entry.Name, entry.Field)
+	}
+	rules[entry.Name] = entry
+	if entry.Required {
+		reg.required[entry.ID] = entry
+	}
+	if len(entry.MissingPolicy) > 0 {
+		reg.missingPolicies++
+	}
+	return nil
+}
+
+// ValidateAdhoc validates the document of req by its rules, in isolation
+// of the registered rules
+func ValidateAdhoc(req *AdhocRequest) (*validationResult, error) {
+	reg, err := newAdhocRegistry(req.Rules)
+	if err != nil {
+		return nil, err
+	}
+	result, err := reg.validateIsolated(req.Document, req.Ruleset)
+	if err != nil {
+		return nil, fmt.Errorf("adhoc validation: %s", err.Error())
+	}
+	return result, nil
+}
+
+// validateIsolated validates the document by the rules of the isolated
+// registry, without the fault injection and the counters
+func (reg ruleRegistry) validateIsolated(document map[string]interface{}, ruleset string) (*validationResult, error) {
+	extractor, err := GetExtractor(ContentTypeJSON)
+	if err != nil {
+		return nil, err
+	}
+	inputFields, err := extractor.Extract(document)
+	if err != nil {
+		return nil, err
+	}
+
+	result := validationResult{flag: true}
+	contexts, fieldRules := reg.newEvalContexts(inputFields, ruleset)
+	missing := reg.missingRequiredRules(inputFields, ruleset)
+	result.noRuleMatched = fieldRules == 0 && len(missing) == 0
+	for _, entry := range missing {
+		result.flag = false
+		result.rules = append(result.rules, entry.Name)
+		result.addCode(entry.ErrorCode)
+		if entry.Message != nil {
+			message := renderRuleMessage(entry.Message, entry.Name, entry.Field, "")
+			message.Code = entry.ErrorCode
+			result.messages = append(result.messages, message)
+		}
+	}
+	mode := DefaultFailFast
+	if mode.skipsAll(missing) {
+		contexts = nil
+	}
+	for _, chain := range evalChains(contexts, mode) {
+		err := evaluateChain(chain, mode, func(ctx *FieldEvalContext) (bool, error) {
+			// no fault injection and no counters, like evaluateRule
+			if res, ok := ctx.nullPolicyResult(); ok {
+				if !res {
+					result.addFailure(ctx)
+				}
+				return !res, nil
+			}
+			res, err := ctx.Rule.Evaluate(ctx)
+			if err == EvalFieldMissingError {
+				res, err = false, nil
+			}
+			if _, ok := res.(bool); err == nil && !ok {
+				err = EvalResultTypeError
+			}
+			if err != nil {
+				return false, fmt.Errorf("rule name, %s, %s", ctx.RuleName, err.Error())
+			}
+			if !res.(bool) {
+				result.addFailure(ctx)
+				return true, nil
+			}
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sortFailedPaths(result.paths)
+	return &result, nil
+}
+
+// POST /api/validation/adhoc service implementation
+func ValidateAdhocData(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(r.Body)
+	// the document numbers keep their exact value
+	decoder.UseNumber()
+	defer r.Body.Close()
+
+	req := AdhocRequest{}
+	if err := decoder.Decode(&req); err != nil {
+		// a malformed request or rule
+		w.WriteHeader(http.StatusBadRequest)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+		return
+	}
+	// the rules are in the namespace of the caller, and its limits
+	for i := range req.Rules {
+		if err := applyPrincipalNamespace(&req.Rules[i], r.Header.Get(UserHeader)); err != nil {
+			if errors.Is(err, RuleNamespaceForbiddenError) {
+				w.WriteHeader(http.StatusForbidden)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+			resStr, _ := json.Marshal(errMsg)
+			io.WriteString(w, string(resStr))
+			return
+		}
+	}
+	result, err := ValidateAdhoc(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		resStr, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(resStr))
+		return
+	}
+	if result.noRuleMatched {
+		// the rules are the client's, a warning rather than a policy
+		w.WriteHeader(http.StatusOK)
+		res := NoRuleResponseMsg{Result: ValidationStatusWarn, Message: NoRuleMatchedMessage}
+		resStr, _ := json.Marshal(res)
+		io.WriteString(w, string(resStr))
+	} else if result.flag {
+		w.WriteHeader(http.StatusOK)
+		res := ResponseMsg{Result: ValidationStatusSucc}
+		resStr, _ := json.Marshal(res)
+		io.WriteString(w, string(resStr))
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		fail := FailResponseMsg{Result: ValidationStatusFail, Rules: result.rules, Codes: result.codes, Messages: result.messages, Paths: result.paths}
+		resStr, _ := json.Marshal(fail)
+		io.WriteString(w, string(resStr))
+	}
+}
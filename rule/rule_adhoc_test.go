@@ -0,0 +1,68 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidateAdhoc(t *testing.T) {
+	req := AdhocRequest{}
+	err := json.Unmarshal([]byte(`{
+		"document": {"adhoc_test": {"username": "bob"}},
+		"rules": [
+			{"name": "adhoc_test_username", "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "adhoc_test.username"}]}, {"value": 4}]}},
+			{"name": "adhoc_test_email", "required": true, "rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "adhoc_test.email"}]}}]}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ValidateAdhoc(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := append([]string{}, result.rules...)
+	sort.Strings(rules)
+	if result.flag || !reflect.DeepEqual(rules, []string{"adhoc_test_email", "adhoc_test_username"}) {
+		t.Errorf("expected both rules to fail, got %v %v", result.flag, result.rules)
+	}
+
+	// the rules are never registered
+	RegRuleLock.RLock()
+	_, registered := AllRegisteredRules["adhoc_test.username"]
+	RegRuleLock.RUnlock()
+	if registered {
+		t.Error("expected the ad hoc rule not to be registered")
+	}
+
+	req.Rules = append(req.Rules, req.Rules[0])
+	if _, err := ValidateAdhoc(&req); err == nil {
+		t.Error("expected an error for a duplicated rule name")
+	}
+
+	RegRuleLock.Lock()
+	saved := namespaceConfig
+	namespaceConfig = NamespaceConfig{Namespaces: map[string]NamespaceLimits{
+		"adhoc_test": {MaxRules: 1, MaxRegexComplexity: 100}}}
+	RegRuleLock.Unlock()
+	defer func() {
+		RegRuleLock.Lock()
+		namespaceConfig = saved
+		RegRuleLock.Unlock()
+	}()
+	for name, rules := range map[string]string{
+		"lookup": `[{"name": "adhoc_test_lookup", "rule": {"operator": "LOOKUP", "operands": [{"value": "http://127.0.0.1/{value}"}, {"field": "adhoc_test.code"}]}}]`,
+		"unique": `[{"name": "adhoc_test_unique", "rule": {"operator": "UNIQUE_IN_SCOPE", "operands": [{"value": "adhoc_test"}, {"value": "1h"}, {"field": "adhoc_test.email"}]}}]`,
+		"regex":  `[{"name": "adhoc_test_regex", "namespace": "adhoc_test", "rule": {"operator": "MATCHES", "operands": [{"value": "^a{500}$"}, {"field": "adhoc_test.username"}]}}]`,
+		"rules": `[{"name": "adhoc_test_a", "namespace": "adhoc_test", "rule": {"operator": "MATCHES", "operands": [{"value": "^a$"}, {"field": "adhoc_test.username"}]}},
+			{"name": "adhoc_test_b", "namespace": "adhoc_test", "rule": {"operator": "MATCHES", "operands": [{"value": "^b$"}, {"field": "adhoc_test.username"}]}}]`,
+	} {
+		req := AdhocRequest{Document: map[string]interface{}{}}
+		if err := json.Unmarshal([]byte(rules), &req.Rules); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateAdhoc(&req); err == nil {
+			t.Errorf("%s: expected the ad hoc rules to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package rule
+
+import (
+	"math/big"
+	"time"
+)
+
+// The aggregate operators reduce the values of the document fields
+// matching a path, usually a wildcard path like "line_items[*].total", so
+// the document-consistency rules compare them with another field, e.g.
+// EQUAL_TO(SUM($document, "line_items[*].total"), invoice.total).  The
+// null fields are skipped.
+
+// aggregateValues returns the non-null values of the document fields
+// matching path
+func aggregateValues(operands []interface{}) ([]interface{}, error) {
+	if len(operands) != 2 {
+		return nil, ParseRuleOperatorError
+	}
+	doc, ok1 := operands[0].(map[string]interface{})
+	path, ok2 := operands[1].(string)
+	if !ok1 || !ok2 {
+		return nil, ParseRuleOperatorError
+	}
+	values := []interface{}{}
+	if !isWildcardPath(path) {
+		if v := doc[path]; v != nil {
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	for field, v := range doc {
+		if _, ok := matchWildcardPath(path, field); ok && v != nil {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// aggregateDecimals converts the values of aggregateValues into exact
+// decimals, a value which isn't a number fails the evaluation
+func aggregateDecimals(operands []interface{}) ([]*big.Rat, error) {
+	values, err := aggregateValues(operands)
+	if err != nil {
+		return nil, err
+	}
+	decimals := make([]*big.Rat, len(values))
+	for i, v := range values {
+		if decimals[i], err = toDecimal(v); err != nil {
+			return nil, err
+		}
+	}
+	return decimals, nil
+}
+
+// decimalResult converts the exact decimal into the operand value, an
+// integer when it is integral, so the sum of the cents like 19.99 + 0.01
+// compares equal to 20
+func decimalResult(d *big.Rat) interface{} {
+	if d.IsInt() {
+		if d.Num().IsInt64() {
+			return d.Num().Int64()
+		}
+		return new(big.Int).Set(d.Num())
+	}
+	f, _ := d.Float64()
+	return f
+}
+
+// sumOperator sums the numbers at the path of the document, 0 without any
+func sumOperator(operands []interface{}) (interface{}, error) {
+	decimals, err := aggregateDecimals(operands)
+	if err != nil {
+		return nil, err
+	}
+	sum := new(big.Rat)
+	for _, d := range decimals {
+		sum.Add(sum, d)
+	}
+	return decimalResult(sum), nil
+}
+
+// extremeOperator returns the lowest, or the highest when sign is +1,
+// number at the path of the document; without any the rule fails like on
+// a missing field
+func extremeOperator(sign int) OperatorFn {
+	return func(operands []interface{}) (interface{}, error) {
+		decimals, err := aggregateDecimals(operands)
+		if err != nil {
+			return nil, err
+		}
+		if len(decimals) == 0 {
+			return nil, EvalFieldMissingError
+		}
+		extreme := decimals[0]
+		for _, d := range decimals[1:] {
+			if d.Cmp(extreme) == sign {
+				extreme = d
+			}
+		}
+		return decimalResult(extreme), nil
+	}
+}
+
+// countOperator counts the non-null fields at the path of the document
+func countOperator(operands []interface{}) (interface{}, error) {
+	values, err := aggregateValues(operands)
+	if err != nil {
+		return nil, err
+	}
+	return len(values), nil
+}
+
+// the layouts of the DATE_AFTER operands, the timestamp first
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
+// parseDate parses an RFC 3339 timestamp, or a date
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dateAfterOperator checks the date, or timestamp, operands[0] is after
+// operands[1], e.g. end_date after start_date; a value which doesn't
+// parse fails the rule
+func dateAfterOperator(operands []interface{}) (interface{}, error) {
+	if len(operands) != 2 {
+		return nil, ParseRuleOperatorError
+	}
+	s1, ok1 := operands[0].(string)
+	s2, ok2 := operands[1].(string)
+	if !ok1 || !ok2 {
+		return nil, ParseRuleOperatorError
+	}
+	t1, ok1 := parseDate(s1)
+	t2, ok2 := parseDate(s2)
+	return ok1 && ok2 && t1.After(t2), nil
+}
@@ -0,0 +1,61 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAggregateRules(t *testing.T) {
+	rules := []string{
+		`{"name": "aggregate_test_total", "primary-field": "aggregate_test.total", "rule": {"operator": "EQUAL_TO", "operands": [
+			{"operator": "SUM", "operands": [{"field": "$document"}, {"value": "aggregate_test.items[*].total"}]},
+			{"field": "aggregate_test.total"}]}}`,
+		`{"name": "aggregate_test_dates", "primary-field": "aggregate_test.end_date", "rule": {"operator": "DATE_AFTER", "operands": [
+			{"field": "aggregate_test.end_date"}, {"field": "aggregate_test.start_date"}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	testCases := []struct {
+		input  string
+		failed []string
+	}{
+		{`{"aggregate_test": {"total": 20, "items": [{"total": 19.99}, {"total": 0.01}]}}`, nil},
+		{`{"aggregate_test": {"total": "15.15", "items": [{"total": 10.1}, {"total": 5.05}, {"total": null}]}}`, nil},
+		{`{"aggregate_test": {"total": 21, "items": [{"total": 19.99}, {"total": 0.01}]}}`, []string{"aggregate_test_total"}},
+		{`{"aggregate_test": {"total": 0, "items": []}}`, nil},
+		{`{"aggregate_test": {"start_date": "2026-01-01", "end_date": "2026-01-02T00:00:00Z"}}`, nil},
+		{`{"aggregate_test": {"start_date": "2026-01-02", "end_date": "2026-01-01"}}`, []string{"aggregate_test_dates"}},
+		{`{"aggregate_test": {"start_date": "2026-01-01", "end_date": "soon"}}`, []string{"aggregate_test_dates"}},
+	}
+	for _, tc := range testCases {
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(tc.input), &doc); err != nil {
+			t.Fatal(err)
+		}
+		result, err := ValidateInputJSONByRules("", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != (len(tc.failed) == 0) || !reflect.DeepEqual(result.rules, tc.failed) {
+			t.Errorf("%s: expected the failed rules %v, got %v %v", tc.input, tc.failed, result.flag, result.rules)
+		}
+	}
+
+	for _, tc := range []struct {
+		operator OperatorType
+		expected interface{}
+	}{{SumOperator, int64(6)}, {MinOperator, 0.5}, {MaxOperator, "3.5"}, {CountOperator, 3}} {
+		doc := map[string]interface{}{"n[0]": 2, "n[1]": 0.5, "n[2]": "3.5", "n[3]": nil}
+		res, err := RegisteredOperators[tc.operator]([]interface{}{doc, "n[*]"})
+		if err != nil || !equalValues(res, tc.expected) {
+			t.Errorf("%s: expected %v, got %v %v", tc.operator, tc.expected, res, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package rule
+
+import (
+	"fmt"
+)
+
+// OperatorAlias maps an operator name to its Target operator, so the rules
+// written with an old operator name still parse after the operator is
+// renamed.  A Deprecated alias is reported as a warning.
+type OperatorAlias struct {
+	Target     OperatorType
+	Deprecated bool
+}
+
+// all operator aliases, aliasName => OperatorAlias
+var OperatorAliases = map[OperatorType]OperatorAlias{
+	RegexMatchOperator: {Target: MatchesOperator, Deprecated: true},
+}
+
+// deprecationWarnings collects the warnings of the deprecated operator
+// aliases used in the parsed rule content
+func deprecationWarnings(t *Term) []string {
+	warnings := []string{}
+	if term, ok := t.Value.(TermOperand); ok {
+		if len(term.deprecatedAlias) > 0 {
+			warnings = append(warnings, fmt.Sprintf("operator %s is deprecated, use %s", term.deprecatedAlias, term.ParseOperator))
+		}
+		for i := range term.ParseOperands {
+			warnings = append(warnings, deprecationWarnings(&term.ParseOperands[i])...)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,34 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestOperatorAlias(t *testing.T) {
+	node := RuleNode{}
+	if err := json.Unmarshal([]byte(`{"name": "alias_test_code", "rule": {"operator": "OR", "operands": [
+		{"operator": "REGEX_MATCH", "operands": [{"value": "^[A-Z]{3}$"}, {"field": "alias_test_code"}]},
+		{"operator": "EQUAL_TO", "operands": [{"field": "alias_test_code"}, {"value": "none"}]}]}}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	if term := node.RuleContent.Value.(TermOperand).ParseOperands[0].Value.(TermOperand); term.ParseOperator != string(MatchesOperator) {
+		t.Errorf("expected the alias resolved to %s, got %s", MatchesOperator, term.ParseOperator)
+	}
+	expected := []string{"operator REGEX_MATCH is deprecated, use MATCHES"}
+	if warnings := deprecationWarnings(&node.RuleContent); !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected the deprecation warnings %v, got %v", expected, warnings)
+	}
+
+	registerTestRule(t, &node)
+	for code, expected := range map[string]bool{"ABC": true, "abc": false} {
+		result, err := ValidateInputJSONByRules("", map[string]interface{}{"alias_test_code": code})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != expected {
+			t.Errorf("%s: expected %v, got %v", code, expected, result.flag)
+		}
+	}
+}
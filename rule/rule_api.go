@@ -2,6 +2,7 @@ package rule
 
 import (
 	"fmt"
+	"errors"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -13,16 +14,143 @@ import (
 func Handlers() *chi.Mux {
 	r := chi.NewRouter()
 
+	// count the requests, including the injected faults
+	r.Use(metricsMiddleware)
+
+	// recover the panics into HTTP 500, after the metrics count them
+	r.Use(recoverMiddleware)
+
+	// inject the endpoint faults in chaos mode
+	r.Use(chaosMiddleware)
+
 	// specify /api/validation route
 	r.Post("/api/validation", ValidateJSONData)
 
+	// POST /api/validation/stream, a JSON array or NDJSON of documents
+	r.Post("/api/validation/stream", ValidateJSONStream)
+
+	// POST /api/validation/batch, the documents validated into one response
+	r.Post("/api/validation/batch", ValidateBatchData)
+
+	// POST /api/validation/field, the rules of one form field on its value
+	r.Post("/api/validation/field", ValidateFieldData)
+
+	// POST /api/validation/jsonl, a JSON Lines archive validated in
+	// background, and GET /api/validation/jsonl/{jobID}, its progress and
+	// report
+	r.Post("/api/validation/jsonl", ValidateJSONLinesAsync)
+	r.Get("/api/validation/jsonl/{jobID}", GetJSONLJob)
+
+	// POST /api/validation/adhoc, a document with its own rules
+	r.Post("/api/validation/adhoc", ValidateAdhocData)
+	// validate a JSON Patch by the patched document, and its operations by
+	// the patch rules
+	r.Post("/api/validation/patch", ValidatePatchData)
+	// validate a document change, the new version with the old one
+	r.Post("/api/validation/diff", ValidateDiffData)
+
+	// GET /api/validation/requirements, the constraints per field
+	r.Get("/api/validation/requirements", GetRequirements)
+
+	// GET /api/validation/bundle, the rules for the client local evaluation
+	r.Get("/api/validation/bundle", GetBundle)
+
+	// GET /version, build and registry info
+	r.Get("/version", GetVersion)
+
+	// GET /readyz, the readiness by the minimum rule coverage
+	r.Get("/readyz", GetReadiness)
+
+	// GET /metrics, the Prometheus scrape, when it is the metrics backend
+	if scrape, ok := ServiceMetrics.(http.Handler); ok {
+		r.Get("/metrics", scrape.ServeHTTP)
+	}
+
+	// GET /admin/stats, per-rule evaluation counters
+	r.Get("/admin/stats", GetRuleStats)
+
+	// POST /admin/wordlists/reload, re-read the word list files
+	r.Post("/admin/wordlists/reload", ReloadWordLists)
+
+	// GET/PUT /admin/chaos, the injected faults in chaos mode
+	r.Get("/admin/chaos", GetChaosConfig)
+	r.With(readOnlyGuard).Put("/admin/chaos", SetChaosConfig)
+
+	// GET /admin/quarantine, the sampled failed payloads
+	r.Get("/admin/quarantine", GetQuarantine)
+
+	// GET /admin/operators, list the available operators
+	r.Get("/admin/operators", GetOperators)
+
+	// GET /admin/namespaces, the resource consumption and limits per namespace
+	r.Get("/admin/namespaces", GetNamespaces)
+
+	// GET /admin/audit, the rule changes
+	r.Get("/admin/audit", GetAudit)
+
+	// GET /admin/rules/duplicates, structurally identical rules,
+	// POST /admin/rules/merge, remove the duplicates of a rule
+	r.Get("/admin/rules/duplicates", GetDuplicateRules)
+	r.With(readOnlyGuard).Post("/admin/rules/merge", MergeRules)
+
+	// GET /admin/rules?tag=pci, list the rules with the tag,
+	// DELETE /admin/rules?tag=pci, delete them
+	r.Get("/admin/rules", GetRules)
+	r.With(readOnlyGuard).Delete("/admin/rules", DeleteRulesByTagHandler)
+
+	// GET /admin/rules/docs?format=html, the rule catalogue
+	r.Get("/admin/rules/docs", GetRuleDocs)
+
+	// GET /admin/rules/export, the registered rules as a rules.json file
+	r.Get("/admin/rules/export", GetRulesExport)
+
+	// GET /admin/rules/graph, the rules, the fields and the references
+	r.Get("/admin/rules/graph", GetRuleGraph)
+
+	// GET /admin/samples?ruleset=signup&count=10, the generated documents
+	r.Get("/admin/samples", GetSamples)
+	// GET /admin/samples/negative?rule=zip_format, the documents failing
+	// one rule each
+	r.Get("/admin/samples/negative", GetNegativeSamples)
+
+	// POST /admin/rules/import, create the rules of a CSV file, or report
+	// them with ?dry-run=true
+	r.With(readOnlyGuard).Post("/admin/rules/import", ImportRules)
+
+	// POST /admin/macro, create an operator macro
+	r.With(readOnlyGuard).Post("/admin/macro", CreateMacro)
+
 	// rule manipulation service: only support CreateRule() and DeleteRule((
 	r.Route("/admin/rule", func(r chi.Router) {
+		// GET /admin/rule?page=1&limit=50&field=password&prefix=pw_, list
+		// the rules
+		r.Get("/", GetRuleList)
 		// POST /admin/rule
-		r.Post("/", CreateRule)
+		r.With(readOnlyGuard).Post("/", CreateRule)
+		// POST /admin/rule/format, the canonical form of a rule
+		r.Post("/format", FormatRule)
+		// POST /admin/rule/dryrun, evaluate a rule without registering it
+		r.Post("/dryrun", DryRunRule)
 		// DELETE /admin/rule/password_length
 		r.Route("/{ruleName}", func(r chi.Router) {
-			r.Delete("/", DeleteRule)
+			// GET /admin/rule/password_length, the rule definition
+			r.Get("/", GetRuleDetail)
+			// POST /admin/rule/password_length/test, evaluate the examples
+			r.Post("/test", TestRule)
+			// GET /admin/rule/password_length/versions, the replaced versions
+			r.Get("/versions", GetRuleVersionList)
+			r.Group(func(r chi.Router) {
+				// the rule changes are rejected in read-only mode
+				r.Use(readOnlyGuard)
+				r.Delete("/", DeleteRule)
+				// PUT /admin/rule/password_length, replace the rule
+				r.Put("/", UpdateRule)
+				// PATCH /admin/rule/password_length/status, enable or disable
+				r.Patch("/status", SetRuleStatus)
+				// POST /admin/rule/password_length/approve, the lifecycle
+				// actions submit, approve and retire
+				r.Post("/{action}", SetRuleState)
+			})
 		})
 	})
 
@@ -33,12 +161,32 @@ func Handlers() *chi.Mux {
 type validationResult struct {
 	flag  bool      // succ/fail
 	rules []string  // violated rule names
+
+	messages []RuleMessage // violation messages of the rules with "message"
+
+	paths map[string][]string // failing paths of the wildcard rules, by rule name
+
+	noRuleMatched bool // none of the input fields has a rule
+
+	unexpected []string // the input fields no rule covers, in the strict mode
+
+	locales []string // the message locales, in the preference order
+
+	codes []string // the error codes of the violated rules, once each
+
+	exclusive map[string]ExclusiveViolation // the failed exclusive groups, by rule name
+
+	details []FailureDetail // the failures by field, with verbose
+	verbose bool            // the failure details are listed
 }
 
 const (
 	ValidationStatusSucc  = "success"
 	ValidationStatusFail  = "failure"
 	ValidationStatusError = "error"
+	ValidationStatusWarn  = "warning"
+
+	NoRuleMatchedMessage = "no rule matches the input fields"
 
 	RuleMgmtError = "error"
 	RuleMgmtSucc  = "success"
@@ -49,23 +197,91 @@ type ResponseMsg struct {
 	Result string `json:"result"`
 }
 type FailResponseMsg struct {
-	Result string   `json:"result"`
-	Rules  []string `json:"rules"`
+	Result     string                        `json:"result"`
+	Rules      []string                      `json:"rules"`
+	Codes      []string                      `json:"codes,omitempty"`
+	Messages   []RuleMessage                 `json:"messages,omitempty"`
+	Paths      map[string][]string           `json:"paths,omitempty"`
+	Unexpected []string                      `json:"unexpected-fields,omitempty"`
+	Exclusive  map[string]ExclusiveViolation `json:"exclusive,omitempty"`
+	RuleInfo   map[string]RuleMetadata       `json:"rule-info,omitempty"`
+	Details    []FailureDetail               `json:"details,omitempty"`
 }
 type ErrResponseMsg struct {
 	Result   string `json:"result"`
 	ErrorMsg string `json:"error-message"`
 }
+type CreateRuleResponseMsg struct {
+	Result   string   `json:"result"`
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	State    string   `json:"state"`
+	Warnings []string `json:"warnings,omitempty"`
+	// the version of the updated rule
+	Version int `json:"version,omitempty"`
+	// the corpus check of the rule, with the regression config
+	Regression *RegressionReport `json:"regression,omitempty"`
+}
+type NormalizedResponseMsg struct {
+	Result   string                 `json:"result"`
+	Document map[string]interface{} `json:"document"`
+}
+type NoRuleResponseMsg struct {
+	Result  string `json:"result"`
+	Message string `json:"message"`
+}
 
-// POST /api/validation service implementation
+// POST /api/validation?ruleset=<ruleset>&tags=<tag,...>&exclude-tags=<tag,...>&normalize=true&strict=true
+// service implementation, without ruleset only the common rules apply, or
+// the ruleset the discriminator selects by the document type.  The
+// rulesets are a comma-separated list, e.g. ruleset=signup,common, or the
+// X-Ruleset header without the query, and an unknown one fails.  With tags
+// (or tag) only the rules with one of the tags, and with exclude-tags
+// none with one of them.  The rules check the document normalized by the
+// normalizers, returned on success with normalize=true, and strict=true
+// fails the fields no rule covers, like a strict ruleset.  The violation
+// messages are translated by the Accept-Language, and rule-info=true adds
+// the metadata of the failed rules.
 func ValidateJSONData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept-Language")
 
 	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
 	defer r.Body.Close()
 
+	ruleset := requestRuleset(r)
+	normalize := r.URL.Query().Get("normalize") == "true"
+	strict := r.URL.Query().Get("strict") == "true"
+	ruleInfo := r.URL.Query().Get("rule-info") == "true"
+	details := failureDetailsOf(r)
+	if err := CheckRuleset(ruleset); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+		return
+	}
+	tags, err := ParseTagFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+		return
+	}
+	// the outcome is posted to the callback of the request, and the webhooks
+	callback, err := webhookCallback(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+		return
+	}
+
 	var f map[string]interface{}
-	err := decoder.Decode(&f)
+	err = decoder.Decode(&f)
 	if err != nil {
 		fmt.Errorf("API service data error, %s", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
@@ -74,8 +290,15 @@ func ValidateJSONData(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, string(result))
 		return
 	}
-	// parse input JSON and run the validation
-	if result, e := ValidateInputJSONByRules(f); e != nil {
+	if len(ruleset) == 0 {
+		// the ruleset of the document type, by the discriminator
+		ruleset = discriminatedRuleset(f)
+	}
+	f = NormalizeDocument(f, ruleset)
+	// the messages in the client's language
+	options := ValidationOptions{Tags: tags, Strict: strict, Locales: parseAcceptLanguage(r.Header.Get("Accept-Language")), Details: details}
+	// parse input JSON, unwrapped by its envelope, and run the validation
+	if result, e := ValidateInput(ruleset, options, requestContentType(r, ruleset), f); e != nil {
 		// internal error
 		fmt.Errorf("API service internal error, %s", e.Error())
 		w.WriteHeader(http.StatusInternalServerError)
@@ -85,7 +308,28 @@ func ValidateJSONData(w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		// handle the validation result for the API response
-		if result.flag {
+		policy := zeroRulePolicyOf(ruleset)
+		defer notifyWebhooks(w.Header().Get(requestIDHeader), callback, ruleset, newStreamResult(0, result, policy))
+		if result.noRuleMatched && policy != ZeroRulePass {
+			// no rule is evaluated, reply by the zero-rule policy
+			res := NoRuleResponseMsg{Result: ValidationStatusWarn, Message: NoRuleMatchedMessage}
+			if policy == ZeroRuleFail {
+				res.Result = ValidationStatusFail
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				w.WriteHeader(http.StatusOK)
+			}
+			resStr, _ := json.Marshal(res)
+			io.WriteString(w, string(resStr))
+
+		} else if result.flag && normalize {
+			// succ, with the normalized document
+			w.WriteHeader(http.StatusOK)
+			res := NormalizedResponseMsg{Result: ValidationStatusSucc, Document: f}
+			resStr, _ := json.Marshal(res)
+			io.WriteString(w, string(resStr))
+
+		} else if result.flag {
 			// succ
 			w.WriteHeader(http.StatusOK)
 			res := ResponseMsg{Result: ValidationStatusSucc}
@@ -95,7 +339,14 @@ func ValidateJSONData(w http.ResponseWriter, r *http.Request) {
 		} else {
 			// fail
 			w.WriteHeader(http.StatusBadRequest)
-			fail := FailResponseMsg{Result: ValidationStatusFail, Rules: result.rules}
+			fail := FailResponseMsg{Result: ValidationStatusFail, Rules: result.rules, Codes: result.codes, Messages: result.messages,
+				Paths: result.paths, Unexpected: result.unexpected, Exclusive: result.exclusive, Details: result.details}
+			if fail.Rules == nil {
+				fail.Rules = []string{}
+			}
+			if ruleInfo {
+				fail.RuleInfo = ruleMetadataOf(fail.Rules)
+			}
 			resStr, _ := json.Marshal(fail)
 			io.WriteString(w, string(resStr))
 		}
@@ -123,28 +374,108 @@ func CreateRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// parse one rule in r
-	fieldList := map[string]int{}
-	if operd, e := ConstructOperandListHelper(&rule.RuleContent, fieldList); e != nil {
+	// the author of the rule, a draft when the rules require the approval
+	if err := prepareRuleCreation(&rule, r.Header.Get(UserHeader)); err != nil {
+		if errors.Is(err, RuleUserMissingError) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+
+	// the corpus by the rules before and after the rule, the new failures
+	// above the threshold reject it, unless ?force=true
+	report, err := checkRuleRegression(&rule, nil)
+	if errors.Is(err, ParseRuleResultTypeError) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, generateCreateRuleErrorMessage(e))
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
 		return
-	} else {
-		// prepare to add rule
-		if err := SaveRuleToRegister(operd, rule.Name, fieldList); err != nil {
-			// save failed
-			w.WriteHeader(http.StatusInternalServerError)
-			io.WriteString(w, generateCreateRuleErrorMessage(err))
+	}
+	if report != nil && report.Blocked && r.URL.Query().Get("force") != "true" {
+		writeRegressionError(w, rule.Name, report)
+		return
+	}
+
+	// parse one rule in r, and add rule
+	if entry, err := RegisterRuleNode(&rule); err != nil {
+		// parse or save failed, a rule not evaluating to bool is invalid
+		if errors.Is(err, ParseRuleResultTypeError) {
+			w.WriteHeader(http.StatusBadRequest)
 		} else {
-			// success
-			w.WriteHeader(http.StatusOK)
-			res := ResponseMsg{Result: RuleMgmtSucc}
-			resStr, _ := json.Marshal(res)
-			io.WriteString(w, string(resStr))
+			w.WriteHeader(http.StatusInternalServerError)
 		}
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+	} else {
+		// success
+		RecordAudit(AuditActionCreate, entry.Name, r.Header.Get(UserHeader), entry.Version)
+		w.WriteHeader(http.StatusOK)
+		res := CreateRuleResponseMsg{Result: RuleMgmtSucc, ID: entry.ID, Name: entry.Name, State: entry.State, Warnings: entry.Warnings,
+			Regression: report}
+		resStr, _ := json.Marshal(res)
+		io.WriteString(w, string(resStr))
 	}
 }
 
+func CreateMacro(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	macro := OperatorMacro{}
+	if err := decoder.Decode(&macro); err != nil {
+		// failed to decode a JSON block
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	if err := SaveMacroToRegister(&macro); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	res := ResponseMsg{Result: RuleMgmtSucc}
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
+
 func DeleteRule(w http.ResponseWriter, r *http.Request) {
 	// TBD
 }
+
+// GET /version service implementation
+func GetVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(GetVersionInfo())
+	io.WriteString(w, string(resStr))
+}
+
+// GET /admin/stats service implementation
+func GetRuleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(GetRuleCounters())
+	io.WriteString(w, string(resStr))
+}
+
+// POST /admin/wordlists/reload service implementation
+func ReloadWordLists(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := LoadWordLists(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	res := ResponseMsg{Result: RuleMgmtSucc}
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,133 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// A batch of documents is validated by one request,
+//   POST /api/validation/batch?ruleset=<ruleset>&id-field=order_id
+// the body is a JSON array of documents or NDJSON like the stream, and the
+// response is one JSON object with the result of each document by its
+// index in the input, and the value of its id-field, so the ETL jobs match
+// the results back to their records.  The documents are evaluated by
+// StreamWorkers, and a batch is at most MaxBatchDocuments documents.
+
+// MaxBatchDocuments is the number of the documents of a batch at most
+var MaxBatchDocuments = 10000
+
+// BatchResult is the result of a document of the batch, ID is the value
+// of its id-field, if any
+type BatchResult struct {
+	ID interface{} `json:"id,omitempty"`
+	StreamResult
+}
+
+// BatchResponseMsg is the results of the batch in the input order, Result
+// is "success" when no document fails or errors
+type BatchResponseMsg struct {
+	Result  string        `json:"result"`
+	Total   int           `json:"total"`
+	Passed  int           `json:"passed"`
+	Warned  int           `json:"warned"`
+	Failed  int           `json:"failed"`
+	Errors  int           `json:"errors"`
+	Results []BatchResult `json:"results"`
+}
+
+// ValidateBatch validates the documents of r against ruleset, the ruleset
+// of each document is discriminated without it, and idField, a field
+// path, identifies the documents in the results
+func ValidateBatch(r io.Reader, ruleset string, idField string) (*BatchResponseMsg, error) {
+	jobs := []*streamJob{}
+	err := decodeDocuments(r, func(doc map[string]interface{}) bool {
+		jobs = append(jobs, &streamJob{index: len(jobs), doc: doc, done: make(chan StreamResult, 1)})
+		return len(jobs) <= MaxBatchDocuments
+	})
+	if err != nil {
+		return nil, fmt.Errorf("batch validation: %s", err.Error())
+	}
+	if len(jobs) > MaxBatchDocuments {
+		return nil, fmt.Errorf("batch validation: more than %d documents", MaxBatchDocuments)
+	}
+
+	workers := StreamWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	policy := zeroRulePolicyOf(ruleset)
+	queue := make(chan *streamJob, len(jobs))
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	jobID := newBatchJobID("batch")
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range queue {
+				runBatchWork(jobID, func() { job.done <- evaluateStreamJob(job, ruleset, policy) })
+			}
+		}()
+	}
+
+	res := &BatchResponseMsg{Result: ValidationStatusSucc, Total: len(jobs), Results: make([]BatchResult, len(jobs))}
+	var panicked interface{}
+	for i, job := range jobs {
+		result := BatchResult{StreamResult: <-job.done}
+		if job.panic != nil && panicked == nil {
+			panicked = job.panic
+		}
+		if len(idField) > 0 {
+			result.ID, _ = sampleAt(job.doc, idField)
+		}
+		switch result.Result {
+		case ValidationStatusSucc:
+			res.Passed++
+		case ValidationStatusWarn:
+			res.Warned++
+		case ValidationStatusFail:
+			res.Failed++
+		default:
+			res.Errors++
+		}
+		res.Results[i] = result
+	}
+	if panicked != nil {
+		// raised by the request, once the workers are done
+		panic(panicked)
+	}
+	if res.Failed > 0 || res.Errors > 0 {
+		res.Result = ValidationStatusFail
+	}
+	return res, nil
+}
+
+// POST /api/validation/batch?ruleset=<ruleset>&id-field=<field path>
+// service implementation.  The batch responds HTTP 200 with the result of
+// each document, and 400 when the body isn't a batch of documents.
+func ValidateBatchData(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	writeError := func(err error) {
+		w.WriteHeader(http.StatusBadRequest)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+	}
+	ruleset := requestRuleset(r)
+	if err := CheckRuleset(ruleset); err != nil {
+		writeError(err)
+		return
+	}
+	res, err := ValidateBatch(r.Body, ruleset, r.URL.Query().Get("id-field"))
+	if err != nil {
+		writeError(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
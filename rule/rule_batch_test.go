@@ -0,0 +1,95 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/richgrove/validation/util"
+)
+
+func TestValidateBatch(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "batch_test_zip", "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "batch_test_zip"}]}}`), &node)
+	registerTestRule(t, &node)
+	batch := func(query string, body string) (int, BatchResponseMsg) {
+		w := httptest.NewRecorder()
+		ValidateBatchData(w, httptest.NewRequest("POST", "/api/validation/batch"+query, strings.NewReader(body)))
+		res := BatchResponseMsg{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+	code, res := batch("?id-field=meta.id", `[{"meta": {"id": "A-1"}, "batch_test_zip": "12345"},
+		{"meta": {"id": "A-2"}, "batch_test_zip": "1234"}, {"batch_test_zip": "54321"}]`)
+	if code != http.StatusOK || res.Result != ValidationStatusFail || res.Total != 3 || res.Passed != 2 || res.Failed != 1 || len(res.Results) != 3 {
+		t.Fatalf("expected a failed batch, got %d %+v", code, res)
+	}
+	for i, expected := range []BatchResult{
+		{ID: "A-1", StreamResult: StreamResult{Index: 0, Result: ValidationStatusSucc}},
+		{ID: "A-2", StreamResult: StreamResult{Index: 1, Result: ValidationStatusFail, Rules: []string{"batch_test_zip"}}},
+		{StreamResult: StreamResult{Index: 2, Result: ValidationStatusSucc}},
+	} {
+		if !reflect.DeepEqual(res.Results[i], expected) {
+			t.Errorf("expected %+v, got %+v", expected, res.Results[i])
+		}
+	}
+	if code, res := batch("", "{\"batch_test_zip\": \"12345\"}\n{\"batch_test_zip\": \"67890\"}\n"); code != http.StatusOK ||
+		res.Result != ValidationStatusSucc || res.Passed != 2 {
+		t.Errorf("expected an NDJSON batch to pass, got %d %+v", code, res)
+	}
+	if code, _ := batch("", `[{"batch_test_zip": "12345"}, "bad"]`); code != http.StatusBadRequest {
+		t.Errorf("expected a malformed batch to fail, got %d", code)
+	}
+	max := MaxBatchDocuments
+	MaxBatchDocuments = 1
+	defer func() { MaxBatchDocuments = max }()
+	if code, _ := batch("", `[{"batch_test_zip": "12345"}, {"batch_test_zip": "12345"}]`); code != http.StatusBadRequest {
+		t.Errorf("expected a batch over the limit to fail, got %d", code)
+	}
+}
+
+func TestValidateBatchScheduled(t *testing.T) {
+	// the operator records the most evaluations at the same time
+	const probeOperator OperatorType = "SCHEDULER_PROBE_TEST"
+	var running, most int32
+	RegisteredOperators[probeOperator] = func(operands []interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return true, nil
+	}
+	defer delete(RegisteredOperators, probeOperator)
+	node := RuleNode{Name: "batch_scheduled_test_probe"}
+	json.Unmarshal([]byte(`{"operator": "SCHEDULER_PROBE_TEST", "operands": [{"field": "batch_scheduled_test"}]}`), &node.RuleContent)
+	registerTestRule(t, &node)
+
+	defer func(scheduler *util.Scheduler, workers int) {
+		util.DefaultScheduler, StreamWorkers = scheduler, workers
+	}(util.DefaultScheduler, StreamWorkers)
+	// one worker for the work of a batch job
+	util.DefaultScheduler = util.NewScheduler(4, 2, 1)
+	StreamWorkers = 4
+
+	body := strings.Repeat(`{"batch_scheduled_test": 1}`+"\n", 20)
+	res, err := ValidateBatch(strings.NewReader(body), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Passed != 20 {
+		t.Errorf("expected 20 passed, got %+v", res)
+	}
+	if most != 1 {
+		t.Errorf("expected the batch job to run in one scheduler worker, got %d at the same time", most)
+	}
+}
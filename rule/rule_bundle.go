@@ -0,0 +1,280 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// BundleFormatVersion is the version of the evaluation bundle layout,
+// bumped on an incompatible change
+const BundleFormatVersion = 1
+
+// serverSideOperators need the server data, the external lookup and the
+// word lists, so a client can't evaluate them locally
+var serverSideOperators = map[OperatorType]bool{
+	LookupOperator:         true,
+	InDictionaryOperator:   true,
+	NotInBlocklistOperator: true,
+	UniqueInScopeOperator:  true,
+}
+
+// BundleRule is a rule in the portable format, its content is the
+// canonical rules.json block.  Server is set when the rule uses a
+// server-side operator, and the client applies the rule in its activation
+// window only.
+type BundleRule struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Field      string          `json:"field"`
+	Fields     []string        `json:"fields"`
+	Rule       json.RawMessage `json:"rule"`
+	Server     bool            `json:"server,omitempty"`
+	Required   bool            `json:"required,omitempty"`
+	Rulesets   []string        `json:"rulesets,omitempty"`
+	ValidFrom  *time.Time      `json:"valid-from,omitempty"`
+	ValidUntil *time.Time      `json:"valid-until,omitempty"`
+}
+
+// EvaluationBundle is the GET /api/validation/bundle response, the active
+// rules for the client pre-flight checks.  Version is the registry hash,
+// it changes whenever the active rules change.
+type EvaluationBundle struct {
+	FormatVersion int          `json:"format-version"`
+	Version       string       `json:"version"`
+	Operators     []string     `json:"operators"`        // operators used by the rules
+	ServerOps     []string     `json:"server-operators"` // used operators evaluated by the server only
+	Rules         []BundleRule `json:"rules"`
+}
+
+// collectOperators adds the operators in the operand tree to ops
+func collectOperators(op Operand, ops map[string]bool) {
+	if term, ok := op.(*TermOperand); ok {
+		ops[term.ParseOperator] = true
+		for _, o := range term.OperandList {
+			collectOperators(o, ops)
+		}
+	}
+}
+
+// GetEvaluationBundle packs the active rules into a bundle
+func GetEvaluationBundle() (*EvaluationBundle, error) {
+	version, _ := registryHash()
+	bundle := &EvaluationBundle{FormatVersion: BundleFormatVersion, Version: version,
+		Operators: []string{}, ServerOps: []string{}, Rules: []BundleRule{}}
+
+	now := time.Now()
+	RegRuleLock.RLock()
+	entries := make([]*RuleEntry, 0, len(AllRegisteredRuleIDs))
+	for _, entry := range AllRegisteredRuleIDs {
+		// the expired rules never apply again
+		if entry.live() && (entry.ValidUntil == nil || now.Before(*entry.ValidUntil)) {
+			entries = append(entries, entry)
+		}
+	}
+	RegRuleLock.RUnlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	used := map[string]bool{}
+	for _, entry := range entries {
+		c, err := canonicalOperand(entry.Rule)
+		if err != nil {
+			return nil, err
+		}
+		content, err := marshalCanonical(c, "")
+		if err != nil {
+			return nil, err
+		}
+		ops := map[string]bool{}
+		collectOperators(entry.Rule, ops)
+		rule := BundleRule{ID: entry.ID, Name: entry.Name, Field: entry.Field, Fields: entry.Fields,
+			Rule: content, Required: entry.Required, Rulesets: entry.Rulesets,
+			ValidFrom: utcTime(entry.ValidFrom), ValidUntil: utcTime(entry.ValidUntil)}
+		for op := range ops {
+			used[op] = true
+			if serverSideOperators[OperatorType(op)] {
+				rule.Server = true
+			}
+		}
+		bundle.Rules = append(bundle.Rules, rule)
+	}
+	for op := range used {
+		bundle.Operators = append(bundle.Operators, op)
+		if serverSideOperators[OperatorType(op)] {
+			bundle.ServerOps = append(bundle.ServerOps, op)
+		}
+	}
+	sort.Strings(bundle.Operators)
+	sort.Strings(bundle.ServerOps)
+	return bundle, nil
+}
+
+// BundleResult is the local evaluation result of a bundle.  Deferred
+// lists the rules to validate by the server, which use a server-side
+// operator, so Pass is only final when Deferred is empty.
+type BundleResult struct {
+	Pass     bool
+	Rules    []string // violated rule names
+	Deferred []string
+}
+
+// applies reports the bundle rule is evaluated in ruleset at now
+func (rule *BundleRule) applies(ruleset string, now time.Time) bool {
+	return inActivationWindow(rule.ValidFrom, rule.ValidUntil, now) && inRulesets(rule.Rulesets, ruleset)
+}
+
+// compiledBundleRule is a bundle rule with its constructed operand tree
+type compiledBundleRule struct {
+	BundleRule
+	operand Operand
+}
+
+// CompiledBundle is an EvaluationBundle ready to evaluate, e.g. by the
+// Go client SDK for the pre-flight checks
+type CompiledBundle struct {
+	Version  string
+	rules     map[string][]compiledBundleRule // primary field => rules
+	required  []BundleRule
+	wildcards []string // the wildcard primary fields
+}
+
+// Compile parses the bundle rules, a bundle of an unknown format version
+// or with an unknown operator is rejected
+func (b *EvaluationBundle) Compile() (*CompiledBundle, error) {
+	if b.FormatVersion != BundleFormatVersion {
+		return nil, fmt.Errorf("bundle: unsupported format version, %d", b.FormatVersion)
+	}
+	compiled := &CompiledBundle{Version: b.Version, rules: map[string][]compiledBundleRule{}}
+	for _, rule := range b.Rules {
+		c := compiledBundleRule{BundleRule: rule}
+		if !rule.Server {
+			var term Term
+			if err := json.Unmarshal(rule.Rule, &term); err != nil {
+				return nil, fmt.Errorf("bundle: rule name, %s, %s", rule.Name, err.Error())
+			}
+			op, err := ConstructOperandListHelper(&term, map[string]int{})
+			if err != nil {
+				return nil, fmt.Errorf("bundle: rule name, %s, %s", rule.Name, err.Error())
+			}
+			c.operand = op
+		}
+		if _, exists := compiled.rules[rule.Field]; !exists && isWildcardPath(rule.Field) {
+			compiled.wildcards = append(compiled.wildcards, rule.Field)
+		}
+		compiled.rules[rule.Field] = append(compiled.rules[rule.Field], c)
+		if rule.Required {
+			compiled.required = append(compiled.required, rule)
+		}
+	}
+	return compiled, nil
+}
+
+// Evaluate validates the input fields, <fieldName, fieldValue>, locally
+// by the common rules
+func (b *CompiledBundle) Evaluate(fields map[string]interface{}) BundleResult {
+	return b.EvaluateRuleset("", fields)
+}
+
+// EvaluateRuleset validates the input fields, <fieldName, fieldValue>,
+// locally against ruleset.  An evaluation error doesn't fail a rule, like
+// the server does.
+func (b *CompiledBundle) EvaluateRuleset(ruleset string, fields map[string]interface{}) BundleResult {
+	result := BundleResult{Pass: true}
+	now := time.Now()
+	for _, rule := range b.required {
+		if !rule.applies(ruleset, now) {
+			continue
+		}
+		present := false
+		if isWildcardPath(rule.Field) {
+			present = hasWildcardMatch(rule.Field, fields)
+		} else {
+			_, present = fields[rule.Field]
+		}
+		if !present {
+			result.Pass = false
+			result.Rules = append(result.Rules, rule.Name)
+		}
+	}
+	for field, value := range fields {
+		for _, rule := range b.rules[field] {
+			b.evaluateRule(&result, ruleset, rule, FieldEvalContext{Field: field, FieldValue: value, Fields: fields})
+		}
+		for _, pattern := range b.wildcards {
+			if indices, ok := matchWildcardPath(pattern, field); ok {
+				for _, rule := range b.rules[pattern] {
+					b.evaluateRule(&result, ruleset, rule, FieldEvalContext{Field: field, FieldValue: value, Fields: fields,
+						Pattern: pattern, indices: indices})
+				}
+			}
+		}
+	}
+	// the document rules are triggered by every input
+	for _, rule := range b.rules[DocumentField] {
+		b.evaluateRule(&result, ruleset, rule, FieldEvalContext{Field: DocumentField, Fields: fields})
+	}
+	// a wildcard rule is listed once
+	result.Rules = uniqueSorted(result.Rules)
+	result.Deferred = uniqueSorted(result.Deferred)
+	return result
+}
+
+// uniqueSorted sorts list, and removes the duplicates
+func uniqueSorted(list []string) []string {
+	sort.Strings(list)
+	unique := list[:0]
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// evaluateRule evaluates one rule in ctx, which has the field data, and
+// adds a failure or a deferral to result
+func (b *CompiledBundle) evaluateRule(result *BundleResult, ruleset string, rule compiledBundleRule, ctx FieldEvalContext) {
+	if !rule.applies(ruleset, time.Now()) {
+		return
+	}
+	if rule.Server {
+		result.Deferred = append(result.Deferred, rule.Name)
+		return
+	}
+	ctx.RuleID, ctx.RuleName, ctx.Rule = rule.ID, rule.Name, rule.operand
+	res, err := ctx.Rule.Evaluate(&ctx)
+	if err == EvalFieldMissingError {
+		res, err = false, nil
+	}
+	if err != nil {
+		return
+	}
+	if pass, ok := res.(bool); ok && !pass {
+		result.Pass = false
+		result.Rules = append(result.Rules, rule.Name)
+	}
+}
+
+// GET /api/validation/bundle service implementation.  The ETag is the
+// bundle version, so a client polls it with If-None-Match.
+func GetBundle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	bundle, err := GetEvaluationBundle()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	etag := `"` + bundle.Version + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(bundle)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,95 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testBundle = `{
+  "format-version": 1,
+  "version": "test",
+  "operators": ["EQUAL_TO", "FIELD_COUNT", "GREATER_THAN", "IN_DICTIONARY", "LENGTH", "REQUIRED"],
+  "server-operators": ["IN_DICTIONARY"],
+  "rules": [
+    {"id": "1", "name": "username_length", "field": "username", "fields": ["username"],
+     "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "username"}]}, {"value": 4}]}},
+    {"id": "2", "name": "password_confirmed", "field": "password_confirm", "fields": ["password_confirm", "password"],
+     "rule": {"operator": "EQUAL_TO", "operands": [{"field": "password"}, {"field": "password_confirm"}]}},
+    {"id": "3", "name": "email_required", "field": "email", "fields": ["email"], "required": true,
+     "rule": {"operator": "REQUIRED", "operands": [{"field": "email"}]}},
+    {"id": "4", "name": "username_known", "field": "username", "fields": ["username"], "server": true,
+     "rule": {"operator": "IN_DICTIONARY", "operands": [{"value": "users"}, {"field": "username"}]}},
+    {"id": "6", "name": "username_signup_length", "field": "username", "fields": ["username"], "rulesets": ["signup"],
+     "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "username"}]}, {"value": 7}]}},
+    {"id": "5", "name": "field_limit", "field": "$document", "fields": ["$document"],
+     "rule": {"operator": "GREATER_THAN", "operands": [{"value": 4}, {"operator": "FIELD_COUNT", "operands": [{"field": "$document"}]}]}}
+  ]
+}`
+
+var bundleTestCases = []struct {
+	description string
+	ruleset     string
+	fields      map[string]interface{}
+	expected    BundleResult
+}{
+	{
+		description: "server-side rule is deferred",
+		fields:      map[string]interface{}{"username": "bwillis", "email": "bwillis@example.com"},
+		expected:    BundleResult{Pass: true, Deferred: []string{"username_known"}},
+	},
+	{
+		description: "local rule fails",
+		fields:      map[string]interface{}{"username": "bw", "email": "bwillis@example.com"},
+		expected:    BundleResult{Pass: false, Rules: []string{"username_length"}, Deferred: []string{"username_known"}},
+	},
+	{
+		description: "cross-field rule",
+		fields:      map[string]interface{}{"password": "secret12", "password_confirm": "secret13", "email": "bwillis@example.com"},
+		expected:    BundleResult{Pass: false, Rules: []string{"password_confirmed"}},
+	},
+	{
+		description: "cross-field rule with a missing field",
+		fields:      map[string]interface{}{"password_confirm": "secret12", "email": "bwillis@example.com"},
+		expected:    BundleResult{Pass: false, Rules: []string{"password_confirmed"}},
+	},
+	{
+		description: "required field is absent",
+		fields:      map[string]interface{}{"username": "bwillis"},
+		expected:    BundleResult{Pass: false, Rules: []string{"email_required"}, Deferred: []string{"username_known"}},
+	},
+	{
+		description: "document rule fails",
+		fields:      map[string]interface{}{"email": "bwillis@example.com", "a": "1", "b": "2", "c": "3"},
+		expected:    BundleResult{Pass: false, Rules: []string{"field_limit"}},
+	},
+	{
+		description: "ruleset rule applies against its ruleset only",
+		ruleset:     "signup",
+		fields:      map[string]interface{}{"username": "bwillis", "email": "bwillis@example.com"},
+		expected:    BundleResult{Pass: false, Rules: []string{"username_signup_length"}, Deferred: []string{"username_known"}},
+	},
+}
+
+func TestCompiledBundleEvaluate(t *testing.T) {
+	bundle := EvaluationBundle{}
+	if err := json.Unmarshal([]byte(testBundle), &bundle); err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := bundle.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range bundleTestCases {
+		if result := compiled.EvaluateRuleset(tc.ruleset, tc.fields); !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.description, tc.expected, result)
+		}
+	}
+}
+
+func TestBundleUnknownFormatVersion(t *testing.T) {
+	bundle := EvaluationBundle{FormatVersion: BundleFormatVersion + 1}
+	if _, err := bundle.Compile(); err == nil {
+		t.Error("expected an error for an unknown format version")
+	}
+}
@@ -0,0 +1,155 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/richgrove/validation/util"
+)
+
+// OperatorCacheConfig is the result cache of an operator with external
+// effects, e.g. LOOKUP, so a hot value doesn't hammer the dependency.
+// The results are cached by the operand values for TTLSeconds, at most
+// MaxEntries of them, the errors are never cached.
+type OperatorCacheConfig struct {
+	TTLSeconds int `json:"ttl-seconds"`
+	MaxEntries int `json:"max-entries"`
+}
+
+// the default operator caches, replaced by LoadOperatorCacheConfig
+var DefaultOperatorCaches = map[OperatorType]OperatorCacheConfig{
+	LookupOperator: {TTLSeconds: 300, MaxEntries: 10000},
+}
+
+type operatorCacheEntry struct {
+	result  interface{}
+	expires time.Time
+}
+
+type operatorCache struct {
+	operator OperatorType
+	ttl      time.Duration
+	size     int
+	lock     sync.Mutex
+	entries  map[string]operatorCacheEntry
+}
+
+var (
+	operatorCaches    = newOperatorCaches(DefaultOperatorCaches)
+	operatorCacheLock = sync.RWMutex{}
+)
+
+func newOperatorCaches(configs map[OperatorType]OperatorCacheConfig) map[OperatorType]*operatorCache {
+	caches := map[OperatorType]*operatorCache{}
+	for name, config := range configs {
+		if config.TTLSeconds <= 0 || config.MaxEntries <= 0 {
+			// disabled
+			continue
+		}
+		caches[name] = &operatorCache{operator: name, ttl: time.Duration(config.TTLSeconds) * time.Second,
+			size: config.MaxEntries, entries: map[string]operatorCacheEntry{}}
+	}
+	return caches
+}
+
+// LoadOperatorCacheConfig replaces the operator caches by the JSON file,
+//   { "LOOKUP": { "ttl-seconds": 60, "max-entries": 50000 } }
+// an operator missing in the file, or with a 0 TTL, is not cached
+func LoadOperatorCacheConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	configs := map[OperatorType]OperatorCacheConfig{}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return err
+	}
+	for name := range configs {
+		if _, ok := RegisteredOperators[name]; !ok {
+			return fmt.Errorf("operator cache: unknown operator, %s", name)
+		}
+		if statefulOperators[name] && configs[name].TTLSeconds > 0 {
+			return fmt.Errorf("operator cache: stateful operator, %s, can't be cached", name)
+		}
+	}
+	operatorCacheLock.Lock()
+	operatorCaches = newOperatorCaches(configs)
+	operatorCacheLock.Unlock()
+	return nil
+}
+
+// operatorCacheOf returns the cache of the operator, nil when it is not
+// cached
+func operatorCacheOf(name OperatorType) *operatorCache {
+	operatorCacheLock.RLock()
+	defer operatorCacheLock.RUnlock()
+	return operatorCaches[name]
+}
+
+// cachedOperators lists the cached operators, sorted
+func cachedOperators() []string {
+	operatorCacheLock.RLock()
+	defer operatorCacheLock.RUnlock()
+	list := []string{}
+	for name := range operatorCaches {
+		list = append(list, string(name))
+	}
+	sort.Strings(list)
+	return list
+}
+
+// call returns the cached result of the operands, or calls fn and caches
+// its result.  The mode is a part of the key, since the decimal variant
+// is another function.
+func (c *operatorCache) call(mode string, fn OperatorFn, operands []interface{}) (interface{}, error) {
+	data, err := json.Marshal(operands)
+	if err != nil {
+		// not a cache key, e.g. a document operand
+		return fn(operands)
+	}
+	key := mode + "\x00" + string(data)
+	labels := util.Labels{"operator": string(c.operator)}
+
+	now := time.Now()
+	c.lock.Lock()
+	entry, ok := c.entries[key]
+	c.lock.Unlock()
+	if ok && now.Before(entry.expires) {
+		ServiceMetrics.Counter(metricOperatorCacheHits, labels, 1)
+		return entry.result, nil
+	}
+	ServiceMetrics.Counter(metricOperatorCacheMisses, labels, 1)
+
+	result, err := fn(operands)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	if len(c.entries) >= c.size {
+		c.purge(now, labels)
+	}
+	c.entries[key] = operatorCacheEntry{result: result, expires: now.Add(c.ttl)}
+	size := len(c.entries)
+	c.lock.Unlock()
+	ServiceMetrics.Gauge(metricOperatorCacheEntries, labels, float64(size))
+	return result, nil
+}
+
+// purge drops the expired entries, or the whole cache when every entry is
+// still alive.  Caller holds the lock.
+func (c *operatorCache) purge(now time.Time, labels util.Labels) {
+	before := len(c.entries)
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if len(c.entries) >= c.size {
+		c.entries = map[string]operatorCacheEntry{}
+	}
+	ServiceMetrics.Counter(metricOperatorCacheEvictions, labels, float64(before-len(c.entries)))
+}
@@ -0,0 +1,60 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOperatorCache(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if strings.HasSuffix(r.URL.Path, "/broken") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer func(prefixes []string) { LookupAllowedURLPrefixes = prefixes }(LookupAllowedURLPrefixes)
+	LookupAllowedURLPrefixes = []string{server.URL + "/codes/"}
+
+	node := RuleNode{}
+	if err := json.Unmarshal([]byte(`{"name": "cache_test_code",
+		"rule": {"operator": "LOOKUP", "operands": [{"value": "`+server.URL+`/codes/{value}"}, {"field": "cache_test_code"}]}}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	entry, _, err := parseRuleNode(&node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluate := func(code string) error {
+		ctx := FieldEvalContext{RuleName: entry.Name, Field: "cache_test_code", FieldValue: code,
+			Fields: map[string]interface{}{"cache_test_code": code}, Rule: entry.Rule}
+		_, err := entry.Rule.Evaluate(&ctx)
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		for _, code := range []string{"a", "b"} {
+			if err := evaluate(code); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected 2 calls for the 2 cached values, got %d", n)
+	}
+	atomic.StoreInt32(&calls, 0)
+	for i := 0; i < 2; i++ {
+		if err := evaluate("broken"); err == nil {
+			t.Error("expected an error for HTTP 500")
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected the errors not to be cached, got %d calls", n)
+	}
+}
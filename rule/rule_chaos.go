@@ -0,0 +1,192 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Chaos (fault-injection) mode is for the integration tests only.  It is
+// enabled by the -chaos-config option, and never in the production.
+
+// ChaosFault is an injected fault: every call is delayed by LatencyMs,
+// then fails at ErrorRate (0.0 to 1.0)
+type ChaosFault struct {
+	LatencyMs int     `json:"latency-ms"`
+	ErrorRate float64 `json:"error-rate"`
+}
+
+// ChaosConfig is the injected faults, loaded from a JSON file like,
+//   { "rules":     { "phone_pattern": { "error-rate": 1.0 } },
+//     "endpoints": { "/api/validation": { "latency-ms": 500 } },
+//     "store":     { "error-rate": 0.5 } }
+// "rules" by rule name inject the evaluation errors, "endpoints" by the
+// request path inject HTTP 500 responses, and "store" injects the
+// counter store failures.
+type ChaosConfig struct {
+	Rules     map[string]ChaosFault `json:"rules"`
+	Endpoints map[string]ChaosFault `json:"endpoints"`
+	Store     ChaosFault            `json:"store"`
+}
+
+var ChaosInjectedError = errors.New("chaos: injected fault")
+
+// nil when chaos mode is disabled
+var chaos *ChaosConfig
+var chaosLock = sync.RWMutex{}
+
+// EnableChaos turns on the chaos mode with the faults in the JSON file
+func EnableChaos(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := ChaosConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	setChaosConfig(&config)
+	return nil
+}
+
+func chaosEnabled() bool {
+	chaosLock.RLock()
+	defer chaosLock.RUnlock()
+	return chaos != nil
+}
+
+func setChaosConfig(config *ChaosConfig) {
+	chaosLock.Lock()
+	chaos = config
+	chaosLock.Unlock()
+}
+
+// inject applies the fault, and returns ChaosInjectedError when it fails.
+// The failure of the input fields is decided by their sampling key, nil
+// fields fail at random.
+func (f ChaosFault) inject(purpose string, fields map[string]interface{}) error {
+	if f.LatencyMs > 0 {
+		time.Sleep(time.Duration(f.LatencyMs) * time.Millisecond)
+	}
+	if sampleInput(purpose, fields, f.ErrorRate) {
+		return ChaosInjectedError
+	}
+	return nil
+}
+
+// lookupChaosFault returns the fault selected by the config
+func lookupChaosFault(selector func(*ChaosConfig) (ChaosFault, bool)) (ChaosFault, bool) {
+	chaosLock.RLock()
+	defer chaosLock.RUnlock()
+	if chaos == nil {
+		return ChaosFault{}, false
+	}
+	return selector(chaos)
+}
+
+func injectRuleFault(ruleName string, fields map[string]interface{}) error {
+	f, ok := lookupChaosFault(func(c *ChaosConfig) (ChaosFault, bool) {
+		f, ok := c.Rules[ruleName]
+		return f, ok
+	})
+	if !ok {
+		return nil
+	}
+	return f.inject("chaos/rule/"+ruleName, fields)
+}
+
+func injectStoreFault() error {
+	f, ok := lookupChaosFault(func(c *ChaosConfig) (ChaosFault, bool) {
+		return c.Store, true
+	})
+	if !ok {
+		return nil
+	}
+	return f.inject("chaos/store", nil)
+}
+
+// chaosMiddleware injects the endpoint faults by the request path
+func chaosMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := lookupChaosFault(func(c *ChaosConfig) (ChaosFault, bool) {
+			f, ok := c.Endpoints[r.URL.Path]
+			return f, ok
+		})
+		if ok {
+			if err := f.inject("chaos/endpoint"+r.URL.Path, nil); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+				result, _ := json.Marshal(errMsg)
+				io.WriteString(w, string(result))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chaosCounterStore injects the store faults into a CounterStore
+type chaosCounterStore struct {
+	store CounterStore
+}
+
+func (s chaosCounterStore) Load() (map[string]RuleCounter, error) {
+	if err := injectStoreFault(); err != nil {
+		return nil, err
+	}
+	return s.store.Load()
+}
+
+func (s chaosCounterStore) Save(counters map[string]RuleCounter) error {
+	if err := injectStoreFault(); err != nil {
+		return err
+	}
+	return s.store.Save(counters)
+}
+
+// GET /admin/chaos service implementation, 404 when chaos mode is disabled
+func GetChaosConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	chaosLock.RLock()
+	config := chaos
+	chaosLock.RUnlock()
+	if config == nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(errors.New("chaos mode is disabled")))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(config)
+	io.WriteString(w, string(resStr))
+}
+
+// PUT /admin/chaos service implementation, replaces the injected faults
+// when chaos mode is enabled at the startup
+func SetChaosConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !chaosEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(errors.New("chaos mode is disabled")))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	config := ChaosConfig{}
+	if err := decoder.Decode(&config); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	setChaosConfig(&config)
+	w.WriteHeader(http.StatusOK)
+	res := ResponseMsg{Result: RuleMgmtSucc}
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
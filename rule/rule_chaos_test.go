@@ -0,0 +1,48 @@
+package rule
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestChaosFaults(t *testing.T) {
+	defer setChaosConfig(nil)
+	handler := chaosMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	store := chaosCounterStore{store: &FileCounterStore{Path: filepath.Join(t.TempDir(), "counters.json")}}
+
+	// disabled, nothing is injected
+	if err := injectRuleFault("chaos_test_zone", nil); err != nil {
+		t.Errorf("expected no fault of the disabled chaos mode, got %v", err)
+	}
+	if _, err := store.Load(); err != nil {
+		t.Errorf("expected no store fault, got %v", err)
+	}
+
+	setChaosConfig(&ChaosConfig{
+		Rules:     map[string]ChaosFault{"chaos_test_zone": {ErrorRate: 1.0}},
+		Endpoints: map[string]ChaosFault{"/api/validation": {ErrorRate: 1.0}},
+		Store:     ChaosFault{ErrorRate: 1.0},
+	})
+	fields := map[string]interface{}{"chaos_test_zone": "Europe/Paris"}
+	if err := injectRuleFault("chaos_test_zone", fields); !errors.Is(err, ChaosInjectedError) {
+		t.Errorf("expected the rule fault, got %v", err)
+	}
+	if err := injectRuleFault("other_rule", fields); err != nil {
+		t.Errorf("expected no fault of another rule, got %v", err)
+	}
+	if err := store.Save(map[string]RuleCounter{}); !errors.Is(err, ChaosInjectedError) {
+		t.Errorf("expected the store fault, got %v", err)
+	}
+	for path, expected := range map[string]int{"/api/validation": http.StatusInternalServerError, "/version": http.StatusOK} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, w.Code)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package rule
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// sniffed bytes, http.DetectContentType reads at most 512 bytes
+const contentSniffLen = 512
+
+// decodeBase64 decodes s in the standard or URL-safe alphabet, padded or not
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// sniffContentType returns the media type of the base64 payload s, without
+// the parameters, e.g. "image/png", by the http.DetectContentType algorithm
+func sniffContentType(s string) (string, error) {
+	data, err := decodeBase64(s)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > contentSniffLen {
+		data = data[:contentSniffLen]
+	}
+	mediaType := http.DetectContentType(data)
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return strings.TrimSpace(mediaType), nil
+}
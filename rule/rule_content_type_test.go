@@ -0,0 +1,25 @@
+package rule
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestContentTypeIs(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	pdf := base64.RawURLEncoding.EncodeToString([]byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"))
+	for _, tc := range []struct {
+		operands []interface{}
+		expected bool
+	}{
+		{[]interface{}{png, "image/png"}, true},
+		{[]interface{}{png, "image/jpeg", " IMAGE/PNG "}, true},
+		{[]interface{}{pdf, "application/pdf"}, true},
+		{[]interface{}{pdf, "image/png"}, false},
+		{[]interface{}{"not base64!", "image/png"}, false},
+	} {
+		if res, err := RegisteredOperators[ContentTypeIsOperator](tc.operands); err != nil || res != tc.expected {
+			t.Errorf("%v: expected %v, got %v %v", tc.operands[1:], tc.expected, res, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCrossFieldRule(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "cross_test_range", "primary-field": "cross_test_max",
+		"rule": {"operator": "GREATER_THAN", "operands": [{"field": "cross_test_min"}, {"field": "cross_test_max"}]}}`), &node)
+	entry := registerTestRule(t, &node)
+	if entry.Field != "cross_test_max" || !reflect.DeepEqual(entry.Fields, []string{"cross_test_max", "cross_test_min"}) {
+		t.Errorf("expected the primary field first, got %s %v", entry.Field, entry.Fields)
+	}
+	for _, tc := range []struct {
+		input    map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"cross_test_min": "5", "cross_test_max": "3"}, true},
+		{map[string]interface{}{"cross_test_min": "2", "cross_test_max": "3"}, false},
+		// the rule is triggered by the primary field only
+		{map[string]interface{}{"cross_test_min": "2"}, true},
+	} {
+		result, err := ValidateInputJSONByRules("", tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.input, tc.expected, result.flag)
+		}
+	}
+
+	other := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "cross_test_other", "primary-field": "cross_test_other",
+		"rule": {"operator": "GREATER_THAN", "operands": [{"field": "cross_test_min"}, {"field": "cross_test_max"}]}}`), &other)
+	if _, err := RegisterRuleNode(&other); err == nil {
+		t.Error("expected a primary field not referenced by the rule rejected")
+	}
+}
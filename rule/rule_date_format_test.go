@@ -0,0 +1,20 @@
+package rule
+
+import "testing"
+
+func TestDateFormat(t *testing.T) {
+	for _, tc := range []struct {
+		layout   string
+		value    string
+		expected bool
+	}{
+		{"01/02/2006", "12/31/2024", true},
+		{"01/02/2006", "2024-12-31", false},
+		{"01/02/2006", "02/30/2024", false},
+		{"2006-01-02T15:04:05Z07:00", "2024-12-31T23:59:59+01:00", true},
+	} {
+		if res, err := RegisteredOperators[DateFormatOperator]([]interface{}{tc.layout, tc.value}); err != nil || res != tc.expected {
+			t.Errorf("%s %s: expected %v, got %v %v", tc.layout, tc.value, tc.expected, res, err)
+		}
+	}
+}
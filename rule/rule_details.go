@@ -0,0 +1,49 @@
+package rule
+
+import (
+	"net/http"
+)
+
+// The failure response lists the failed rules, and with ?details=true, or
+// -failure-details, a detail of each failure,
+//   "details": [ { "field": "addresses[1].zip_code", "rule": "zip_pattern", "code": "E_ZIP",
+//                  "message": "zip_code must be 5 digits", "value": "1234" } ]
+// the failing field path, a wildcard rule has a detail per failing path,
+// the rendered message of the rule, or the description of the rule
+// without "message", and the offending value, redacted by the field's
+// redaction.  A missing required field has no value.
+
+// DefaultFailureDetails lists the failure details without ?details=
+var DefaultFailureDetails = false
+
+// FailureDetail is a failure of a rule on a field
+type FailureDetail struct {
+	Field   string         `json:"field"`
+	Rule    string         `json:"rule"`
+	Code    string         `json:"code,omitempty"`
+	Message string         `json:"message"`
+	Value   *RedactedValue `json:"value,omitempty"`
+}
+
+// failureDetailsOf reports the request asks for the failure details,
+// ?details=true or false overrides the default
+func failureDetailsOf(r *http.Request) bool {
+	if s := r.URL.Query().Get("details"); len(s) > 0 {
+		return s == "true"
+	}
+	return DefaultFailureDetails
+}
+
+// addDetail adds the failure detail of the rule on the field, message is
+// the rendered message, or nil for the requirement the rule describes
+func (result *validationResult) addDetail(name string, code string, field string, value interface{}, message *RuleMessage,
+	requirement string) {
+	detail := FailureDetail{Field: field, Rule: name, Code: code, Message: "expected " + requirement}
+	if message != nil {
+		detail.Message = message.Message
+	}
+	if value != nil {
+		detail.Value = NewRedactedValue(field, fieldText(value))
+	}
+	result.details = append(result.details, detail)
+}
@@ -0,0 +1,65 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFailureDetails(t *testing.T) {
+	nodes := []RuleNode{}
+	json.Unmarshal([]byte(`[{"name": "details_test_zip", "error-code": "E_ZIP", "message": "{{.Field}} must be 5 digits",
+		"rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "details_test.addresses[*].zip"}]}},
+		{"name": "details_test_name", "required": true, "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "details_test.name"}]}, {"value": "2"}]}},
+		{"name": "details_test_password", "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "password"}]}, {"value": "8"}]}}]`), &nodes)
+	for i := range nodes {
+		registerTestRule(t, &nodes[i])
+	}
+	type detail struct {
+		Field   string      `json:"field"`
+		Rule    string      `json:"rule"`
+		Code    string      `json:"code"`
+		Message string      `json:"message"`
+		Value   interface{} `json:"value"`
+	}
+	type response struct {
+		Result  string   `json:"result"`
+		Details []detail `json:"details"`
+	}
+	validate := func(query string, body string) response {
+		w := httptest.NewRecorder()
+		ValidateJSONData(w, httptest.NewRequest("POST", "/api/validation"+query, strings.NewReader(body)))
+		res := response{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return res
+	}
+	body := `{"details_test": {"addresses": [{"zip": "12345"}, {"zip": "1234"}]}, "password": "short"}`
+	if res := validate("", body); res.Result != ValidationStatusFail || res.Details != nil {
+		t.Errorf("expected no details by default, got %+v", res)
+	}
+
+	res := validate("?details=true", body)
+	details := map[string]detail{}
+	for _, d := range res.Details {
+		details[d.Rule] = d
+	}
+	expected := detail{Field: "details_test.addresses[1].zip", Rule: "details_test_zip", Code: "E_ZIP",
+		Message: "details_test.addresses[1].zip must be 5 digits", Value: "1234"}
+	if details["details_test_zip"] != expected {
+		t.Errorf("expected the wildcard failure detail, got %+v", details["details_test_zip"])
+	}
+	if d := details["details_test_name"]; d.Field != "details_test.name" || d.Value != nil || d.Message != "expected the value is present" {
+		t.Errorf("expected the missing field detail, got %+v", d)
+	}
+	// the password is never echoed
+	if d := details["details_test_password"]; d.Field != "password" || d.Value != nil || !strings.HasPrefix(d.Message, "expected ") {
+		t.Errorf("expected the redacted password detail, got %+v", d)
+	}
+
+	DefaultFailureDetails = true
+	defer func() { DefaultFailureDetails = false }()
+	if res := validate("?details=false", body); res.Details != nil {
+		t.Errorf("expected the details to be opted out, got %+v", res.Details)
+	}
+}
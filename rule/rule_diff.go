@@ -0,0 +1,199 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+)
+
+// A document change is validated with its previous version,
+//   POST /api/validation/diff?ruleset=<ruleset>
+//   { "old": { "email": "a@b.io", "verified": true },
+//     "new": { "email": "c@d.io", "verified": true } }
+// the new version is validated like POST /api/validation, and the rules
+// read the old one by OLD(field), its value in the old version,
+// CHANGED(field), the values differ, and CHANGE_PERCENT(field), the
+// relative change of a number, e.g. "email may not change once verified"
+// and "price may not decrease by more than 50%",
+//   if(old(verified) == true, changed(email) == false)
+//   change_percent(price) >= -50
+// Without the old version, e.g. POST /api/validation, the document is its
+// own old version, OLD is the value, CHANGED is false and CHANGE_PERCENT
+// is 0.  A field absent in the old version is missing for OLD and
+// CHANGE_PERCENT, and changed when it is added.
+
+// DiffRequest is the request of the change validation
+type DiffRequest struct {
+	Old map[string]interface{} `json:"old"`
+	New map[string]interface{} `json:"new"`
+}
+
+// previousContext returns the context of the rule on the old version of
+// the document, and whether the old version has the primary field
+func (context *FieldEvalContext) previousContext() (*FieldEvalContext, bool) {
+	value, present := context.previous[context.Field]
+	return &FieldEvalContext{RuleID: context.RuleID, RuleName: context.RuleName, Field: context.Field, FieldValue: value,
+		Fields: context.previous, Pattern: context.Pattern, indices: context.indices, emptyFields: context.emptyFields}, present
+}
+
+// previousValue evaluates the field operand in the old version of the
+// document
+func previousValue(cx EvalContext, operand Operand) (interface{}, error) {
+	field, ok := operand.(*FieldOperand)
+	if !ok {
+		return nil, ParseRuleOperatorError
+	}
+	ctx, ok := cx.(*FieldEvalContext)
+	if !ok || ctx.previous == nil {
+		// no old version, the document is unchanged
+		return field.Evaluate(cx)
+	}
+	prev, present := ctx.previousContext()
+	if !present && (field.Name == prev.Field || field.Name == prev.Pattern) {
+		return nil, EvalFieldMissingError
+	}
+	return field.Evaluate(prev)
+}
+
+// evaluateOld evaluates OLD(field)
+func evaluateOld(cx EvalContext, operands []Operand) (interface{}, error) {
+	if len(operands) != 1 {
+		return nil, ParseRuleOperatorError
+	}
+	return previousValue(cx, operands[0])
+}
+
+// evaluateChanged evaluates CHANGED(field), a field added or removed is
+// changed
+func evaluateChanged(cx EvalContext, operands []Operand) (interface{}, error) {
+	if len(operands) != 1 {
+		return nil, ParseRuleOperatorError
+	}
+	old, err := previousValue(cx, operands[0])
+	if err != nil && err != EvalFieldMissingError {
+		return nil, err
+	}
+	oldMissing := err == EvalFieldMissingError
+	current, err := operands[0].Evaluate(cx)
+	if err != nil && err != EvalFieldMissingError {
+		return nil, err
+	}
+	if currentMissing := err == EvalFieldMissingError; oldMissing || currentMissing {
+		return oldMissing != currentMissing, nil
+	}
+	return !patchValuesEqual(old, current), nil
+}
+
+// evaluateChangePercent evaluates CHANGE_PERCENT(field), the change of the
+// number from the old version in percent of the old one
+func evaluateChangePercent(cx EvalContext, operands []Operand) (interface{}, error) {
+	if len(operands) != 1 {
+		return nil, ParseRuleOperatorError
+	}
+	old, err := previousValue(cx, operands[0])
+	if err != nil {
+		return nil, err
+	}
+	current, err := operands[0].Evaluate(cx)
+	if err != nil {
+		return nil, err
+	}
+	return changePercent(old, current)
+}
+
+func changePercent(old interface{}, current interface{}) (float64, error) {
+	v1, err := toNumericValue(old)
+	if err != nil {
+		return 0, err
+	}
+	v2, err := toNumericValue(current)
+	if err != nil {
+		return 0, err
+	}
+	if compareNumeric(v1, v2, 0) == 0 {
+		return 0, nil
+	}
+	if v1.f == 0 {
+		return 0, fmt.Errorf("change percent: the old value is 0")
+	}
+	return (v2.f - v1.f) * 100 / math.Abs(v1.f), nil
+}
+
+// POST /api/validation/diff?ruleset=<ruleset>&tags=<tag,...>&strict=true
+// service implementation, the new version is validated with the old one
+func ValidateDiffData(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept-Language")
+
+	decoder := json.NewDecoder(r.Body)
+	// the document numbers keep their exact value
+	decoder.UseNumber()
+	defer r.Body.Close()
+
+	writeError := func(status int, err error) {
+		w.WriteHeader(status)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+	}
+	ruleset := requestRuleset(r)
+	if err := CheckRuleset(ruleset); err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	tags, err := ParseTagFilter(r.URL.Query())
+	if err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	req := DiffRequest{}
+	if err := decoder.Decode(&req); err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	if req.Old == nil || req.New == nil {
+		writeError(http.StatusBadRequest, fmt.Errorf("diff validation: old and new are required"))
+		return
+	}
+	if len(ruleset) == 0 {
+		// the ruleset of the new document type, by the discriminator
+		ruleset = discriminatedRuleset(req.New)
+	}
+	options := ValidationOptions{Tags: tags, Strict: r.URL.Query().Get("strict") == "true",
+		Locales: parseAcceptLanguage(r.Header.Get("Accept-Language")), Previous: NormalizeDocument(req.Old, ruleset)}
+	doc := NormalizeDocument(req.New, ruleset)
+	result, err := ValidateInput(ruleset, options, requestContentType(r, ruleset), doc)
+	if err != nil {
+		writeError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if policy := zeroRulePolicyOf(ruleset); result.noRuleMatched && policy != ZeroRulePass {
+		// no rule is evaluated, reply by the zero-rule policy
+		res := NoRuleResponseMsg{Result: ValidationStatusWarn, Message: NoRuleMatchedMessage}
+		if policy == ZeroRuleFail {
+			res.Result = ValidationStatusFail
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		resStr, _ := json.Marshal(res)
+		io.WriteString(w, string(resStr))
+	} else if result.flag {
+		w.WriteHeader(http.StatusOK)
+		res := ResponseMsg{Result: ValidationStatusSucc}
+		resStr, _ := json.Marshal(res)
+		io.WriteString(w, string(resStr))
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		fail := FailResponseMsg{Result: ValidationStatusFail, Rules: result.rules, Codes: result.codes, Messages: result.messages,
+			Paths: result.paths, Unexpected: result.unexpected, Exclusive: result.exclusive}
+		if fail.Rules == nil {
+			fail.Rules = []string{}
+		}
+		resStr, _ := json.Marshal(fail)
+		io.WriteString(w, string(resStr))
+	}
+}
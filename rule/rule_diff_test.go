@@ -0,0 +1,62 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateDiff(t *testing.T) {
+	for _, rule := range []string{
+		`{"name": "diff_test_email_locked", "field": "diff_test_email", "expression": "if(old(diff_test_verified) == true, changed(diff_test_email) == false)"}`,
+		`{"name": "diff_test_price_drop", "expression": "change_percent(diff_test_price) >= -50"}`} {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "diff_test_literal", "rule": {"operator": "CHANGED", "operands": [{"value": "x"}]}}`), &node)
+	if _, err := RegisterRuleNode(&node); err == nil {
+		t.Errorf("expected CHANGED of a literal to fail")
+	}
+
+	validate := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ValidateDiffData(w, httptest.NewRequest("POST", "/api/validation/diff", strings.NewReader(body)))
+		return w
+	}
+	for i, c := range []struct {
+		old, new string
+		rules    []string
+	}{
+		{`{"diff_test_email": "a@b.io", "diff_test_verified": false}`, `{"diff_test_email": "c@d.io", "diff_test_verified": true}`, nil},
+		{`{"diff_test_email": "a@b.io", "diff_test_verified": true}`, `{"diff_test_email": "a@b.io", "diff_test_verified": true}`, nil},
+		{`{"diff_test_email": "a@b.io", "diff_test_verified": true}`, `{"diff_test_email": "c@d.io", "diff_test_verified": true}`, []string{"diff_test_email_locked"}},
+		{`{"diff_test_price": 100}`, `{"diff_test_price": 50}`, nil},
+		{`{"diff_test_price": 100}`, `{"diff_test_price": 49.5}`, []string{"diff_test_price_drop"}},
+		// a price added is missing in the old version
+		{`{}`, `{"diff_test_price": 10}`, []string{"diff_test_price_drop"}},
+	} {
+		w := validate(`{"old": ` + c.old + `, "new": ` + c.new + `}`)
+		fail := FailResponseMsg{}
+		json.Unmarshal(w.Body.Bytes(), &fail)
+		if (w.Code == http.StatusOK) != (c.rules == nil) || (c.rules != nil && !reflect.DeepEqual(fail.Rules, c.rules)) {
+			t.Errorf("%d: expected %v, got %d %s", i, c.rules, w.Code, w.Body.String())
+		}
+	}
+	if w := validate(`{"new": {}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a missing old version to fail, got %d", w.Code)
+	}
+
+	// without the old version, the document is unchanged
+	result, err := ValidateInputJSONByRules("", map[string]interface{}{"diff_test_email": "c@d.io", "diff_test_verified": true,
+		"diff_test_price": json.Number("1")})
+	if err != nil || !result.flag {
+		t.Errorf("expected the unchanged document to pass, got %v %v", result, err)
+	}
+}
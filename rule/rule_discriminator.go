@@ -0,0 +1,95 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// DiscriminatorConfig selects the ruleset of a document by the value of
+// its type field, loaded from a JSON file like,
+//   { "field": "payload.type",
+//     "rulesets": { "corporate": "corporate_customer", "individual": "retail_customer" },
+//     "default": "retail_customer" }
+// so one endpoint validates the heterogeneous documents.  The field is a
+// path of the nested objects in the document, and a value the rulesets
+// don't list selects "default", the common rules without it.  The
+// ruleset of the request, ?ruleset=, wins over the discriminator.
+type DiscriminatorConfig struct {
+	Field    string            `json:"field"`
+	Rulesets map[string]string `json:"rulesets"`
+	Default  string            `json:"default,omitempty"`
+}
+
+// the configured discriminator, nil without one
+var Discriminator *DiscriminatorConfig
+
+// LoadDiscriminatorConfig loads the discriminator from the JSON file, the
+// rulesets must be known, so it is loaded after the rules
+func LoadDiscriminatorConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := DiscriminatorConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(config.Field)) == 0 {
+		return fmt.Errorf("discriminator, empty field")
+	}
+	for value, ruleset := range config.Rulesets {
+		if len(ruleset) == 0 {
+			return fmt.Errorf("discriminator, %s, empty ruleset", value)
+		}
+		if err := CheckRuleset(ruleset); err != nil {
+			return fmt.Errorf("discriminator, %s, %s", value, err.Error())
+		}
+	}
+	if err := CheckRuleset(config.Default); err != nil {
+		return fmt.Errorf("discriminator, default, %s", err.Error())
+	}
+	RegRuleLock.Lock()
+	Discriminator = &config
+	RegRuleLock.Unlock()
+	return nil
+}
+
+// discriminatedRuleset returns the ruleset of the document by the
+// discriminator, "" without one
+func discriminatedRuleset(doc map[string]interface{}) string {
+	RegRuleLock.RLock()
+	config := Discriminator
+	RegRuleLock.RUnlock()
+	if config == nil {
+		return ""
+	}
+	var value interface{} = doc
+	for _, name := range strings.Split(config.Field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return config.Default
+		}
+		value = object[name]
+	}
+	if value == nil {
+		return config.Default
+	}
+	if ruleset, ok := config.Rulesets[fieldText(value)]; ok {
+		return ruleset
+	}
+	return config.Default
+}
+
+// discriminate returns the ruleset of a document of a stream and its
+// zero-rule policy, by the discriminator when the stream has no ruleset
+func discriminate(doc map[string]interface{}, ruleset string, policy ZeroRulePolicy) (string, ZeroRulePolicy) {
+	if len(ruleset) > 0 {
+		return ruleset, policy
+	}
+	if ruleset = discriminatedRuleset(doc); len(ruleset) > 0 {
+		return ruleset, zeroRulePolicyOf(ruleset)
+	}
+	return ruleset, policy
+}
@@ -0,0 +1,44 @@
+package rule
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscriminator(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "discriminator_test_vat", "rulesets": ["discriminator_test_corporate"], "required": true,
+		"rule": {"operator": "REQUIRED", "operands": [{"field": "discriminator_test_vat"}]}}`), &node)
+	registerTestRule(t, &node)
+
+	path := filepath.Join(t.TempDir(), "discriminator.json")
+	os.WriteFile(path, []byte(`{"field": "payload.type", "rulesets": {"unknown": "no_such_ruleset"}}`), 0644)
+	if err := LoadDiscriminatorConfig(path); err == nil {
+		t.Errorf("expected an error of the unknown ruleset")
+	}
+	os.WriteFile(path, []byte(`{"field": "payload.type", "rulesets": {"corporate": "discriminator_test_corporate"}}`), 0644)
+	if err := LoadDiscriminatorConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { Discriminator = nil }()
+
+	input := `{"payload": {"type": "corporate"}}
+		{"payload": {"type": "individual"}}
+		{"payload": {"type": "corporate"}, "discriminator_test_vat": "DE123"}`
+	results := []string{}
+	err := ValidateStream(strings.NewReader(input), "", func(result StreamResult) error {
+		results = append(results, result.Result)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{ValidationStatusFail, ValidationStatusSucc, ValidationStatusSucc}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
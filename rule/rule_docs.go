@@ -0,0 +1,191 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// RuleDoc is a registered rule in the rule catalogue, for the product
+// teams which don't read rules.json
+type RuleDoc struct {
+	Name        string
+	Field       string
+	Expression  string
+	Requirement string
+	Rulesets    []string
+	Tags        []string
+	Severity    string
+	State       string // "disabled", or the lifecycle state but published
+	Examples    *RuleExamples
+	RuleMetadata
+}
+
+// RuleDocs lists the registered rules with the tag, "" lists all of them,
+// sorted by the field and the rule name
+func RuleDocs(tag string) []RuleDoc {
+	RegRuleLock.RLock()
+	docs := []RuleDoc{}
+	for _, entry := range AllRegisteredRuleIDs {
+		if !entry.hasTag(tag) {
+			continue
+		}
+		expression, _ := ruleExpression(entry.Rule)
+		requirement := describeOperand(entry.Rule, entry.Field)
+		if entry.Required && !isRequiredOperand(entry.Rule) {
+			requirement = "the value is present, and " + requirement
+		}
+		state := ""
+		if !entry.published() {
+			state = entry.State
+		} else if entry.Disabled {
+			state = "disabled"
+		}
+		docs = append(docs, RuleDoc{Name: entry.Name, Field: entry.Field, Expression: expression, Requirement: requirement,
+			Rulesets: entry.Rulesets, Tags: entry.Tags, Severity: entry.Severity, State: state, Examples: entry.Examples, RuleMetadata: entry.Metadata})
+	}
+	RegRuleLock.RUnlock()
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Field != docs[j].Field {
+			return docs[i].Field < docs[j].Field
+		}
+		return docs[i].Name < docs[j].Name
+	})
+	return docs
+}
+
+// ruleDocsByField groups the sorted docs by the field
+type ruleDocsByField struct {
+	Field string
+	Rules []RuleDoc
+}
+
+func groupRuleDocs(docs []RuleDoc) []ruleDocsByField {
+	groups := []ruleDocsByField{}
+	for _, doc := range docs {
+		if n := len(groups); n > 0 && groups[n-1].Field == doc.Field {
+			groups[n-1].Rules = append(groups[n-1].Rules, doc)
+			continue
+		}
+		groups = append(groups, ruleDocsByField{doc.Field, []RuleDoc{doc}})
+	}
+	return groups
+}
+
+// markdownCode quotes s as a Markdown code span, which contains no
+// backtick run as long as its delimiter
+func markdownCode(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+// joinExamples joins the example JSON texts
+func joinExamples(examples []json.RawMessage, quote func(string) string) string {
+	quoted := make([]string, len(examples))
+	for i, example := range examples {
+		quoted[i] = quote(string(example))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+var ruleDocsMarkdown = template.Must(template.New("markdown").Funcs(template.FuncMap{
+	"code": markdownCode, "join": strings.Join,
+	"examples": func(examples []json.RawMessage) string { return joinExamples(examples, markdownCode) },
+}).Parse(`# Validation rules
+{{range .}}
+## {{code .Field}}
+{{range .Rules}}
+### {{.Name}}{{if .State}} ({{.State}}){{end}}
+{{if .Description}}
+{{.Description}}
+{{end}}
+- Requirement: {{.Requirement}}
+- Expression: {{code .Expression}}
+{{- if .Severity}}
+- Severity: {{.Severity}}{{end}}
+{{- if .Rulesets}}
+- Rulesets: {{join .Rulesets ", "}}{{end}}
+{{- if .Tags}}
+- Tags: {{join .Tags ", "}}{{end}}
+{{- if .Owner}}
+- Owner: {{.Owner}}{{end}}
+{{- if .Documentation}}
+- Documentation: <{{.Documentation}}>{{end}}
+{{- with .Examples}}{{if .Pass}}
+- Passes: {{examples .Pass}}{{end}}{{if .Fail}}
+- Fails: {{examples .Fail}}{{end}}{{end}}
+{{end}}{{end}}`))
+
+var ruleDocsHTML = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+	"join": strings.Join,
+	"examples": func(examples []json.RawMessage) string {
+		return joinExamples(examples, func(s string) string { return s })
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Validation rules</title></head>
+<body>
+<h1>Validation rules</h1>
+{{- range .}}
+<h2><code>{{.Field}}</code></h2>
+{{- range .Rules}}
+<h3 id="{{.Name}}">{{.Name}}{{if .State}} ({{.State}}){{end}}</h3>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+<dl>
+<dt>Requirement</dt><dd>{{.Requirement}}</dd>
+<dt>Expression</dt><dd><code>{{.Expression}}</code></dd>
+{{- if .Severity}}
+<dt>Severity</dt><dd>{{.Severity}}</dd>{{end}}
+{{- if .Rulesets}}
+<dt>Rulesets</dt><dd>{{join .Rulesets ", "}}</dd>{{end}}
+{{- if .Tags}}
+<dt>Tags</dt><dd>{{join .Tags ", "}}</dd>{{end}}
+{{- if .Owner}}
+<dt>Owner</dt><dd>{{.Owner}}</dd>{{end}}
+{{- if .Documentation}}
+<dt>Documentation</dt><dd><a href="{{.Documentation}}">{{.Documentation}}</a></dd>{{end}}
+{{- with .Examples}}{{if .Pass}}
+<dt>Passes</dt><dd><code>{{examples .Pass}}</code></dd>{{end}}{{if .Fail}}
+<dt>Fails</dt><dd><code>{{examples .Fail}}</code></dd>{{end}}{{end}}
+</dl>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// GET /admin/rules/docs?format=html&tag=<tag> service implementation, the
+// rule catalogue in Markdown, or in HTML
+func GetRuleDocs(w http.ResponseWriter, r *http.Request) {
+	groups := groupRuleDocs(RuleDocs(r.URL.Query().Get("tag")))
+	var buf bytes.Buffer
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "markdown":
+		ruleDocsMarkdown.Execute(&buf, groups)
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	case "html":
+		ruleDocsHTML.Execute(&buf, groups)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(fmt.Errorf("unknown docs format, %s", format)))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,37 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRuleDocs(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "docs_test_zip", "tags": ["docs_test"], "description": "the zip <code> is 5 digits",
+		"owner": "geo-team", "rule": {"operator": "EQUAL_TO", "operands": [{"operator": "LENGTH", "operands": [{"field": "docs_test_zip"}]}, {"value": 5}]}}`), &node)
+	registerTestRule(t, &node)
+
+	for format, expected := range map[string][]string{
+		"":     {"## `docs_test_zip`", "### docs_test_zip", "- Expression: `EQUAL_TO(LENGTH(docs_test_zip), 5)`", "- Owner: geo-team"},
+		"html": {"<h3 id=\"docs_test_zip\">", "the zip &lt;code&gt; is 5 digits", "<dt>Owner</dt><dd>geo-team</dd>"},
+	} {
+		w := httptest.NewRecorder()
+		GetRuleDocs(w, httptest.NewRequest("GET", "/admin/rules/docs?tag=docs_test&format="+format, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("format %q: expected 200, got %d", format, w.Code)
+		}
+		for _, s := range expected {
+			if !strings.Contains(w.Body.String(), s) {
+				t.Errorf("format %q: expected %q in %s", format, s, w.Body.String())
+			}
+		}
+	}
+	w := httptest.NewRecorder()
+	GetRuleDocs(w, httptest.NewRequest("GET", "/admin/rules/docs?format=pdf", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package rule
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// documentHasPath checks the document has the field path, or an object or
+// array block at path, i.e. a field nested below it like "path.x" or
+// "path[0]"
+func documentHasPath(doc map[string]interface{}, path string) bool {
+	if _, ok := doc[path]; ok {
+		return true
+	}
+	for field := range doc {
+		if strings.HasPrefix(field, path) && len(field) > len(path) &&
+			(field[len(path)] == '.' || field[len(path)] == '[') {
+			return true
+		}
+	}
+	return false
+}
+
+// dependentField checks the document has the field path operands[1], or
+// doesn't when not required, if the condition operands[2] is true; a
+// null field is absent
+func dependentField(operands []interface{}, required bool) (interface{}, error) {
+	if len(operands) != 3 {
+		return nil, ParseRuleOperatorError
+	}
+	doc, ok1 := operands[0].(map[string]interface{})
+	path, ok2 := operands[1].(string)
+	cond, ok3 := operands[2].(bool)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, ParseRuleOperatorError
+	}
+	if !cond {
+		return true, nil
+	}
+	present := documentHasPath(doc, path)
+	if v, ok := doc[path]; ok && v == nil {
+		present = false
+	}
+	return present == required, nil
+}
+
+// documentDepth returns the nesting depth of the document, 1 for the
+// fields of the root object, e.g. 4 for "order.lines[0].sku"
+func documentDepth(doc map[string]interface{}) int {
+	depth := 0
+	for field := range doc {
+		if d := 1 + strings.Count(field, ".") + strings.Count(field, "["); d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// documentLength returns the total characters of the field values of the
+// document, a number or bool in its JSON text and null in none
+func documentLength(doc map[string]interface{}) int {
+	length := 0
+	for _, v := range doc {
+		if v != nil {
+			length += utf8.RuneCountInString(fieldText(v))
+		}
+	}
+	return length
+}
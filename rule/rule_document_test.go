@@ -0,0 +1,38 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDocumentShapeOperators(t *testing.T) {
+	doc := map[string]interface{}{}
+	json.Unmarshal([]byte(`{"id": 12, "name": "Zoë", "order": {"lines": [{"sku": "A1"}]}, "note": null, "paid": true}`), &doc)
+	fields, err := extractJSON(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, _ := RegisteredOperators[DocumentDepthOperator]([]interface{}{fields}); depth != 4 {
+		t.Errorf("expected the depth 4, got %v", depth)
+	}
+	// "12" + "Zoë" + "A1" + "true"
+	if length, _ := RegisteredOperators[DocumentLengthOperator]([]interface{}{fields}); length != 11 {
+		t.Errorf("expected the length 11, got %v", length)
+	}
+
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "document_test_depth", "rule": {"operator": "GREATER_THAN", "operands": [
+		{"value": 4}, {"operator": "DOCUMENT_DEPTH", "operands": [{"field": "$document"}]}]}}`), &node)
+	registerTestRule(t, &node)
+	for input, expected := range map[string]bool{`{"a": {"b": {"c": 1}}}`: true, `{"a": {"b": {"c": [1]}}}`: false} {
+		doc := map[string]interface{}{}
+		json.Unmarshal([]byte(input), &doc)
+		result, err := ValidateInputJSONByRules("", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != expected {
+			t.Errorf("%s: expected %v, got %v %v", input, expected, result.flag, result.rules)
+		}
+	}
+}
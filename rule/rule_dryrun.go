@@ -0,0 +1,106 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// A rule is tried on a sample document without registering it,
+//   POST /admin/rule/dryrun
+//   { "rule": { "name": "zip_code", "rule": { ... } }, "document": { "zip_code": "1234" } }
+// the rule is parsed like a created rule, and evaluated alone like its
+// examples, whatever its state, ruleset and activation window, so a rule
+// author finds out whether the rule parses and what it answers before
+// deploying it.  A document other than an object is the value of the
+// primary field.  A rule calling out by LOOKUP is rejected unless the
+// lookup URLs are restricted to an allowlist.
+
+// DryRunRequest is the rule and the document of the dry run
+type DryRunRequest struct {
+	Rule     *RuleNode       `json:"rule"`
+	Document json.RawMessage `json:"document"`
+}
+
+// DryRunResponseMsg is the verdict of the dry run, Result is "success" or
+// "failure", "warning" when the document has no field of the rule, and
+// "error" when the evaluation fails
+type DryRunResponseMsg struct {
+	Result     string        `json:"result"`
+	Name       string        `json:"name"`
+	Fields     []string      `json:"fields"`
+	Expression string        `json:"expression"`
+	Warnings   []string      `json:"warnings,omitempty"`
+	Messages   []RuleMessage `json:"messages,omitempty"`
+	Paths      []string      `json:"paths,omitempty"`
+	ErrorMsg   string        `json:"error-message,omitempty"`
+}
+
+// DryRun parses the rule of req, and evaluates it on the document.
+// An error is a malformed request or rule, the evaluation error is the
+// verdict.
+func DryRun(req *DryRunRequest) (*DryRunResponseMsg, error) {
+	if req.Rule == nil || len(req.Document) == 0 {
+		return nil, fmt.Errorf("rule dry run: rule and document are required")
+	}
+	entry, fieldList, err := parseRuleNode(req.Rule)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveRuleFields(entry, fieldList); err != nil {
+		return nil, err
+	}
+	if op, ok := usedOperator(entry.Rule, remoteOperators); ok && len(LookupAllowedURLPrefixes) == 0 {
+		return nil, fmt.Errorf("rule dry run: rule name, %s, uses the operator %s, without a lookup URL allowlist", entry.Name, op)
+	}
+	expression, err := ruleExpression(entry.Rule)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := exampleDocument(entry, req.Document)
+	if err != nil {
+		return nil, fmt.Errorf("rule dry run: %s", err.Error())
+	}
+
+	res := &DryRunResponseMsg{Name: entry.Name, Fields: entry.Fields, Expression: expression, Warnings: entry.Warnings}
+	reg, ruleset := entry.isolatedRegistry()
+	result, err := reg.validateIsolated(doc, ruleset)
+	switch {
+	case err != nil:
+		res.Result, res.ErrorMsg = ValidationStatusError, err.Error()
+	case result.noRuleMatched:
+		res.Result, res.ErrorMsg = ValidationStatusWarn, NoRuleMatchedMessage
+	case result.flag:
+		res.Result = ValidationStatusSucc
+	default:
+		res.Result, res.Messages, res.Paths = ValidationStatusFail, result.messages, result.paths[entry.Name]
+	}
+	return res, nil
+}
+
+// POST /admin/rule/dryrun service implementation, the verdict of a rule on
+// a document without registering the rule
+func DryRunRule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	req := DryRunRequest{}
+	if err := decoder.Decode(&req); err != nil {
+		// a malformed request or rule
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	res, err := DryRun(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
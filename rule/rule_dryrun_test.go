@@ -0,0 +1,62 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDryRunRule(t *testing.T) {
+	dryrun := func(body string) (int, DryRunResponseMsg) {
+		w := httptest.NewRecorder()
+		DryRunRule(w, httptest.NewRequest("POST", "/admin/rule/dryrun", strings.NewReader(body)))
+		res := DryRunResponseMsg{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+	rule := `{"name": "dryrun_test_zip", "message": "{{.Field}} is not 5 digits", "rulesets": ["dryrun_test"], "state": "draft",
+		"rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "zip"}]}}`
+	if code, res := dryrun(`{"rule": ` + rule + `, "document": {"zip": "12345"}}`); code != http.StatusOK || res.Result != ValidationStatusSucc ||
+		res.Expression != `MATCHES("^[0-9]{5}$", zip)` {
+		t.Errorf("expected a pass, got %d %+v", code, res)
+	}
+	if code, res := dryrun(`{"rule": ` + rule + `, "document": "1234"}`); code != http.StatusOK || res.Result != ValidationStatusFail ||
+		len(res.Messages) != 1 || res.Messages[0].Message != "zip is not 5 digits" {
+		t.Errorf("expected a failure, got %d %+v", code, res)
+	}
+	if _, res := dryrun(`{"rule": ` + rule + `, "document": {"city": "Oslo"}}`); res.Result != ValidationStatusWarn {
+		t.Errorf("expected no evaluation, got %+v", res)
+	}
+	if code, res := dryrun(`{"rule": {"name": "dryrun_test_len", "rule": {"operator": "GREATER_THAN", "operands": [{"field": "age"}, {"value": "18"}]}},
+		"document": {"age": "old"}}`); code != http.StatusOK || res.Result != ValidationStatusError || len(res.ErrorMsg) == 0 {
+		t.Errorf("expected an evaluation error, got %d %+v", code, res)
+	}
+	if code, _ := dryrun(`{"rule": {"name": "dryrun_test_bad", "rule": {"operator": "NO_SUCH_OPERATOR", "operands": []}}, "document": {}}`); code != http.StatusBadRequest {
+		t.Errorf("expected a parse error, got %d", code)
+	}
+	if code, _ := dryrun(`{"document": {}}`); code != http.StatusBadRequest {
+		t.Errorf("expected a missing rule, got %d", code)
+	}
+	lookup := `{"rule": {"name": "dryrun_test_code", "rule": {"operator": "LOOKUP", "operands": [{"value": "http://127.0.0.1:1/{value}"}, {"field": "code"}]}},
+		"document": {"code": "x"}}`
+	defer func(prefixes []string) { LookupAllowedURLPrefixes = prefixes }(LookupAllowedURLPrefixes)
+	LookupAllowedURLPrefixes = nil
+	if code, _ := dryrun(lookup); code != http.StatusBadRequest {
+		t.Errorf("expected the lookup rule to be rejected without an allowlist, got %d", code)
+	}
+	defer func(readOnly bool) { ReadOnly = readOnly }(ReadOnly)
+	ReadOnly = true
+	w := httptest.NewRecorder()
+	Handlers().ServeHTTP(w, httptest.NewRequest("POST", "/admin/rule/dryrun", strings.NewReader(`{"rule": `+rule+`, "document": {"zip": "12345"}}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"result":"success"`) {
+		t.Errorf("expected the dry run in read-only mode, got %d %s", w.Code, w.Body.String())
+	}
+	RegRuleLock.RLock()
+	registered := findRuleByName("dryrun_test_zip")
+	RegRuleLock.RUnlock()
+	if registered != nil {
+		t.Errorf("expected the rule not to be registered")
+	}
+}
@@ -0,0 +1,486 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A rule is written either as the operator tree of "rule", or as the infix
+// "expression" compiled into the same tree when the rule is decoded, e.g.
+//   length(password) == 0 or length(password) > 6
+// is
+//   OR(EQUAL_TO(LENGTH(password), 0), GREATER_THAN(LENGTH(password), 6))
+// A call is an operator, or a macro, by its case-insensitive name, a bare
+// name is a field, e.g. address.zip, items[*].sku or $document, and the
+// literals are the JSON strings, also in single quotes, numbers, true,
+// false and null.  The comparisons are ==, >, <, >= and <=, of a higher
+// precedence than "and", of a higher one than "or", and the parentheses
+// group.  A registered rule is formatted back into the expression by
+// ruleDSL, when the expression compiles to the same canonical tree.
+
+// ruleNodeJSON is RuleNode without its JSON decoding
+type ruleNodeJSON RuleNode
+
+// UnmarshalJSON decodes the rule, and compiles its "expression" into the
+// rule content
+func (node *RuleNode) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*ruleNodeJSON)(node)); err != nil {
+		return err
+	}
+	if len(node.Expression) == 0 {
+		return nil
+	}
+	if node.RuleContent.Value != nil {
+		return fmt.Errorf("rule name, %s, has both \"rule\" and \"expression\"", node.Name)
+	}
+	tree, err := CompileExpression(node.Expression)
+	if err != nil {
+		return fmt.Errorf("rule name, %s, %s", node.Name, err.Error())
+	}
+	content, _ := json.Marshal(tree)
+	return json.Unmarshal(content, &node.RuleContent)
+}
+
+// CompileExpression compiles the rule expression into the JSON operator
+// tree of "rule"
+func CompileExpression(expression string) (interface{}, error) {
+	tokens, err := tokenizeExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &expressionParser{tokens: tokens}
+	tree, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, p.errorAt(t, "unexpected %q", t.text)
+	}
+	return tree, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenName
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type expressionToken struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+// the comparison symbols, the two-character ones first
+var expressionSymbols = []string{"==", "!=", ">=", "<=", ">", "<", "(", ")", ","}
+
+// tokenizeExpression splits the expression into the names, the literals
+// and the symbols
+func tokenizeExpression(expression string) ([]expressionToken, error) {
+	tokens := []expressionToken{}
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("rule expression: unterminated string at %d", i)
+			}
+			tokens = append(tokens, expressionToken{tokenString, string(runes[i : j+1]), i})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for ; j < len(runes) && (unicode.IsDigit(runes[j]) || strings.ContainsRune(".eE+-", runes[j])); j++ {
+				if (runes[j] == '+' || runes[j] == '-') && runes[j-1] != 'e' && runes[j-1] != 'E' {
+					break
+				}
+			}
+			tokens = append(tokens, expressionToken{tokenNumber, string(runes[i:j]), i})
+			i = j
+		case unicode.IsLetter(r) || r == '_' || r == '$' || r == '.':
+			j := i + 1
+			for ; j < len(runes); j++ {
+				c := runes[j]
+				if c == '[' {
+					// an array index or [*]
+					for j < len(runes) && runes[j] != ']' {
+						j++
+					}
+					continue
+				}
+				if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("_$.-", c) {
+					break
+				}
+			}
+			tokens = append(tokens, expressionToken{tokenName, string(runes[i:j]), i})
+			i = j
+		default:
+			matched := false
+			for _, symbol := range expressionSymbols {
+				if strings.HasPrefix(string(runes[i:]), symbol) {
+					tokens = append(tokens, expressionToken{tokenSymbol, symbol, i})
+					i += len([]rune(symbol))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("rule expression: unexpected %q at %d", string(r), i)
+			}
+		}
+	}
+	return append(tokens, expressionToken{tokenEnd, "end of expression", len(runes)}), nil
+}
+
+type expressionParser struct {
+	tokens []expressionToken
+	pos    int
+}
+
+func (p *expressionParser) peek() expressionToken {
+	return p.tokens[p.pos]
+}
+
+func (p *expressionParser) next() expressionToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *expressionParser) errorAt(t expressionToken, format string, args ...interface{}) error {
+	return fmt.Errorf("rule expression: "+format+" at %d", append(args, t.offset)...)
+}
+
+// keyword checks the token is the case-insensitive keyword
+func (t expressionToken) keyword(word string) bool {
+	return t.kind == tokenName && strings.EqualFold(t.text, word)
+}
+
+func operatorNode(operator OperatorType, operands ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"operator": string(operator), "operands": operands}
+}
+
+// parseOr parses the "or" chain, the lowest precedence
+func (p *expressionParser) parseOr() (interface{}, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = operatorNode(OrOperator, left, right)
+	}
+	return left, nil
+}
+
+// parseAnd parses the "and" chain
+func (p *expressionParser) parseAnd() (interface{}, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("and") {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = operatorNode(AndOperator, left, right)
+	}
+	return left, nil
+}
+
+// parseComparison parses an operand, compared with another one
+func (p *expressionParser) parseComparison() (interface{}, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokenSymbol {
+		return left, nil
+	}
+	switch t.text {
+	case "==", ">", "<", ">=", "<=":
+	case "!=":
+		return nil, p.errorAt(t, "!= isn't supported, there's no NOT operator")
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch t.text {
+	case "==":
+		return operatorNode(EqualToOperator, left, right), nil
+	case ">":
+		return operatorNode(GreaterThanOperator, left, right), nil
+	case "<":
+		return operatorNode(GreaterThanOperator, right, left), nil
+	case ">=":
+		return operatorNode(OrOperator, operatorNode(GreaterThanOperator, left, right), operatorNode(EqualToOperator, left, right)), nil
+	}
+	return operatorNode(OrOperator, operatorNode(GreaterThanOperator, right, left), operatorNode(EqualToOperator, left, right)), nil
+}
+
+// parseOperand parses a parenthesized expression, a call, a field or a
+// literal
+func (p *expressionParser) parseOperand() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenSymbol:
+		if t.text != "(" {
+			return nil, p.errorAt(t, "unexpected %q", t.text)
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.text != ")" || closing.kind != tokenSymbol {
+			return nil, p.errorAt(closing, "expects ), got %q", closing.text)
+		}
+		return inner, nil
+	case tokenString:
+		text := t.text
+		if text[0] == '\'' {
+			// the single-quoted string in the JSON quotes
+			text = `"` + strings.ReplaceAll(strings.ReplaceAll(text[1:len(text)-1], `\'`, `'`), `"`, `\"`) + `"`
+		}
+		var s string
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, p.errorAt(t, "invalid string %s", t.text)
+		}
+		return map[string]interface{}{"value": s}, nil
+	case tokenNumber:
+		if !json.Valid([]byte(t.text)) {
+			return nil, p.errorAt(t, "invalid number %s", t.text)
+		}
+		return map[string]interface{}{"value": json.Number(t.text)}, nil
+	case tokenName:
+		switch {
+		case t.keyword("true"):
+			return map[string]interface{}{"value": true}, nil
+		case t.keyword("false"):
+			return map[string]interface{}{"value": false}, nil
+		case t.keyword("null"):
+			return map[string]interface{}{"value": nil}, nil
+		case t.keyword("and") || t.keyword("or"):
+			return nil, p.errorAt(t, "unexpected %q", t.text)
+		}
+		if open := p.peek(); open.kind == tokenSymbol && open.text == "(" {
+			return p.parseCall(t)
+		}
+		return map[string]interface{}{"field": t.text}, nil
+	}
+	return nil, p.errorAt(t, "unexpected %s", t.text)
+}
+
+// parseCall parses the operands of the call of the operator name
+func (p *expressionParser) parseCall(name expressionToken) (interface{}, error) {
+	p.next()
+	operands := []interface{}{}
+	if closing := p.peek(); closing.kind == tokenSymbol && closing.text == ")" {
+		p.next()
+		return operatorNode(OperatorType(strings.ToUpper(name.text)), operands...), nil
+	}
+	for {
+		operand, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		t := p.next()
+		if t.kind == tokenSymbol && t.text == ")" {
+			break
+		} else if t.kind != tokenSymbol || t.text != "," {
+			return nil, p.errorAt(t, "expects , or ), got %q", t.text)
+		}
+	}
+	return operatorNode(OperatorType(strings.ToUpper(name.text)), operands...), nil
+}
+
+// the precedence of the expression forms, the higher binds tighter
+const (
+	dslOr = iota + 1
+	dslAnd
+	dslComparison
+	dslOperand
+)
+
+// ruleDSL formats the operand tree as the rule expression, e.g.
+// `length(password) == "0" or length(password) > "6"`, and returns "" when
+// the tree has no expression, e.g. an operator mode, a list value, or an
+// OR of more than two operands.  The expression compiles back to the same
+// canonical tree.
+func ruleDSL(op Operand) (string, error) {
+	c, err := canonicalOperand(op)
+	if err != nil {
+		return "", err
+	}
+	expression, ok := formatDSL(c, dslOr)
+	if !ok {
+		return "", nil
+	}
+	// the round trip, e.g. a field name read as a keyword has no expression
+	tree, err := CompileExpression(expression)
+	if err != nil {
+		return "", nil
+	}
+	content, _ := json.Marshal(tree)
+	term := Term{}
+	if err := json.Unmarshal(content, &term); err != nil {
+		return "", nil
+	}
+	compiled, err := ConstructOperandListHelper(&term, map[string]int{})
+	if err != nil {
+		return "", nil
+	}
+	if c2, err := canonicalOperand(compiled); err != nil || !sameCanonical(c, c2) {
+		return "", nil
+	}
+	return expression, nil
+}
+
+// formatDSL formats the canonical block at least of the precedence, in
+// the parentheses otherwise
+func formatDSL(c interface{}, precedence int) (string, bool) {
+	text, own, ok := formatDSLForm(c)
+	if !ok {
+		return "", false
+	}
+	if own < precedence {
+		return "(" + text + ")", true
+	}
+	return text, true
+}
+
+// formatDSLForm formats the canonical block, and returns its precedence
+func formatDSLForm(c interface{}) (string, int, bool) {
+	switch v := c.(type) {
+	case canonicalField:
+		tokens, err := tokenizeExpression(v.Field)
+		if err != nil || len(tokens) != 2 || tokens[0].kind != tokenName || tokens[0].text != v.Field {
+			return "", 0, false
+		}
+		for _, word := range []string{"and", "or", "true", "false", "null"} {
+			if tokens[0].keyword(word) {
+				return "", 0, false
+			}
+		}
+		return v.Field, dslOperand, true
+	case canonicalValue:
+		switch v.Value.(type) {
+		case []interface{}, map[string]interface{}:
+			return "", 0, false
+		}
+		data, err := marshalCanonical(v.Value, "")
+		if err != nil {
+			return "", 0, false
+		}
+		return string(data), dslOperand, true
+	case canonicalTerm:
+		return formatDSLTerm(v)
+	}
+	return "", 0, false
+}
+
+func formatDSLTerm(term canonicalTerm) (string, int, bool) {
+	if len(term.Mode) > 0 {
+		return "", 0, false
+	}
+	binary := func(symbol string, precedence int, left interface{}, right interface{}, rightPrecedence int) (string, int, bool) {
+		l, ok1 := formatDSL(left, precedence)
+		r, ok2 := formatDSL(right, rightPrecedence)
+		return l + " " + symbol + " " + r, precedence, ok1 && ok2
+	}
+	operands := term.Operands
+	switch OperatorType(term.Operator) {
+	case OrOperator:
+		if len(operands) != 2 {
+			return "", 0, false
+		}
+		if left, right, ok := greaterOrEqual(operands[0], operands[1]); ok {
+			return binary(">=", dslComparison, left, right, dslOperand)
+		}
+		if left, right, ok := greaterOrEqual(operands[1], operands[0]); ok {
+			return binary(">=", dslComparison, left, right, dslOperand)
+		}
+		// "or" is left associative
+		return binary("or", dslOr, operands[0], operands[1], dslAnd)
+	case AndOperator:
+		if len(operands) != 2 {
+			return "", 0, false
+		}
+		return binary("and", dslAnd, operands[0], operands[1], dslComparison)
+	case EqualToOperator:
+		if len(operands) == 2 {
+			return binary("==", dslComparison, operands[0], operands[1], dslOperand)
+		}
+	case GreaterThanOperator:
+		if len(operands) == 2 {
+			return binary(">", dslComparison, operands[0], operands[1], dslOperand)
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString(strings.ToLower(term.Operator))
+	buf.WriteString("(")
+	for i, o := range operands {
+		text, ok := formatDSL(o, dslOr)
+		if !ok {
+			return "", 0, false
+		}
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(text)
+	}
+	buf.WriteString(")")
+	return buf.String(), dslOperand, true
+}
+
+// greaterOrEqual matches GREATER_THAN(a, b) and EQUAL_TO(a, b), in any
+// operand order, the compiled "a >= b", and returns a and b
+func greaterOrEqual(greater interface{}, equal interface{}) (interface{}, interface{}, bool) {
+	gt, ok1 := greater.(canonicalTerm)
+	eq, ok2 := equal.(canonicalTerm)
+	if !ok1 || !ok2 || OperatorType(gt.Operator) != GreaterThanOperator || OperatorType(eq.Operator) != EqualToOperator ||
+		len(gt.Mode) > 0 || len(eq.Mode) > 0 || len(gt.Operands) != 2 || len(eq.Operands) != 2 {
+		return nil, nil, false
+	}
+	left, right := gt.Operands[0], gt.Operands[1]
+	if (sameCanonical(left, eq.Operands[0]) && sameCanonical(right, eq.Operands[1])) ||
+		(sameCanonical(left, eq.Operands[1]) && sameCanonical(right, eq.Operands[0])) {
+		return left, right, true
+	}
+	return nil, nil, false
+}
+
+// sameCanonical compares the canonical blocks by their compact JSON
+func sameCanonical(a interface{}, b interface{}) bool {
+	dataA, err1 := marshalCanonical(a, "")
+	dataB, err2 := marshalCanonical(b, "")
+	return err1 == nil && err2 == nil && bytes.Equal(dataA, dataB)
+}
@@ -0,0 +1,71 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRuleExpression(t *testing.T) {
+	node := RuleNode{}
+	if err := json.Unmarshal([]byte(`{"name": "expression_test_password",
+		"expression": "length(expression_test_password) == 0 or (length(expression_test_password) >= 6 and length(expression_test_password) < 10)"}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	registerTestRule(t, &node)
+	for password, expected := range map[string]bool{"": true, "abc": false, "abcdef": true, "abcdefghi": true, "abcdefghij": false} {
+		result, err := ValidateInputJSONByRules("", map[string]interface{}{"expression_test_password": password})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != expected {
+			t.Errorf("password %q: expected %v, got %v", password, expected, result.flag)
+		}
+	}
+
+	for _, expression := range []string{"a != 1", "length(a", "a == 'b", "a == 1 or", "a # 1"} {
+		if _, err := CompileExpression(expression); err == nil {
+			t.Errorf("expected %q to fail", expression)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"name": "x", "expression": "x == 1", "rule": {"field": "x"}}`), &RuleNode{}); err == nil {
+		t.Errorf("expected both rule and expression to fail")
+	}
+}
+
+func TestRuleDSL(t *testing.T) {
+	format := func(rule string) *FormattedRule {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := FormatRuleNode(&node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return formatted
+	}
+	rules := map[string]string{
+		`{"name": "a", "expression": "length(password) == 0 or (length(password) >= 6 and length(password) < 10)"}`: "",
+		`{"name": "b", "expression": "matches('^[0-9]{5}$', address.zip) and items[*].qty > 0"}`:                    "",
+		`{"name": "c", "rule": {"operator": "OR", "operands": [{"operator": "EQUAL_TO", "operands": [{"operator": "LENGTH", "operands": [{"field": "password"}]}, {"value": "0"}]},
+			{"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "password"}]}, {"value": "8"}]}]}}`: `length(password) == "0" or length(password) > "8"`,
+	}
+	for rule, expected := range rules {
+		formatted := format(rule)
+		if len(formatted.DSL) == 0 || (len(expected) > 0 && formatted.DSL != expected) {
+			t.Errorf("expected the DSL of %s, got %q", formatted.Name, formatted.DSL)
+			continue
+		}
+		// the DSL compiles back to the same rule
+		expression, _ := json.Marshal(formatted.DSL)
+		if again := format(`{"name": "again", "expression": ` + string(expression) + `}`); again.Fingerprint != formatted.Fingerprint {
+			t.Errorf("expected %q to round-trip, got %s", formatted.DSL, again.Expression)
+		}
+	}
+	if formatted := format(`{"name": "d", "rule": {"operator": "EQUAL_TO", "mode": "decimal", "operands": [{"field": "price"}, {"value": "1.0"}]}}`); formatted.DSL != "" {
+		t.Errorf("expected no DSL with an operator mode, got %q", formatted.DSL)
+	}
+	if formatted := format(`{"name": "e", "rule": {"operator": "EQUAL_TO", "operands": [{"field": "or"}, {"value": "x"}]}}`); formatted.DSL != "" {
+		t.Errorf("expected no DSL with a keyword field, got %q", formatted.DSL)
+	}
+}
@@ -0,0 +1,157 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DuplicateRuleGroup is a set of structurally identical rules registered
+// under different names, i.e. the rules with the same fingerprint in the
+// same rulesets
+type DuplicateRuleGroup struct {
+	Field       string   `json:"field"`
+	Fingerprint string   `json:"fingerprint"`
+	Expression  string   `json:"expression"`
+	Rules       []string `json:"rules"`
+}
+
+// FindDuplicateRules reports the duplicate rule groups, sorted by field.
+// The fingerprint is taken on the canonical form, so the rules differing
+// in the operand order of a commutative operator, or in a deprecated
+// operator alias, are duplicates as well.
+func FindDuplicateRules() []DuplicateRuleGroup {
+	RegRuleLock.RLock()
+	byFingerprint := map[string][]*RuleEntry{}
+	for _, entry := range AllRegisteredRuleIDs {
+		key := entry.Fingerprint + "\x00" + strings.Join(entry.Rulesets, ",")
+		byFingerprint[key] = append(byFingerprint[key], entry)
+	}
+	RegRuleLock.RUnlock()
+
+	groups := []DuplicateRuleGroup{}
+	for _, entries := range byFingerprint {
+		if len(entries) < 2 {
+			continue
+		}
+		group := DuplicateRuleGroup{Field: entries[0].Field, Fingerprint: entries[0].Fingerprint}
+		group.Expression, _ = ruleExpression(entries[0].Rule)
+		for _, entry := range entries {
+			group.Rules = append(group.Rules, entry.Name)
+		}
+		sort.Strings(group.Rules)
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Field != groups[j].Field {
+			return groups[i].Field < groups[j].Field
+		}
+		return groups[i].Rules[0] < groups[j].Rules[0]
+	})
+	return groups
+}
+
+// findRuleByName returns the registered rule named name, caller holds the lock
+func findRuleByName(name string) *RuleEntry {
+	for _, rules := range AllRegisteredRules {
+		if entry, ok := rules[name]; ok {
+			return entry
+		}
+	}
+	return nil
+}
+
+// MergeDuplicateRules removes the duplicates of the rule keep, and folds
+// their counters into keep.  Every removed rule must have the same
+// fingerprint and rulesets as keep, otherwise nothing is removed.  The
+// rules must be in the namespace of user.
+func MergeDuplicateRules(keep string, remove []string, user string) error {
+	RegRuleLock.Lock()
+	kept := findRuleByName(keep)
+	if kept == nil {
+		RegRuleLock.Unlock()
+		return fmt.Errorf("merge rules: rule name, %s, is not found", keep)
+	}
+	if err := checkRuleNamespace(kept, user); err != nil {
+		RegRuleLock.Unlock()
+		return err
+	}
+	removed := []*RuleEntry{}
+	for _, name := range remove {
+		entry := findRuleByName(name)
+		if entry == nil {
+			RegRuleLock.Unlock()
+			return fmt.Errorf("merge rules: rule name, %s, is not found", name)
+		}
+		if entry == kept {
+			RegRuleLock.Unlock()
+			return fmt.Errorf("merge rules: rule name, %s, is the kept rule", name)
+		}
+		if err := checkRuleNamespace(entry, user); err != nil {
+			RegRuleLock.Unlock()
+			return err
+		}
+		if entry.Fingerprint != kept.Fingerprint ||
+			strings.Join(entry.Rulesets, ",") != strings.Join(kept.Rulesets, ",") {
+			RegRuleLock.Unlock()
+			return fmt.Errorf("merge rules: rule name, %s, is not a duplicate of rule name, %s", name, keep)
+		}
+		removed = append(removed, entry)
+	}
+	for _, entry := range removed {
+		removeRuleFromRegister(entry)
+	}
+	RegRuleLock.Unlock()
+
+	for _, entry := range removed {
+		mergeRuleCounters(kept.ID, entry.ID)
+	}
+	return nil
+}
+
+// MergeRulesRequest is the POST /admin/rules/merge request,
+//   { "keep": "phone_pattern", "remove": [ "phone_pattern_2" ] }
+type MergeRulesRequest struct {
+	Keep   string   `json:"keep"`
+	Remove []string `json:"remove"`
+}
+
+// GET /admin/rules/duplicates service implementation
+func GetDuplicateRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(FindDuplicateRules())
+	io.WriteString(w, string(resStr))
+}
+
+// POST /admin/rules/merge service implementation
+func MergeRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	req := MergeRulesRequest{}
+	if err := decoder.Decode(&req); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	if err := MergeDuplicateRules(req.Keep, req.Remove, r.Header.Get(UserHeader)); err != nil {
+		if errors.Is(err, RuleNamespaceForbiddenError) {
+			w.WriteHeader(http.StatusForbidden)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	res := ResponseMsg{Result: RuleMgmtSucc}
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
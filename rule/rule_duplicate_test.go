@@ -0,0 +1,56 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergeDuplicateRules(t *testing.T) {
+	rules := []string{
+		`{"name": "duplicate_test_a", "rule": {"operator": "EQUAL_TO", "operands": [{"field": "duplicate_test_code"}, {"value": "x"}]}}`,
+		`{"name": "duplicate_test_b", "rule": {"operator": "EQUAL_TO", "operands": [{"value": "x"}, {"field": "duplicate_test_code"}]}}`,
+		`{"name": "duplicate_test_c", "rule": {"operator": "EQUAL_TO", "operands": [{"field": "duplicate_test_code"}, {"value": "y"}]}}`,
+	}
+	entries := []*RuleEntry{}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, registerTestRule(t, &node))
+	}
+
+	found := false
+	for _, group := range FindDuplicateRules() {
+		if group.Field == "duplicate_test_code" {
+			found = true
+			if !reflect.DeepEqual(group.Rules, []string{"duplicate_test_a", "duplicate_test_b"}) {
+				t.Errorf("expected the commutated rules duplicated, got %v", group.Rules)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("expected the duplicate group")
+	}
+
+	if err := MergeDuplicateRules("duplicate_test_a", []string{"duplicate_test_c"}, ""); err == nil {
+		t.Error("expected a different rule not merged")
+	}
+	recordRuleEvaluation(entries[1].ID, entries[1].Name, false, nil)
+	before := GetRuleCounters()
+	if err := MergeDuplicateRules("duplicate_test_a", []string{"duplicate_test_b"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	RegRuleLock.RLock()
+	removed := findRuleByName("duplicate_test_b")
+	RegRuleLock.RUnlock()
+	if removed != nil {
+		t.Error("expected the duplicate removed")
+	}
+	counters := GetRuleCounters()
+	failures := before[entries[0].ID].Failures + before[entries[1].ID].Failures
+	if _, ok := counters[entries[1].ID]; ok || counters[entries[0].ID].Failures != failures {
+		t.Errorf("expected the counters folded into the kept rule, got %v", counters[entries[0].ID])
+	}
+}
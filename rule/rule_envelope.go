@@ -0,0 +1,168 @@
+package rule
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// The envelope formats wrap the resource in the request document, their
+// extractors unwrap it, so the rules target the logical attribute names
+// instead of hard-coding the envelope paths.
+//   JSON:API, { "data": { "type": "users", "id": "1", "attributes": { "email": ... } } }
+//     is extracted as "type", "id" and "email", the relationships stay
+//     under "relationships", and a collection is "data[0].email", ...
+//   HAL, { "email": ..., "_links": { ... }, "_embedded": { "orders": [ { "total": ... } ] } }
+//     is extracted as "email" and "orders[0].total", the links dropped
+const (
+	ContentTypeJSONAPI = "application/vnd.api+json"
+	ContentTypeHAL     = "application/hal+json"
+)
+
+// the envelope names of the ruleset config, by the content type
+var envelopeContentTypes = map[string]string{
+	"jsonapi": ContentTypeJSONAPI,
+	"hal":     ContentTypeHAL,
+}
+
+func init() {
+	RegisterExtractor(ContentTypeJSONAPI, envelopeExtractor(unwrapJSONAPI))
+	RegisterExtractor(ContentTypeHAL, envelopeExtractor(unwrapHAL))
+}
+
+// envelopeExtractor extracts the fields of the JSON document unwrapped by
+// unwrap
+func envelopeExtractor(unwrap func(map[string]interface{}) (map[string]interface{}, error)) Extractor {
+	return ExtractorFunc(func(input interface{}) (map[string]interface{}, error) {
+		var doc map[string]interface{}
+		switch v := input.(type) {
+		case map[string]interface{}:
+			doc = v
+		case []byte:
+			if err := decodeJSONDocument(v, &doc); err != nil {
+				return nil, err
+			}
+		case string:
+			if err := decodeJSONDocument([]byte(v), &doc); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("extractor: unsupported JSON input type, %T", input)
+		}
+		data, err := unwrap(doc)
+		if err != nil {
+			return nil, err
+		}
+		return extractJSON(data)
+	})
+}
+
+// unwrapJSONAPI returns the primary data of the JSON:API document, a
+// resource or a collection of them in "data"
+func unwrapJSONAPI(doc map[string]interface{}) (map[string]interface{}, error) {
+	switch data := doc["data"].(type) {
+	case map[string]interface{}:
+		return jsonAPIResource(data)
+	case []interface{}:
+		items := make([]interface{}, len(data))
+		for i, item := range data {
+			resource, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("jsonapi: data[%d] is not a resource object", i)
+			}
+			var err error
+			if items[i], err = jsonAPIResource(resource); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]interface{}{"data": items}, nil
+	case nil:
+		if _, ok := doc["data"]; ok {
+			// an empty to-one relationship
+			return map[string]interface{}{}, nil
+		}
+	}
+	return nil, fmt.Errorf("jsonapi: the document has no primary data")
+}
+
+// jsonAPIResource flattens the resource object, the attributes with the
+// identification and the relationships
+func jsonAPIResource(resource map[string]interface{}) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	if attributes, ok := resource["attributes"]; ok {
+		members, ok := attributes.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("jsonapi: attributes is not an object")
+		}
+		for k, v := range members {
+			out[k] = v
+		}
+	}
+	// the specification reserves the names for the members below
+	for _, member := range []string{"id", "type", "relationships"} {
+		if v, ok := resource[member]; ok {
+			out[member] = v
+		}
+	}
+	return out, nil
+}
+
+// unwrapHAL returns the HAL resource without "_links", and its embedded
+// resources as the members named by their relation
+func unwrapHAL(resource map[string]interface{}) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	for k, v := range resource {
+		if k != "_links" && k != "_embedded" {
+			out[k] = v
+		}
+	}
+	embedded, ok := resource["_embedded"].(map[string]interface{})
+	if !ok {
+		return out, nil
+	}
+	for rel, v := range embedded {
+		if _, exists := out[rel]; exists {
+			return nil, fmt.Errorf("hal: embedded resource, %s, collides with a property", rel)
+		}
+		switch item := v.(type) {
+		case map[string]interface{}:
+			r, err := unwrapHAL(item)
+			if err != nil {
+				return nil, err
+			}
+			out[rel] = r
+		case []interface{}:
+			items := make([]interface{}, len(item))
+			for i, e := range item {
+				if m, ok := e.(map[string]interface{}); ok {
+					var err error
+					if items[i], err = unwrapHAL(m); err != nil {
+						return nil, err
+					}
+				} else {
+					items[i] = e
+				}
+			}
+			out[rel] = items
+		default:
+			out[rel] = v
+		}
+	}
+	return out, nil
+}
+
+// requestContentType is the extractor content type of the validation
+// request, the envelope of its Content-Type, or the envelope of the
+// ruleset, otherwise the plain JSON
+func requestContentType(r *http.Request, ruleset string) string {
+	contentType := normalizeContentType(r.Header.Get("Content-Type"))
+	if contentType == ContentTypeJSONAPI || contentType == ContentTypeHAL {
+		return contentType
+	}
+	RegRuleLock.RLock()
+	envelope := rulesetConfigOf(ruleset).Envelope
+	RegRuleLock.RUnlock()
+	if t, ok := envelopeContentTypes[envelope]; ok {
+		return t
+	}
+	return ContentTypeJSON
+}
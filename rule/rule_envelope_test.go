@@ -0,0 +1,47 @@
+package rule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvelopeExtractors(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		document    string
+		expected    map[string]interface{}
+	}{
+		{ContentTypeJSONAPI, `{"data": {"type": "users", "id": "1", "attributes": {"email": "a@b", "name": {"first": "Bo"}},
+			"relationships": {"team": {"data": {"type": "teams", "id": "7"}}}}, "meta": {"page": 1}}`,
+			map[string]interface{}{"type": "users", "id": "1", "email": "a@b", "name.first": "Bo",
+				"relationships.team.data.type": "teams", "relationships.team.data.id": "7"}},
+		{ContentTypeJSONAPI, `{"data": [{"type": "users", "attributes": {"email": "a@b"}}, {"type": "users", "attributes": {"email": "c@d"}}]}`,
+			map[string]interface{}{"data[0].type": "users", "data[0].email": "a@b", "data[1].type": "users", "data[1].email": "c@d"}},
+		{ContentTypeHAL, `{"email": "a@b", "_links": {"self": {"href": "/users/1"}},
+			"_embedded": {"orders": [{"total": 5, "_links": {"self": {"href": "/orders/1"}}}], "team": {"name": "x"}}}`,
+			map[string]interface{}{"email": "a@b", "orders[0].total": int64(5), "team.name": "x"}},
+	}
+	for _, tc := range testCases {
+		extractor, err := GetExtractor(tc.contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields, err := extractor.Extract([]byte(tc.document))
+		if err != nil {
+			t.Errorf("%s: unexpected error, %s", tc.contentType, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(fields, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.contentType, tc.expected, fields)
+		}
+	}
+
+	extractor, _ := GetExtractor(ContentTypeJSONAPI)
+	if _, err := extractor.Extract([]byte(`{"meta": {}}`)); err == nil {
+		t.Error("expected an error for a JSON:API document without the primary data")
+	}
+	extractor, _ = GetExtractor(ContentTypeHAL)
+	if _, err := extractor.Extract([]byte(`{"team": 1, "_embedded": {"team": {"name": "x"}}}`)); err == nil {
+		t.Error("expected an error for an embedded resource colliding with a property")
+	}
+}
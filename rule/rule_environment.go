@@ -0,0 +1,65 @@
+package rule
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// A rule targets the deployment environments of "environments", e.g.
+// ["dev", "staging"], and the server loads only the rules of its
+// Environment, so one rules repository drives all the tiers and an
+// experiment is never enforced in production by accident.  A rule without
+// "environments" is loaded everywhere, and a server without Environment
+// loads only those.
+
+// Environment is the deployment environment of the server, e.g. prod
+var Environment = ""
+
+// normalizeEnvironments checks the environment names of a rule, and
+// returns them sorted without the duplicates
+func normalizeEnvironments(environments []string) ([]string, error) {
+	for _, name := range environments {
+		if len(strings.TrimSpace(name)) == 0 || strings.Contains(name, ",") {
+			return nil, fmt.Errorf("invalid environment name, %q", name)
+		}
+	}
+	// the same checks and order as the ruleset names
+	return normalizeRulesets(environments)
+}
+
+// inEnvironment reports a rule of environments is loaded in Environment
+func inEnvironment(environments []string) bool {
+	if len(environments) == 0 {
+		return true
+	}
+	for _, name := range environments {
+		if name == Environment {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEnvironment rejects a rule which doesn't target Environment
+func checkEnvironment(name string, environments []string) error {
+	if !inEnvironment(environments) {
+		return fmt.Errorf("rule name, %s, targets the environments %s, not %q", name, strings.Join(environments, ","), Environment)
+	}
+	return nil
+}
+
+// environmentNodes returns the rules of the rules file which target
+// Environment, the others are skipped
+func environmentNodes(nodes []RuleNode) []RuleNode {
+	kept := make([]RuleNode, 0, len(nodes))
+	for _, node := range nodes {
+		if inEnvironment(node.Environments) {
+			kept = append(kept, node)
+		}
+	}
+	if skipped := len(nodes) - len(kept); skipped > 0 {
+		log.Printf("system rule load: %d rules skipped, not targeting the environment %q", skipped, Environment)
+	}
+	return kept
+}
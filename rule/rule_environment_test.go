@@ -0,0 +1,35 @@
+package rule
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRuleEnvironments(t *testing.T) {
+	defer func(environment string) { Environment = environment }(Environment)
+	Environment = "prod"
+	nodes := []RuleNode{{Name: "environment_test_all"}, {Name: "environment_test_dev", Environments: []string{"dev", "staging"}},
+		{Name: "environment_test_prod", Environments: []string{"prod"}}}
+	kept := environmentNodes(nodes)
+	if len(kept) != 2 || kept[0].Name != "environment_test_all" || kept[1].Name != "environment_test_prod" {
+		t.Errorf("expected the rules of all and prod, got %v", kept)
+	}
+
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "environment_test_dev", "environments": ["staging", "dev"],
+		"rule": {"operator": "EQUAL_TO", "operands": [{"field": "environment_test"}, {"value": "x"}]}}`), &node)
+	formatted, err := FormatRuleNode(&node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(formatted.Canonical, `"environments": [
+    "dev",
+    "staging"
+  ]`) {
+		t.Errorf("expected the sorted environments, got %s", formatted.Canonical)
+	}
+	if _, err := RegisterRuleNode(&node); err == nil {
+		t.Errorf("expected the dev rule to be rejected in prod")
+	}
+}
@@ -0,0 +1,202 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// A rule carries the examples, the inputs it is expected to pass and to
+// fail, e.g.
+//   "examples": { "pass": [ "user@example.com" ], "fail": [ "user@", "" ] }
+// An example object is a whole input document, any other value is the
+// value of the primary field.  The examples are evaluated by the rule
+// alone, whatever its state, ruleset and activation window.
+
+// the rule registration is rejected when its examples fail, off by default
+var EnforceRuleExamples = false
+
+// RuleExamples is the inputs the rule is expected to pass and to fail
+type RuleExamples struct {
+	Pass []json.RawMessage `json:"pass,omitempty"`
+	Fail []json.RawMessage `json:"fail,omitempty"`
+}
+
+// ExampleMismatch is an example the rule doesn't evaluate as expected
+type ExampleMismatch struct {
+	Expected string          `json:"expected"` // "pass" or "fail"
+	Example  json.RawMessage `json:"example"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// ExampleReport is the POST /admin/rule/{ruleName}/test response
+type ExampleReport struct {
+	Rule       string            `json:"rule"`
+	Examples   int               `json:"examples"`
+	Mismatches []ExampleMismatch `json:"mismatches"`
+}
+
+// exampleDocument returns the input document of the example of the rule
+func exampleDocument(entry *RuleEntry, example json.RawMessage) (map[string]interface{}, error) {
+	var v interface{}
+	if err := decodeJSONDocument(example, &v); err != nil {
+		return nil, err
+	}
+	if doc, ok := v.(map[string]interface{}); ok {
+		return doc, nil
+	}
+	field := entry.Field
+	if field == DocumentField || isWildcardPath(field) || strings.ContainsAny(field, "[]") {
+		return nil, fmt.Errorf("the example of the field, %s, must be a document", field)
+	}
+	// the value nested at the field path
+	names := strings.Split(field, ".")
+	for i := len(names) - 1; i >= 0; i-- {
+		v = map[string]interface{}{names[i]: v}
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// runExamples evaluates the examples of the rule entry, and returns the
+// mismatches and the number of the examples.  Caller owns entry, which
+// fields are resolved.
+func (entry *RuleEntry) runExamples() ([]ExampleMismatch, int) {
+	mismatches := []ExampleMismatch{}
+	if entry.Examples == nil {
+		return mismatches, 0
+	}
+	reg, ruleset := entry.isolatedRegistry()
+
+	run := func(examples []json.RawMessage, pass bool, expected string) {
+		for _, example := range examples {
+			doc, err := exampleDocument(entry, example)
+			if err == nil {
+				var result *validationResult
+				if result, err = reg.validateIsolated(doc, ruleset); err == nil && result.flag == pass {
+					continue
+				}
+			}
+			mismatch := ExampleMismatch{Expected: expected, Example: example}
+			if err != nil {
+				mismatch.Error = err.Error()
+			}
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+	run(entry.Examples.Pass, true, "pass")
+	run(entry.Examples.Fail, false, "fail")
+	return mismatches, len(entry.Examples.Pass) + len(entry.Examples.Fail)
+}
+
+// isolatedRegistry returns the registry of the rule alone, evaluated as a
+// published, enabled and active rule, and the ruleset it applies to
+func (entry *RuleEntry) isolatedRegistry() (ruleRegistry, string) {
+	isolated := *entry
+	isolated.State, isolated.Disabled, isolated.ValidFrom, isolated.ValidUntil = RuleStatePublished, false, nil, nil
+	isolated.Enforcement = nil
+	ruleset := ""
+	if len(isolated.Rulesets) > 0 {
+		ruleset = isolated.Rulesets[0]
+	}
+	reg := newIsolatedRegistry()
+	reg.add(&isolated)
+	return reg, ruleset
+}
+
+// checkRuleExamples rejects the parsed rule entry which fails its
+// examples, when the examples are enforced
+func checkRuleExamples(entry *RuleEntry, fieldList map[string]int) error {
+	if !EnforceRuleExamples || entry.Examples == nil {
+		return nil
+	}
+	resolved := *entry
+	if err := resolveRuleFields(&resolved, fieldList); err != nil {
+		return err
+	}
+	if mismatches, _ := resolved.runExamples(); len(mismatches) > 0 {
+		m := mismatches[0]
+		return fmt.Errorf("rule name, %s, %d examples fail, e.g. %s is expected to %s", entry.Name, len(mismatches), string(m.Example), m.Expected)
+	}
+	return nil
+}
+
+// checkReplacedRuleExamples rejects the parsed rule entry replacing the
+// registered rule which fails the examples of the replaced one, but the
+// examples the entry lists itself, in either list, which supersede them
+func checkReplacedRuleExamples(entry *RuleEntry, fieldList map[string]int, replaced *RuleEntry) error {
+	if !EnforceRuleExamples || replaced.Examples == nil {
+		return nil
+	}
+	listed := map[string]bool{}
+	if entry.Examples != nil {
+		for _, example := range append(append([]json.RawMessage{}, entry.Examples.Pass...), entry.Examples.Fail...) {
+			listed[compactExample(example)] = true
+		}
+	}
+	kept := &RuleExamples{}
+	for _, example := range replaced.Examples.Pass {
+		if !listed[compactExample(example)] {
+			kept.Pass = append(kept.Pass, example)
+		}
+	}
+	for _, example := range replaced.Examples.Fail {
+		if !listed[compactExample(example)] {
+			kept.Fail = append(kept.Fail, example)
+		}
+	}
+	resolved := *entry
+	resolved.Examples = kept
+	if err := resolveRuleFields(&resolved, fieldList); err != nil {
+		return err
+	}
+	if mismatches, _ := resolved.runExamples(); len(mismatches) > 0 {
+		m := mismatches[0]
+		return fmt.Errorf("rule name, %s, %d examples of version %d fail, e.g. %s is expected to %s", entry.Name, len(mismatches), replaced.Version, string(m.Example), m.Expected)
+	}
+	return nil
+}
+
+// compactExample returns the example without the insignificant spaces,
+// to compare the examples
+func compactExample(example json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, example); err != nil {
+		return string(example)
+	}
+	return b.String()
+}
+
+// RunRuleExamples evaluates the examples of the registered rule
+func RunRuleExamples(name string) (*ExampleReport, error) {
+	RegRuleLock.RLock()
+	entry := findRuleByName(name)
+	if entry == nil {
+		RegRuleLock.RUnlock()
+		return nil, fmt.Errorf("rule name, %s, is not found", name)
+	}
+	// the state is guarded by the lock
+	registered := *entry
+	RegRuleLock.RUnlock()
+	mismatches, count := registered.runExamples()
+	return &ExampleReport{Rule: name, Examples: count, Mismatches: mismatches}, nil
+}
+
+// POST /admin/rule/{ruleName}/test service implementation, evaluates the
+// examples of the rule
+func TestRule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	report, err := RunRuleExamples(chi.URLParam(r, "ruleName"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(report)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,57 @@
+package rule
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRuleExamplesRun(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "examples_test_zip", "state": "draft",
+		"examples": {"pass": ["12345", {"examples_test": {"zip": "54321"}}], "fail": ["1234", "99999"]},
+		"rule": {"operator": "EQUAL_TO", "operands": [{"operator": "LENGTH", "operands": [{"field": "examples_test.zip"}]}, {"value": 5}]}}`), &node)
+	registerTestRule(t, &node)
+
+	// the draft rule is evaluated by its examples, "99999" passes
+	report, err := RunRuleExamples("examples_test_zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Examples != 4 || len(report.Mismatches) != 1 || string(report.Mismatches[0].Example) != `"99999"` || report.Mismatches[0].Expected != "fail" {
+		t.Errorf("expected the mismatch of 99999, got %+v", report)
+	}
+	if _, err := RunRuleExamples("examples_test_none"); err == nil {
+		t.Errorf("expected the unknown rule to fail")
+	}
+
+	defer func() { EnforceRuleExamples = false }()
+	EnforceRuleExamples = true
+	node = RuleNode{}
+	json.Unmarshal([]byte(`{"name": "examples_test_enforced", "examples": {"fail": ["abc"]},
+		"rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "examples_test_enforced"}]}, {"value": 1}]}}`), &node)
+	if _, err := RegisterRuleNode(&node); err == nil {
+		t.Errorf("expected the rule failing its examples to be rejected")
+	}
+
+	// an update runs the examples of the replaced version too
+	node = RuleNode{}
+	json.Unmarshal([]byte(`{"name": "examples_test_updated", "examples": {"pass": ["abcd"], "fail": ["ab"]},
+		"rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "examples_test_updated"}]}, {"value": 3}]}}`), &node)
+	registerTestRule(t, &node)
+	update := func(definition string) error {
+		node := RuleNode{}
+		json.Unmarshal([]byte(definition), &node)
+		_, err := UpdateRuleNode("examples_test_updated", &node, nil)
+		return err
+	}
+	if err := update(`{"rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "examples_test_updated"}]}, {"value": 1}]}}`); err == nil ||
+		!strings.Contains(err.Error(), "version 1") {
+		t.Errorf("expected the update failing the replaced examples to be rejected, got %v", err)
+	}
+	// the example listed by the update supersedes the replaced one
+	if err := update(`{"examples": {"pass": [ "ab" ]},
+		"rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "examples_test_updated"}]}, {"value": 1}]}}`); err != nil {
+		t.Errorf("expected the update, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package rule
+
+// The exclusive field groups are the document rules of EXACTLY_ONE_OF and
+// AT_MOST_ONE_OF on the field paths, e.g. "email" xor "phone".  A field
+// path is present like HAS_FIELD, and a null field is absent.  A failed
+// group is reported with its fields, and the present ones, the
+// conflicting fields.
+
+// ExclusiveViolation is the violation entry of a failed exclusive group
+type ExclusiveViolation struct {
+	Group   []string `json:"group"`
+	Present []string `json:"present"`
+}
+
+// presentGroupFields returns the field paths of operands[1:] the document
+// operands[0] has, in order
+func presentGroupFields(operands []interface{}) ([]string, error) {
+	if len(operands) < 3 {
+		return nil, ParseRuleOperatorError
+	}
+	doc, ok := operands[0].(map[string]interface{})
+	if !ok {
+		return nil, ParseRuleOperatorError
+	}
+	present := []string{}
+	for _, op := range operands[1:] {
+		path, ok := op.(string)
+		if !ok {
+			return nil, ParseRuleOperatorError
+		}
+		if v, ok := doc[path]; (ok && v != nil) || (!ok && documentHasPath(doc, path)) {
+			present = append(present, path)
+		}
+	}
+	return present, nil
+}
+
+// exclusiveViolation returns the violation entry of the failed rule of
+// ctx, when the rule is an exclusive group
+func exclusiveViolation(ctx *FieldEvalContext) (ExclusiveViolation, bool) {
+	term, ok := ctx.Rule.(*TermOperand)
+	if !ok || (OperatorType(term.ParseOperator) != ExactlyOneOfOperator && OperatorType(term.ParseOperator) != AtMostOneOfOperator) {
+		return ExclusiveViolation{}, false
+	}
+	operands := make([]interface{}, len(term.OperandList))
+	for i, op := range term.OperandList {
+		v, err := op.Evaluate(ctx)
+		if err != nil {
+			return ExclusiveViolation{}, false
+		}
+		operands[i] = v
+	}
+	present, err := presentGroupFields(operands)
+	if err != nil {
+		return ExclusiveViolation{}, false
+	}
+	violation := ExclusiveViolation{Present: present}
+	for _, op := range operands[1:] {
+		violation.Group = append(violation.Group, op.(string))
+	}
+	return violation, true
+}
@@ -0,0 +1,49 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExclusiveGroupRules(t *testing.T) {
+	rules := []string{
+		`{"name": "exclusive_test_contact", "rule": {"operator": "EXACTLY_ONE_OF", "operands": [
+			{"field": "$document"}, {"value": "exclusive_test_email"}, {"value": "exclusive_test_phone"}]}}`,
+		`{"name": "exclusive_test_payment", "rule": {"operator": "AT_MOST_ONE_OF", "operands": [
+			{"field": "$document"}, {"value": "exclusive_test_card"}, {"value": "exclusive_test_iban"}, {"value": "exclusive_test_paypal"}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	testCases := []struct {
+		input     string
+		exclusive map[string]ExclusiveViolation
+	}{
+		{`{"exclusive_test_email": "a@example.com"}`, nil},
+		{`{"exclusive_test_email": "a@example.com", "exclusive_test_phone": null}`, nil},
+		{`{"exclusive_test_email": "a@example.com", "exclusive_test_phone": "+4930123"}`, map[string]ExclusiveViolation{
+			"exclusive_test_contact": {Group: []string{"exclusive_test_email", "exclusive_test_phone"}, Present: []string{"exclusive_test_email", "exclusive_test_phone"}}}},
+		{`{"exclusive_test_card": {"number": "4111"}, "exclusive_test_paypal": "a@example.com"}`, map[string]ExclusiveViolation{
+			"exclusive_test_contact": {Group: []string{"exclusive_test_email", "exclusive_test_phone"}, Present: []string{}},
+			"exclusive_test_payment": {Group: []string{"exclusive_test_card", "exclusive_test_iban", "exclusive_test_paypal"}, Present: []string{"exclusive_test_card", "exclusive_test_paypal"}}}},
+	}
+	for _, tc := range testCases {
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(tc.input), &doc); err != nil {
+			t.Fatal(err)
+		}
+		result, err := ValidateInputJSONByRules("", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != (tc.exclusive == nil) || !reflect.DeepEqual(result.exclusive, tc.exclusive) {
+			t.Errorf("%s: expected the exclusive violations %v, got %v %v", tc.input, tc.exclusive, result.flag, result.exclusive)
+		}
+	}
+}
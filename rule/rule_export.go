@@ -0,0 +1,659 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The rules of a ruleset are exported as the contracts of the downstream
+// consumers, generated from the registry by one command,
+//   validation export -format=jsonschema|openapi|proto [-ruleset=<ruleset>]
+// the client JSON Schema, the OpenAPI document of POST /api/validation, and
+// the protobuf message with the protovalidate (buf.validate) constraints.
+// The rule shapes below are translated into the constraints, the others
+// are described in the field description only,
+//   REQUIRED(f), or "required": true              - required
+//   MATCHES(pattern, f)                           - pattern
+//   GREATER_THAN(LENGTH(f), n)                    - minimum length n+1
+//   BETWEEN(LENGTH(f), low, high)                 - length range
+//   GREATER_THAN(f, n), BETWEEN(f, low, high)     - number range
+//   EQUAL_TO(f, v), OR(EQUAL_TO(f, v), ...)       - enumeration
+//   AND(a, b)                                     - both a and b
+// The field "a.b" is the member b of the object a, and "a[*].b" the
+// member b of the items of the array a.  The protobuf field numbers are
+// kept in ProtoFieldNumbers, by -proto-fields across the exports, so a
+// field keeps its number, a new one gets the next free number, and the
+// numbers of the removed ones are reserved.  Without it the numbers
+// follow the sorted field names, and aren't stable on the wire when a
+// field is added or removed.
+const (
+	ExportJSONSchema = "jsonschema"
+	ExportOpenAPI    = "openapi"
+	ExportProto      = "proto"
+)
+
+// exportNode is the constraints of a field, and its members or items
+type exportNode struct {
+	kind             string // "string", "number", or "" when it isn't known
+	required         bool
+	patterns         []string
+	minLength        *int64
+	maxLength        *int64
+	minimum          interface{}
+	maximum          interface{}
+	exclusiveMinimum interface{}
+	enum             []interface{}
+	descriptions     []string
+	properties       map[string]*exportNode
+	items            *exportNode
+}
+
+var (
+	// a path segment, the member name, and its array item levels
+	exportSegment = regexp.MustCompile(`^([^\[]*)((\[[^\]]*\])*)$`)
+	// the characters of the protobuf names
+	protoNameSeparator = regexp.MustCompile(`[^A-Za-z0-9]+`)
+	protoFieldInvalid  = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// ProtoFieldNumbers is the protobuf field number by the full field name,
+// e.g. "validation.SignupInput.address.zip", the proto export adds the
+// new fields
+var ProtoFieldNumbers = map[string]int{}
+
+// LoadProtoFieldNumbers reads the field numbers of the previous exports,
+// a missing file is none
+func LoadProtoFieldNumbers(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	numbers := map[string]int{}
+	if err := json.Unmarshal(data, &numbers); err != nil {
+		return fmt.Errorf("export: %s, %s", path, err.Error())
+	}
+	for name, number := range numbers {
+		if number < 1 || number > protoMaxFieldNumber {
+			return fmt.Errorf("export: %s, field number of %s, %d, is out of 1 to %d", path, name, number, protoMaxFieldNumber)
+		}
+	}
+	ProtoFieldNumbers = numbers
+	return nil
+}
+
+// SaveProtoFieldNumbers writes the field numbers for the next exports
+func SaveProtoFieldNumbers(path string) error {
+	data, err := marshalCanonical(ProtoFieldNumbers, "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// the largest protobuf field number
+const protoMaxFieldNumber = 1<<29 - 1
+
+// protoFieldNumbers returns the numbers of the members of the message
+// named name, the kept ones, the next free ones of the new members, and
+// the numbers of the removed members to reserve
+func protoFieldNumbers(name string, members []string) (map[string]int, []int) {
+	prefix := name + "."
+	numbers := map[string]int{}
+	present := map[string]bool{}
+	for _, member := range members {
+		present[protoFieldName(member)] = true
+	}
+	next := 1
+	reserved := []int{}
+	for field, number := range ProtoFieldNumbers {
+		if !strings.HasPrefix(field, prefix) || strings.Contains(field[len(prefix):], ".") {
+			continue
+		}
+		if number >= next {
+			next = number + 1
+		}
+		if !present[field[len(prefix):]] {
+			reserved = append(reserved, number)
+		}
+	}
+	sort.Ints(reserved)
+	for _, member := range members {
+		field := prefix + protoFieldName(member)
+		number, ok := ProtoFieldNumbers[field]
+		if !ok {
+			number = next
+			next++
+			ProtoFieldNumbers[field] = number
+		}
+		numbers[member] = number
+	}
+	return numbers, reserved
+}
+
+// node returns the node of the field path under the root object
+func (root *exportNode) node(field string) *exportNode {
+	n := root
+	for _, segment := range strings.Split(field, ".") {
+		name, levels := segment, 0
+		if m := exportSegment.FindStringSubmatch(segment); m != nil {
+			name, levels = m[1], strings.Count(m[2], "[")
+		}
+		if len(name) > 0 {
+			if n.properties == nil {
+				n.properties = map[string]*exportNode{}
+			}
+			child, ok := n.properties[name]
+			if !ok {
+				child = &exportNode{}
+				n.properties[name] = child
+			}
+			n = child
+		}
+		for ; levels > 0; levels-- {
+			if n.items == nil {
+				n.items = &exportNode{}
+			}
+			n = n.items
+		}
+	}
+	return n
+}
+
+// tighterBound returns the tighter of the bounds, the greater one for a
+// sign of 1, the lesser one for -1
+func tighterBound(current, v interface{}, sign int) interface{} {
+	if current == nil {
+		return v
+	}
+	n1, err1 := toNumericValue(current)
+	n2, err2 := toNumericValue(v)
+	if err1 == nil && err2 == nil && sign*compareNumeric(n2, n1, 0) > 0 {
+		return v
+	}
+	return current
+}
+
+// lengthLiteral returns the literal as a length
+func lengthLiteral(op Operand) (int64, bool) {
+	v, ok := numberLiteral(op)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case *big.Int:
+		if n.IsInt64() {
+			return n.Int64(), true
+		}
+	}
+	return 0, false
+}
+
+// numberLiteral returns the literal when it is a number, or the number
+// in a string, e.g. "4", which the comparison operators accept
+func numberLiteral(op Operand) (interface{}, bool) {
+	v, ok := op.(*ValueOperand)
+	if !ok {
+		return nil, false
+	}
+	if s, isString := v.Value.(string); isString {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, false
+		}
+		n, err := typedLiteral(json.Number(s))
+		return n, err == nil
+	}
+	return v.Value, isNumber(v.Value)
+}
+
+// fieldOf returns the field name of a field operand, or of LENGTH(field)
+// for length
+func fieldOf(op Operand, length bool) (string, bool) {
+	if length {
+		term, ok := op.(*TermOperand)
+		if !ok || OperatorType(term.ParseOperator) != LengthOperator || len(term.OperandList) != 1 {
+			return "", false
+		}
+		op = term.OperandList[0]
+	}
+	f, ok := op.(*FieldOperand)
+	if !ok || f.Name == DocumentField {
+		return "", false
+	}
+	return f.Name, true
+}
+
+// enumValues returns the field and values of OR(EQUAL_TO(f, v), ...)
+func enumValues(op Operand) (string, []interface{}, bool) {
+	term, ok := op.(*TermOperand)
+	if !ok || len(term.ParseMode) > 0 {
+		return "", nil, false
+	}
+	switch OperatorType(term.ParseOperator) {
+	case EqualToOperator:
+		if len(term.OperandList) != 2 {
+			return "", nil, false
+		}
+		field, ok := fieldOf(term.OperandList[0], false)
+		value, isValue := term.OperandList[1].(*ValueOperand)
+		if !ok || !isValue {
+			return "", nil, false
+		}
+		return field, []interface{}{value.Value}, true
+	case OrOperator:
+		f1, v1, ok1 := enumValues(term.OperandList[0])
+		f2, v2, ok2 := enumValues(term.OperandList[1])
+		if ok1 && ok2 && f1 == f2 {
+			return f1, append(v1, v2...), true
+		}
+	}
+	return "", nil, false
+}
+
+// constrain adds the constraints of the rule content op to root
+func (root *exportNode) constrain(op Operand) {
+	term, ok := op.(*TermOperand)
+	if !ok || len(term.ParseMode) > 0 {
+		return
+	}
+	operands := term.OperandList
+	switch OperatorType(term.ParseOperator) {
+	case AndOperator:
+		for _, o := range operands {
+			root.constrain(o)
+		}
+	case RequiredOperator:
+		if field, ok := fieldOf(operands[0], false); ok {
+			root.node(field).required = true
+		}
+	case MatchesOperator:
+		pattern, isValue := operands[0].(*ValueOperand)
+		field, ok := fieldOf(operands[1], false)
+		if !ok || !isValue {
+			return
+		}
+		if s, isString := pattern.Value.(string); isString {
+			n := root.node(field)
+			n.kind = "string"
+			n.patterns = append(n.patterns, s)
+		}
+	case GreaterThanOperator:
+		if len(operands) != 2 {
+			return
+		}
+		if field, ok := fieldOf(operands[0], true); ok {
+			if length, ok := lengthLiteral(operands[1]); ok {
+				n := root.node(field)
+				n.kind = "string"
+				n.minLength = tighterLength(n.minLength, length+1, 1)
+			}
+		} else if field, ok := fieldOf(operands[0], false); ok {
+			if v, ok := numberLiteral(operands[1]); ok {
+				n := root.node(field)
+				n.kind = "number"
+				n.exclusiveMinimum = tighterBound(n.exclusiveMinimum, v, 1)
+			}
+		}
+	case BetweenOperator:
+		if field, ok := fieldOf(operands[0], true); ok {
+			low, ok1 := lengthLiteral(operands[1])
+			high, ok2 := lengthLiteral(operands[2])
+			if ok1 && ok2 {
+				n := root.node(field)
+				n.kind = "string"
+				n.minLength = tighterLength(n.minLength, low, 1)
+				n.maxLength = tighterLength(n.maxLength, high, -1)
+			}
+		} else if field, ok := fieldOf(operands[0], false); ok {
+			low, ok1 := numberLiteral(operands[1])
+			high, ok2 := numberLiteral(operands[2])
+			if ok1 && ok2 {
+				n := root.node(field)
+				n.kind = "number"
+				n.minimum = tighterBound(n.minimum, low, 1)
+				n.maximum = tighterBound(n.maximum, high, -1)
+			}
+		}
+	case EqualToOperator, OrOperator:
+		if field, values, ok := enumValues(op); ok {
+			n := root.node(field)
+			if n.enum == nil {
+				n.enum = values
+			}
+			if len(n.kind) == 0 {
+				n.kind = literalKind(values)
+			}
+		}
+	}
+}
+
+// literalKind returns the kind of the values when they have the same one
+func literalKind(values []interface{}) string {
+	kind := ""
+	for i, v := range values {
+		k := ""
+		switch literalType(v) {
+		case TypeString:
+			k = "string"
+		case TypeNumber:
+			k = "number"
+		}
+		if i > 0 && k != kind {
+			return ""
+		}
+		kind = k
+	}
+	return kind
+}
+
+// tighterLength is tighterBound of the lengths
+func tighterLength(current *int64, v int64, sign int) *int64 {
+	if current == nil || (sign > 0 && v > *current) || (sign < 0 && v < *current) {
+		return &v
+	}
+	return current
+}
+
+// exportRules builds the constraints of the active rules in ruleset
+func exportRules(ruleset string) *exportNode {
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	entries := []*RuleEntry{}
+	for _, rules := range AllRegisteredRules {
+		for _, entry := range rules {
+			if entry.applies(ruleset) && entry.Field != DocumentField && !isPatchField(entry.Field) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	root := &exportNode{}
+	for _, entry := range entries {
+		root.constrain(entry.Rule)
+		n := root.node(entry.Field)
+		if entry.Required {
+			n.required = true
+		}
+		n.descriptions = append(n.descriptions, entry.Name+": "+describeOperand(entry.Rule, entry.Field))
+	}
+	return root
+}
+
+// jsonSchema returns the JSON Schema of the node
+func (n *exportNode) jsonSchema() map[string]interface{} {
+	schema := map[string]interface{}{}
+	if len(n.descriptions) > 0 {
+		schema["description"] = strings.Join(n.descriptions, "; ")
+	}
+	switch {
+	case n.properties != nil:
+		schema["type"] = "object"
+		properties := map[string]interface{}{}
+		required := []string{}
+		for name, child := range n.properties {
+			properties[name] = child.jsonSchema()
+			if child.required {
+				required = append(required, name)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+	case n.items != nil:
+		schema["type"] = "array"
+		schema["items"] = n.items.jsonSchema()
+	case len(n.kind) > 0:
+		schema["type"] = n.kind
+	}
+	if len(n.patterns) > 0 {
+		schema["pattern"] = n.patterns[0]
+		if len(n.patterns) > 1 {
+			all := []interface{}{}
+			for _, p := range n.patterns[1:] {
+				all = append(all, map[string]interface{}{"pattern": p})
+			}
+			schema["allOf"] = all
+		}
+	}
+	for key, v := range map[string]interface{}{"minimum": n.minimum, "maximum": n.maximum, "exclusiveMinimum": n.exclusiveMinimum} {
+		if v != nil {
+			schema[key] = v
+		}
+	}
+	if n.minLength != nil {
+		schema["minLength"] = *n.minLength
+	}
+	if n.maxLength != nil {
+		schema["maxLength"] = *n.maxLength
+	}
+	if n.enum != nil {
+		schema["enum"] = n.enum
+	}
+	return schema
+}
+
+// exportTitle is the title of the exported ruleset
+func exportTitle(ruleset string) string {
+	if len(ruleset) == 0 {
+		return "validation"
+	}
+	return "validation " + ruleset
+}
+
+// ExportRules writes the active rules in ruleset, "" is the common rules,
+// in the format to w
+func ExportRules(format string, ruleset string, w io.Writer) error {
+	if err := CheckRuleset(ruleset); err != nil {
+		return err
+	}
+	root := exportRules(ruleset)
+	if root.properties == nil {
+		root.properties = map[string]*exportNode{}
+	}
+	var doc interface{}
+	switch format {
+	case ExportJSONSchema:
+		schema := root.jsonSchema()
+		schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+		schema["title"] = exportTitle(ruleset)
+		doc = schema
+	case ExportOpenAPI:
+		path := "/api/validation"
+		if len(ruleset) > 0 {
+			path += "?ruleset=" + ruleset
+		}
+		doc = map[string]interface{}{
+			"openapi": "3.1.0",
+			"info":    map[string]interface{}{"title": exportTitle(ruleset), "version": BuildVersion},
+			"paths": map[string]interface{}{path: map[string]interface{}{"post": map[string]interface{}{
+				"requestBody": map[string]interface{}{"required": true, "content": map[string]interface{}{
+					ContentTypeJSON: map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Input"}}}},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{"description": "the validation result"},
+					"400": map[string]interface{}{"description": "the input is invalid"}},
+			}}},
+			"components": map[string]interface{}{"schemas": map[string]interface{}{"Input": root.jsonSchema()}},
+		}
+	case ExportProto:
+		_, err := io.WriteString(w, protoFile(root, ruleset))
+		return err
+	default:
+		return fmt.Errorf("export: unknown format, %s", format)
+	}
+	data, err := marshalCanonical(doc, "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// protoName converts a name into a protobuf message name, e.g. "home_address"
+// is "HomeAddress"
+func protoName(name string) string {
+	out := ""
+	for _, part := range protoNameSeparator.Split(name, -1) {
+		if len(part) > 0 {
+			out += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	if len(out) == 0 || (out[0] >= '0' && out[0] <= '9') {
+		out = "F" + out
+	}
+	return out
+}
+
+// protoFieldName converts a member name into a protobuf field name
+func protoFieldName(name string) string {
+	out := protoFieldInvalid.ReplaceAllString(name, "_")
+	if len(out) == 0 || (out[0] >= '0' && out[0] <= '9') {
+		out = "f_" + out
+	}
+	return out
+}
+
+// protoLiteral formats a value in the protobuf text format
+func protoLiteral(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return strconv.Quote(value)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// protoFile returns the .proto file of the root message
+func protoFile(root *exportNode, ruleset string) string {
+	var messages strings.Builder
+	name := protoName(exportTitle(ruleset)) + "Input"
+	constrained := writeProtoMessage(&messages, "validation."+name, name, root, "")
+	var b strings.Builder
+	b.WriteString("// generated by validation export -format=proto from the rules of " + exportTitle(ruleset) + "\n")
+	b.WriteString("syntax = \"proto3\";\n\npackage validation;\n\n")
+	if constrained {
+		b.WriteString("import \"buf/validate/validate.proto\";\n\n")
+	}
+	b.WriteString(messages.String())
+	return b.String()
+}
+
+// writeProtoMessage writes the message of the object node, fullName is
+// its name with the package and the enclosing messages, its nested
+// messages inside, and reports any field is constrained
+func writeProtoMessage(b *strings.Builder, fullName string, name string, n *exportNode, indent string) bool {
+	constrained := false
+	b.WriteString(indent + "message " + name + " {\n")
+	names := []string{}
+	for member := range n.properties {
+		names = append(names, member)
+	}
+	sort.Strings(names)
+	numbers, reserved := protoFieldNumbers(fullName, names)
+	if len(reserved) > 0 {
+		list := []string{}
+		for _, number := range reserved {
+			list = append(list, strconv.Itoa(number))
+		}
+		b.WriteString(indent + "  reserved " + strings.Join(list, ", ") + ";\n")
+	}
+	for _, member := range names {
+		child := n.properties[member]
+		for _, d := range child.descriptions {
+			b.WriteString(indent + "  // " + d + "\n")
+		}
+		repeated := ""
+		item := child
+		if child.items != nil && child.properties == nil {
+			repeated = "repeated "
+			item = child.items
+		}
+		fieldType := "string"
+		switch {
+		case item.properties != nil:
+			fieldType = protoName(member)
+			if len(repeated) > 0 {
+				fieldType += "Item"
+			}
+			if writeProtoMessage(b, fullName+"."+fieldType, fieldType, item, indent+"  ") {
+				constrained = true
+			}
+		case item.kind == "number":
+			fieldType = "double"
+		}
+		options := protoOptions(child, item, fieldType)
+		if len(options) > 0 {
+			constrained = true
+		}
+		b.WriteString(fmt.Sprintf("%s  %s%s %s = %d", indent, repeated, fieldType, protoFieldName(member), numbers[member]))
+		if len(options) > 0 {
+			b.WriteString(" [" + strings.Join(options, ", ") + "]")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString(indent + "}\n")
+	return constrained
+}
+
+// protoOptions returns the buf.validate options of the field, the item
+// constraints of a repeated field
+func protoOptions(field *exportNode, item *exportNode, fieldType string) []string {
+	options := []string{}
+	if field.required {
+		options = append(options, "(buf.validate.field).required = true")
+	}
+	rules := []string{}
+	switch fieldType {
+	case "string":
+		if item.minLength != nil {
+			rules = append(rules, fmt.Sprintf("min_len: %d", *item.minLength))
+		}
+		if item.maxLength != nil {
+			rules = append(rules, fmt.Sprintf("max_len: %d", *item.maxLength))
+		}
+		if len(item.patterns) > 0 {
+			// protovalidate takes one pattern, the others are in the comments
+			rules = append(rules, "pattern: "+strconv.Quote(item.patterns[0]))
+		}
+	case "double":
+		for _, bound := range []struct {
+			key string
+			v   interface{}
+		}{{"gte", item.minimum}, {"lte", item.maximum}, {"gt", item.exclusiveMinimum}} {
+			if bound.v != nil {
+				rules = append(rules, bound.key+": "+protoLiteral(bound.v))
+			}
+		}
+	default:
+		return options
+	}
+	if item.enum != nil {
+		values := []string{}
+		for _, v := range item.enum {
+			values = append(values, protoLiteral(v))
+		}
+		rules = append(rules, "in: ["+strings.Join(values, ", ")+"]")
+	}
+	if len(rules) == 0 {
+		return options
+	}
+	rule := "(buf.validate.field)." + fieldType + " = {" + strings.Join(rules, ", ") + "}"
+	if item != field {
+		rule = "(buf.validate.field).repeated.items." + fieldType + " = {" + strings.Join(rules, ", ") + "}"
+	}
+	return append(options, rule)
+}
@@ -0,0 +1,104 @@
+package rule
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportRules(t *testing.T) {
+	rules := []string{
+		`{"name": "export_test_code", "required": true,
+		  "rule": {"operator": "AND", "operands": [
+			{"operator": "MATCHES", "operands": [{"value": "^[A-Z]+$"}, {"field": "export_test.code"}]},
+			{"operator": "BETWEEN", "operands": [{"operator": "LENGTH", "operands": [{"field": "export_test.code"}]}, {"value": 2}, {"value": "8"}]}]}}`,
+		`{"name": "export_test_age",
+		  "rule": {"operator": "BETWEEN", "operands": [{"field": "export_test.items[*].age"}, {"value": 18}, {"value": 120}]}}`,
+		`{"name": "export_test_plan",
+		  "rule": {"operator": "OR", "operands": [
+			{"operator": "EQUAL_TO", "operands": [{"field": "export_test.plan"}, {"value": "free"}]},
+			{"operator": "EQUAL_TO", "operands": [{"field": "export_test.plan"}, {"value": "pro"}]}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	var out strings.Builder
+	if err := ExportRules(ExportJSONSchema, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(out.String()), &schema); err != nil {
+		t.Fatal(err)
+	}
+	object := schema["properties"].(map[string]interface{})["export_test"].(map[string]interface{})
+	properties := object["properties"].(map[string]interface{})
+	code := properties["code"].(map[string]interface{})
+	if code["pattern"] != "^[A-Z]+$" || code["minLength"] != 2.0 || code["maxLength"] != 8.0 {
+		t.Errorf("expected the code pattern and length, got %v", code)
+	}
+	if !reflect.DeepEqual(object["required"], []interface{}{"code"}) {
+		t.Errorf("expected the code required, got %v", object["required"])
+	}
+	age := properties["items"].(map[string]interface{})["items"].(map[string]interface{})["properties"].(map[string]interface{})["age"].(map[string]interface{})
+	if age["type"] != "number" || age["minimum"] != 18.0 || age["maximum"] != 120.0 {
+		t.Errorf("expected the age range of the items, got %v", age)
+	}
+	if plan := properties["plan"].(map[string]interface{}); !reflect.DeepEqual(plan["enum"], []interface{}{"free", "pro"}) {
+		t.Errorf("expected the plan enumeration, got %v", plan)
+	}
+
+	defer func(numbers map[string]int) { ProtoFieldNumbers = numbers }(ProtoFieldNumbers)
+	ProtoFieldNumbers = map[string]int{}
+	out.Reset()
+	if err := ExportRules(ExportProto, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`string code = 1 [(buf.validate.field).required = true, (buf.validate.field).string = {min_len: 2, max_len: 8, pattern: "^[A-Z]+$"}];`,
+		`repeated ItemsItem items = 2;`,
+		`double age = 1 [(buf.validate.field).double = {gte: 18, lte: 120}];`,
+		`string plan = 3 [(buf.validate.field).string = {in: ["free", "pro"]}];`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %s in the proto file, got\n%s", want, out.String())
+		}
+	}
+
+	// the kept numbers, a new field gets the next one, and a removed one
+	// is reserved
+	path := filepath.Join(t.TempDir(), "proto-fields.json")
+	if err := os.WriteFile(path, []byte(`{"validation.ValidationInput.ExportTest.plan": 1, "validation.ValidationInput.ExportTest.gone": 2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadProtoFieldNumbers(path); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := ExportRules(ExportProto, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"reserved 2;", "string code = 3 [", "repeated ItemsItem items = 4;", "string plan = 1 ["} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %s in the proto file, got\n%s", want, out.String())
+		}
+	}
+	if err := SaveProtoFieldNumbers(path); err != nil {
+		t.Fatal(err)
+	}
+	ProtoFieldNumbers = nil
+	if err := LoadProtoFieldNumbers(path); err != nil || ProtoFieldNumbers["validation.ValidationInput.ExportTest.code"] != 3 {
+		t.Errorf("expected the saved numbers, got %v %v", ProtoFieldNumbers, err)
+	}
+
+	if err := ExportRules("xml", "", &out); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+}
@@ -0,0 +1,108 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeGoValue = "application/x-go-value"
+)
+
+// Extractor turns an input document into the <fieldName, fieldValue> model
+// consumed by the rule evaluation, e.g. the nested JSON field
+//     { "address": { "zip_code": "90067" } }
+// is extracted as "address.zip_code" => "90067"
+type Extractor interface {
+	Extract(input interface{}) (map[string]interface{}, error)
+}
+
+// ExtractorFunc adapts an ordinary function to the Extractor interface
+type ExtractorFunc func(input interface{}) (map[string]interface{}, error)
+
+func (fn ExtractorFunc) Extract(input interface{}) (map[string]interface{}, error) {
+	return fn(input)
+}
+
+// all registered extractors by content type, contentType => Extractor
+var registeredExtractors = map[string]Extractor{}
+var extractorLock = sync.RWMutex{}
+
+func init() {
+	RegisterExtractor(ContentTypeJSON, ExtractorFunc(extractJSON))
+	RegisterExtractor(ContentTypeGoValue, ExtractorFunc(extractGoValue))
+}
+
+// RegisterExtractor registers the Extractor for the given content type, the
+// content type parameters like "; charset=utf-8" are ignored.
+// A registered content type is replaced by the later registration.
+func RegisterExtractor(contentType string, e Extractor) {
+	extractorLock.Lock()
+	defer extractorLock.Unlock()
+	registeredExtractors[normalizeContentType(contentType)] = e
+}
+
+// GetExtractor looks up the registered Extractor for the given content type
+func GetExtractor(contentType string) (Extractor, error) {
+	extractorLock.RLock()
+	defer extractorLock.RUnlock()
+	if e, ok := registeredExtractors[normalizeContentType(contentType)]; ok {
+		return e, nil
+	}
+	return nil, fmt.Errorf("extractor: unsupported content type, %s", contentType)
+}
+
+func normalizeContentType(contentType string) string {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// extractJSON accepts either a decoded JSON object or the raw JSON bytes
+func extractJSON(input interface{}) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	switch v := input.(type) {
+	case map[string]interface{}:
+		data = v
+	case []byte:
+		if err := decodeJSONDocument(v, &data); err != nil {
+			return nil, err
+		}
+	case string:
+		if err := decodeJSONDocument([]byte(v), &data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("extractor: unsupported JSON input type, %T", input)
+	}
+
+	fields := make(map[string]interface{})
+	if err := parseInputJSON(fields, "", data); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// decodeJSONDocument decodes the JSON document with the numbers as
+// json.Number, so an integer keeps its exact value
+func decodeJSONDocument(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// extractGoValue accepts a Go struct (or pointer to struct), or a map.
+// The value is re-encoded by encoding/json, so the field names follow
+// the `json:"..."` struct tags, like the generated protobuf messages.
+func extractGoValue(input interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	return extractJSON(data)
+}
@@ -0,0 +1,48 @@
+package rule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	type address struct {
+		ZipCode string `json:"zip_code"`
+	}
+	type user struct {
+		Name    string   `json:"name"`
+		Address *address `json:"address"`
+	}
+	expected := map[string]interface{}{"name": "alice", "address.zip_code": "90067"}
+
+	extractor, err := GetExtractor("Application/JSON; charset=utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields, err := extractor.Extract(`{"name": "alice", "address": {"zip_code": "90067"}}`); err != nil || !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the JSON fields %v, got %v %v", expected, fields, err)
+	}
+	extractor, _ = GetExtractor(ContentTypeGoValue)
+	if fields, err := extractor.Extract(&user{"alice", &address{"90067"}}); err != nil || !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the struct fields %v, got %v %v", expected, fields, err)
+	}
+
+	if _, err := GetExtractor("application/x-custom"); err == nil {
+		t.Error("expected an unsupported content type rejected")
+	}
+	RegisterExtractor("application/x-custom", ExtractorFunc(func(input interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"raw": input}, nil
+	}))
+	defer func() {
+		extractorLock.Lock()
+		delete(registeredExtractors, "application/x-custom")
+		extractorLock.Unlock()
+	}()
+	extractor, err = GetExtractor("application/x-custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields, err := extractor.Extract("a=1"); err != nil || fields["raw"] != "a=1" {
+		t.Errorf("expected the custom extractor, got %v %v", fields, err)
+	}
+}
@@ -0,0 +1,201 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// A form field is validated alone, e.g. on blur,
+//   POST /api/validation/field?ruleset=<ruleset>
+//   { "field": "email", "value": "a@b" }
+// only the rules of the field, and the wildcard rules matching its path,
+// are evaluated, and the outcome of each rule is returned.  A rule reading
+// other fields of the document can't be decided by the field alone, it is
+// "skipped".  The field check is an isolated evaluation, it isn't counted
+// in the rule statistics, and UNIQUE_IN_SCOPE doesn't record the value.
+
+// the outcome of a rule reading other fields
+const FieldRuleSkipped = "skipped"
+
+// FieldRequest is the field and its value, the value of an object or an
+// array field is walked like in a document
+type FieldRequest struct {
+	Field string      `json:"field"`
+	Value interface{} `json:"value"`
+}
+
+// FieldRuleResult is the outcome of a rule on the field, Result is
+// "success", "failure", "error" or "skipped"
+type FieldRuleResult struct {
+	Rule     string       `json:"rule"`
+	Field    string       `json:"field"`
+	Result   string       `json:"result"`
+	Code     string       `json:"code,omitempty"`
+	Message  *RuleMessage `json:"message,omitempty"`
+	ErrorMsg string       `json:"error-message,omitempty"`
+}
+
+// FieldResponseMsg is the outcome of the field, Result is "error" when a
+// rule can't be evaluated, "failure" when a rule fails, and "warning" when
+// the field has no rule
+type FieldResponseMsg struct {
+	Result string            `json:"result"`
+	Field  string            `json:"field"`
+	Rules  []FieldRuleResult `json:"rules"`
+}
+
+// ValidateField evaluates the rules of the field in ruleset on its value
+func ValidateField(req *FieldRequest, ruleset string, tags TagFilter, locales []string) (*FieldResponseMsg, error) {
+	if len(req.Field) == 0 {
+		return nil, fmt.Errorf("field validation: field is required")
+	}
+	inputFields := map[string]interface{}{}
+	if err := parseInputJSONValue(inputFields, req.Field, req.Value); err != nil {
+		return nil, err
+	}
+
+	RegRuleLock.RLock()
+	reg := sharedRegistry()
+	reg.tags, reg.isolated = tags, true
+	contexts, _ := reg.newEvalContexts(inputFields, ruleset)
+	// the rules reading other fields, by rule name
+	skipped := map[string]bool{}
+	for _, ctx := range contexts {
+		key := ctx.Field
+		if len(ctx.Pattern) > 0 {
+			key = ctx.Pattern
+		}
+		if entry := reg.rules[key][ctx.RuleName]; entry != nil && readsOtherFields(entry) {
+			skipped[ctx.RuleName] = true
+		}
+	}
+	RegRuleLock.RUnlock()
+
+	res := &FieldResponseMsg{Result: ValidationStatusSucc, Field: req.Field, Rules: []FieldRuleResult{}}
+	errored := false
+	for i := range contexts {
+		ctx := &contexts[i]
+		if ctx.Field == DocumentField {
+			// the document rules read the whole document
+			continue
+		}
+		outcome := FieldRuleResult{Rule: ctx.RuleName, Field: ctx.Field}
+		if skipped[ctx.RuleName] {
+			outcome.Result = FieldRuleSkipped
+			res.Rules = append(res.Rules, outcome)
+			continue
+		}
+		pass, err := evaluateFieldRule(ctx)
+		switch {
+		case err != nil:
+			outcome.Result, outcome.ErrorMsg = ValidationStatusError, err.Error()
+			errored = true
+		case pass || !ctx.enforced():
+			outcome.Result = ValidationStatusSucc
+		default:
+			outcome.Result, outcome.Code = ValidationStatusFail, ctx.code
+			if tmpl := Messages.localize(ctx.RuleName, ctx.message, locales); tmpl != nil {
+				rendered := renderRuleMessage(tmpl, ctx.RuleName, ctx.Field, ctx.FieldValue)
+				rendered.Code = ctx.code
+				outcome.Message = &rendered
+			}
+			res.Result = ValidationStatusFail
+		}
+		res.Rules = append(res.Rules, outcome)
+	}
+	if errored {
+		// the field isn't decided, whatever the other rules
+		res.Result = ValidationStatusError
+	} else if len(res.Rules) == 0 {
+		res.Result = ValidationStatusWarn
+	}
+	sort.SliceStable(res.Rules, func(i, j int) bool {
+		if res.Rules[i].Field != res.Rules[j].Field {
+			return res.Rules[i].Field < res.Rules[j].Field
+		}
+		return res.Rules[i].Rule < res.Rules[j].Rule
+	})
+	return res, nil
+}
+
+// readsOtherFields reports the rule reads a field other than its primary
+// one
+func readsOtherFields(entry *RuleEntry) bool {
+	for _, field := range entry.Fields {
+		if field != entry.Field {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateFieldRule evaluates the rule of ctx without counting it, like an
+// isolated validation
+func evaluateFieldRule(ctx *FieldEvalContext) (bool, error) {
+	if res, ok := ctx.nullPolicyResult(); ok {
+		return res, nil
+	}
+	res, err := ctx.Rule.Evaluate(ctx)
+	if err == EvalFieldMissingError {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	pass, ok := res.(bool)
+	if !ok {
+		return false, EvalResultTypeError
+	}
+	return pass, nil
+}
+
+// POST /api/validation/field?ruleset=<ruleset>&tags=<tag,...> service
+// implementation, the outcome of each rule of the field on its value
+func ValidateFieldData(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept-Language")
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	defer r.Body.Close()
+
+	writeError := func(status int, err error) {
+		w.WriteHeader(status)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+	}
+	ruleset := requestRuleset(r)
+	if err := CheckRuleset(ruleset); err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	tags, err := ParseTagFilter(r.URL.Query())
+	if err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	req := FieldRequest{}
+	if err := decoder.Decode(&req); err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	res, err := ValidateField(&req, ruleset, tags, parseAcceptLanguage(r.Header.Get("Accept-Language")))
+	if err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	switch res.Result {
+	case ValidationStatusError:
+		// a rule evaluation error, like the internal error of POST /api/validation
+		w.WriteHeader(http.StatusInternalServerError)
+	case ValidationStatusFail:
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,65 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateField(t *testing.T) {
+	nodes := []RuleNode{}
+	json.Unmarshal([]byte(`[{"name": "field_test_email", "error-code": "E_EMAIL", "message": "{{.Field}} is not an email",
+		"rule": {"operator": "MATCHES", "operands": [{"value": "^[^@]+@[^@]+\\.[a-z]+$"}, {"field": "field_test.email"}]}},
+		{"name": "field_test_confirm", "rule": {"operator": "EQUAL_TO", "operands": [{"field": "field_test.email"}, {"field": "field_test.confirm"}]}},
+		{"name": "field_test_age", "rule": {"operator": "GREATER_THAN", "operands": [{"field": "field_test.age"}, {"value": 17}]}},
+		{"name": "field_test_tag", "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "field_test.tags[*]"}]}, {"value": "1"}]}}]`), &nodes)
+	entries := []*RuleEntry{}
+	for i := range nodes {
+		entries = append(entries, registerTestRule(t, &nodes[i]))
+	}
+	validate := func(body string) (int, FieldResponseMsg) {
+		w := httptest.NewRecorder()
+		ValidateFieldData(w, httptest.NewRequest("POST", "/api/validation/field", strings.NewReader(body)))
+		res := FieldResponseMsg{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+	code, res := validate(`{"field": "field_test.email", "value": "a@b"}`)
+	if code != http.StatusBadRequest || res.Result != ValidationStatusFail || len(res.Rules) != 2 {
+		t.Fatalf("expected a failure, got %d %+v", code, res)
+	}
+	if r := res.Rules[0]; r.Rule != "field_test_confirm" || r.Result != FieldRuleSkipped {
+		t.Errorf("expected the cross-field rule to be skipped, got %+v", r)
+	}
+	if r := res.Rules[1]; r.Rule != "field_test_email" || r.Result != ValidationStatusFail || r.Code != "E_EMAIL" ||
+		r.Message == nil || r.Message.Message != "field_test.email is not an email" {
+		t.Errorf("expected the email failure, got %+v", r)
+	}
+	if code, res := validate(`{"field": "field_test.email", "value": "a@b.io"}`); code != http.StatusOK || res.Result != ValidationStatusSucc {
+		t.Errorf("expected a pass, got %d %+v", code, res)
+	}
+	code, res = validate(`{"field": "field_test.tags", "value": ["ok", "x"]}`)
+	if code != http.StatusBadRequest || len(res.Rules) != 2 || res.Rules[0].Field != "field_test.tags[0]" || res.Rules[0].Result != ValidationStatusSucc ||
+		res.Rules[1].Field != "field_test.tags[1]" || res.Rules[1].Result != ValidationStatusFail {
+		t.Errorf("expected the wildcard outcomes, got %d %+v", code, res)
+	}
+	if code, res := validate(`{"field": "field_test.city", "value": "Oslo"}`); code != http.StatusOK || res.Result != ValidationStatusWarn {
+		t.Errorf("expected no rule, got %d %+v", code, res)
+	}
+	code, res = validate(`{"field": "field_test.age", "value": "abc"}`)
+	if code != http.StatusInternalServerError || res.Result != ValidationStatusError || len(res.Rules) != 1 ||
+		res.Rules[0].Result != ValidationStatusError || len(res.Rules[0].ErrorMsg) == 0 {
+		t.Errorf("expected the evaluation error, got %d %+v", code, res)
+	}
+	if code, _ := validate(`{"value": "Oslo"}`); code != http.StatusBadRequest {
+		t.Errorf("expected a missing field, got %d", code)
+	}
+	ruleCounterLock.Lock()
+	_, counted := ruleCounters[entries[0].ID]
+	ruleCounterLock.Unlock()
+	if counted {
+		t.Errorf("expected the field check not to be counted")
+	}
+}
@@ -0,0 +1,521 @@
+package rule
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The canonical form of a rule is the rules.json layout with the aliases
+// resolved, the macros expanded, and the operands of the commutative
+// operators sorted, so two structurally identical rules are formatted
+// to the same text and have the same fingerprint.
+
+// commutative operators, the operand order doesn't change the result
+var commutativeOperators = map[OperatorType]int{
+	OrOperator:      2,
+	AndOperator:     2,
+	EqualToOperator: 2, // without epsilon
+}
+
+// canonical JSON blocks, in the rules.json key order
+type canonicalNode struct {
+	ID             string        `json:"id,omitempty"`
+	Name           string        `json:"name"`
+	Namespace      string        `json:"namespace,omitempty"`
+	PrimaryField   string        `json:"primary-field,omitempty"`
+	Rulesets       []string      `json:"rulesets,omitempty"`
+	Tags           []string      `json:"tags,omitempty"`
+	Required       bool          `json:"required,omitempty"`
+	Priority       int           `json:"priority,omitempty"`
+	Severity       string        `json:"severity,omitempty"`
+	Enabled        *bool         `json:"enabled,omitempty"`
+	ValidFrom      *time.Time    `json:"valid-from,omitempty"`
+	ValidUntil     *time.Time    `json:"valid-until,omitempty"`
+	OnExpiry       string        `json:"on-expiry,omitempty"`
+	NullPolicy     string        `json:"null-policy,omitempty"`
+	MissingPolicy  string        `json:"missing-policy,omitempty"`
+	Message        string        `json:"message,omitempty"`
+	ErrorCode      string        `json:"error-code,omitempty"`
+	Description    string        `json:"description,omitempty"`
+	Owner          string        `json:"owner,omitempty"`
+	Documentation  string        `json:"documentation,omitempty"`
+	Enforcement    *float64      `json:"enforcement,omitempty"`
+	EnforcementKey string        `json:"enforcement-key,omitempty"`
+	State          string        `json:"state,omitempty"`
+	Environments   []string      `json:"environments,omitempty"`
+	Examples       *RuleExamples `json:"examples,omitempty"`
+	Expression     string        `json:"expression,omitempty"`
+	Rule           interface{}   `json:"rule,omitempty"`
+}
+
+type canonicalTerm struct {
+	Operator string        `json:"operator"`
+	Mode     string        `json:"mode,omitempty"`
+	Operands []interface{} `json:"operands"`
+}
+
+type canonicalField struct {
+	Field string `json:"field"`
+}
+
+type canonicalValue struct {
+	Value interface{} `json:"value"`
+}
+
+// marshalCanonical encodes v without escaping "<", ">" and "&", which
+// are common in the regex patterns
+func marshalCanonical(v interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// canonicalOperand converts a constructed operand tree into the canonical JSON blocks
+func canonicalOperand(op Operand) (interface{}, error) {
+	switch v := op.(type) {
+	case *FieldOperand:
+		return canonicalField{v.Name}, nil
+	case *ValueOperand:
+		return canonicalValue{v.Value}, nil
+	case *TermOperand:
+		term := canonicalTerm{Operator: v.ParseOperator, Mode: v.ParseMode}
+		keys := []string{}
+		for _, o := range v.OperandList {
+			c, err := canonicalOperand(o)
+			if err != nil {
+				return nil, err
+			}
+			key, err := marshalCanonical(c, "")
+			if err != nil {
+				return nil, err
+			}
+			term.Operands = append(term.Operands, c)
+			keys = append(keys, string(key))
+		}
+		if n, ok := commutativeOperators[OperatorType(v.ParseOperator)]; ok && n == len(keys) {
+			sort.Sort(operandsByKey{term.Operands, keys})
+		}
+		return term, nil
+	}
+	return nil, fmt.Errorf("unknown rule operand, %v", op)
+}
+
+// operandsByKey sorts the canonical operands by their compact JSON
+type operandsByKey struct {
+	operands []interface{}
+	keys     []string
+}
+
+func (s operandsByKey) Len() int           { return len(s.keys) }
+func (s operandsByKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s operandsByKey) Swap(i, j int) {
+	s.operands[i], s.operands[j] = s.operands[j], s.operands[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// ruleFingerprint returns the SHA-256 of the canonical rule content,
+// the same for the structurally identical rules regardless of the names
+func ruleFingerprint(op Operand) (string, error) {
+	c, err := canonicalOperand(op)
+	if err != nil {
+		return "", err
+	}
+	data, err := marshalCanonical(c, "")
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ruleExpression formats the operand tree in the readable functional form,
+//
+//	OR(EQUAL_TO(LENGTH(password), "0"), GREATER_THAN(LENGTH(password), "8"))
+//
+// The fields are the bare names, the values are the JSON literals, and
+// the operator mode follows the operator, e.g. EQUAL_TO:decimal(...).
+func ruleExpression(op Operand) (string, error) {
+	c, err := canonicalOperand(op)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := writeExpression(&buf, c); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func writeExpression(buf *bytes.Buffer, c interface{}) error {
+	switch v := c.(type) {
+	case canonicalField:
+		buf.WriteString(v.Field)
+	case canonicalValue:
+		data, err := marshalCanonical(v.Value, "")
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	case canonicalTerm:
+		buf.WriteString(v.Operator)
+		if len(v.Mode) > 0 {
+			buf.WriteString(":" + v.Mode)
+		}
+		buf.WriteString("(")
+		for i, o := range v.Operands {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeExpression(buf, o); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(")")
+	}
+	return nil
+}
+
+// FormattedRule is a rule definition in the canonical form, DSL is its
+// infix "expression", "" when the rule has none
+type FormattedRule struct {
+	Name        string `json:"name"`
+	Canonical   string `json:"canonical"`
+	Expression  string `json:"expression"`
+	DSL         string `json:"dsl,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// FormatRuleNode parses node without registering it, and formats it in
+// the canonical form
+func FormatRuleNode(node *RuleNode) (*FormattedRule, error) {
+	content, primaryField, err := resolveAddressing(node)
+	if err != nil {
+		return nil, err
+	}
+	op, err := ConstructOperandListHelper(&content, map[string]int{})
+	if err != nil {
+		return nil, err
+	}
+	c, err := canonicalOperand(op)
+	if err != nil {
+		return nil, err
+	}
+	rulesets, err := normalizeRulesets(node.Rulesets)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := normalizeNamespace(node.Namespace); err != nil {
+		return nil, err
+	}
+	tags, err := normalizeTags(node.Tags)
+	if err != nil {
+		return nil, err
+	}
+	severity, err := normalizeSeverity(node.Severity)
+	if err != nil {
+		return nil, err
+	}
+	if severity == SeverityError {
+		// the default is omitted
+		severity = ""
+	}
+	enabled := node.Enabled
+	if enabled != nil && *enabled {
+		// the default is omitted
+		enabled = nil
+	}
+	if err := checkActivationWindow(node.Name, node.ValidFrom, node.ValidUntil); err != nil {
+		return nil, err
+	}
+	onExpiry, err := normalizeOnExpiry(node.OnExpiry)
+	if err != nil {
+		return nil, err
+	}
+	if onExpiry == OnExpiryKeep {
+		// the default is omitted
+		onExpiry = ""
+	}
+	if _, err := newRuleMetadata(node); err != nil {
+		return nil, err
+	}
+	if err := checkErrorCode(node.Name, node.ErrorCode); err != nil {
+		return nil, err
+	}
+	if len(node.NullPolicy) > 0 {
+		if _, err := ParseNullPolicy(node.NullPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if len(node.MissingPolicy) > 0 {
+		if _, err := ParseMissingPolicy(node.MissingPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkEnforcement(node.Name, node.Enforcement); err != nil {
+		return nil, err
+	}
+	enforcement := node.Enforcement
+	if enforcement != nil && *enforcement == 100 {
+		// the default is omitted
+		enforcement = nil
+	}
+	state, err := normalizeRuleState(node.State)
+	if err != nil {
+		return nil, err
+	}
+	if state == RuleStatePublished {
+		// the default is omitted
+		state = ""
+	}
+	environments, err := normalizeEnvironments(node.Environments)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := marshalCanonical(canonicalNode{node.ID, node.Name, node.Namespace, primaryField, rulesets, tags, node.Required,
+		node.Priority, severity, enabled, utcTime(node.ValidFrom), utcTime(node.ValidUntil), onExpiry, node.NullPolicy, node.MissingPolicy,
+		node.Message, node.ErrorCode, node.Description, node.Owner, node.Documentation, enforcement, node.EnforcementKey, state, environments, node.Examples, "", c}, "  ")
+	if err != nil {
+		return nil, err
+	}
+	expression, err := ruleExpression(op)
+	if err != nil {
+		return nil, err
+	}
+	dsl, err := ruleDSL(op)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := ruleFingerprint(op)
+	if err != nil {
+		return nil, err
+	}
+	return &FormattedRule{node.Name, string(canonical), expression, dsl, fingerprint}, nil
+}
+
+// utcTime returns t in UTC, so an instant has one canonical form
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// FormatRulesFile writes the rules.json file in path in the canonical
+// form to w, the rule order is kept, and the fragment definitions are
+// kept as they are, before the rules
+func FormatRulesFile(path string, w io.Writer) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	entries := []json.RawMessage{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	nodes := []RuleNode{}
+	fragments := []RuleFragment{}
+	blocks := []string{}
+	for _, data := range entries {
+		entry, err := decodeRulesFileEntry(data)
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.fragment != nil:
+			fragments = append(fragments, *entry.fragment)
+			// the fragments are kept first, as they are
+			block, err := canonicalFragmentBlock(entry.fragment)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, "  "+strings.Replace(block, "\n", "\n  ", -1))
+		case entry.normalizer != nil:
+			// the normalizers are kept before the rules as well
+			if err := entry.normalizer.check(); err != nil {
+				return fmt.Errorf("format rules: %s", err.Error())
+			}
+			block, err := marshalCanonical(entry.normalizer, "  ")
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, "  "+strings.Replace(string(block), "\n", "\n  ", -1))
+		default:
+			nodes = append(nodes, *entry.node)
+		}
+	}
+	if err := SetRuleFragments(fragments); err != nil {
+		return fmt.Errorf("format rules: %s", err.Error())
+	}
+	for i := range nodes {
+		formatted, err := FormatRuleNode(&nodes[i])
+		if err != nil {
+			return fmt.Errorf("format rules: rule name, %s, %s", nodes[i].Name, err.Error())
+		}
+		// indent the rule block in the array
+		blocks = append(blocks, "  "+strings.Replace(formatted.Canonical, "\n", "\n  ", -1))
+	}
+	_, err = io.WriteString(w, "[\n"+strings.Join(blocks, ",\n")+"\n]\n")
+	return err
+}
+
+// canonicalEntryNode converts a registered rule back into its rules.json
+// block, with the macros, the fragments and RULE_REF expanded as they are
+// registered.  Caller holds the READ lock.
+func canonicalEntryNode(entry *RuleEntry) (canonicalNode, error) {
+	c, err := canonicalOperand(entry.Rule)
+	if err != nil {
+		return canonicalNode{}, err
+	}
+	node := canonicalNode{ID: entry.ID, Name: entry.Name, Namespace: entry.Namespace, Rulesets: entry.Rulesets, Tags: entry.Tags,
+		Required: entry.Required, Priority: entry.Priority, ValidFrom: utcTime(entry.ValidFrom), ValidUntil: utcTime(entry.ValidUntil),
+		NullPolicy: string(entry.NullPolicy), MissingPolicy: string(entry.MissingPolicy), ErrorCode: entry.ErrorCode,
+		Description: entry.Metadata.Description, Owner: entry.Metadata.Owner, Documentation: entry.Metadata.Documentation,
+		EnforcementKey: entry.EnforcementKey, Environments: entry.Environments, Examples: entry.Examples, Rule: c}
+	if len(entry.Fields) > 1 && entry.Field != DocumentField {
+		// the default primary field is the first one of the rule
+		node.PrimaryField = entry.Field
+	}
+	// the defaults are omitted
+	if entry.Severity != SeverityError {
+		node.Severity = entry.Severity
+	}
+	if entry.Disabled {
+		enabled := false
+		node.Enabled = &enabled
+	}
+	if entry.OnExpiry != OnExpiryKeep {
+		node.OnExpiry = entry.OnExpiry
+	}
+	if entry.Message != nil {
+		node.Message = entry.Message.Root.String()
+	}
+	if entry.Enforcement != nil && *entry.Enforcement != 100 {
+		node.Enforcement = entry.Enforcement
+	}
+	if entry.State != RuleStatePublished {
+		node.State = entry.State
+	}
+	return node, nil
+}
+
+// ExportRulesFile writes the registered rules to w as a rules.json file,
+// the fragment definitions and the normalizers first, then the rules by
+// name, in the canonical form
+func ExportRulesFile(w io.Writer) error {
+	blocks := []string{}
+	fragmentLock.RLock()
+	names := make([]string, 0, len(ruleFragments))
+	for name := range ruleFragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		block, err := canonicalFragmentBlock(ruleFragments[name])
+		if err != nil {
+			fragmentLock.RUnlock()
+			return fmt.Errorf("export rules: fragment, %s, %s", name, err.Error())
+		}
+		blocks = append(blocks, "  "+strings.Replace(block, "\n", "\n  ", -1))
+	}
+	fragmentLock.RUnlock()
+
+	normalizerLock.RLock()
+	for i := range normalizers {
+		block, err := marshalCanonical(&normalizers[i], "  ")
+		if err != nil {
+			normalizerLock.RUnlock()
+			return err
+		}
+		blocks = append(blocks, "  "+strings.Replace(string(block), "\n", "\n  ", -1))
+	}
+	normalizerLock.RUnlock()
+
+	// the snapshot of the registry, the order doesn't matter to the
+	// loader, which registers a referenced rule first
+	RegRuleLock.RLock()
+	entries := make([]*RuleEntry, 0, len(AllRegisteredRuleIDs))
+	for _, entry := range AllRegisteredRuleIDs {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for _, entry := range entries {
+		node, err := canonicalEntryNode(entry)
+		if err != nil {
+			RegRuleLock.RUnlock()
+			return fmt.Errorf("export rules: rule name, %s, %s", entry.Name, err.Error())
+		}
+		// the "expression" of the rule with a DSL form, the tree otherwise
+		if dsl, err := ruleDSL(entry.Rule); err == nil && len(dsl) > 0 {
+			node.Expression, node.Rule = dsl, nil
+		}
+		block, err := marshalCanonical(node, "  ")
+		if err != nil {
+			RegRuleLock.RUnlock()
+			return err
+		}
+		blocks = append(blocks, "  "+strings.Replace(string(block), "\n", "\n  ", -1))
+	}
+	RegRuleLock.RUnlock()
+
+	if len(blocks) == 0 {
+		_, err := io.WriteString(w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(w, "[\n"+strings.Join(blocks, ",\n")+"\n]\n")
+	return err
+}
+
+// GET /admin/rules/export service implementation, the registered rules
+// as a rules.json file
+func GetRulesExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var buf bytes.Buffer
+	if err := ExportRulesFile(&buf); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="rules.json"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// POST /admin/rule/format service implementation, formats a rule
+// definition in the canonical form without registering it
+func FormatRule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	rule := RuleNode{}
+	if err := decoder.Decode(&rule); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	formatted, err := FormatRuleNode(&rule)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(formatted)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,97 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportRulesFile(t *testing.T) {
+	nodes := []RuleNode{}
+	json.Unmarshal([]byte(`[{"id": "export_test_1", "name": "export_test_zip", "tags": ["export_test"], "priority": 2, "enabled": false,
+		"message": "{{.Field}} is invalid", "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "export_test_zip"}]}},
+		{"name": "export_test_range", "primary-field": "export_test_max", "severity": "warning",
+		"rule": {"operator": "GREATER_THAN", "operands": [{"field": "export_test_max"}, {"field": "export_test_min"}]}}]`), &nodes)
+	entries := []*RuleEntry{}
+	for i := range nodes {
+		entries = append(entries, registerTestRule(t, &nodes[i]))
+	}
+
+	w := httptest.NewRecorder()
+	GetRulesExport(w, httptest.NewRequest("GET", "/admin/rules/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	blocks := []json.RawMessage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &blocks); err != nil {
+		t.Fatal(err)
+	}
+	exported := map[string]*RuleNode{}
+	for _, data := range blocks {
+		entry, err := decodeRulesFileEntry(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.node != nil {
+			exported[entry.node.Name] = entry.node
+		}
+	}
+	zip, ok := exported["export_test_zip"]
+	if !ok || zip.ID != "export_test_1" || zip.Enabled == nil || *zip.Enabled || zip.Priority != 2 || zip.Message != "{{.Field}} is invalid" ||
+		len(zip.Tags) != 1 || zip.PrimaryField != "" {
+		t.Errorf("expected the rule attributes, got %+v", zip)
+	}
+	// a rule with a DSL form is exported as its expression
+	if !strings.Contains(w.Body.String(), `"expression": "matches(\"^[0-9]{5}$\", export_test_zip)"`) {
+		t.Errorf("expected the DSL form of the rule, got %s", w.Body.String())
+	}
+	rng, ok := exported["export_test_range"]
+	if !ok || rng.PrimaryField != "export_test_max" || rng.Severity != SeverityWarning {
+		t.Errorf("expected the primary field and the severity, got %+v", rng)
+	}
+	// the exported rules are the registered ones
+	for _, entry := range entries {
+		formatted, err := FormatRuleNode(exported[entry.Name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formatted.Fingerprint != entry.Fingerprint {
+			t.Errorf("expected the fingerprint of %s, got %s", entry.Name, formatted.Fingerprint)
+		}
+	}
+}
+
+func TestFormatRuleNode(t *testing.T) {
+	formatted := []*FormattedRule{}
+	for _, rule := range []string{
+		`{"name": "format_test_a", "rule": {"operator": "OR", "operands": [
+			{"operator": "EQUAL_TO", "operands": [{"operator": "LENGTH", "operands": [{"field": "format_test"}]}, {"value": "0"}]},
+			{"operator": "REGEX_MATCH", "operands": [{"value": "^[a-z]+$"}, {"field": "format_test"}]}]}}`,
+		// the commutative operands swapped, and the alias resolved
+		`{"name": "format_test_b", "rule": {"operator": "OR", "operands": [
+			{"operator": "MATCHES", "operands": [{"value": "^[a-z]+$"}, {"field": "format_test"}]},
+			{"operator": "EQUAL_TO", "operands": [{"value": "0"}, {"operator": "LENGTH", "operands": [{"field": "format_test"}]}]}]}}`,
+	} {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		f, err := FormatRuleNode(&node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted = append(formatted, f)
+	}
+	a, b := formatted[0], formatted[1]
+	if a.Fingerprint != b.Fingerprint || a.Expression != b.Expression {
+		t.Errorf("expected the same canonical rule, got %s %s", a.Expression, b.Expression)
+	}
+	if !strings.Contains(a.Expression, "MATCHES(") || strings.Contains(a.Expression, "REGEX_MATCH") {
+		t.Errorf("expected the alias resolved, got %s", a.Expression)
+	}
+	if strings.Replace(a.Canonical, "format_test_a", "format_test_b", 1) != b.Canonical {
+		t.Errorf("expected the canonical rules to differ by the name only, got %s %s", a.Canonical, b.Canonical)
+	}
+}
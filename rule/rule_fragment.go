@@ -0,0 +1,194 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RuleFragment is a named sub-expression shared by the rules of rules.json,
+// defined in the rule array,
+//   { "fragment": "us_zip_pattern", "body": { "value": "^[0-9]{5}(-[0-9]{4})?$" } }
+// and referenced in a rule body, or in another fragment, by
+//   { "fragment": "us_zip_pattern" }
+// The reference is expanded when the rule is parsed, like a macro without
+// arguments, so the fragments of the file are defined before its rules,
+// wherever they are in the file.
+type RuleFragment struct {
+	Name        string `json:"fragment"`
+	Description string `json:"description,omitempty"`
+	Body        Term   `json:"body"`
+
+	// the body JSON, for the canonical form of the rules file
+	raw json.RawMessage
+}
+
+// FragmentOperand is the fragment reference, parsed from
+//     { "fragment": _fragment_name_ }
+// it never stays in a constructed rule.
+type FragmentOperand struct {
+	Name string `json:"fragment"`
+}
+
+func (*FragmentOperand) GetOperator() *OperatorFn {
+	return nil
+}
+func (*FragmentOperand) GetOperands() []Operand {
+	return nil
+}
+func (f *FragmentOperand) Evaluate(cx EvalContext) (interface{}, error) {
+	return nil, fmt.Errorf("fragment, %s, is not expanded", f.Name)
+}
+
+// the fragments of rules.json, fragmentName => RuleFragment
+var ruleFragments = map[string]*RuleFragment{}
+var fragmentLock = sync.RWMutex{}
+
+// expandFragment constructs the body of the fragment name
+func expandFragment(name string, fieldList map[string]int, args []Operand) (Operand, error) {
+	fragmentLock.RLock()
+	fragment := ruleFragments[name]
+	fragmentLock.RUnlock()
+	if fragment == nil {
+		return nil, fmt.Errorf("fragment, %s, is not defined", name)
+	}
+	return constructOperand(&fragment.Body, fieldList, args)
+}
+
+// fragmentReferences lists the fragments referenced by t
+func fragmentReferences(t *Term) []string {
+	switch v := t.Value.(type) {
+	case FragmentOperand:
+		return []string{v.Name}
+	case TermOperand:
+		refs := []string{}
+		for i := range v.ParseOperands {
+			refs = append(refs, fragmentReferences(&v.ParseOperands[i])...)
+		}
+		return refs
+	}
+	return nil
+}
+
+// SetRuleFragments replaces the fragments.  The names are unique, and a
+// fragment refers to the defined fragments only, without a cycle.
+func SetRuleFragments(fragments []RuleFragment) error {
+	defined := map[string]*RuleFragment{}
+	for i := range fragments {
+		f := &fragments[i]
+		if len(f.Name) == 0 {
+			return fmt.Errorf("fragment: name is missing")
+		}
+		if _, exists := defined[f.Name]; exists {
+			return fmt.Errorf("fragment: name, %s, is duplicated", f.Name)
+		}
+		if f.Body.Value == nil {
+			return fmt.Errorf("fragment: %s, body is missing", f.Name)
+		}
+		defined[f.Name] = f
+	}
+
+	// a fragment is expanded before the fragments it references are done
+	state := map[string]int{} // 1 expanding, 2 done
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("fragment cycle, %s -> %s", strings.Join(path, " -> "), name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, ref := range fragmentReferences(&defined[name].Body) {
+			if _, ok := defined[ref]; !ok {
+				return fmt.Errorf("fragment: %s, refers to the undefined fragment %s", name, ref)
+			}
+			if err := visit(ref, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	names := make([]string, 0, len(defined))
+	for name := range defined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+
+	fragmentLock.Lock()
+	ruleFragments = defined
+	fragmentLock.Unlock()
+	return nil
+}
+
+// fragmentCount is the number of the fragments, for the features
+func fragmentCount() int {
+	fragmentLock.RLock()
+	defer fragmentLock.RUnlock()
+	return len(ruleFragments)
+}
+
+// rulesFileEntry is an item of the rules file array, one of a rule, a
+// fragment definition or a normalizer
+type rulesFileEntry struct {
+	node       *RuleNode
+	fragment   *RuleFragment
+	normalizer *Normalizer
+}
+
+// decodeRulesFileEntry decodes an item of the rules file array
+func decodeRulesFileEntry(data json.RawMessage) (rulesFileEntry, error) {
+	probe := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return rulesFileEntry{}, err
+	}
+	if _, ok := probe["fragment"]; ok {
+		fragment := &RuleFragment{}
+		if err := json.Unmarshal(data, fragment); err != nil {
+			return rulesFileEntry{}, fmt.Errorf("fragment, %s", err.Error())
+		}
+		fragment.raw = probe["body"]
+		return rulesFileEntry{fragment: fragment}, nil
+	}
+	if _, ok := probe["normalize"]; ok {
+		normalizer := &Normalizer{}
+		if err := json.Unmarshal(data, normalizer); err != nil {
+			return rulesFileEntry{}, fmt.Errorf("normalizer, %s", err.Error())
+		}
+		return rulesFileEntry{normalizer: normalizer}, nil
+	}
+	node := &RuleNode{}
+	if err := json.Unmarshal(data, node); err != nil {
+		return rulesFileEntry{}, err
+	}
+	return rulesFileEntry{node: node}, nil
+}
+
+// canonical fragment definition, in the rules.json key order
+type canonicalFragment struct {
+	Name        string      `json:"fragment"`
+	Description string      `json:"description,omitempty"`
+	Body        interface{} `json:"body"`
+}
+
+// canonicalFragmentBlock formats the fragment definition as it is, the
+// body isn't expanded
+func canonicalFragmentBlock(f *RuleFragment) (string, error) {
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(f.raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return "", err
+	}
+	data, err := marshalCanonical(canonicalFragment{f.Name, f.Description, body}, "  ")
+	return string(data), err
+}
@@ -0,0 +1,71 @@
+package rule
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRuleFragments(t *testing.T) {
+	file := `[
+	{ "name": "fragment_test_zip",
+	  "rule": { "operator": "MATCHES", "operands": [ { "fragment": "fragment_test_zip_pattern" }, { "field": "fragment_test.zip" } ] } },
+	{ "fragment": "fragment_test_zip_pattern", "body": { "fragment": "fragment_test_zip5" } },
+	{ "fragment": "fragment_test_zip5", "description": "the US zip code", "body": { "value": "^[0-9]{5}$" } }
+]`
+	entries := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(file), &entries); err != nil {
+		t.Fatal(err)
+	}
+	nodes := []RuleNode{}
+	fragments := []RuleFragment{}
+	for _, data := range entries {
+		entry, err := decodeRulesFileEntry(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.fragment != nil {
+			fragments = append(fragments, *entry.fragment)
+		} else {
+			nodes = append(nodes, *entry.node)
+		}
+	}
+	defer SetRuleFragments(nil)
+	if err := SetRuleFragments(fragments); err != nil {
+		t.Fatal(err)
+	}
+	registerTestRule(t, &nodes[0])
+	for zip, pass := range map[string]bool{"90067": true, "9006": false} {
+		result, err := ValidateInputJSONByRules("", map[string]interface{}{"fragment_test": map[string]interface{}{"zip": zip}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != pass {
+			t.Errorf("%s: expected %v, got %v", zip, pass, result.flag)
+		}
+	}
+
+	// the formatted file keeps the fragments, and expands them in the rules
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(file), 0644)
+	var out strings.Builder
+	if err := FormatRulesFile(path, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "[\n  {\n    \"fragment\": \"fragment_test_zip_pattern\",") ||
+		!strings.Contains(out.String(), `"value": "^[0-9]{5}$"`) {
+		t.Errorf("expected the fragments first, and the rule expanded, got\n%s", out.String())
+	}
+
+	for _, bad := range [][]RuleFragment{
+		{{Name: "a", Body: Term{FragmentOperand{"b"}}}, {Name: "b", Body: Term{FragmentOperand{"a"}}}},
+		{{Name: "a", Body: Term{FragmentOperand{"undefined"}}}},
+		{{Name: "a", Body: Term{ValueOperand{"x"}}}, {Name: "a", Body: Term{ValueOperand{"y"}}}},
+	} {
+		if err := SetRuleFragments(bad); err == nil {
+			t.Errorf("expected the fragments %+v to fail", bad)
+		}
+	}
+}
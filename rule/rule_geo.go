@@ -0,0 +1,88 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+)
+
+// geoPoint is a coordinate in decimal degrees
+type geoPoint struct {
+	lat, long float64
+}
+
+// toCoordinate parses a latitude or longitude value, string or number,
+// and checks it is in [-limit, limit] degrees
+func toCoordinate(operand interface{}, limit float64) (float64, error) {
+	v, err := toNumericValue(operand)
+	if err != nil {
+		return 0, err
+	}
+	if v.f < -limit || v.f > limit {
+		return 0, fmt.Errorf("rule operator: coordinate out of range, %v", operand)
+	}
+	return v.f, nil
+}
+
+func toLatitude(operand interface{}) (float64, error) {
+	return toCoordinate(operand, 90)
+}
+
+func toLongitude(operand interface{}) (float64, error) {
+	return toCoordinate(operand, 180)
+}
+
+// parseGeoPoint parses a "lat,long" string, e.g. "37.7749,-122.4194"
+func parseGeoPoint(s string) (geoPoint, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return geoPoint{}, fmt.Errorf("rule operator: invalid coordinate, %s", s)
+	}
+	lat, err := toLatitude(parts[0])
+	if err != nil {
+		return geoPoint{}, err
+	}
+	long, err := toLongitude(parts[1])
+	if err != nil {
+		return geoPoint{}, err
+	}
+	return geoPoint{lat, long}, nil
+}
+
+// geoBox is a bounding box by its south-west and north-east corners
+type geoBox struct {
+	sw, ne geoPoint
+}
+
+// toGeoBox converts the operands (minLat, minLong, maxLat, maxLong)
+func toGeoBox(operands []interface{}) (geoBox, error) {
+	var box geoBox
+	var err error
+	if box.sw.lat, err = toLatitude(operands[0]); err != nil {
+		return box, err
+	}
+	if box.sw.long, err = toLongitude(operands[1]); err != nil {
+		return box, err
+	}
+	if box.ne.lat, err = toLatitude(operands[2]); err != nil {
+		return box, err
+	}
+	if box.ne.long, err = toLongitude(operands[3]); err != nil {
+		return box, err
+	}
+	if box.sw.lat > box.ne.lat {
+		return box, fmt.Errorf("rule operator: bounding box min latitude is above max latitude")
+	}
+	return box, nil
+}
+
+// contains checks p is in the box, borders included.  A box with
+// min longitude above max longitude crosses the 180th meridian.
+func (b geoBox) contains(p geoPoint) bool {
+	if p.lat < b.sw.lat || p.lat > b.ne.lat {
+		return false
+	}
+	if b.sw.long <= b.ne.long {
+		return p.long >= b.sw.long && p.long <= b.ne.long
+	}
+	return p.long >= b.sw.long || p.long <= b.ne.long
+}
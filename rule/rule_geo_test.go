@@ -0,0 +1,26 @@
+package rule
+
+import "testing"
+
+func TestGeoBox(t *testing.T) {
+	if _, err := parseGeoPoint("91,0"); err == nil {
+		t.Error("expected a latitude above 90 rejected")
+	}
+	if _, err := toGeoBox([]interface{}{10, 0, 5, 1}); err == nil {
+		t.Error("expected a box with min latitude above max latitude rejected")
+	}
+	// the Fiji box crosses the 180th meridian
+	box, err := toGeoBox([]interface{}{-21, 177, -12, -178})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for point, expected := range map[string]bool{"-17.7,178.0": true, "-17.7,-179.5": true, "-17.7,0": false, "-12,177": true} {
+		p, err := parseGeoPoint(point)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if box.contains(p) != expected {
+			t.Errorf("%s: expected %v", point, expected)
+		}
+	}
+}
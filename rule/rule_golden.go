@@ -0,0 +1,105 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// the golden verdict file extension, the verdict of "signup_ok.json" is
+// in "signup_ok.golden"
+const goldenVerdictExt = ".golden"
+
+// GoldenVerdict is the expected validation verdict of a corpus payload.
+// Ruleset is the validation condition, kept by the update, and the rules
+// are sorted, so the verdict doesn't depend on the evaluation order.
+type GoldenVerdict struct {
+	Ruleset string   `json:"ruleset,omitempty"`
+	Result  string   `json:"result"`
+	Rules   []string `json:"rules,omitempty"`
+}
+
+// goldenVerdictOf validates the payload doc against ruleset, and returns
+// its verdict
+func goldenVerdictOf(ruleset string, doc map[string]interface{}) GoldenVerdict {
+	verdict := GoldenVerdict{Ruleset: ruleset}
+	if err := CheckRuleset(ruleset); err != nil {
+		verdict.Result = ValidationStatusError
+		return verdict
+	}
+	result, err := ValidateInputJSONByRules(ruleset, doc)
+	if err != nil {
+		verdict.Result = ValidationStatusError
+		return verdict
+	}
+	res := newStreamResult(0, result, zeroRulePolicyOf(ruleset))
+	verdict.Result = res.Result
+	if len(res.Rules) > 0 {
+		verdict.Rules = append([]string{}, res.Rules...)
+		sort.Strings(verdict.Rules)
+	}
+	return verdict
+}
+
+// VerifyGoldenCorpus validates each payload, *.json, in dir by the active
+// rules, and compares the verdict with its golden file.  Every changed or
+// missing verdict is reported to w, and counted in the failures.  update
+// rewrites the golden files with the current verdicts instead.
+func VerifyGoldenCorpus(dir string, update bool, w io.Writer) (failures int, err error) {
+	payloads, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(payloads)
+	for _, path := range payloads {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return failures, err
+		}
+		doc := map[string]interface{}{}
+		if err := decodeJSONDocument(data, &doc); err != nil {
+			return failures, fmt.Errorf("golden corpus: payload, %s, %s", name, err.Error())
+		}
+
+		goldenPath := strings.TrimSuffix(path, ".json") + goldenVerdictExt
+		expected := GoldenVerdict{}
+		hasGolden := false
+		if data, err := ioutil.ReadFile(goldenPath); err == nil {
+			if err := json.Unmarshal(data, &expected); err != nil {
+				return failures, fmt.Errorf("golden corpus: verdict, %s, %s", name, err.Error())
+			}
+			hasGolden = true
+		}
+		actual := goldenVerdictOf(expected.Ruleset, doc)
+
+		if update {
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(actual)
+			if err := ioutil.WriteFile(goldenPath, buf.Bytes(), 0644); err != nil {
+				return failures, err
+			}
+			fmt.Fprintf(w, "UPDATE %s: %s %v\n", name, actual.Result, actual.Rules)
+			continue
+		}
+		if !hasGolden {
+			failures++
+			fmt.Fprintf(w, "FAIL %s: no golden verdict, %s %v\n", name, actual.Result, actual.Rules)
+		} else if !reflect.DeepEqual(expected, actual) {
+			failures++
+			fmt.Fprintf(w, "FAIL %s: expected %s %v, got %s %v\n", name, expected.Result, expected.Rules, actual.Result, actual.Rules)
+		} else {
+			fmt.Fprintf(w, "ok   %s\n", name)
+		}
+	}
+	fmt.Fprintf(w, "%d payloads, %d failed\n", len(payloads), failures)
+	return failures, nil
+}
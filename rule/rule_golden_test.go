@@ -0,0 +1,101 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// registerSystemRules registers the rules of the service rules.json, they
+// are removed when the test ends
+func registerSystemRules(t *testing.T) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", ruleJsonDefinitionFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := []RuleNode{}
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		t.Fatal(err)
+	}
+	if nodes, err = orderByReferences(nodes); err != nil {
+		t.Fatal(err)
+	}
+	for i := range nodes {
+		registerTestRule(t, &nodes[i])
+	}
+}
+
+func TestGoldenCorpus(t *testing.T) {
+	registerSystemRules(t)
+	var out bytes.Buffer
+	failures, err := VerifyGoldenCorpus(filepath.Join("..", "testdata", "golden"), false, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 0 {
+		t.Errorf("expected the golden verdicts, got\n%s", out.String())
+	}
+}
+
+func TestGoldenCorpusChanged(t *testing.T) {
+	registerSystemRules(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "short_password.json"), []byte(`{"username": "alice_w", "password": "abc"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "short_password.golden"), []byte(`{"result": "success"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "missing.json"), []byte(`{"username": "alice_w"}`), 0644)
+
+	var out bytes.Buffer
+	failures, err := VerifyGoldenCorpus(dir, false, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 2 || !strings.Contains(out.String(), "FAIL short_password: expected success [], got failure [password_length]") ||
+		!strings.Contains(out.String(), "FAIL missing: no golden verdict") {
+		t.Errorf("expected the changed and the missing verdicts, got %d\n%s", failures, out.String())
+	}
+
+	// the update records the current verdicts
+	out.Reset()
+	if _, err := VerifyGoldenCorpus(dir, true, &out); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if failures, err := VerifyGoldenCorpus(dir, false, &out); err != nil || failures != 0 {
+		t.Errorf("expected the updated verdicts, got %d %v\n%s", failures, err, out.String())
+	}
+}
+
+func TestVerifyGoldenCorpus(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "golden_test_code", "rule": {"operator": "MATCHES", "operands": [{"value": "^[A-Z]{3}$"}, {"field": "golden_test_code"}]}}`), &node)
+	registerTestRule(t, &node)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "upper.json"), []byte(`{"golden_test_code": "ABC"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "upper.golden"), []byte(`{"result": "success"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "lower.json"), []byte(`{"golden_test_code": "abc"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "lower.golden"), []byte(`{"result": "success"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "missing.json"), []byte(`{"golden_test_code": "XYZ"}`), 0644)
+
+	var out bytes.Buffer
+	failures, err := VerifyGoldenCorpus(dir, false, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 2 || !strings.Contains(out.String(), "FAIL lower: expected success [], got failure [golden_test_code]") ||
+		!strings.Contains(out.String(), "FAIL missing: no golden verdict") || !strings.Contains(out.String(), "ok   upper") {
+		t.Errorf("expected the changed and the missing verdicts, got %d\n%s", failures, out.String())
+	}
+
+	// the update records the current verdicts
+	if _, err := VerifyGoldenCorpus(dir, true, &out); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if failures, err := VerifyGoldenCorpus(dir, false, &out); err != nil || failures != 0 {
+		t.Errorf("expected the updated verdicts, got %d %v\n%s", failures, err, out.String())
+	}
+}
@@ -0,0 +1,131 @@
+package rule
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// The rule graph links the rules to the fields they reference, and to the
+// rules they embed by RULE_REF, for the visualization of the coverage.
+// The field nodes are the fields of the rules, the "allowed-fields" of
+// the ruleset configs and the "fields" of the readiness config, so a
+// field of the API contract without any rule shows up as uncovered.
+
+// the graph node and edge types
+const (
+	GraphNodeField = "field"
+	GraphNodeRule  = "rule"
+
+	GraphEdgePrimary   = "primary"   // the rule is triggered by the field
+	GraphEdgeReference = "reference" // the rule references the field
+	GraphEdgeEmbeds    = "embeds"    // the rule embeds the rule by RULE_REF
+)
+
+// GraphNode is a field or a rule of the rule graph, the ID is prefixed by
+// the node type, e.g. "field:email" or "rule:email_pattern"
+type GraphNode struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// the live rules referencing the field
+	Rules int `json:"rules,omitempty"`
+	// the rule is published and enabled
+	Live bool `json:"live,omitempty"`
+}
+
+// GraphEdge is a directed edge from a rule to a field or a rule
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+// RuleGraph is the GET /admin/rules/graph response, the nodes and the
+// edges are sorted by the ID, and the uncovered fields have no live rule
+type RuleGraph struct {
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Uncovered []string    `json:"uncovered"`
+}
+
+// BuildRuleGraph returns the graph of the rules in ruleset, "" is all of
+// them
+func BuildRuleGraph(ruleset string) RuleGraph {
+	// the live rule count by the known field
+	fields := map[string]int{}
+	known := func(field string) {
+		if _, ok := fields[field]; !ok {
+			fields[field] = 0
+		}
+	}
+	RegRuleLock.RLock()
+	for name, config := range RulesetConfigs {
+		if len(ruleset) == 0 || name == ruleset {
+			for _, field := range config.AllowedFields {
+				known(field)
+			}
+		}
+	}
+	for field := range Readiness.Fields {
+		known(field)
+	}
+
+	graph := RuleGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}, Uncovered: []string{}}
+	for _, entry := range AllRegisteredRuleIDs {
+		if len(ruleset) > 0 && !entry.inRuleset(ruleset) {
+			continue
+		}
+		live := entry.live()
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: GraphNodeRule + ":" + entry.Name, Type: GraphNodeRule, Name: entry.Name, Live: live})
+		for i, field := range entry.Fields {
+			edge := GraphEdgeReference
+			if i == 0 {
+				edge = GraphEdgePrimary
+			}
+			graph.Edges = append(graph.Edges, GraphEdge{GraphNodeRule + ":" + entry.Name, GraphNodeField + ":" + field, edge})
+			if live {
+				fields[field]++
+			} else {
+				known(field)
+			}
+		}
+		for _, name := range entry.References {
+			if referenced := findRuleByName(name); referenced != nil && (len(ruleset) == 0 || referenced.inRuleset(ruleset)) {
+				graph.Edges = append(graph.Edges, GraphEdge{GraphNodeRule + ":" + entry.Name, GraphNodeRule + ":" + name, GraphEdgeEmbeds})
+			}
+		}
+	}
+	RegRuleLock.RUnlock()
+
+	for field, count := range fields {
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: GraphNodeField + ":" + field, Type: GraphNodeField, Name: field, Rules: count})
+		if count == 0 {
+			graph.Uncovered = append(graph.Uncovered, field)
+		}
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	sort.Strings(graph.Uncovered)
+	return graph
+}
+
+// GET /admin/rules/graph?ruleset=<ruleset> service implementation
+func GetRuleGraph(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ruleset := r.URL.Query().Get("ruleset")
+	if err := CheckRuleset(ruleset); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(BuildRuleGraph(ruleset))
+	io.WriteString(w, string(resStr))
+}
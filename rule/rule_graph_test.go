@@ -0,0 +1,44 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRuleGraph(t *testing.T) {
+	defer func(configs map[string]RulesetConfig) { RulesetConfigs = configs }(RulesetConfigs)
+	RulesetConfigs = map[string]RulesetConfig{"graph_test": {AllowedFields: []string{"graph_test_nickname"}}}
+	for _, data := range []string{
+		`{"name": "graph_test_base", "rulesets": ["graph_test"], "rule": {"operator": "GREATER_THAN", "operands": [{"field": "graph_test_age"}, {"value": 0}]}}`,
+		`{"name": "graph_test_ref", "rulesets": ["graph_test"], "rule": {"operator": "AND", "operands": [
+			{"operator": "RULE_REF", "operands": [{"value": "graph_test_base"}]},
+			{"operator": "GREATER_THAN", "operands": [{"field": "graph_test_limit"}, {"field": "graph_test_age"}]}]}}`,
+	} {
+		node := RuleNode{}
+		json.Unmarshal([]byte(data), &node)
+		registerTestRule(t, &node)
+	}
+
+	graph := BuildRuleGraph("graph_test")
+	if !reflect.DeepEqual(graph.Uncovered, []string{"graph_test_nickname"}) {
+		t.Errorf("expected the uncovered nickname, got %v", graph.Uncovered)
+	}
+	edges := map[GraphEdge]bool{}
+	for _, edge := range graph.Edges {
+		edges[edge] = true
+	}
+	for _, edge := range []GraphEdge{
+		{"rule:graph_test_base", "field:graph_test_age", GraphEdgePrimary},
+		{"rule:graph_test_ref", "rule:graph_test_base", GraphEdgeEmbeds},
+	} {
+		if !edges[edge] {
+			t.Errorf("expected the edge %v in %v", edge, graph.Edges)
+		}
+	}
+	for _, node := range graph.Nodes {
+		if node.ID == "field:graph_test_age" && node.Rules != 2 {
+			t.Errorf("expected 2 rules of the age, got %d", node.Rules)
+		}
+	}
+}
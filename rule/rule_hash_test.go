@@ -0,0 +1,25 @@
+package rule
+
+import "testing"
+
+func TestHashOperators(t *testing.T) {
+	for _, tc := range []struct {
+		operator OperatorType
+		operands []interface{}
+		expected bool
+	}{
+		// the digests are compared case-insensitive
+		{Sha256EqualsOperator, []interface{}{"hello", "2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824"}, true},
+		{Sha256EqualsOperator, []interface{}{"hello!", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}, false},
+		{Crc32EqualsOperator, []interface{}{"hello", "3610a686"}, true},
+		{Crc32EqualsOperator, []interface{}{"hello", "3610A686"}, true},
+		{Crc32EqualsOperator, []interface{}{"hello", "3610a687"}, false},
+	} {
+		if res, err := RegisteredOperators[tc.operator](tc.operands); err != nil || res != tc.expected {
+			t.Errorf("%s%v: expected %v, got %v %v", tc.operator, tc.operands, tc.expected, res, err)
+		}
+	}
+	if _, err := RegisteredOperators[Sha256EqualsOperator]([]interface{}{"hello", 1}); err == nil {
+		t.Error("expected a digest of another type rejected")
+	}
+}
@@ -0,0 +1,136 @@
+package rule
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// The versions replaced by the updates of a rule, and the audit log of the
+// rule changes made by the API and the sweeper, are kept in memory,
+//   GET /admin/rule/<rule-name>/versions  the replaced versions, oldest first
+//   GET /admin/audit                      the rule changes, oldest first
+// The sweeper prunes the versions replaced, and the audit entries
+// recorded, more than RuleVersionRetention and AuditRetention ago.
+
+// RuleVersionRetention and AuditRetention keep the replaced rule versions
+// and the audit entries for the duration, 0 keeps them
+var (
+	RuleVersionRetention time.Duration
+	AuditRetention       time.Duration
+)
+
+// the audit actions, besides the lifecycle actions submit, approve and
+// retire
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionEnable  = "enable"
+	AuditActionDisable = "disable"
+	AuditActionDelete  = "delete"
+)
+
+// RuleVersion is a replaced version of a rule, in the canonical form
+type RuleVersion struct {
+	Version  int           `json:"version"`
+	Replaced time.Time     `json:"replaced"`
+	Rule     canonicalNode `json:"rule"`
+}
+
+// AuditEntry is a rule change, the user is "" for the sweeper
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Rule    string    `json:"rule"`
+	User    string    `json:"user,omitempty"`
+	Version int       `json:"version,omitempty"`
+}
+
+var (
+	historyLock  sync.Mutex
+	ruleVersions = map[string][]RuleVersion{}
+	auditLog     = []AuditEntry{}
+)
+
+// recordRuleVersion keeps the replaced entry.  Caller holds the READ lock.
+func recordRuleVersion(entry *RuleEntry, replaced time.Time) {
+	node, err := canonicalEntryNode(entry)
+	if err != nil {
+		return
+	}
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	ruleVersions[entry.Name] = append(ruleVersions[entry.Name], RuleVersion{Version: entry.Version, Replaced: replaced, Rule: node})
+}
+
+// RecordAudit appends the rule change to the audit log
+func RecordAudit(action, name, user string, version int) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	auditLog = append(auditLog, AuditEntry{Time: time.Now(), Action: action, Rule: name, User: user, Version: version})
+}
+
+// GetRuleVersions returns the replaced versions of the rule name, oldest
+// first
+func GetRuleVersions(name string) []RuleVersion {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	return append([]RuleVersion{}, ruleVersions[name]...)
+}
+
+// GetAuditLog returns the audit entries, oldest first
+func GetAuditLog() []AuditEntry {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	return append([]AuditEntry{}, auditLog...)
+}
+
+// pruneHistory drops the versions and the audit entries past their
+// retention at now, and returns their numbers
+func pruneHistory(now time.Time) (versions int, entries int) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	if RuleVersionRetention > 0 {
+		cutoff := now.Add(-RuleVersionRetention)
+		for name, kept := range ruleVersions {
+			i := 0
+			for i < len(kept) && kept[i].Replaced.Before(cutoff) {
+				i++
+			}
+			versions += i
+			if i == len(kept) {
+				delete(ruleVersions, name)
+			} else if i > 0 {
+				ruleVersions[name] = append([]RuleVersion{}, kept[i:]...)
+			}
+		}
+	}
+	if AuditRetention > 0 {
+		cutoff := now.Add(-AuditRetention)
+		for entries < len(auditLog) && auditLog[entries].Time.Before(cutoff) {
+			entries++
+		}
+		auditLog = append([]AuditEntry{}, auditLog[entries:]...)
+	}
+	return versions, entries
+}
+
+// GET /admin/rule/{ruleName}/versions service implementation
+func GetRuleVersionList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resStr, _ := json.Marshal(GetRuleVersions(chi.URLParam(r, "ruleName")))
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(resStr))
+}
+
+// GET /admin/audit service implementation
+func GetAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resStr, _ := json.Marshal(GetAuditLog())
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,56 @@
+package rule
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+)
+
+// IDGenerator assigns the immutable ID of a new rule.  The rule ID, not its
+// name, links the rule with its statistics and references, so a renamed
+// rule keeps its history.
+type IDGenerator interface {
+	NewID(ruleName string) string
+}
+
+// RandomIDGenerator generates the random UUID (version 4), independent of
+// the rule name
+type RandomIDGenerator struct{}
+
+func (RandomIDGenerator) NewID(ruleName string) string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return formatUUID(u)
+}
+
+// NameBasedIDGenerator generates the name-based UUID (version 5), so a rule
+// loaded without its "id" gets the same ID at every system rule load
+type NameBasedIDGenerator struct{}
+
+// UUID namespace of the rule names, 1f75d671-2fd8-43fa-b3a8-74bc4f2a170b,
+// owned by the validation service
+var ruleNamespaceUUID = [16]byte{0x1f, 0x75, 0xd6, 0x71, 0x2f, 0xd8, 0x43, 0xfa,
+	0xb3, 0xa8, 0x74, 0xbc, 0x4f, 0x2a, 0x17, 0x0b}
+
+func (NameBasedIDGenerator) NewID(ruleName string) string {
+	h := sha1.New()
+	h.Write(ruleNamespaceUUID[:])
+	h.Write([]byte(ruleName))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return formatUUID(u)
+}
+
+func formatUUID(u [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// the rule ID generator, used when a rule is created without its "id".
+// The rules.json rules are always assigned by NameBasedIDGenerator.
+var RuleIDGenerator IDGenerator = RandomIDGenerator{}
@@ -0,0 +1,49 @@
+package rule
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func TestIDGenerators(t *testing.T) {
+	// uuid5(1f75d671-2fd8-43fa-b3a8-74bc4f2a170b, "password_length")
+	if id := (NameBasedIDGenerator{}).NewID("password_length"); id != "337fc11b-9381-5a92-a9b2-121724acce1c" {
+		t.Errorf("expected the name-based UUID of the service namespace, got %s", id)
+	}
+	if (NameBasedIDGenerator{}).NewID("a") == (NameBasedIDGenerator{}).NewID("b") {
+		t.Error("expected the names to get distinct IDs")
+	}
+	uuid4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	id := (RandomIDGenerator{}).NewID("password_length")
+	if !uuid4.MatchString(id) {
+		t.Errorf("expected a random UUID, got %s", id)
+	}
+	if again := (RandomIDGenerator{}).NewID("password_length"); again == id {
+		t.Errorf("expected a new random UUID, got %s twice", id)
+	}
+}
+
+func TestRuleIDIndependentOfName(t *testing.T) {
+	rule := `{"name": "id_test", "rule": {"operator": "EQUAL_TO", "operands": [{"field": "id_test"}, {"value": "x"}]}}`
+	node := RuleNode{}
+	json.Unmarshal([]byte(rule), &node)
+	entry := registerTestRule(t, &node)
+	if entry.ID == (NameBasedIDGenerator{}).NewID("id_test") {
+		t.Errorf("expected a random ID of a created rule, got the name-based %s", entry.ID)
+	}
+	RegRuleLock.Lock()
+	removeRuleFromRegister(entry)
+	RegRuleLock.Unlock()
+
+	// a rules.json rule gets the same ID at every load
+	loaded := RuleNode{}
+	json.Unmarshal([]byte(rule), &loaded)
+	entry, err := registerRuleNode(&loaded, NameBasedIDGenerator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ID != (NameBasedIDGenerator{}).NewID("id_test") {
+		t.Errorf("expected the name-based ID of a loaded rule, got %s", entry.ID)
+	}
+}
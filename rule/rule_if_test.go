@@ -0,0 +1,44 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIfOperator(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "if_test_zip", "primary-field": "if_test_country", "rule": {"operator": "IF", "operands": [
+		{"operator": "EQUAL_TO", "operands": [{"field": "if_test_country"}, {"value": "US"}]},
+		{"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "if_test_zip"}]}]}}`), &node)
+	registerTestRule(t, &node)
+	for _, tc := range []struct {
+		input    map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"if_test_country": "US", "if_test_zip": "90067"}, true},
+		{map[string]interface{}{"if_test_country": "US", "if_test_zip": "9006"}, false},
+		// the branch is not evaluated, the missing field is not an error
+		{map[string]interface{}{"if_test_country": "FR"}, true},
+	} {
+		result, err := ValidateInputJSONByRules("", tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.input, tc.expected, result.flag)
+		}
+	}
+
+	for _, tc := range []struct {
+		operands []interface{}
+		expected interface{}
+	}{
+		{[]interface{}{true, "then"}, "then"},
+		{[]interface{}{false, "then"}, true},
+		{[]interface{}{false, "then", "else"}, "else"},
+	} {
+		if res, err := RegisteredOperators[IfOperator](tc.operands); err != nil || res != tc.expected {
+			t.Errorf("IF%v: expected %v, got %v %v", tc.operands, tc.expected, res, err)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package rule
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The rules maintained in a spreadsheet are imported from its CSV export,
+// a header row, then one constraint per row,
+//   field,constraint,parameters,message,severity
+//   username,min_length,8,"{{.Field}} is too short",error
+//   zip_code,pattern,^[0-9]{5}$,,warning
+//   age,range,18|120,,
+// the columns are in any order, "field" and "constraint" are mandatory,
+// and an optional "name" column names the rule, a generated name
+// otherwise.  The parameters of a constraint are separated by "|".
+//   required              - the field is present
+//   min_length   N        - at least N characters
+//   max_length   N        - at most N characters
+//   length       N|M      - N to M characters
+//   range        LOW|HIGH - a number in the inclusive range
+//   pattern      REGEX    - the regex matches, "|" is not a separator
+//   one_of       A|B|...  - one of the values
+//   equals_field FIELD    - equal to the other field
+//   date_format  LAYOUT   - parses with the Go time layout
+//   in_list      NAME     - in the named word list
+const importParamSeparator = "|"
+
+// the import columns
+var importColumns = map[string]bool{
+	"name": true, "field": true, "constraint": true, "parameters": true, "message": true, "severity": true,
+}
+
+// importConstraint builds the rule content of a constraint on field
+type importConstraint struct {
+	params int // the parameter count, -1 is one or more, 0 none
+	build  func(field string, params []string) (map[string]interface{}, error)
+}
+
+func fieldTerm(field string) map[string]interface{} {
+	return map[string]interface{}{"field": field}
+}
+
+func valueTerm(v interface{}) map[string]interface{} {
+	return map[string]interface{}{"value": v}
+}
+
+func operatorTerm(operator OperatorType, operands ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"operator": string(operator), "operands": operands}
+}
+
+// numberParam parses a number parameter, it keeps its JSON form
+func numberParam(s string) (interface{}, error) {
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return nil, fmt.Errorf("parameter, %s, is not a number", s)
+	}
+	return typedLiteral(json.Number(s))
+}
+
+// lengthParam parses a non-negative integer parameter
+func lengthParam(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("parameter, %s, is not a length", s)
+	}
+	return n, nil
+}
+
+var importConstraints = map[string]importConstraint{
+	"required": {0, func(field string, params []string) (map[string]interface{}, error) {
+		return operatorTerm(RequiredOperator, fieldTerm(field)), nil
+	}},
+	"min_length": {1, func(field string, params []string) (map[string]interface{}, error) {
+		n, err := lengthParam(params[0])
+		if err != nil {
+			return nil, err
+		}
+		return operatorTerm(GreaterThanOperator, operatorTerm(LengthOperator, fieldTerm(field)), valueTerm(n-1)), nil
+	}},
+	"max_length": {1, func(field string, params []string) (map[string]interface{}, error) {
+		n, err := lengthParam(params[0])
+		if err != nil {
+			return nil, err
+		}
+		return operatorTerm(BetweenOperator, operatorTerm(LengthOperator, fieldTerm(field)), valueTerm(0), valueTerm(n)), nil
+	}},
+	"length": {2, func(field string, params []string) (map[string]interface{}, error) {
+		low, err := lengthParam(params[0])
+		if err != nil {
+			return nil, err
+		}
+		high, err := lengthParam(params[1])
+		if err != nil {
+			return nil, err
+		}
+		return operatorTerm(BetweenOperator, operatorTerm(LengthOperator, fieldTerm(field)), valueTerm(low), valueTerm(high)), nil
+	}},
+	"range": {2, func(field string, params []string) (map[string]interface{}, error) {
+		low, err := numberParam(params[0])
+		if err != nil {
+			return nil, err
+		}
+		high, err := numberParam(params[1])
+		if err != nil {
+			return nil, err
+		}
+		return operatorTerm(BetweenOperator, fieldTerm(field), valueTerm(low), valueTerm(high)), nil
+	}},
+	"pattern": {1, func(field string, params []string) (map[string]interface{}, error) {
+		return operatorTerm(MatchesOperator, valueTerm(params[0]), fieldTerm(field)), nil
+	}},
+	"one_of": {-1, func(field string, params []string) (map[string]interface{}, error) {
+		// OR takes two operands, the alternatives are nested
+		term := operatorTerm(EqualToOperator, fieldTerm(field), valueTerm(params[len(params)-1]))
+		for i := len(params) - 2; i >= 0; i-- {
+			term = operatorTerm(OrOperator, operatorTerm(EqualToOperator, fieldTerm(field), valueTerm(params[i])), term)
+		}
+		return term, nil
+	}},
+	"equals_field": {1, func(field string, params []string) (map[string]interface{}, error) {
+		return operatorTerm(EqualToOperator, fieldTerm(field), fieldTerm(params[0])), nil
+	}},
+	"date_format": {1, func(field string, params []string) (map[string]interface{}, error) {
+		return operatorTerm(DateFormatOperator, valueTerm(params[0]), fieldTerm(field)), nil
+	}},
+	"in_list": {1, func(field string, params []string) (map[string]interface{}, error) {
+		return operatorTerm(InDictionaryOperator, valueTerm(params[0]), fieldTerm(field)), nil
+	}},
+}
+
+// importRow converts a CSV row, by the column name, into a rule definition
+func importRow(row map[string]string) (*RuleNode, error) {
+	field := strings.TrimSpace(row["field"])
+	if len(field) == 0 {
+		return nil, fmt.Errorf("field is missing")
+	}
+	name := strings.ToLower(strings.TrimSpace(row["constraint"]))
+	constraint, ok := importConstraints[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown constraint, %s", row["constraint"])
+	}
+	params := []string{}
+	if p := row["parameters"]; len(p) > 0 {
+		if name == "pattern" {
+			params = []string{p}
+		} else {
+			for _, s := range strings.Split(p, importParamSeparator) {
+				params = append(params, strings.TrimSpace(s))
+			}
+		}
+	}
+	switch {
+	case constraint.params < 0 && len(params) == 0:
+		return nil, fmt.Errorf("constraint, %s, expects one or more parameters", name)
+	case constraint.params >= 0 && len(params) != constraint.params:
+		return nil, fmt.Errorf("constraint, %s, expects %d parameters, got %d", name, constraint.params, len(params))
+	}
+	content, err := constraint.build(field, params)
+	if err != nil {
+		return nil, fmt.Errorf("constraint, %s, %s", name, err.Error())
+	}
+	definition := map[string]interface{}{
+		"name":     strings.TrimSpace(row["name"]),
+		"message":  row["message"],
+		"severity": strings.ToLower(strings.TrimSpace(row["severity"])),
+		"rule":     content,
+	}
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return nil, err
+	}
+	node := &RuleNode{}
+	if err := json.Unmarshal(data, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// ImportedRule is the import report of a CSV row, the canonical rule
+// definition, or the error of the row
+type ImportedRule struct {
+	Line       int             `json:"line"`
+	Name       string          `json:"name,omitempty"`
+	Definition json.RawMessage `json:"definition,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// ImportReport is the POST /admin/rules/import response, Created is false
+// in a dry run, or when a row has an error
+type ImportReport struct {
+	DryRun  bool           `json:"dry-run"`
+	Created bool           `json:"created"`
+	Rules   []ImportedRule `json:"rules"`
+}
+
+// parseRulesCSV converts the CSV rows into the rule definitions, and
+// reports each row.  The nodes are nil when a row has an error.
+func parseRulesCSV(r io.Reader) ([]RuleNode, []ImportedRule, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("rules import: header, %s", err.Error())
+	}
+	columns := make([]string, len(header))
+	for i, column := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(column))
+		if !importColumns[columns[i]] {
+			return nil, nil, fmt.Errorf("rules import: unknown column, %s", column)
+		}
+	}
+
+	nodes := []RuleNode{}
+	report := []ImportedRule{}
+	failed := false
+	names := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("rules import: %s", err.Error())
+		}
+		line, _ := reader.FieldPos(0)
+		row := map[string]string{}
+		for i, value := range record {
+			row[columns[i]] = value
+		}
+		node, err := importRow(row)
+		imported := importNode(node, err, line, names)
+		if len(imported.Error) > 0 {
+			failed = true
+		} else {
+			nodes = append(nodes, *node)
+		}
+		report = append(report, imported)
+	}
+	if failed {
+		nodes = nil
+	}
+	return nodes, report, nil
+}
+
+// parseRulesJSON reads the rule definitions of a rules.json array, and
+// reports each rule, its line is the position in the array from 1.  The
+// nodes are nil when a rule has an error.
+func parseRulesJSON(r io.Reader) ([]RuleNode, []ImportedRule, error) {
+	definitions := []json.RawMessage{}
+	if err := json.NewDecoder(r).Decode(&definitions); err != nil {
+		return nil, nil, fmt.Errorf("rules import: %s", err.Error())
+	}
+	nodes := []RuleNode{}
+	report := []ImportedRule{}
+	failed := false
+	names := map[string]int{}
+	for i, definition := range definitions {
+		node := &RuleNode{}
+		imported := importNode(node, json.Unmarshal(definition, node), i+1, names)
+		if len(imported.Error) > 0 {
+			failed = true
+		} else {
+			nodes = append(nodes, *node)
+		}
+		report = append(report, imported)
+	}
+	if failed {
+		nodes = nil
+	}
+	return nodes, report, nil
+}
+
+// importNode reports the imported rule of node at line, or the error of
+// its reading, err, or of the rule: its parse, a name of a previous line
+// in names, or of a registered rule
+func importNode(node *RuleNode, err error, line int, names map[string]int) ImportedRule {
+	imported := ImportedRule{Line: line}
+	var formatted *FormattedRule
+	if err == nil {
+		// the generated name is known after the rule is parsed
+		var entry *RuleEntry
+		if entry, _, err = parseRuleNode(node); err == nil {
+			node.Name = entry.Name
+			formatted, err = FormatRuleNode(node)
+		}
+	}
+	if err == nil {
+		if first, ok := names[node.Name]; ok {
+			err = fmt.Errorf("rule name, %s, is the rule of line %d", node.Name, first)
+		}
+	}
+	if err == nil {
+		RegRuleLock.RLock()
+		existing := findRuleByName(node.Name)
+		RegRuleLock.RUnlock()
+		if existing != nil {
+			err = fmt.Errorf("rule name, %s, is registered", node.Name)
+		}
+	}
+	if err != nil {
+		imported.Error = err.Error()
+	} else {
+		names[node.Name] = line
+		imported.Name = node.Name
+		imported.Definition = json.RawMessage(formatted.Canonical)
+	}
+	return imported
+}
+
+// ImportRulesCSV imports the rules of the CSV into the register, none of
+// them when a row has an error, or in a dry run.  The rules are created by
+// user, drafts when the rules require the approval.
+func ImportRulesCSV(r io.Reader, dryRun bool, user string) (*ImportReport, error) {
+	nodes, rules, err := parseRulesCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	return importRules(nodes, rules, dryRun, user)
+}
+
+// ImportRulesJSON imports the rules of a rules.json array like
+// ImportRulesCSV
+func ImportRulesJSON(r io.Reader, dryRun bool, user string) (*ImportReport, error) {
+	nodes, rules, err := parseRulesJSON(r)
+	if err != nil {
+		return nil, err
+	}
+	return importRules(nodes, rules, dryRun, user)
+}
+
+// importRules registers the imported nodes, all or none, like the rules
+// created by POST /admin/rule
+func importRules(nodes []RuleNode, rules []ImportedRule, dryRun bool, user string) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Rules: rules}
+	if dryRun || nodes == nil {
+		return report, nil
+	}
+	for i := range nodes {
+		if err := prepareRuleCreation(&nodes[i], user); err != nil {
+			return nil, fmt.Errorf("rules import: rule name, %s, %w", nodes[i].Name, err)
+		}
+	}
+	created := []*RuleEntry{}
+	for i := range nodes {
+		entry, err := RegisterRuleNode(&nodes[i])
+		if err != nil {
+			// all or nothing
+			RegRuleLock.Lock()
+			for _, e := range created {
+				removeRuleFromRegister(e)
+			}
+			RegRuleLock.Unlock()
+			return nil, fmt.Errorf("rules import: rule name, %s, %s", nodes[i].Name, err.Error())
+		}
+		created = append(created, entry)
+	}
+	report.Created = true
+	return report, nil
+}
+
+// ImportRulesCSVFile writes the rules of the CSV file in path as a
+// rules.json file to w, in the canonical form
+func ImportRulesCSVFile(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	nodes, report, err := parseRulesCSV(f)
+	if err != nil {
+		return err
+	}
+	if nodes == nil {
+		for _, rule := range report {
+			if len(rule.Error) > 0 {
+				return fmt.Errorf("rules import: line %d, %s", rule.Line, rule.Error)
+			}
+		}
+	}
+	blocks := []string{}
+	for _, rule := range report {
+		// indent the rule block in the array
+		blocks = append(blocks, "  "+strings.Replace(string(rule.Definition), "\n", "\n  ", -1))
+	}
+	_, err = io.WriteString(w, "[\n"+strings.Join(blocks, ",\n")+"\n]\n")
+	return err
+}
+
+// POST /admin/rules/import?dry-run=true service implementation, the body
+// is the CSV file, or a rules.json array with the application/json content
+// type
+func ImportRules(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	importer := ImportRulesCSV
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		importer = ImportRulesJSON
+	}
+	w.Header().Set("Content-Type", "application/json")
+	dryRun := r.URL.Query().Get("dry-run") == "true"
+	report, err := importer(r.Body, dryRun, r.Header.Get(UserHeader))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, RuleStateTransitionError) || errors.Is(err, RuleNamespaceForbiddenError) {
+			// a published rule is imported by the approval only, and a
+			// rule in the namespace of the caller only
+			status = http.StatusForbidden
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	status := http.StatusOK
+	if !dryRun && !report.Created {
+		// a row has an error
+		status = http.StatusBadRequest
+	}
+	w.WriteHeader(status)
+	resStr, _ := json.Marshal(report)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,114 @@
+package rule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestImportRulesCSV(t *testing.T) {
+	csvData := "field,constraint,parameters,message,severity,name\n" +
+		"import_test.username,min_length,3,,,import_test_username\n" +
+		"import_test.zip,pattern,^[0-9]{5}$|^[0-9]{9}$,,warning,import_test_zip\n" +
+		"import_test.plan,one_of,free|pro|team,\"{{.Field}} is unknown\",,import_test_plan\n" +
+		"import_test.age,range,18|120,,,\n"
+	report, err := ImportRulesCSV(strings.NewReader(csvData), true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created || len(report.Rules) != 4 {
+		t.Fatalf("expected a dry run report of 4 rules, got %+v", report)
+	}
+	for _, rule := range report.Rules {
+		if len(rule.Error) > 0 || len(rule.Name) == 0 {
+			t.Errorf("line %d: expected a rule, got %+v", rule.Line, rule)
+		}
+	}
+	RegRuleLock.RLock()
+	registered := findRuleByName("import_test_username")
+	RegRuleLock.RUnlock()
+	if registered != nil {
+		t.Fatal("expected the dry run not to create the rules")
+	}
+
+	report, err = ImportRulesCSV(strings.NewReader(csvData), false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range report.Rules {
+		cleanupTestRule(t, rule.Name)
+	}
+	result, err := ValidateInputJSONByRules("", []byte(`{"import_test": {"username": "bo", "zip": "123456789", "plan": "gold", "age": 17}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := append([]string{}, result.rules...)
+	sort.Strings(failed)
+	expected := []string{report.Rules[3].Name, "import_test_plan", "import_test_username"}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(failed, expected) {
+		t.Errorf("expected %v to fail, got %v", expected, failed)
+	}
+
+	// a row error creates nothing
+	report, err = ImportRulesCSV(strings.NewReader("field,constraint,parameters\nimport_test.x,min_length,3\nimport_test.y,max_size,3\n"), false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created || len(report.Rules[1].Error) == 0 {
+		t.Errorf("expected the unknown constraint to fail the import, got %+v", report)
+	}
+}
+
+func TestImportRulesApproval(t *testing.T) {
+	defer func(require bool) { RequireApproval = require }(RequireApproval)
+	RequireApproval = true
+
+	importRules := func(contentType, body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/rules/import", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if len(user) > 0 {
+			req.Header.Set(UserHeader, user)
+		}
+		w := httptest.NewRecorder()
+		ImportRules(w, req)
+		return w
+	}
+	csvData := "field,constraint,parameters,name\nimport_approval_test.code,min_length,3,import_approval_test_code\n"
+	if w := importRules("text/csv", csvData, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected the missing user to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	if w := importRules("text/csv", csvData, "alice"); w.Code != http.StatusOK {
+		t.Fatalf("expected the import, got %d %s", w.Code, w.Body.String())
+	}
+	cleanupTestRule(t, "import_approval_test_code")
+
+	jsonData := `[{"name": "import_approval_test_zip", "expression": "matches('^[0-9]{5}$', import_approval_test_zip)"}]`
+	if w := importRules("application/json", `[{"name": "import_approval_test_zip", "state": "published", "expression": "length(import_approval_test_zip) > 0"}]`, "alice"); w.Code != http.StatusForbidden {
+		t.Errorf("expected a published rule to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	if w := importRules("application/json; charset=utf-8", jsonData, "alice"); w.Code != http.StatusOK {
+		t.Fatalf("expected the import, got %d %s", w.Code, w.Body.String())
+	}
+	cleanupTestRule(t, "import_approval_test_zip")
+
+	RegRuleLock.RLock()
+	for _, name := range []string{"import_approval_test_code", "import_approval_test_zip"} {
+		if entry := findRuleByName(name); entry == nil || entry.State != RuleStateDraft || entry.Author != "alice" {
+			t.Errorf("%s: expected a draft of alice, got %+v", name, entry)
+		}
+	}
+	RegRuleLock.RUnlock()
+
+	// the drafts aren't evaluated
+	result, err := ValidateInputJSONByRules("", map[string]interface{}{"import_approval_test": map[string]interface{}{"code": "a"}, "import_approval_test_zip": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.flag {
+		t.Errorf("expected the drafts not to be evaluated, got %v", result.rules)
+	}
+}
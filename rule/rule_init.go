@@ -1,8 +1,11 @@
 package rule
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
 	"log"
 	"os"
 	"reflect"
@@ -10,15 +13,80 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 )
 
 const (
 	ruleJsonDefinitionFileName = "./rules.json"
 )
 
-// registered rule is, ruleName => Operand
+// RuleEntry is a registered rule, its operand tree and metadata.
+// ID is immutable, while the rule name can change.
+type RuleEntry struct {
+	ID       string
+	Name     string
+	Field    string   // the primary field, which triggers the rule
+	Fields   []string // all referenced fields, the primary one first
+	Rule     Operand
+	Created  time.Time
+	Warnings []string // e.g. the deprecated operators in the rule
+	// the canonical rule content hash, the same for the structurally
+	// identical rules
+	Fingerprint string
+	// the primary field must be present in the input
+	Required bool
+	// the violation message template, nil without "message"
+	Message *template.Template
+	// the stable error code of the failure, "" without "error-code"
+	ErrorCode string
+	// the rulesets of the rule, sorted, none for a common rule
+	Rulesets []string
+	// the free-form tags of the rule, sorted, e.g. "pci"
+	Tags []string
+	// the rules embedded by RULE_REF, sorted
+	References []string
+	// the parsed definition, re-parsed when an embedded rule is updated
+	source *RuleNode
+	// the namespace accounted for the rule resources
+	Namespace string
+	// the fail-fast evaluation order, the lower first, and the severity
+	// of the failure
+	Priority int
+	Severity string
+	// a disabled rule is kept, but not evaluated, guarded by RegRuleLock
+	Disabled bool
+	// the activation window, [ValidFrom, ValidUntil), nil is unbounded
+	ValidFrom  *time.Time
+	ValidUntil *time.Time
+	// the sweeper action of the expired rule
+	OnExpiry string
+	// the null and absent field policies, "" is the system policy
+	NullPolicy    FieldPolicy
+	MissingPolicy FieldPolicy
+	// what the rule enforces, for the people reading it
+	Metadata RuleMetadata
+	// the percentage of the inputs the failure fails, keyed on the field
+	// EnforcementKey, nil is enforced for all
+	Enforcement    *float64
+	EnforcementKey string
+	// the lifecycle state, the author of the rule and the approver of its
+	// publication, guarded by RegRuleLock
+	State    string
+	Author   string
+	Approver string
+	// the deployment environments of the rule, sorted, none for all
+	Environments []string
+	// the inputs expected to pass and to fail the rule, nil without any
+	Examples *RuleExamples
+	// the revision of the rule, from 1, incremented by each update
+	Version   int
+	resources ruleResources
+}
+
+// registered rule is, ruleName => RuleEntry
 // ruleName is unique
-type RegisteredRule map[string]Operand
+type RegisteredRule map[string]*RuleEntry
 
 // AllRegisteredRules is collection of (dataFieldName, [RegisteredRule, ...])
 // given a data field name may be defined with multiple rules, e.g.
@@ -26,12 +94,19 @@ type RegisteredRule map[string]Operand
 //   rule1 - length is 0 OR length > 6
 //   rule2 - contains letter, digital, one special character in a regex pattern
 var AllRegisteredRules = map[string]RegisteredRule{}
+// all registered rules by the rule ID, ruleID => RuleEntry
+var AllRegisteredRuleIDs = map[string]*RuleEntry{}
+// the required rules by the rule ID, checked for the absent primary field
+var AllRequiredRules = map[string]*RuleEntry{}
 // define registered rules RWMutex lock
 var RegRuleLock = sync.RWMutex{}
 
 // all registered operators in OperatorFn
 var RegisteredOperators map[OperatorType]OperatorFn
 
+// operators supporting the "decimal" mode, in OperatorFn
+var RegisteredDecimalOperators map[OperatorType]OperatorFn
+
 func init() {
 
 	// prepare built-in operators
@@ -50,51 +125,32 @@ func init() {
 			}
 		},
 
-		// compare two values equal w/ the same type, such as string or int
+		// compare two values equal, as numbers when either one is a number
+		// literal or a number result, otherwise w/ the same type.
+		// With the 3rd operand, epsilon, compare two number values equal
+		// within epsilon
 		EqualToOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) == 3 {
+				v1, v2, epsilon, err := numericOperands(operands)
+				if err != nil {
+					return nil, err
+				}
+				return compareNumeric(v1, v2, epsilon) == 0, nil
+			}
 			if len(operands) != 2 {
 				return nil, ParseRuleOperatorError
 			}
-			var v1, v2 string
-			switch v := operands[0].(type) {
-			case string:
-				v1 = v
-			case int:
-				v1 = strconv.Itoa(v)
-			}
-			switch v := operands[1].(type) {
-			case string:
-				v2 = v
-			case int:
-				v2 = strconv.Itoa(v)
-			}
-			return strings.Compare(v1, v2) == 0, nil
+			return equalValues(operands[0], operands[1]), nil
 		},
 
-		// compare two number values in >
+		// compare two number values in >, integer or float, with the
+		// optional 3rd operand epsilon: the values within epsilon are equal
 		GreaterThanOperator: func(operands []interface{}) (interface{}, error) {
-			if len(operands) != 2 {
-				return nil, ParseRuleOperatorError
-			}
-			var v1, v2 int
-			var err error
-			switch v := operands[0].(type) {
-			case string:
-				if v1, err = strconv.Atoi(v); err != nil {
-					return nil, err
-				}
-			case int:
-				v1 = v
-			}
-			switch v := operands[1].(type) {
-			case string:
-				if v2, err = strconv.Atoi(v); err != nil {
-					return nil, err
-				}
-			case int:
-				v2 = v
+			v1, v2, epsilon, err := numericOperands(operands)
+			if err != nil {
+				return nil, err
 			}
-			return v1 > v2, nil
+			return compareNumeric(v1, v2, epsilon) > 0, nil
 		},
 
 		// do the logic OR on two bool values
@@ -125,8 +181,138 @@ func init() {
 			return nil, ParseRuleOperatorError
 		},
 
+		// IF(condition, then[, else]) on the evaluated operands, the result
+		// is true when the condition is false and there is no else branch.
+		// The rule evaluation uses the lazy variant in lazyOperators.
+		IfOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 2 && len(operands) != 3 {
+				return nil, ParseRuleOperatorError
+			}
+			cond, ok := operands[0].(bool)
+			if !ok {
+				return nil, ParseRuleOperatorError
+			}
+			if cond {
+				return operands[1], nil
+			} else if len(operands) == 3 {
+				return operands[2], nil
+			}
+			return true, nil
+		},
+
+		// the evaluated field is present, a missing field fails the rule by
+		// EvalFieldMissingError.  A rule of REQUIRED is a required rule.
+		RequiredOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			return true, nil
+		},
+
+		// count the fields of the document
+		FieldCountOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			if doc, ok := operands[0].(map[string]interface{}); ok {
+				return len(doc), nil
+			}
+			return nil, ParseRuleOperatorError
+		},
+
+		// the nesting depth of the document, and the total characters of
+		// its field values
+		DocumentDepthOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			if doc, ok := operands[0].(map[string]interface{}); ok {
+				return documentDepth(doc), nil
+			}
+			return nil, ParseRuleOperatorError
+		},
+		DocumentLengthOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			if doc, ok := operands[0].(map[string]interface{}); ok {
+				return documentLength(doc), nil
+			}
+			return nil, ParseRuleOperatorError
+		},
+
+		// check the document has the field operands[1], or an object or
+		// array block at the path, e.g. "billing" of "billing.city"
+		HasFieldOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 2 {
+				return nil, ParseRuleOperatorError
+			}
+			doc, ok1 := operands[0].(map[string]interface{})
+			path, ok2 := operands[1].(string)
+			if !ok1 || !ok2 {
+				return nil, ParseRuleOperatorError
+			}
+			return documentHasPath(doc, path), nil
+		},
+
+		// REQUIRED_IF(document, path, condition) and FORBIDDEN_IF on the
+		// evaluated operands, the rule evaluation uses the lazy variants
+		RequiredIfOperator: func(operands []interface{}) (interface{}, error) {
+			return dependentField(operands, true)
+		},
+		ForbiddenIfOperator: func(operands []interface{}) (interface{}, error) {
+			return dependentField(operands, false)
+		},
+
+		// OLD(field), CHANGED(field) and CHANGE_PERCENT(field) without the
+		// old version of the document, which is unchanged, the rule
+		// evaluation uses the lazy variants
+		OldOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			return operands[0], nil
+		},
+		ChangedOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			return false, nil
+		},
+		ChangePercentOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			return changePercent(operands[0], operands[0])
+		},
+
+		// the document operands[0] has exactly one, or at most one, of the
+		// field paths operands[1:]
+		ExactlyOneOfOperator: func(operands []interface{}) (interface{}, error) {
+			present, err := presentGroupFields(operands)
+			if err != nil {
+				return nil, err
+			}
+			return len(present) == 1, nil
+		},
+		AtMostOneOfOperator: func(operands []interface{}) (interface{}, error) {
+			present, err := presentGroupFields(operands)
+			if err != nil {
+				return nil, err
+			}
+			return len(present) <= 1, nil
+		},
+
+		// aggregate the numbers at the path operands[1] of the document
+		// operands[0], and compare the dates
+		SumOperator:       sumOperator,
+		MinOperator:       extremeOperator(-1),
+		MaxOperator:       extremeOperator(+1),
+		CountOperator:     countOperator,
+		DateAfterOperator: dateAfterOperator,
+
 		// do the regex match on two parameters,
-		RegexMatchOperator: func(operands []interface{}) (interface{}, error) {
+		MatchesOperator: func(operands []interface{}) (interface{}, error) {
 			if len(operands) != 2 {
 				return nil, ParseRuleOperatorError
 			}
@@ -143,79 +329,563 @@ func init() {
 			}
 			return nil, ParseRuleOperatorError
 		},
+
+		// check a string is a valid semantic version, e.g. "1.10.0-rc.1"
+		IsSemverOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			switch v := operands[0].(type) {
+			case string:
+				_, err := parseSemver(v)
+				return err == nil, nil
+			}
+			return nil, ParseRuleOperatorError
+		},
+
+		// compare two semantic versions in >, by the semver precedence
+		SemverGreaterThanOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 2 {
+				return nil, ParseRuleOperatorError
+			}
+			v1, ok1 := operands[0].(string)
+			v2, ok2 := operands[1].(string)
+			if !ok1 || !ok2 {
+				return nil, ParseRuleOperatorError
+			}
+			s1, err := parseSemver(v1)
+			if err != nil {
+				return false, nil
+			}
+			s2, err := parseSemver(v2)
+			if err != nil {
+				return nil, err
+			}
+			return s1.compare(s2) > 0, nil
+		},
+
+		// hash the string operands[0] in SHA-256, and compare with the
+		// expected hex digest, operands[1]
+		Sha256EqualsOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 2 {
+				return nil, ParseRuleOperatorError
+			}
+			data, ok1 := operands[0].(string)
+			digest, ok2 := operands[1].(string)
+			if !ok1 || !ok2 {
+				return nil, ParseRuleOperatorError
+			}
+			sum := sha256.Sum256([]byte(data))
+			return strings.EqualFold(hex.EncodeToString(sum[:]), digest), nil
+		},
+
+		// checksum the string operands[0] in CRC-32 (IEEE), and compare with
+		// the expected 8-digit hex checksum, operands[1]
+		Crc32EqualsOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 2 {
+				return nil, ParseRuleOperatorError
+			}
+			data, ok1 := operands[0].(string)
+			checksum, ok2 := operands[1].(string)
+			if !ok1 || !ok2 {
+				return nil, ParseRuleOperatorError
+			}
+			sum := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(data)))
+			return strings.EqualFold(sum, checksum), nil
+		},
+
+		// call the external HTTP endpoint, operands[0] URL template, with
+		// the value operands[1]: HTTP 200 is true, 404 is false
+		LookupOperator: lookupOperator,
+
+		// record the value operands[2] in the scope operands[0] for the TTL
+		// operands[1]: a value seen in the TTL is false
+		UniqueInScopeOperator: uniqueInScopeOperator,
+
+		// check the value operands[1] is in the word list named operands[0]
+		InDictionaryOperator: wordListOperator(true),
+
+		// check the value operands[1] is not in the word list named operands[0]
+		NotInBlocklistOperator: wordListOperator(false),
+
+		// check a string is an IANA time zone name, e.g. "America/Los_Angeles"
+		IsTimezoneOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 1 {
+				return nil, ParseRuleOperatorError
+			}
+			switch v := operands[0].(type) {
+			case string:
+				// time.LoadLocation() treats "" as "UTC", and "Local" as
+				// the server local zone: both are not a zone name
+				if len(v) == 0 || v == "Local" {
+					return false, nil
+				}
+				_, err := time.LoadLocation(v)
+				return err == nil, nil
+			}
+			return nil, ParseRuleOperatorError
+		},
+
+		// check a number value, operands[0], in the inclusive range
+		// [operands[1], operands[2]]
+		BetweenOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 3 {
+				return nil, ParseRuleOperatorError
+			}
+			v, low, _, err := numericOperands(operands[:2])
+			if err != nil {
+				return nil, err
+			}
+			high, err := toNumericValue(operands[2])
+			if err != nil {
+				return nil, err
+			}
+			return compareNumeric(v, low, 0) >= 0 && compareNumeric(v, high, 0) <= 0, nil
+		},
+
+		// apply the regex pattern operands[0] with one capture group to the
+		// string operands[1], and return the captured substring, or "" when
+		// the pattern doesn't match
+		RegexExtractOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 2 {
+				return nil, ParseRuleOperatorError
+			}
+			pattern, ok1 := operands[0].(string)
+			value, ok2 := operands[1].(string)
+			if !ok1 || !ok2 {
+				return nil, ParseRuleOperatorError
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if re.NumSubexp() != 1 {
+				return nil, fmt.Errorf("rule operator: %s expects one capture group, %s", RegexExtractOperator, pattern)
+			}
+			if m := re.FindStringSubmatch(value); m != nil {
+				return m[1], nil
+			}
+			return "", nil
+		},
+
+		// check the string operands[1] parses with the Go time layout
+		// operands[0], e.g. "01/02/2006"
+		DateFormatOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 2 {
+				return nil, ParseRuleOperatorError
+			}
+			layout, ok1 := operands[0].(string)
+			value, ok2 := operands[1].(string)
+			if !ok1 || !ok2 {
+				return nil, ParseRuleOperatorError
+			}
+			_, err := time.Parse(layout, value)
+			return err == nil, nil
+		},
+
+		// check the sniffed MIME type of the base64 payload operands[0]
+		// is one of the media types operands[1:]
+		ContentTypeIsOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) < 2 {
+				return nil, ParseRuleOperatorError
+			}
+			payload, ok := operands[0].(string)
+			if !ok {
+				return nil, ParseRuleOperatorError
+			}
+			mediaType, err := sniffContentType(payload)
+			if err != nil {
+				return false, nil
+			}
+			for _, o := range operands[1:] {
+				want, ok := o.(string)
+				if !ok {
+					return nil, ParseRuleOperatorError
+				}
+				if strings.EqualFold(mediaType, strings.TrimSpace(want)) {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
 	}
 
-	if err := loadSystemRules(); err != nil {
-		// panic
-		log.Fatal(err)
-		panic("system rule load: failed")
+	// prepare the "decimal" mode operators, which compare the values
+	// in the arbitrary-precision decimal, e.g. monetary amounts
+	RegisteredDecimalOperators = map[OperatorType]OperatorFn{
+
+		EqualToOperator: func(operands []interface{}) (interface{}, error) {
+			d1, d2, epsilon, err := decimalOperands(operands)
+			if err != nil {
+				return nil, err
+			}
+			return compareDecimal(d1, d2, epsilon) == 0, nil
+		},
+
+		GreaterThanOperator: func(operands []interface{}) (interface{}, error) {
+			d1, d2, epsilon, err := decimalOperands(operands)
+			if err != nil {
+				return nil, err
+			}
+			return compareDecimal(d1, d2, epsilon) > 0, nil
+		},
+
+		BetweenOperator: func(operands []interface{}) (interface{}, error) {
+			if len(operands) != 3 {
+				return nil, ParseRuleOperatorError
+			}
+			d, low, _, err := decimalOperands(operands[:2])
+			if err != nil {
+				return nil, err
+			}
+			high, err := toDecimal(operands[2])
+			if err != nil {
+				return nil, err
+			}
+			return d.Cmp(low) >= 0 && d.Cmp(high) <= 0, nil
+		},
 	}
 }
 
 // Helper function transforms the Unmarshal parsed temporary result, Term
-// into OperandList []Operand, and record number of unique field names in the rule.
+// into OperandList []Operand, and record the unique field names in the rule,
+// name => the order of its first reference.
 func ConstructOperandListHelper(t *Term, fieldList map[string]int) (Operand, error) {
+	return constructOperand(t, fieldList, nil)
+}
+
+// constructOperand does the ConstructOperandListHelper() transform, and
+// replaces the macro argument placeholders by args when it constructs
+// a macro body
+func constructOperand(t *Term, fieldList map[string]int, args []Operand) (Operand, error) {
 	switch v := t.Value.(type) {
 	case TermOperand:
+		if len(v.ruleRef) > 0 {
+			return resolveRuleRef(v.ruleRef, fieldList)
+		}
 		for _, o := range v.ParseOperands {
-			if opernd, err := ConstructOperandListHelper(&o, fieldList); err == nil {
+			if opernd, err := constructOperand(&o, fieldList, args); err == nil {
 				v.OperandList = append(v.OperandList, opernd)
 			} else {
 				return nil, err
 			}
 		}
+		if v.macro != nil {
+			// expand the macro with the constructed operands as its arguments
+			return v.macro.expand(v.OperandList, fieldList)
+		}
+		if err := typecheckTerm(&v); err != nil {
+			return nil, err
+		}
 		return &v, nil
 
 	case FieldOperand:
-		fieldList[v.Name] = 1
+		if isJSONPath(v.Name) {
+			name, err := parseJSONPath(v.Name)
+			if err != nil {
+				return nil, err
+			}
+			v.Name = name
+		}
+		// keep the order of the first reference
+		if _, ok := fieldList[v.Name]; !ok {
+			fieldList[v.Name] = len(fieldList)
+		}
 		return &v, nil
 	case ValueOperand:
 		return &v, nil
+	case FragmentOperand:
+		return expandFragment(v.Name, fieldList, args)
+	case MacroArgOperand:
+		if args == nil {
+			return nil, fmt.Errorf("macro argument, %d, is used outside of a macro body", v.Index)
+		}
+		if v.Index < 0 || v.Index >= len(args) {
+			return nil, fmt.Errorf("macro argument, %d, is out of range", v.Index)
+		}
+		return args[v.Index], nil
 	}
 	return nil, fmt.Errorf("unknown rule operand, %v", t)
 }
 
+// isRequiredOperand checks the rule is REQUIRED(field), the presence of the field
+func isRequiredOperand(op Operand) bool {
+	term, ok := op.(*TermOperand)
+	return ok && OperatorType(term.ParseOperator) == RequiredOperator
+}
+
+// RegisterRuleNode parses the rule content of node, and saves it to the
+// rule register.  A rule without "id" is assigned by RuleIDGenerator.  A
+// rule without "name" is named by its content, so a retried creation of
+// the same rule returns the registered one rather than a duplicate.
+func RegisterRuleNode(node *RuleNode) (*RuleEntry, error) {
+	return registerRuleNode(node, RuleIDGenerator)
+}
+
+// registerRuleNode registers the rule of node, a rule without "id" is
+// assigned by ids
+func registerRuleNode(node *RuleNode, ids IDGenerator) (*RuleEntry, error) {
+	entry, fieldList, err := parseRuleNodeWithIDs(node, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEnvironment(entry.Name, entry.Environments); err != nil {
+		return nil, err
+	}
+	if err := checkRuleExamples(entry, fieldList); err != nil {
+		return nil, err
+	}
+	if err := SaveRuleToRegister(entry, fieldList); err != nil {
+		if len(node.Name) == 0 {
+			RegRuleLock.RLock()
+			existing := AllRegisteredRules[entry.Field][entry.Name]
+			RegRuleLock.RUnlock()
+			if existing != nil && (len(node.ID) == 0 || existing.ID == entry.ID) && existing.Fingerprint == entry.Fingerprint {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+// the prefix of the generated rule names
+const generatedRuleNamePrefix = "rule_"
+
+// generatedRuleName names the rule without "name" by the hash of its
+// namespace, content and settings, the same for a retried creation
+func generatedRuleName(entry *RuleEntry, message string) string {
+	h := sha256.New()
+	for _, s := range []string{entry.Namespace, entry.Field, entry.Fingerprint, strings.Join(entry.Rulesets, ","), strconv.FormatBool(entry.Required), message} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return generatedRuleNamePrefix + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// parseRuleNode parses node into a rule entry without registering it, and
+// returns the referenced fields
+func parseRuleNode(node *RuleNode) (*RuleEntry, map[string]int, error) {
+	return parseRuleNodeWithIDs(node, RuleIDGenerator)
+}
+
+// parseRuleNodeWithIDs parses node like parseRuleNode, a rule without "id"
+// is assigned by ids
+func parseRuleNodeWithIDs(node *RuleNode, ids IDGenerator) (*RuleEntry, map[string]int, error) {
+	references := ruleReferences(&node.RuleContent)
+	for _, ref := range references {
+		if ref == node.Name {
+			return nil, nil, fmt.Errorf("rule reference cycle, %s references itself", ref)
+		}
+	}
+	content, primaryField, err := resolveAddressing(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	fieldList := map[string]int{}
+	rule, err := ConstructOperandListHelper(&content, fieldList)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkRuleResult(node.Name, rule); err != nil {
+		return nil, nil, err
+	}
+	entry := &RuleEntry{ID: node.ID, Name: node.Name, Field: primaryField, Rule: rule,
+		Created: time.Now(), Warnings: deprecationWarnings(&node.RuleContent),
+		Required: node.Required || isRequiredOperand(rule), Priority: node.Priority,
+		Disabled: node.Enabled != nil && !*node.Enabled, ValidFrom: node.ValidFrom, ValidUntil: node.ValidUntil,
+		References: references, Version: 1}
+	if len(references) > 0 {
+		source := *node
+		entry.source = &source
+	}
+	if err := checkActivationWindow(node.Name, node.ValidFrom, node.ValidUntil); err != nil {
+		return nil, nil, err
+	}
+	if entry.Severity, err = normalizeSeverity(node.Severity); err != nil {
+		return nil, nil, err
+	}
+	if entry.OnExpiry, err = normalizeOnExpiry(node.OnExpiry); err != nil {
+		return nil, nil, err
+	}
+	if entry.Metadata, err = newRuleMetadata(node); err != nil {
+		return nil, nil, err
+	}
+	if err := checkErrorCode(node.Name, node.ErrorCode); err != nil {
+		return nil, nil, err
+	}
+	entry.ErrorCode = node.ErrorCode
+	if err := checkEnforcement(node.Name, node.Enforcement); err != nil {
+		return nil, nil, err
+	}
+	entry.Enforcement, entry.EnforcementKey = node.Enforcement, node.EnforcementKey
+	if warning := enforcementWarning(node.Enforcement, node.EnforcementKey); len(warning) > 0 {
+		entry.Warnings = append(entry.Warnings, warning)
+	}
+	if entry.State, err = normalizeRuleState(node.State); err != nil {
+		return nil, nil, err
+	}
+	entry.Author = node.author
+	if entry.Environments, err = normalizeEnvironments(node.Environments); err != nil {
+		return nil, nil, err
+	}
+	entry.Examples = node.Examples
+	if len(node.NullPolicy) > 0 {
+		if entry.NullPolicy, err = ParseNullPolicy(node.NullPolicy); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(node.MissingPolicy) > 0 {
+		if entry.MissingPolicy, err = ParseMissingPolicy(node.MissingPolicy); err != nil {
+			return nil, nil, err
+		}
+	}
+	if entry.Fingerprint, err = ruleFingerprint(rule); err != nil {
+		return nil, nil, err
+	}
+	if entry.Rulesets, err = normalizeRulesets(node.Rulesets); err != nil {
+		return nil, nil, err
+	}
+	if entry.Tags, err = normalizeTags(node.Tags); err != nil {
+		return nil, nil, err
+	}
+	if entry.Namespace, err = normalizeNamespace(node.Namespace); err != nil {
+		return nil, nil, err
+	}
+	if entry.resources, err = measureRule(rule); err != nil {
+		return nil, nil, err
+	}
+	if len(entry.Name) == 0 {
+		entry.Name = generatedRuleName(entry, node.Message)
+	}
+	if len(entry.ID) == 0 {
+		entry.ID = ids.NewID(entry.Name)
+	}
+	if len(node.Message) > 0 {
+		if entry.Message, err = parseRuleMessage(entry.Name, node.Message); err != nil {
+			return nil, nil, err
+		}
+	}
+	return entry, fieldList, nil
+}
+
+// resolveRuleFields sets the primary field and the referenced fields of
+// entry.  A cross-field rule is registered against its primary field,
+// entry.Field, or the first referenced field when it is not given.  A rule
+// referencing $document is a document rule, unless its primary field is
+// given.
+func resolveRuleFields(entry *RuleEntry, fieldList map[string]int) error {
+	if len(fieldList) == 0 {
+		return fmt.Errorf("system rule load: rule name, %s, contains no field name", entry.Name)
+	}
+	fields := make([]string, len(fieldList))
+	for k, i := range fieldList {
+		fields[i] = k
+	}
+	if _, ok := fieldList[DocumentField]; ok && len(entry.Field) == 0 {
+		entry.Field = DocumentField
+	} else if len(entry.Field) == 0 {
+		entry.Field = fields[0]
+	} else if _, ok := fieldList[entry.Field]; !ok {
+		return fmt.Errorf("system rule load: rule name, %s, doesn't reference its primary field, %s", entry.Name, entry.Field)
+	}
+	// the primary field first
+	entry.Fields = []string{entry.Field}
+	for _, k := range fields {
+		if k != entry.Field {
+			entry.Fields = append(entry.Fields, k)
+		}
+	}
+	if entry.Field == DocumentField && entry.Required {
+		return fmt.Errorf("system rule load: rule name, %s, is a document rule, which can't be required", entry.Name)
+	}
+	return checkPatchRuleFields(entry)
+}
+
 // sanity check the rule, then save to the rule register,  AllRegisteredRules
-// maintain the RWLock as need
-func SaveRuleToRegister(rule Operand, ruleName string, fieldList map[string]int) error {
-	count := 0
-	var fieldName string
-	for k := range fieldList {
-		count++
-		fieldName = k
-	}
-	if count != 1 {
-		// unique field name in a rule can only have one
-		return fmt.Errorf("system rule load: rule name, %s, contains more than one unique field name", ruleName)
+// maintain the RWLock as need.
+func SaveRuleToRegister(entry *RuleEntry, fieldList map[string]int) error {
+	if err := resolveRuleFields(entry, fieldList); err != nil {
+		return err
 	}
 	// save rule with ruleName
-	RegRuleLock.RLock()    // READ lock
-	rules, exists := AllRegisteredRules[fieldName]
-	RegRuleLock.RUnlock()  // READ unlock
+	RegRuleLock.Lock()   // WRITE lock
+	defer RegRuleLock.Unlock()
+	return saveRuleLocked(entry)
+}
 
+// saveRuleLocked saves the resolved rule entry, caller holds the WRITE lock
+func saveRuleLocked(entry *RuleEntry) error {
+	fieldName := entry.Field
+	if existing, exists := AllRegisteredRuleIDs[entry.ID]; exists {
+		// duplicated rule ID
+		return fmt.Errorf("system rule load: rule ID, %s, of rule name, %s, is used by rule name, %s", entry.ID, entry.Name, existing.Name)
+	}
+	rules, exists := AllRegisteredRules[fieldName]
 	if !exists {
 		// create a new registered rule
-		regRule := map[string]Operand{}
-		regRule[ruleName] = rule
-		RegRuleLock.Lock()   // WRITE lock
-		AllRegisteredRules[fieldName] = regRule
-		RegRuleLock.Unlock() // WRITE unlock
-	} else {
-		if _, exists := rules[ruleName]; exists {
-			// duplicated rule name
-			return fmt.Errorf("system rule load: rule name, %s, is duplicaed in the field name, %s", ruleName, fieldName)
-		} else {
-			RegRuleLock.Lock()   // WRITE lock
-			rules[ruleName] = rule
-			RegRuleLock.Unlock() // WRITE unlock
+		rules = RegisteredRule{}
+		AllRegisteredRules[fieldName] = rules
+		if isWildcardPath(fieldName) {
+			wildcardFields[fieldName] = true
 		}
+	} else if _, exists := rules[entry.Name]; exists {
+		// duplicated rule name
+		return fmt.Errorf("system rule load: rule name, %s, is duplicaed in the field name, %s", entry.Name, fieldName)
 	}
+	if err := checkNamespaceLimits(entry); err != nil {
+		if len(rules) == 0 {
+			delete(AllRegisteredRules, fieldName)
+			delete(wildcardFields, fieldName)
+		}
+		return err
+	}
+	rules[entry.Name] = entry
+	AllRegisteredRuleIDs[entry.ID] = entry
+	if entry.Required {
+		AllRequiredRules[entry.ID] = entry
+	}
+	if len(entry.MissingPolicy) > 0 {
+		missingPolicyRuleCount++
+	}
+	for _, name := range entry.Rulesets {
+		rulesetRuleCount[name]++
+	}
+	addNamespaceUsage(entry, 1)
+	addTagUsage(entry, 1)
+	recordRegisteredRules()
 	return nil
 }
 
+// removeRuleFromRegister drops the registered entry, caller holds the WRITE lock
+func removeRuleFromRegister(entry *RuleEntry) {
+	if rules, exists := AllRegisteredRules[entry.Field]; exists {
+		delete(rules, entry.Name)
+		if len(rules) == 0 {
+			delete(AllRegisteredRules, entry.Field)
+			delete(wildcardFields, entry.Field)
+		}
+	}
+	delete(AllRegisteredRuleIDs, entry.ID)
+	delete(AllRequiredRules, entry.ID)
+	if len(entry.MissingPolicy) > 0 {
+		missingPolicyRuleCount--
+	}
+	for _, name := range entry.Rulesets {
+		if rulesetRuleCount[name]--; rulesetRuleCount[name] <= 0 {
+			delete(rulesetRuleCount, name)
+		}
+	}
+	addNamespaceUsage(entry, -1)
+	addTagUsage(entry, -1)
+	recordRegisteredRules()
+}
+
 // when the system starts up, it tries to load all rules defined in ruleJsonDefinitionFileName.
-// AllRegisteredRules manipulation doesn't require to be locked
-func loadSystemRules() error {
+// AllRegisteredRules manipulation doesn't require to be locked.
+// It is called by the service main() instead of init(), so the package
+// can be unit tested without the rules file.
+func LoadSystemRules() error {
 	jsonFile, err := os.Open(ruleJsonDefinitionFileName)
 	if err != nil {
 		return err
@@ -230,26 +900,66 @@ func loadSystemRules() error {
 	}
 
 	// file stream read while the array contains values
+	nodes := []RuleNode{}
+	fragments := []RuleFragment{}
+	normalizers := []Normalizer{}
 	for decoder.More() {
-		r := RuleNode{}
 		// decode one rule block,
 		//    { "name":  _rule_name_, "rule": { _rule_content_ ...} }
-		// into a map[string]interface{}
-		if err := decoder.Decode(&r); err != nil {
+		// a fragment block,
+		//    { "fragment": _fragment_name_, "body": { _rule_content_ ...} }
+		// or a normalizer block,
+		//    { "normalize": _field_name_, "transforms": [ ... ] }
+		var data json.RawMessage
+		if err := decoder.Decode(&data); err != nil {
 			// failed to decode a JSON block
 			return err
 		}
-
-		// parse one rule in r
-		fieldList := map[string]int{}
-		rule, _ := ConstructOperandListHelper(&r.RuleContent, fieldList)
-		SaveRuleToRegister(rule, r.Name, fieldList)
+		entry, err := decodeRulesFileEntry(data)
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.fragment != nil:
+			fragments = append(fragments, *entry.fragment)
+		case entry.normalizer != nil:
+			normalizers = append(normalizers, *entry.normalizer)
+		default:
+			nodes = append(nodes, *entry.node)
+		}
 	}
 
 	// at closing bracket
 	if _, err = decoder.Token(); err != nil {
 		return err
 	}
+
+	// the fragments are expanded in the rules
+	if err := SetRuleFragments(fragments); err != nil {
+		return fmt.Errorf("system rule load: %s", err.Error())
+	}
+	if err := SetNormalizers(normalizers); err != nil {
+		return fmt.Errorf("system rule load: %s", err.Error())
+	}
+
+	// the rules of the other environments are skipped, and a rule
+	// referenced by RULE_REF is registered first
+	nodes, err = orderByReferences(environmentNodes(nodes))
+	if err != nil {
+		return fmt.Errorf("system rule load: %s", err.Error())
+	}
+	for i := range nodes {
+		r := &nodes[i]
+		// parse one rule in r, a rule without "id" gets the same ID at
+		// every load
+		if entry, err := registerRuleNode(r, NameBasedIDGenerator{}); err != nil {
+			return fmt.Errorf("system rule load: rule name, %s, %s", r.Name, err.Error())
+		} else {
+			for _, warning := range entry.Warnings {
+				log.Printf("system rule load: rule name, %s, %s", r.Name, warning)
+			}
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,66 @@
+package rule
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedRuleName(t *testing.T) {
+	rule := `{"rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "generated_test"}]}, {"value": 4}]}}`
+	node := RuleNode{}
+	if err := json.Unmarshal([]byte(rule), &node); err != nil {
+		t.Fatal(err)
+	}
+	entry := registerTestRule(t, &node)
+	if !strings.HasPrefix(entry.Name, generatedRuleNamePrefix) {
+		t.Errorf("expected a generated name, got %q", entry.Name)
+	}
+
+	// a retry returns the registered rule
+	retry := RuleNode{}
+	json.Unmarshal([]byte(rule), &retry)
+	again, err := RegisterRuleNode(&retry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != entry {
+		t.Errorf("expected the registered rule %s, got %s", entry.Name, again.Name)
+	}
+
+	// another rule is named differently
+	other := RuleNode{}
+	json.Unmarshal([]byte(rule), &other)
+	other.Required = true
+	otherEntry, _, err := parseRuleNode(&other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherEntry.Name == entry.Name || otherEntry.ID == entry.ID {
+		t.Errorf("expected a different name and ID, got %s %s", otherEntry.Name, otherEntry.ID)
+	}
+}
+
+// registerTestRule registers the rule of node, it is removed when the
+// test ends
+func registerTestRule(t *testing.T, node *RuleNode) *RuleEntry {
+	t.Helper()
+	entry, err := RegisterRuleNode(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanupTestRule(t, entry.Name)
+	return entry
+}
+
+// cleanupTestRule removes the rule named name when the test ends, the rule
+// may be updated or removed by the test meanwhile
+func cleanupTestRule(t *testing.T, name string) {
+	t.Cleanup(func() {
+		RegRuleLock.Lock()
+		defer RegRuleLock.Unlock()
+		if entry := findRuleByName(name); entry != nil {
+			removeRuleFromRegister(entry)
+		}
+	})
+}
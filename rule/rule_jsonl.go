@@ -0,0 +1,414 @@
+package rule
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// A JSON Lines log archive, one JSON object per line, is validated into a
+// summary rather than a result per line: the lines are read as a stream,
+// evaluated by StreamWorkers in any order, and the report counts the
+// violations per rule with a few offending lines of each.  An empty line
+// is skipped, and a line which isn't a JSON object is counted as invalid,
+// the archive goes on.
+
+// JSONLSampleSize is the number of the offending lines kept per rule
+var JSONLSampleSize = 5
+
+// MaxJSONLJobs is the number of the async JSONL jobs kept, the oldest
+// finished one is dropped for a new one
+var MaxJSONLJobs = 100
+
+// MaxJSONLBytes caps the body of an async JSONL validation
+var MaxJSONLBytes int64 = 1 << 30
+
+// MaxJSONLLineBytes caps a line, a longer line fails the validation
+var MaxJSONLLineBytes = 1 << 20
+
+// the bytes of an offending line kept in a sample
+const jsonlSampleBytes = 512
+
+// JSONLSample is an offending line, truncated
+type JSONLSample struct {
+	Line int64  `json:"line"`
+	Text string `json:"text"`
+}
+
+// JSONLRuleSummary is the violations of a rule
+type JSONLRuleSummary struct {
+	Violations int64         `json:"violations"`
+	Samples    []JSONLSample `json:"samples"`
+}
+
+// JSONLProgress is the progress of a JSONL validation
+type JSONLProgress struct {
+	Lines  int64 `json:"lines"`
+	Bytes  int64 `json:"bytes"`
+	Failed int64 `json:"failed"`
+}
+
+// JSONLReport is the summary of a JSONL validation, the lines by their
+// result, and the violations by rule name
+type JSONLReport struct {
+	Lines          int64                        `json:"lines"`
+	Passed         int64                        `json:"passed"`
+	Warned         int64                        `json:"warned"`
+	Failed         int64                        `json:"failed"`
+	Invalid        int64                        `json:"invalid"`
+	Bytes          int64                        `json:"bytes"`
+	Seconds        float64                      `json:"seconds"`
+	Rules          map[string]*JSONLRuleSummary `json:"rules"`
+	InvalidSamples []JSONLSample                `json:"invalid-samples,omitempty"`
+}
+
+// jsonlSample returns the sample of the line, redacted and truncated.  The
+// fields of a JSON object are redacted like the quarantined ones, and the
+// text of an invalid line by the default redaction kept at rest.
+func jsonlSample(line int64, text []byte) JSONLSample {
+	text = bytes.TrimRight(text, "\r\n")
+	var doc map[string]interface{}
+	if err := decodeJSONDocument(text, &doc); err == nil && doc != nil {
+		fields := map[string]interface{}{}
+		if err := parseInputJSON(fields, "", doc); err == nil {
+			text, _ = json.Marshal(redactStoredFields(fields))
+		} else {
+			text = nil
+		}
+	} else {
+		redacted, _ := Redaction.storedDefault().redact(string(text))
+		text = []byte(redacted)
+	}
+	if len(text) > jsonlSampleBytes {
+		return JSONLSample{Line: line, Text: string(text[:jsonlSampleBytes]) + "..."}
+	}
+	return JSONLSample{Line: line, Text: string(text)}
+}
+
+// add counts the result of the line, caller holds the lock
+func (report *JSONLReport) add(line int64, text []byte, result *StreamResult) {
+	switch result.Result {
+	case ValidationStatusSucc:
+		report.Passed++
+		return
+	case ValidationStatusWarn:
+		report.Warned++
+		return
+	case ValidationStatusError:
+		report.Invalid++
+		if len(report.InvalidSamples) < JSONLSampleSize {
+			report.InvalidSamples = append(report.InvalidSamples, jsonlSample(line, text))
+		}
+		return
+	}
+	report.Failed++
+	for _, name := range result.Rules {
+		summary, ok := report.Rules[name]
+		if !ok {
+			summary = &JSONLRuleSummary{Samples: []JSONLSample{}}
+			report.Rules[name] = summary
+		}
+		summary.Violations++
+		if len(summary.Samples) < JSONLSampleSize {
+			summary.Samples = append(summary.Samples, jsonlSample(line, text))
+		}
+	}
+}
+
+type jsonlLine struct {
+	number int64
+	text   []byte
+}
+
+// ValidateJSONLines validates the JSON Lines of r against ruleset, and
+// calls progress, when it isn't nil, every interval and at the end
+func ValidateJSONLines(r io.Reader, ruleset string, interval time.Duration, progress func(JSONLProgress)) (*JSONLReport, error) {
+	workers := StreamWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	start := time.Now()
+	policy := zeroRulePolicyOf(ruleset)
+	report := &JSONLReport{Rules: map[string]*JSONLRuleSummary{}}
+	lock := sync.Mutex{}
+	var lines, read, failed int64
+	snapshot := func() JSONLProgress {
+		return JSONLProgress{Lines: atomic.LoadInt64(&lines), Bytes: atomic.LoadInt64(&read), Failed: atomic.LoadInt64(&failed)}
+	}
+
+	jobs := make(chan jsonlLine, StreamBufferSize*workers)
+	jobID := newBatchJobID("jsonl")
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for line := range jobs {
+				var result StreamResult
+				runBatchWork(jobID, func() { result = evaluateJSONLine(line.text, ruleset, policy) })
+				if result.Result == ValidationStatusFail {
+					atomic.AddInt64(&failed, 1)
+				}
+				lock.Lock()
+				report.add(line.number, line.text, &result)
+				lock.Unlock()
+				atomic.AddInt64(&lines, 1)
+			}
+		}()
+	}
+
+	stop := make(chan struct{})
+	if progress != nil && interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					progress(snapshot())
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(&jsonlCounter{r: r, read: &read})
+	// the scanner caps a line at the larger of the max and the buffer size
+	initial := 64 * 1024
+	if initial > MaxJSONLLineBytes {
+		initial = MaxJSONLLineBytes
+	}
+	scanner.Buffer(make([]byte, 0, initial), MaxJSONLLineBytes)
+	var number int64
+	for scanner.Scan() {
+		number++
+		if text := scanner.Bytes(); len(bytes.TrimSpace(text)) > 0 {
+			// the scanner reuses its buffer
+			jobs <- jsonlLine{number: number, text: append([]byte(nil), text...)}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(stop)
+	if err := scanner.Err(); err == bufio.ErrTooLong {
+		return nil, fmt.Errorf("jsonl: line %d is longer than %d bytes", number+1, MaxJSONLLineBytes)
+	} else if err != nil {
+		return nil, err
+	}
+
+	report.Lines = lines
+	report.Bytes = read
+	report.Seconds = time.Since(start).Seconds()
+	if progress != nil {
+		progress(snapshot())
+	}
+	return report, nil
+}
+
+// jsonlCounter counts the bytes read from r
+type jsonlCounter struct {
+	r    io.Reader
+	read *int64
+}
+
+func (c *jsonlCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.read, int64(n))
+	return n, err
+}
+
+// evaluateJSONLine validates one line, an error result is an invalid line
+func evaluateJSONLine(text []byte, ruleset string, policy ZeroRulePolicy) (result StreamResult) {
+	if RecoverPanics {
+		defer func() {
+			if v := recover(); v != nil {
+				logPanic("jsonl line", v)
+				result = StreamResult{Result: ValidationStatusError}
+			}
+		}()
+	}
+	var doc map[string]interface{}
+	if err := decodeJSONDocument(text, &doc); err != nil || doc == nil {
+		return StreamResult{Result: ValidationStatusError}
+	}
+	ruleset, policy = discriminate(doc, ruleset, policy)
+	res, err := ValidateInputJSONByRules(ruleset, doc)
+	if err != nil {
+		return StreamResult{Result: ValidationStatusError}
+	}
+	return newStreamResult(0, res, policy)
+}
+
+// JSONLJob is an async JSONL validation, Report is set when it is done
+type JSONLJob struct {
+	ID         string        `json:"job-id"`
+	Status     string        `json:"status"`
+	Ruleset    string        `json:"ruleset,omitempty"`
+	TotalBytes int64         `json:"total-bytes"`
+	Progress   JSONLProgress `json:"progress"`
+	Report     *JSONLReport  `json:"report,omitempty"`
+	ErrorMsg   string        `json:"error-message,omitempty"`
+	created    time.Time
+	// the validated ruleset, in the request order
+	ruleset string
+}
+
+// the async JSONL job statuses
+const (
+	JSONLJobRunning = "running"
+	JSONLJobDone    = "done"
+	JSONLJobError   = "error"
+)
+
+var (
+	jsonlJobs    = map[string]*JSONLJob{}
+	jsonlJobLock = sync.Mutex{}
+)
+
+// newJSONLJob adds a running job, it drops the oldest finished job when
+// MaxJSONLJobs are kept
+func newJSONLJob(ruleset string, totalBytes int64) (*JSONLJob, error) {
+	jsonlJobLock.Lock()
+	defer jsonlJobLock.Unlock()
+	if len(jsonlJobs) >= MaxJSONLJobs {
+		var oldest *JSONLJob
+		for _, job := range jsonlJobs {
+			if job.Status != JSONLJobRunning && (oldest == nil || job.created.Before(oldest.created)) {
+				oldest = job
+			}
+		}
+		if oldest == nil {
+			return nil, fmt.Errorf("jsonl: %d jobs are running", len(jsonlJobs))
+		}
+		delete(jsonlJobs, oldest.ID)
+	}
+	job := &JSONLJob{ID: newRequestID(), Status: JSONLJobRunning, Ruleset: rulesetKey(ruleset), TotalBytes: totalBytes, created: time.Now(),
+		ruleset: ruleset}
+	jsonlJobs[job.ID] = job
+	return job, nil
+}
+
+// getJSONLJob returns a copy of the job, nil when it is unknown
+func getJSONLJob(id string) *JSONLJob {
+	jsonlJobLock.Lock()
+	defer jsonlJobLock.Unlock()
+	job, ok := jsonlJobs[id]
+	if !ok {
+		return nil
+	}
+	c := *job
+	return &c
+}
+
+// failJSONLJob ends the job with the error
+func failJSONLJob(job *JSONLJob, err error) {
+	jsonlJobLock.Lock()
+	defer jsonlJobLock.Unlock()
+	job.Status = JSONLJobError
+	job.ErrorMsg = err.Error()
+}
+
+// runJSONLJob validates the spooled file of the job, and removes it
+func runJSONLJob(job *JSONLJob, path string) {
+	defer os.Remove(path)
+	f, err := os.Open(path)
+	var report *JSONLReport
+	if err == nil {
+		report, err = ValidateJSONLines(f, job.ruleset, time.Second, func(p JSONLProgress) {
+			jsonlJobLock.Lock()
+			job.Progress = p
+			jsonlJobLock.Unlock()
+		})
+		f.Close()
+	}
+	if err != nil {
+		failJSONLJob(job, err)
+		return
+	}
+	jsonlJobLock.Lock()
+	defer jsonlJobLock.Unlock()
+	job.Status = JSONLJobDone
+	job.Report = report
+}
+
+// POST /api/validation/jsonl?ruleset=<ruleset> service implementation,
+// the body, up to MaxJSONLBytes, is spooled to a temporary file, and
+// validated in background.  It responds HTTP 202 with the job, polled at
+// its Location.
+func ValidateJSONLinesAsync(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+	writeError := func(status int, err error) {
+		w.WriteHeader(status)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+	}
+	ruleset := requestRuleset(r)
+	if err := CheckRuleset(ruleset); err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	// the job is taken before the body is spooled, so the jobs cap the
+	// spooled bodies
+	job, err := newJSONLJob(ruleset, 0)
+	if err != nil {
+		writeError(http.StatusServiceUnavailable, err)
+		return
+	}
+	f, err := os.CreateTemp("", "validation-jsonl-*")
+	if err != nil {
+		failJSONLJob(job, err)
+		writeError(http.StatusInternalServerError, err)
+		return
+	}
+	size, err := io.Copy(f, http.MaxBytesReader(w, r.Body, MaxJSONLBytes))
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		failJSONLJob(job, err)
+		status := http.StatusBadRequest
+		if _, ok := err.(*http.MaxBytesError); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(status, err)
+		return
+	}
+	jsonlJobLock.Lock()
+	job.TotalBytes = size
+	snapshot := *job
+	jsonlJobLock.Unlock()
+	go runJSONLJob(job, f.Name())
+
+	w.Header().Set("Location", "/api/validation/jsonl/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	resStr, _ := json.Marshal(snapshot)
+	io.WriteString(w, string(resStr))
+}
+
+// GET /api/validation/jsonl/{jobID} service implementation, the progress
+// of the job, and its report when it is done
+func GetJSONLJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	job := getJSONLJob(chi.URLParam(r, "jobID"))
+	if job == nil {
+		w.WriteHeader(http.StatusNotFound)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: "jsonl: unknown job"}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(job)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,103 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateJSONLines(t *testing.T) {
+	node := RuleNode{Name: "jsonl_test_status"}
+	json.Unmarshal([]byte(`{"operator": "MATCHES", "operands": [{"value": "^[0-9]{3}$"}, {"field": "jsonl_test.status"}]}`), &node.RuleContent)
+	registerTestRule(t, &node)
+	defer func(size int) { JSONLSampleSize = size }(JSONLSampleSize)
+	JSONLSampleSize = 2
+
+	lines := []string{}
+	for i := 0; i < 100; i++ {
+		status := "200"
+		if i%10 == 0 {
+			status = "OK"
+		}
+		lines = append(lines, fmt.Sprintf(`{"jsonl_test": {"status": "%s"}}`, status))
+	}
+	lines = append(lines, "", "not json", `{"jsonl_test": {"status": "404"}}`)
+	progressed := int64(0)
+	report, err := ValidateJSONLines(strings.NewReader(strings.Join(lines, "\n")), "", time.Hour, func(p JSONLProgress) {
+		progressed = p.Lines
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Lines != 102 || report.Passed != 91 || report.Failed != 10 || report.Invalid != 1 || progressed != 102 {
+		t.Errorf("expected 102 lines, 91 passed, 10 failed, 1 invalid, got %+v, progress %d", report, progressed)
+	}
+	summary := report.Rules["jsonl_test_status"]
+	if summary == nil || summary.Violations != 10 || len(summary.Samples) != 2 || summary.Samples[0].Line%10 != 1 {
+		t.Errorf("expected 10 violations with 2 samples, got %+v", summary)
+	}
+	if len(report.InvalidSamples) != 1 || report.InvalidSamples[0].Line != 102 || report.InvalidSamples[0].Text != "********" {
+		t.Errorf("expected the invalid line 102, got %+v", report.InvalidSamples)
+	}
+
+	// the samples are redacted, the fields not listed are masked
+	sample := func() string {
+		report, err := ValidateJSONLines(strings.NewReader(`{"jsonl_test": {"status": "OK"}, "password": "secret"}`), "", 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples := report.Rules["jsonl_test_status"].Samples
+		if len(samples) != 1 || strings.Contains(samples[0].Text, "secret") {
+			t.Fatalf("expected the redacted sample, got %+v", samples)
+		}
+		return samples[0].Text
+	}
+	if text := sample(); !strings.Contains(text, `"jsonl_test.status":"**"`) {
+		t.Errorf("expected the masked status, got %s", text)
+	}
+	defer func(config RedactionConfig) { Redaction = config }(Redaction)
+	Redaction = RedactionConfig{Fields: map[string]FieldRedaction{"jsonl_test.status": {Mode: RedactionShow}}}
+	if text := sample(); !strings.Contains(text, `"jsonl_test.status":"OK"`) {
+		t.Errorf("expected the listed status, got %s", text)
+	}
+
+	defer func(size int) { MaxJSONLLineBytes = size }(MaxJSONLLineBytes)
+	MaxJSONLLineBytes = 100
+	long := `{"jsonl_test": {"status": "` + strings.Repeat("2", 200) + `"}}`
+	if _, err := ValidateJSONLines(strings.NewReader("{}\n"+long), "", 0, nil); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected the line 2 to be too long, got %v", err)
+	}
+}
+
+func TestValidateJSONLinesAsyncLimits(t *testing.T) {
+	defer func(jobs int, size int64) { MaxJSONLJobs, MaxJSONLBytes = jobs, size }(MaxJSONLJobs, MaxJSONLBytes)
+	jsonlJobLock.Lock()
+	saved := jsonlJobs
+	jsonlJobs = map[string]*JSONLJob{"running": {ID: "running", Status: JSONLJobRunning}}
+	jsonlJobLock.Unlock()
+	defer func() {
+		jsonlJobLock.Lock()
+		jsonlJobs = saved
+		jsonlJobLock.Unlock()
+	}()
+
+	post := func(body *countingReader) int {
+		w := httptest.NewRecorder()
+		ValidateJSONLinesAsync(w, httptest.NewRequest("POST", "/api/validation/jsonl", body))
+		return w.Code
+	}
+	MaxJSONLJobs = 1
+	body := &countingReader{r: strings.NewReader(`{"a": 1}`)}
+	if code := post(body); code != http.StatusServiceUnavailable || atomic.LoadInt64(&body.read) != 0 {
+		t.Errorf("expected HTTP 503 without reading the body, got %d, %d bytes read", code, atomic.LoadInt64(&body.read))
+	}
+	MaxJSONLJobs, MaxJSONLBytes = 10, 10
+	if code := post(&countingReader{r: strings.NewReader(strings.Repeat("{}\n", 10))}); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected HTTP 413, got %d", code)
+	}
+}
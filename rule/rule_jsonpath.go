@@ -0,0 +1,90 @@
+package rule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// isJSONPath checks the field name is a JSONPath expression, "$.a.b" or
+// "$['a']", rather than the flattened field name, "a.b"
+func isJSONPath(name string) bool {
+	return strings.HasPrefix(name, "$.") || strings.HasPrefix(name, "$[")
+}
+
+// parseJSONPath converts the JSONPath expression into the flattened field
+// name of the input fields, the same field name the input parser produces,
+//   $.address.zip_code      address.zip_code
+//   $['first name']         first name
+//   $.addresses[0].zip_code addresses[0].zip_code
+//   $.addresses[*].zip_code addresses[*].zip_code, any array item
+//   $..email                ..email, at any depth
+// The filters, the slices and the member wildcard, ".*", are not supported.
+func parseJSONPath(expr string) (string, error) {
+	var b strings.Builder
+	rest := expr[1:] // skip "$"
+	for len(rest) > 0 {
+		switch {
+		case strings.HasPrefix(rest, recursiveDescent):
+			rest = rest[len(recursiveDescent):]
+			name, n := jsonPathMemberName(rest)
+			if n == 0 {
+				return "", fmt.Errorf("JSONPath, %s, recursive descent without a member name", expr)
+			}
+			b.WriteString(recursiveDescent + name)
+			rest = rest[n:]
+		case rest[0] == '.':
+			rest = rest[1:]
+			name, n := jsonPathMemberName(rest)
+			if n == 0 || name == "*" {
+				return "", fmt.Errorf("JSONPath, %s, unsupported member name", expr)
+			}
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(name)
+			rest = rest[n:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return "", fmt.Errorf("JSONPath, %s, unterminated [", expr)
+			}
+			sel := strings.TrimSpace(rest[1:end])
+			switch {
+			case sel == "*":
+				b.WriteString(wildcardIndex)
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				// a quoted member name, may contain "." and spaces
+				if b.Len() > 0 {
+					b.WriteString(".")
+				}
+				b.WriteString(sel[1 : len(sel)-1])
+			default:
+				if _, err := strconv.ParseUint(sel, 10, 32); err != nil {
+					return "", fmt.Errorf("JSONPath, %s, unsupported selector, [%s]", expr, sel)
+				}
+				if b.Len() == 0 {
+					return "", fmt.Errorf("JSONPath, %s, the input document is not an array", expr)
+				}
+				b.WriteString("[" + sel + "]")
+			}
+			rest = rest[end+1:]
+		default:
+			return "", fmt.Errorf("JSONPath, %s, unexpected %q", expr, rest[0])
+		}
+	}
+	if b.Len() == 0 {
+		return "", fmt.Errorf("JSONPath, %s, addresses no field, use %s for the document", expr, DocumentField)
+	}
+	return b.String(), nil
+}
+
+// jsonPathMemberName returns the dot-notation member name at the start of
+// s, and its length
+func jsonPathMemberName(s string) (string, int) {
+	n := strings.IndexAny(s, ".[")
+	if n < 0 {
+		n = len(s)
+	}
+	return s[:n], n
+}
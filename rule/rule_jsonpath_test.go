@@ -0,0 +1,58 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var jsonPathTestCases = []struct {
+	expr     string
+	expected string
+	valid    bool
+}{
+	{"$.address.zip_code", "address.zip_code", true},
+	{"$['first name']", "first name", true},
+	{`$.user["e.mail"]`, "user.e.mail", true},
+	{"$.addresses[0].zip_code", "addresses[0].zip_code", true},
+	{"$.addresses[*].zip_code", "addresses[*].zip_code", true},
+	{"$..email", "..email", true},
+	{"$.user..email", "user..email", true},
+	{"$", "", false},
+	{"$.user.*", "", false},
+	{"$.items[0:2]", "", false},
+	{"$.items[?(@.id)]", "", false},
+	{"$[0]", "", false},
+	{"$..", "", false},
+}
+
+func TestParseJSONPath(t *testing.T) {
+	for _, tc := range jsonPathTestCases {
+		name, err := parseJSONPath(tc.expr)
+		if (err == nil) != tc.valid || name != tc.expected {
+			t.Errorf("%s: expected %q %v, got %q %v", tc.expr, tc.expected, tc.valid, name, err)
+		}
+	}
+}
+
+func TestJSONPathRule(t *testing.T) {
+	// every email, at any depth, has "@"
+	node := RuleNode{Name: "jsonpath_test_email"}
+	rule := `{"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "$..jsonpath_test_email"}]}`
+	if err := json.Unmarshal([]byte(rule), &node.RuleContent); err != nil {
+		t.Fatal(err)
+	}
+	registerTestRule(t, &node)
+
+	doc := map[string]interface{}{}
+	json.Unmarshal([]byte(`{"jsonpath_test_email": "a@example.com",
+		"user": {"jsonpath_test_email": "b.example.com", "contacts": [{"jsonpath_test_email": "c@example.com"}]}}`), &doc)
+	expectedPaths := map[string][]string{"jsonpath_test_email": {"user.jsonpath_test_email"}}
+	result, err := ValidateInputJSONByRules("", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.flag || !reflect.DeepEqual(result.paths, expectedPaths) {
+		t.Errorf("expected the failing paths %v, got %v %v", expectedPaths, result.flag, result.paths)
+	}
+}
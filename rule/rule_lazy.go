@@ -0,0 +1,79 @@
+package rule
+
+// lazyOperator evaluates the operands on demand, e.g. IF doesn't
+// evaluate the branch not taken, which may refer to a field missing in
+// the input.  A lazy operator is registered in RegisteredOperators as
+// well, to parse the rules.
+type lazyOperator func(cx EvalContext, operands []Operand) (interface{}, error)
+
+var lazyOperators = map[OperatorType]lazyOperator{
+	IfOperator:          evaluateIf,
+	RequiredIfOperator:  evaluateRequiredIf,
+	ForbiddenIfOperator: evaluateForbiddenIf,
+	// not lazy, but an isolated evaluation doesn't record the value
+	UniqueInScopeOperator: evaluateUniqueInScope,
+	// the field of the old version of the document
+	OldOperator:           evaluateOld,
+	ChangedOperator:       evaluateChanged,
+	ChangePercentOperator: evaluateChangePercent,
+}
+
+// evaluateIf evaluates IF(condition, then[, else])
+func evaluateIf(cx EvalContext, operands []Operand) (interface{}, error) {
+	if len(operands) != 2 && len(operands) != 3 {
+		return nil, ParseRuleOperatorError
+	}
+	res, err := operands[0].Evaluate(cx)
+	if err != nil {
+		return nil, err
+	}
+	cond, ok := res.(bool)
+	if !ok {
+		return nil, ParseRuleOperatorError
+	}
+	if cond {
+		return operands[1].Evaluate(cx)
+	} else if len(operands) == 3 {
+		return operands[2].Evaluate(cx)
+	}
+	return true, nil
+}
+
+// evaluateRequiredIf evaluates REQUIRED_IF(document, path, condition)
+func evaluateRequiredIf(cx EvalContext, operands []Operand) (interface{}, error) {
+	return evaluateDependentField(cx, operands, true)
+}
+
+// evaluateForbiddenIf evaluates FORBIDDEN_IF(document, path, condition)
+func evaluateForbiddenIf(cx EvalContext, operands []Operand) (interface{}, error) {
+	return evaluateDependentField(cx, operands, false)
+}
+
+// evaluateDependentField evaluates the condition first, a condition on a
+// field missing in the input is not met, and then the presence of the
+// dependent field only when it is met
+func evaluateDependentField(cx EvalContext, operands []Operand, required bool) (interface{}, error) {
+	if len(operands) != 3 {
+		return nil, ParseRuleOperatorError
+	}
+	res, err := operands[2].Evaluate(cx)
+	if err == EvalFieldMissingError {
+		return true, nil
+	} else if err != nil {
+		return nil, err
+	}
+	cond, ok := res.(bool)
+	if !ok {
+		return nil, ParseRuleOperatorError
+	} else if !cond {
+		return true, nil
+	}
+	evalResult := make([]interface{}, 3)
+	for i, op := range operands[:2] {
+		if evalResult[i], err = op.Evaluate(cx); err != nil {
+			return nil, err
+		}
+	}
+	evalResult[2] = cond
+	return dependentField(evalResult, required)
+}
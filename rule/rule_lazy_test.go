@@ -0,0 +1,51 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDependentFieldRules(t *testing.T) {
+	rules := []string{
+		`{"name": "dependent_test_shipping", "rule": {"operator": "REQUIRED_IF", "operands": [
+			{"field": "$document"}, {"value": "dependent_test_address"},
+			{"operator": "EQUAL_TO", "operands": [{"field": "dependent_test_delivery"}, {"value": "ship"}]}]}}`,
+		`{"name": "dependent_test_po_box", "rule": {"operator": "FORBIDDEN_IF", "operands": [
+			{"field": "$document"}, {"value": "dependent_test_po_box"},
+			{"operator": "EQUAL_TO", "operands": [{"field": "dependent_test_country"}, {"value": "DE"}]}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	testCases := []struct {
+		input  string
+		failed []string
+	}{
+		{`{"dependent_test_delivery": "ship", "dependent_test_address": {"city": "Berlin"}}`, nil},
+		{`{"dependent_test_delivery": "ship", "dependent_test_address": null}`, []string{"dependent_test_shipping"}},
+		{`{"dependent_test_delivery": "ship"}`, []string{"dependent_test_shipping"}},
+		{`{"dependent_test_delivery": "pickup"}`, nil},
+		{`{"dependent_test_country": "DE", "dependent_test_po_box": "1234"}`, []string{"dependent_test_po_box"}},
+		{`{"dependent_test_country": "FR", "dependent_test_po_box": "1234"}`, nil},
+		{`{"dependent_test_po_box": "1234"}`, nil},
+	}
+	for _, tc := range testCases {
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(tc.input), &doc); err != nil {
+			t.Fatal(err)
+		}
+		result, err := ValidateInputJSONByRules("", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != (len(tc.failed) == 0) || !reflect.DeepEqual(result.rules, tc.failed) {
+			t.Errorf("%s: expected the failed rules %v, got %v %v", tc.input, tc.failed, result.flag, result.rules)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// A rule goes through the lifecycle states,
+//   draft => pending (submit) => published (approve) => retired (retire)
+// and only a published rule is evaluated.  A rule without "state" is
+// published, e.g. the rules of the deployed rule files.  The approval is
+// the two-person review: the approver, the UserHeader of the approve
+// request, must be another person than the author of the rule, the
+// UserHeader of its creation.  With RequireApproval a rule created by
+// POST /admin/rule is a draft, and can't be published but by the approval.
+
+const (
+	RuleStateDraft     = "draft"
+	RuleStatePending   = "pending"
+	RuleStatePublished = "published"
+	RuleStateRetired   = "retired"
+)
+
+// the lifecycle actions of POST /admin/rule/{ruleName}/{action}
+const (
+	RuleActionSubmit  = "submit"
+	RuleActionApprove = "approve"
+	RuleActionRetire  = "retire"
+)
+
+// UserHeader is the request header of the person changing the rules, set
+// by the authenticating proxy
+const UserHeader = "X-User"
+
+// RequireApproval makes the rules created by the API drafts
+var RequireApproval = false
+
+var RuleStateTransitionError = errors.New("rule lifecycle: the action doesn't apply to the rule state")
+var RuleSelfApprovalError = errors.New("rule lifecycle: the approver must be another person than the author")
+var RuleUserMissingError = errors.New("rule lifecycle: the " + UserHeader + " header is missing")
+var RuleRegressionError = errors.New("rule lifecycle: the approval fails the regression check")
+
+// the states an action applies to, and the state it leads to
+var ruleTransitions = map[string]struct {
+	from []string
+	to   string
+}{
+	RuleActionSubmit:  {[]string{RuleStateDraft}, RuleStatePending},
+	RuleActionApprove: {[]string{RuleStateDraft, RuleStatePending}, RuleStatePublished},
+	RuleActionRetire:  {[]string{RuleStatePublished}, RuleStateRetired},
+}
+
+type RuleStateResponseMsg struct {
+	Result     string            `json:"result"`
+	Name       string            `json:"name"`
+	State      string            `json:"state"`
+	Regression *RegressionReport `json:"regression,omitempty"`
+}
+
+// normalizeRuleState checks the rule state, "" is RuleStatePublished
+func normalizeRuleState(state string) (string, error) {
+	switch state {
+	case "":
+		return RuleStatePublished, nil
+	case RuleStateDraft, RuleStatePending, RuleStatePublished, RuleStateRetired:
+		return state, nil
+	}
+	return "", fmt.Errorf("unknown rule state, %s", state)
+}
+
+// published reports the rule is in the published state, a rule entry
+// without a state is
+func (entry *RuleEntry) published() bool {
+	return entry.State == "" || entry.State == RuleStatePublished
+}
+
+// live reports the rule is published and enabled
+func (entry *RuleEntry) live() bool {
+	return entry.published() && !entry.Disabled
+}
+
+// TransitionRule applies the lifecycle action to the registered rule named
+// name on behalf of user, and returns the new state.  The approval is
+// checked by the regression corpus, a draft fails no document at its
+// creation, and a blocked one fails by RuleRegressionError with the
+// report, unless force.
+func TransitionRule(name string, action string, user string, force bool) (string, *RegressionReport, error) {
+	transition, ok := ruleTransitions[action]
+	if !ok {
+		return "", nil, fmt.Errorf("rule lifecycle: unknown action, %s", action)
+	}
+	var report *RegressionReport
+	var checked *RuleEntry
+	if action == RuleActionApprove && Regression != nil {
+		RegRuleLock.RLock()
+		checked = findRuleByName(name)
+		err := checkTransition(checked, name, transition.from, action, user)
+		var published RuleEntry
+		if err == nil {
+			published = *checked
+		}
+		RegRuleLock.RUnlock()
+		if err != nil {
+			return "", nil, err
+		}
+		published.State = RuleStatePublished
+		if report, err = checkRuleRegressionOf(&published, checked); err != nil {
+			return "", nil, err
+		}
+		if report.Blocked && !force {
+			return "", report, RuleRegressionError
+		}
+	}
+
+	RegRuleLock.Lock()
+	defer RegRuleLock.Unlock()
+	entry := findRuleByName(name)
+	if err := checkTransition(entry, name, transition.from, action, user); err != nil {
+		return "", nil, err
+	}
+	if checked != nil && entry != checked {
+		return "", nil, fmt.Errorf("%w, %s is updated during the regression check", RuleStateTransitionError, name)
+	}
+	if action == RuleActionApprove {
+		entry.Approver = user
+	}
+	entry.State = transition.to
+	return entry.State, report, nil
+}
+
+// checkTransition checks the action from the states applies to entry,
+// the registered rule named name, on behalf of user
+func checkTransition(entry *RuleEntry, name string, from []string, action string, user string) error {
+	if entry == nil {
+		return fmt.Errorf("rule lifecycle: rule name, %s, is not found", name)
+	}
+	if err := checkRuleNamespace(entry, user); err != nil {
+		return err
+	}
+	state := entry.State
+	if len(state) == 0 {
+		state = RuleStatePublished
+	}
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || s == state
+	}
+	if !allowed {
+		return fmt.Errorf("%w, %s is %s", RuleStateTransitionError, name, state)
+	}
+	if action == RuleActionApprove {
+		if len(user) == 0 {
+			return RuleUserMissingError
+		} else if user == entry.Author {
+			return RuleSelfApprovalError
+		}
+	}
+	return nil
+}
+
+// POST /admin/rule/{ruleName}/{action}?force=true service implementation,
+// the action is submit, approve or retire
+func SetRuleState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := chi.URLParam(r, "ruleName")
+	force := r.URL.Query().Get("force") == "true"
+	state, report, err := TransitionRule(name, chi.URLParam(r, "action"), r.Header.Get(UserHeader), force)
+	if err != nil {
+		switch {
+		case errors.Is(err, RuleRegressionError):
+			writeRegressionError(w, name, report)
+			return
+		case errors.Is(err, RuleStateTransitionError):
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, RuleSelfApprovalError), errors.Is(err, RuleNamespaceForbiddenError):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, RuleUserMissingError):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	RecordAudit(chi.URLParam(r, "action"), name, r.Header.Get(UserHeader), 0)
+	w.WriteHeader(http.StatusOK)
+	res := RuleStateResponseMsg{Result: RuleMgmtSucc, Name: name, State: state, Regression: report}
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
+
+// prepareRuleCreation sets the author and the namespace of the rule created
+// by the API, and with RequireApproval makes it a draft, a rule can't be
+// created published
+func prepareRuleCreation(node *RuleNode, user string) error {
+	node.author = user
+	if err := applyPrincipalNamespace(node, user); err != nil {
+		return err
+	}
+	if !RequireApproval {
+		return nil
+	}
+	if len(user) == 0 {
+		return RuleUserMissingError
+	}
+	switch node.State {
+	case "":
+		node.State = RuleStateDraft
+	case RuleStateDraft, RuleStatePending:
+	default:
+		return fmt.Errorf("%w, a rule is published by the approval only", RuleStateTransitionError)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRuleLifecycle(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "lifecycle_test_zip",
+		"rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "lifecycle_test_zip"}]}}`), &node)
+	defer func(require bool) { RequireApproval = require }(RequireApproval)
+	RequireApproval = true
+	if err := prepareRuleCreation(&node, ""); !errors.Is(err, RuleUserMissingError) {
+		t.Errorf("expected the missing user error, got %v", err)
+	}
+	if err := prepareRuleCreation(&node, "alice"); err != nil || node.State != RuleStateDraft {
+		t.Fatalf("expected a draft, got %q %v", node.State, err)
+	}
+	entry := registerTestRule(t, &node)
+
+	validate := func() bool {
+		result, err := ValidateInputJSONByRules("", map[string]interface{}{"lifecycle_test_zip": "9006"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.flag
+	}
+	if !validate() {
+		t.Errorf("expected the draft rule not to be evaluated")
+	}
+	if _, _, err := TransitionRule("lifecycle_test_zip", RuleActionRetire, "bob", false); !errors.Is(err, RuleStateTransitionError) {
+		t.Errorf("expected the transition error, got %v", err)
+	}
+	if state, _, err := TransitionRule("lifecycle_test_zip", RuleActionSubmit, "alice", false); err != nil || state != RuleStatePending {
+		t.Errorf("expected pending, got %q %v", state, err)
+	}
+	if _, _, err := TransitionRule("lifecycle_test_zip", RuleActionApprove, "alice", false); !errors.Is(err, RuleSelfApprovalError) {
+		t.Errorf("expected the self-approval error, got %v", err)
+	}
+	if state, _, err := TransitionRule("lifecycle_test_zip", RuleActionApprove, "bob", false); err != nil || state != RuleStatePublished {
+		t.Errorf("expected published, got %q %v", state, err)
+	}
+	if validate() || entry.Approver != "bob" {
+		t.Errorf("expected the published rule to fail the input, approved by bob, got %q", entry.Approver)
+	}
+	if state, _, err := TransitionRule("lifecycle_test_zip", RuleActionRetire, "bob", false); err != nil || state != RuleStateRetired {
+		t.Errorf("expected retired, got %q %v", state, err)
+	}
+	if !validate() {
+		t.Errorf("expected the retired rule not to be evaluated")
+	}
+}
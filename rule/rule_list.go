@@ -0,0 +1,227 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// the page size of the rule list, by default and at most
+const (
+	DefaultRuleListLimit = 50
+	MaxRuleListLimit     = 500
+)
+
+// RuleListFilter selects the rules of the rule list, the rules referencing
+// Field, the primary field or another one, and the rules which name
+// starts with Prefix, "" selects all
+type RuleListFilter struct {
+	Field  string
+	Prefix string
+}
+
+// selects reports the filter selects the rule
+func (filter RuleListFilter) selects(entry *RuleEntry) bool {
+	if !strings.HasPrefix(entry.Name, filter.Prefix) {
+		return false
+	}
+	if len(filter.Field) == 0 {
+		return true
+	}
+	for _, field := range entry.Fields {
+		if field == filter.Field {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleListItem is a rule of the rule list, its summary and its rule body in
+// the rules.json form, and in the DSL form when it has one
+type RuleListItem struct {
+	RuleSummary
+	DSL  string          `json:"dsl,omitempty"`
+	Rule json.RawMessage `json:"rule"`
+}
+
+// RuleListResponseMsg is a page of the rule list, Total counts the rules of
+// all the pages
+type RuleListResponseMsg struct {
+	Rules []RuleListItem `json:"rules"`
+	Page  int            `json:"page"`
+	Limit int            `json:"limit"`
+	Total int            `json:"total"`
+}
+
+// ListRules lists the page, from 1, of the registered rules selected by
+// the filter, sorted by name
+func ListRules(filter RuleListFilter, page int, limit int) (*RuleListResponseMsg, error) {
+	if page < 1 {
+		return nil, fmt.Errorf("rule list: invalid page, %d", page)
+	}
+	if limit < 1 || limit > MaxRuleListLimit {
+		return nil, fmt.Errorf("rule list: limit, %d, is not in [1, %d]", limit, MaxRuleListLimit)
+	}
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	entries := []*RuleEntry{}
+	for _, entry := range AllRegisteredRuleIDs {
+		if filter.selects(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	// a page past the last one is rejected, (page-1)*limit can't overflow
+	pages := (len(entries) + limit - 1) / limit
+	if page > 1 && page > pages {
+		return nil, fmt.Errorf("rule list: page, %d, is past the last page, %d", page, pages)
+	}
+	res := &RuleListResponseMsg{Rules: []RuleListItem{}, Page: page, Limit: limit, Total: len(entries)}
+	entries = entries[(page-1)*limit:]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for _, entry := range entries {
+		item := RuleListItem{RuleSummary: entry.summary()}
+		c, err := canonicalOperand(entry.Rule)
+		if err != nil {
+			return nil, err
+		}
+		if item.Rule, err = marshalCanonical(c, ""); err != nil {
+			return nil, err
+		}
+		if item.DSL, err = ruleDSL(entry.Rule); err != nil {
+			return nil, err
+		}
+		res.Rules = append(res.Rules, item)
+	}
+	return res, nil
+}
+
+// ruleListQuery parses the page and the limit of the rule list
+func ruleListQuery(r *http.Request) (page int, limit int, err error) {
+	page, limit = 1, DefaultRuleListLimit
+	if s := r.URL.Query().Get("page"); len(s) > 0 {
+		if page, err = strconv.Atoi(s); err != nil {
+			return 0, 0, fmt.Errorf("rule list: invalid page, %s", s)
+		}
+	}
+	if s := r.URL.Query().Get("limit"); len(s) > 0 {
+		if limit, err = strconv.Atoi(s); err != nil {
+			return 0, 0, fmt.Errorf("rule list: invalid limit, %s", s)
+		}
+	}
+	return page, limit, nil
+}
+
+// GET /admin/rule?page=1&limit=50&field=<field>&prefix=<name prefix>
+// service implementation
+func GetRuleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	page, limit, err := ruleListQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	filter := RuleListFilter{Field: r.URL.Query().Get("field"), Prefix: r.URL.Query().Get("prefix")}
+	res, err := ListRules(filter, page, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
+
+// RuleDetail is the full definition of a registered rule, with its rule
+// body in the rules.json form and its creation time
+type RuleDetail struct {
+	RuleSummary
+	Namespace      string        `json:"namespace,omitempty"`
+	Fields         []string      `json:"fields"`
+	Required       bool          `json:"required,omitempty"`
+	Priority       int           `json:"priority,omitempty"`
+	Severity       string        `json:"severity,omitempty"`
+	ValidFrom      *time.Time    `json:"valid-from,omitempty"`
+	ValidUntil     *time.Time    `json:"valid-until,omitempty"`
+	OnExpiry       string        `json:"on-expiry,omitempty"`
+	NullPolicy     FieldPolicy   `json:"null-policy,omitempty"`
+	MissingPolicy  FieldPolicy   `json:"missing-policy,omitempty"`
+	Message        string        `json:"message,omitempty"`
+	ErrorCode      string        `json:"error-code,omitempty"`
+	Enforcement    *float64      `json:"enforcement,omitempty"`
+	EnforcementKey string        `json:"enforcement-key,omitempty"`
+	Environments   []string      `json:"environments,omitempty"`
+	References     []string      `json:"references,omitempty"`
+	Examples       *RuleExamples `json:"examples,omitempty"`
+	Author         string        `json:"author,omitempty"`
+	Approver       string        `json:"approver,omitempty"`
+	Created        time.Time     `json:"created"`
+	Fingerprint    string        `json:"fingerprint"`
+	Version        int           `json:"version"`
+	Warnings       []string      `json:"warnings,omitempty"`
+	Expression     string        `json:"expression"`
+	DSL            string        `json:"dsl,omitempty"`
+	Rule           interface{}   `json:"rule"`
+}
+
+// RuleDetailOf returns the full definition of the named rule
+func RuleDetailOf(name string) (*RuleDetail, error) {
+	RegRuleLock.RLock()
+	entry := findRuleByName(name)
+	if entry == nil {
+		RegRuleLock.RUnlock()
+		return nil, fmt.Errorf("rule name, %s, is not found", name)
+	}
+	detail := &RuleDetail{RuleSummary: entry.summary(), Namespace: entry.Namespace, Fields: entry.Fields, Required: entry.Required,
+		Priority: entry.Priority, Severity: entry.Severity, ValidFrom: utcTime(entry.ValidFrom), ValidUntil: utcTime(entry.ValidUntil),
+		OnExpiry: entry.OnExpiry, NullPolicy: entry.NullPolicy, MissingPolicy: entry.MissingPolicy, ErrorCode: entry.ErrorCode,
+		Enforcement: entry.Enforcement, EnforcementKey: entry.EnforcementKey, Environments: entry.Environments,
+		References: entry.References, Examples: entry.Examples, Author: entry.Author, Approver: entry.Approver,
+		Created: entry.Created, Fingerprint: entry.Fingerprint, Version: entry.Version, Warnings: entry.Warnings}
+	if entry.Message != nil {
+		// the template source, re-printed from its parse tree
+		detail.Message = entry.Message.Root.String()
+	}
+	RegRuleLock.RUnlock()
+
+	// the operand tree doesn't change once the rule is registered
+	var err error
+	if detail.Rule, err = canonicalOperand(entry.Rule); err != nil {
+		return nil, err
+	}
+	if detail.Expression, err = ruleExpression(entry.Rule); err != nil {
+		return nil, err
+	}
+	if detail.DSL, err = ruleDSL(entry.Rule); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// GET /admin/rule/{ruleName} service implementation
+func GetRuleDetail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	detail, err := RuleDetailOf(chi.URLParam(r, "ruleName"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	// the version an update is conditional on, by If-Match
+	w.Header().Set("ETag", ruleETag(detail.Version))
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(detail)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,87 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListRules(t *testing.T) {
+	for _, rule := range []string{
+		`{"name": "list_test_a", "rule": {"operator": "GREATER_THAN", "operands": [{"field": "list_test_age"}, {"value": 17}]}}`,
+		`{"name": "list_test_b", "expression": "list_test_limit > list_test_age"}`,
+		`{"name": "list_test_c", "expression": "length(list_test_name) > 0"}`} {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+	list := func(query string) (*httptest.ResponseRecorder, RuleListResponseMsg) {
+		w := httptest.NewRecorder()
+		GetRuleList(w, httptest.NewRequest("GET", "/admin/rule"+query, nil))
+		res := RuleListResponseMsg{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+	w, res := list("?prefix=list_test_&limit=2&page=2")
+	if w.Code != http.StatusOK || res.Total != 3 || len(res.Rules) != 1 || res.Rules[0].Name != "list_test_c" || !res.Rules[0].Enabled {
+		t.Errorf("expected the second page of list_test_c, got %d %s", w.Code, w.Body.String())
+	}
+	if body := string(res.Rules[0].Rule); !strings.Contains(body, `"operator":"GREATER_THAN"`) {
+		t.Errorf("expected the rule body, got %s", body)
+	}
+	if dsl := res.Rules[0].DSL; dsl != "length(list_test_name) > 0" {
+		t.Errorf("expected the DSL form of the rule, got %q", dsl)
+	}
+	_, res = list("?field=list_test_age")
+	names := []string{}
+	for _, item := range res.Rules {
+		names = append(names, item.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"list_test_a", "list_test_b"}) {
+		t.Errorf("expected the rules of list_test_age, got %v", names)
+	}
+	if _, res = list("?prefix=list_test_none_&page=1"); res.Total != 0 || len(res.Rules) != 0 {
+		t.Errorf("expected an empty page, got %+v", res)
+	}
+	for _, query := range []string{"?page=0", "?limit=501", "?limit=x", "?prefix=list_test_&page=3&limit=2",
+		"?page=9223372036854775807&limit=500", "?page=4611686018427387904&limit=4"} {
+		if w, _ := list(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+
+	// the rule list doesn't keep the registry locked
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "list_test_d", "rule": {"operator": "GREATER_THAN", "operands": [{"field": "list_test_age"}, {"value": 20}]}}`), &node)
+	registerTestRule(t, &node)
+}
+
+func TestGetRuleDetail(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "detail_test_zip", "tags": ["detail_test"], "priority": 3, "message": "{{.Field}} is not 5 digits",
+		"description": "the zip code", "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "detail_test_zip"}]}}`), &node)
+	registerTestRule(t, &node)
+	handler := Handlers()
+	get := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/rule/"+name, nil))
+		return w
+	}
+	w := get("detail_test_zip")
+	detail := map[string]interface{}{}
+	json.Unmarshal(w.Body.Bytes(), &detail)
+	rule, _ := json.Marshal(detail["rule"])
+	if w.Code != http.StatusOK || detail["field"] != "detail_test_zip" || detail["priority"] != 3.0 || detail["description"] != "the zip code" ||
+		detail["message"] != "{{.Field}} is not 5 digits" || detail["created"] == nil || detail["expression"] != `MATCHES("^[0-9]{5}$", detail_test_zip)` ||
+		detail["dsl"] != `matches("^[0-9]{5}$", detail_test_zip)` || string(rule) != `{"operands":[{"value":"^[0-9]{5}$"},{"field":"detail_test_zip"}],"operator":"MATCHES"}` {
+		t.Errorf("expected the rule definition, got %d %s", w.Code, w.Body.String())
+	}
+	if w := get("detail_test_missing"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,109 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+// typedLiteral converts a value literal decoded with json.Number into its
+// native type: an integer is int64, or *big.Int when it overflows int64,
+// and other numbers stay json.Number, so the decimal mode compares their
+// exact decimal rather than the float64 rounding.  Array items are converted
+// as well.
+func typedLiteral(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i, nil
+		}
+		if i, ok := new(big.Int).SetString(value.String(), 10); ok {
+			return i, nil
+		}
+		if _, err := value.Float64(); err != nil {
+			return nil, fmt.Errorf("rule parser: invalid number literal, %s", value)
+		}
+		return value, nil
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			typed, err := typedLiteral(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = typed
+		}
+		return items, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("rule parser: object is not a value literal")
+	}
+	return v, nil
+}
+
+// literalType returns the value type of a literal
+func literalType(v interface{}) ValueType {
+	switch v.(type) {
+	case string:
+		return TypeString
+	case int, int64, *big.Int, float64, json.Number:
+		return TypeNumber
+	case bool:
+		return TypeBool
+	case []interface{}:
+		return TypeArray
+	}
+	// null
+	return TypeAny
+}
+
+// isNumber checks v is a native number
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int64, *big.Int, float64, json.Number:
+		return true
+	}
+	return false
+}
+
+// fieldText returns the text of a field value, a string as is, and the
+// other types in their JSON form, e.g. 6 is "6" and null is "null"
+func fieldText(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// equalValues compares two operand values: numbers are compared
+// numerically when either side is a native number, a bool with the JSON
+// literal of a field value, "true" or "false", strings as strings, and
+// the other types by their value
+func equalValues(v1, v2 interface{}) bool {
+	if isNumber(v1) || isNumber(v2) {
+		n1, err1 := toNumericValue(v1)
+		n2, err2 := toNumericValue(v2)
+		return err1 == nil && err2 == nil && compareNumeric(n1, n2, 0) == 0
+	}
+	if b, ok := v1.(bool); ok {
+		if s, ok := v2.(string); ok {
+			return s == strconv.FormatBool(b)
+		}
+	}
+	if b, ok := v2.(bool); ok {
+		if s, ok := v1.(string); ok {
+			return s == strconv.FormatBool(b)
+		}
+	}
+	s1, ok1 := v1.(string)
+	s2, ok2 := v2.(string)
+	if ok1 && ok2 {
+		return s1 == s2
+	}
+	return reflect.DeepEqual(v1, v2)
+}
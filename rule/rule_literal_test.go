@@ -0,0 +1,73 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+var typedLiteralTestCases = []struct {
+	literal  string
+	field    string
+	expected bool
+}{
+	{`6`, "6", true},
+	{`6`, "6.0", true},
+	{`6.5`, "6", false},
+	{`123456789012345678901234567890`, "123456789012345678901234567890", true},
+	{`true`, "true", true},
+	{`false`, "true", false},
+	{`true`, "1", false},
+	{`null`, "", false},
+	{`"6"`, "6", true},
+	{`[1, 2]`, "1", false},
+}
+
+func TestTypedLiteralEquality(t *testing.T) {
+	for _, tc := range typedLiteralTestCases {
+		term := Term{}
+		rule := `{"operator": "EQUAL_TO", "operands": [{"field": "n"}, {"value": ` + tc.literal + `}]}`
+		if err := json.Unmarshal([]byte(rule), &term); err != nil {
+			t.Fatal(err)
+		}
+		op, err := ConstructOperandListHelper(&term, map[string]int{})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.literal, err)
+		}
+		ctx := FieldEvalContext{Field: "n", FieldValue: tc.field, Rule: op}
+		if res, err := op.Evaluate(&ctx); err != nil || res != tc.expected {
+			t.Errorf("%s == %q: expected %v, got %v %v", tc.literal, tc.field, tc.expected, res, err)
+		}
+	}
+}
+
+func TestTypedLiteral(t *testing.T) {
+	for literal, expected := range map[string]interface{}{"6": int64(6), "6.5": json.Number("6.5"), `"6"`: "6", "true": true} {
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader([]byte(literal)))
+		decoder.UseNumber()
+		decoder.Decode(&v)
+		if typed, err := typedLiteral(v); err != nil || typed != expected {
+			t.Errorf("%s: expected %v, got %v %v", literal, expected, typed, err)
+		}
+	}
+	if typed, err := typedLiteral(json.Number("123456789012345678901234567890")); err != nil || typed.(*big.Int).String() != "123456789012345678901234567890" {
+		t.Errorf("expected the exact big integer, got %v %v", typed, err)
+	}
+	if _, err := typedLiteral(map[string]interface{}{}); err == nil {
+		t.Error("expected an object literal rejected")
+	}
+	for _, tc := range []struct {
+		v1, v2   interface{}
+		expected bool
+	}{
+		{int64(6), "6.0", true},
+		{"6", "6.0", false},
+		{[]interface{}{int64(1)}, []interface{}{int64(1)}, true},
+	} {
+		if equalValues(tc.v1, tc.v2) != tc.expected {
+			t.Errorf("%v == %v: expected %v", tc.v1, tc.v2, tc.expected)
+		}
+	}
+}
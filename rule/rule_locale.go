@@ -0,0 +1,115 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// MessageCatalog is the translations of the violation messages, per rule
+// and per locale, loaded from a JSON file like,
+//   { "default-locale": "en",
+//     "rules": { "zip5": { "en": "{{.Field}} must be 5 digits",
+//                          "fr": "{{.Field}} doit comporter 5 chiffres" } } }
+// The message of a failed rule is picked by the Accept-Language of the
+// request, a locale like "fr-CA" falls back to "fr", then to the default
+// locale, then to the rule's "message".  The placeholders are those of the
+// rule "message".
+type MessageCatalog struct {
+	DefaultLocale string                       `json:"default-locale,omitempty"`
+	Rules         map[string]map[string]string `json:"rules"`
+
+	// the parsed templates, ruleName => locale => template
+	templates map[string]map[string]*template.Template
+}
+
+// the system message catalog, no translation by default
+var Messages = MessageCatalog{}
+
+// LoadMessageCatalog replaces the system message catalog by the JSON file
+func LoadMessageCatalog(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	catalog := MessageCatalog{}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return err
+	}
+	catalog.DefaultLocale = strings.ToLower(catalog.DefaultLocale)
+	catalog.templates = map[string]map[string]*template.Template{}
+	for ruleName, translations := range catalog.Rules {
+		catalog.templates[ruleName] = map[string]*template.Template{}
+		for locale, text := range translations {
+			tmpl, err := parseRuleMessage(ruleName, text)
+			if err != nil {
+				return fmt.Errorf("message catalog: locale, %s, %s", locale, err.Error())
+			}
+			catalog.templates[ruleName][strings.ToLower(locale)] = tmpl
+		}
+	}
+	Messages = catalog
+	return nil
+}
+
+// localize returns the message template of the rule in the first
+// available locale, tmpl, the rule's "message", when none is translated
+func (c MessageCatalog) localize(ruleName string, tmpl *template.Template, locales []string) *template.Template {
+	translations := c.templates[ruleName]
+	if len(translations) == 0 {
+		return tmpl
+	}
+	for _, locale := range locales {
+		if t, ok := translations[locale]; ok {
+			return t
+		}
+		if i := strings.Index(locale, "-"); i > 0 {
+			if t, ok := translations[locale[:i]]; ok {
+				return t
+			}
+		}
+	}
+	if t, ok := translations[c.DefaultLocale]; ok {
+		return t
+	}
+	return tmpl
+}
+
+// parseAcceptLanguage returns the locales of the Accept-Language header in
+// the preference order, lowercase, e.g. "fr-CA,fr;q=0.9,en;q=0.8" is
+// "fr-ca", "fr", "en".  "*" and the locales of q=0 are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	list := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(locale) == 0 || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			list = append(list, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+	locales := make([]string, len(list))
+	for i, w := range list {
+		locales[i] = w.locale
+	}
+	return locales
+}
@@ -0,0 +1,50 @@
+package rule
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLocalizedMessages(t *testing.T) {
+	if locales := parseAcceptLanguage("en;q=0.8, fr-CA,fr;q=0.9, *;q=0.5, de;q=0"); !reflect.DeepEqual(locales, []string{"fr-ca", "fr", "en"}) {
+		t.Errorf("expected fr-ca, fr, en, got %v", locales)
+	}
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "locale_test_zip", "message": "{{.Field}} must be 5 digits",
+	  "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "locale_test.zip"}]}}`), &node)
+	registerTestRule(t, &node)
+
+	catalog := filepath.Join(t.TempDir(), "messages.json")
+	os.WriteFile(catalog, []byte(`{"default-locale": "de", "rules": {"locale_test_zip": {
+	  "fr": "{{.Field}} doit comporter 5 chiffres", "de": "{{.Field}} muss 5 Ziffern haben"}}}`), 0644)
+	defer func(messages MessageCatalog) { Messages = messages }(Messages)
+	if err := LoadMessageCatalog(catalog); err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{"locale_test": map[string]interface{}{"zip": "123"}}
+	for locales, expected := range map[string]string{
+		"fr-CA,en;q=0.5": "locale_test.zip doit comporter 5 chiffres",
+		"es":             "locale_test.zip muss 5 Ziffern haben",
+	} {
+		result, err := ValidateInput("", ValidationOptions{Locales: parseAcceptLanguage(locales)}, ContentTypeJSON, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.messages) != 1 || result.messages[0].Message != expected {
+			t.Errorf("%s: expected %q, got %v", locales, expected, result.messages)
+		}
+	}
+	Messages = MessageCatalog{}
+	result, _ := ValidateInput("", ValidationOptions{Locales: []string{"fr"}}, ContentTypeJSON, doc)
+	if len(result.messages) != 1 || result.messages[0].Message != "locale_test.zip must be 5 digits" {
+		t.Errorf("expected the rule message, got %v", result.messages)
+	}
+
+	os.WriteFile(catalog, []byte(`{"rules": {"locale_test_zip": {"fr": "{{.Unknown}}"}}}`), 0644)
+	if err := LoadMessageCatalog(catalog); err == nil {
+		t.Error("expected an unknown placeholder to fail")
+	}
+}
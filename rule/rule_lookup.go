@@ -0,0 +1,186 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LOOKUP operator calls an external HTTP endpoint to check a field value,
+//   { "operator": "LOOKUP", "operands": [ { "value": "http://host/codes/{value}" }, { "field": "referral_code" } ] }
+// the "{value}" placeholder in the URL template is replaced by the field
+// value, path escaped in the path and query escaped in the query.  HTTP 200
+// evaluates to true, 404 to false, others are errors, the redirects aren't
+// followed.
+// The answers are cached by the operator cache, DefaultOperatorCaches.
+// The calls are denied, unless the URL is under one of
+// LookupAllowedURLPrefixes, set by -lookup-allow.  The circuit breaker of
+// an endpoint opens after LookupBreakerThreshold consecutive failures, is
+// half-open after LookupBreakerCooldown, when a single call probes the
+// endpoint, and closes by its success or opens again by its failure.
+const lookupValuePlaceholder = "{value}"
+
+var (
+	// per-call HTTP timeout
+	LookupTimeout = 2 * time.Second
+	// consecutive failures to open the circuit breaker of an endpoint
+	LookupBreakerThreshold = 5
+	// how long an open circuit breaker rejects calls before a retry
+	LookupBreakerCooldown = 30 * time.Second
+	// the URL must be under one of the prefixes, none allows no call
+	LookupAllowedURLPrefixes []string
+)
+
+var LookupCircuitOpenError = errors.New("lookup operator: circuit breaker open")
+
+// lookupBreaker is a consecutive-failure circuit breaker of one endpoint,
+// closed, open until openUntil, or half-open past it while probing
+type lookupBreaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+type lookupService struct {
+	lock     sync.Mutex
+	client   *http.Client
+	breakers map[string]*lookupBreaker
+}
+
+var lookup = &lookupService{
+	client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}},
+	breakers: map[string]*lookupBreaker{},
+}
+
+// lookupOperator is the LOOKUP OperatorFn, operands are (URL template, value)
+func lookupOperator(operands []interface{}) (interface{}, error) {
+	if len(operands) != 2 {
+		return nil, ParseRuleOperatorError
+	}
+	template, ok1 := operands[0].(string)
+	value, ok2 := operands[1].(string)
+	if !ok1 || !ok2 {
+		return nil, ParseRuleOperatorError
+	}
+	return lookup.check(template, value)
+}
+
+func (l *lookupService) check(template string, value string) (bool, error) {
+	target := lookupURL(template, value)
+	u, err := url.Parse(target)
+	if err != nil {
+		return false, err
+	}
+	if !lookupURLAllowed(u) {
+		return false, fmt.Errorf("lookup operator: URL not allowed by -lookup-allow, %s", template)
+	}
+	endpoint := u.Scheme + "://" + u.Host
+
+	now := time.Now()
+	l.lock.Lock()
+	breaker := l.breakers[endpoint]
+	if breaker == nil {
+		breaker = &lookupBreaker{}
+		l.breakers[endpoint] = breaker
+	}
+	probe := false
+	if !breaker.openUntil.IsZero() {
+		// open, or half-open with a probe on its way
+		if now.Before(breaker.openUntil) || breaker.probing {
+			l.lock.Unlock()
+			return false, LookupCircuitOpenError
+		}
+		breaker.probing, probe = true, true
+	}
+	l.lock.Unlock()
+
+	found, err := l.call(target)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if probe {
+		breaker.probing = false
+	}
+	if err != nil {
+		breaker.failures++
+		if probe || breaker.failures >= LookupBreakerThreshold {
+			breaker.openUntil = time.Now().Add(LookupBreakerCooldown)
+			breaker.failures = 0
+		}
+		return false, err
+	}
+	breaker.failures, breaker.openUntil = 0, time.Time{}
+	return found, nil
+}
+
+// lookupURL replaces the placeholders of template by value, escaped by
+// where the placeholder sits, the path or the query
+func lookupURL(template string, value string) string {
+	query := strings.IndexAny(template, "?#")
+	var b strings.Builder
+	for {
+		i := strings.Index(template, lookupValuePlaceholder)
+		if i < 0 {
+			break
+		}
+		if query >= 0 && i > query {
+			b.WriteString(template[:i] + url.QueryEscape(value))
+		} else {
+			b.WriteString(template[:i] + url.PathEscape(value))
+		}
+		template = template[i+len(lookupValuePlaceholder):]
+		query -= i + len(lookupValuePlaceholder)
+	}
+	b.WriteString(template)
+	return b.String()
+}
+
+func (l *lookupService) call(target string) (bool, error) {
+	client := *l.client
+	client.Timeout = LookupTimeout
+	res, err := client.Get(target)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("lookup operator: unexpected HTTP status %d from %s", res.StatusCode, target)
+}
+
+// SetLookupAllowlist sets LookupAllowedURLPrefixes, each an absolute
+// http(s) URL
+func SetLookupAllowlist(prefixes []string) error {
+	allowed := []string{}
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSpace(prefix)
+		u, err := url.Parse(prefix)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return fmt.Errorf("lookup operator: %s is not an http(s) URL", prefix)
+		}
+		allowed = append(allowed, prefix)
+	}
+	LookupAllowedURLPrefixes = allowed
+	return nil
+}
+
+// lookupURLAllowed reports the URL is under one of the allowed prefixes
+func lookupURLAllowed(u *url.URL) bool {
+	for _, prefix := range LookupAllowedURLPrefixes {
+		if urlUnderPrefix(u, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package rule
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupOperator(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/codes/a":
+			w.WriteHeader(http.StatusOK)
+		case "/codes/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	defer func(prefixes []string, threshold int) {
+		LookupAllowedURLPrefixes, LookupBreakerThreshold = prefixes, threshold
+	}(LookupAllowedURLPrefixes, LookupBreakerThreshold)
+	LookupAllowedURLPrefixes, LookupBreakerThreshold = []string{server.URL + "/codes/"}, 2
+
+	template := server.URL + "/codes/{value}"
+	for value, expected := range map[string]bool{"a": true, "missing": false} {
+		if found, err := lookupOperator([]interface{}{template, value}); err != nil || found != expected {
+			t.Errorf("%s: expected %v, got %v %v", value, expected, found, err)
+		}
+	}
+	lookupOperator([]interface{}{template, "broken"})
+	lookupOperator([]interface{}{template, "broken"})
+	if _, err := lookupOperator([]interface{}{template, "other"}); !errors.Is(err, LookupCircuitOpenError) {
+		t.Errorf("expected the breaker open after 2 failures, got %v", err)
+	}
+}
+
+func TestLookupEscaping(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.RequestURI())
+		if r.URL.Path == "/codes/moved" {
+			http.Redirect(w, r, "/codes/a", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer func(prefixes []string) { LookupAllowedURLPrefixes = prefixes }(LookupAllowedURLPrefixes)
+	LookupAllowedURLPrefixes = []string{server.URL + "/codes"}
+
+	for template, expected := range map[string]string{
+		"/codes/{value}":              "/codes/a%20b%2Fc",
+		"/codes?code={value}":         "/codes?code=a+b%2Fc",
+		"/codes/{value}?code={value}": "/codes/a%20b%2Fc?code=a+b%2Fc",
+	} {
+		requested = nil
+		if found, err := lookupOperator([]interface{}{server.URL + template, "a b/c"}); err != nil || found != true {
+			t.Errorf("%s: expected to be found, got %v %v", template, found, err)
+		}
+		if len(requested) != 1 || requested[0] != expected {
+			t.Errorf("%s: expected %s requested, got %v", template, expected, requested)
+		}
+	}
+
+	// the redirects aren't followed
+	requested = nil
+	if _, err := lookupOperator([]interface{}{server.URL + "/codes/{value}", "moved"}); err == nil {
+		t.Error("expected the redirect to be an error")
+	}
+	if len(requested) != 1 {
+		t.Errorf("expected the redirect not followed, got %v", requested)
+	}
+}
+
+func TestLookupAllowlist(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer func(prefixes []string) { LookupAllowedURLPrefixes = prefixes }(LookupAllowedURLPrefixes)
+
+	// denied by default
+	LookupAllowedURLPrefixes = nil
+	if _, err := lookupOperator([]interface{}{server.URL + "/codes/{value}", "a"}); err == nil || !strings.Contains(err.Error(), "-lookup-allow") {
+		t.Errorf("expected the lookup denied without an allowlist, got %v", err)
+	}
+	if err := SetLookupAllowlist([]string{server.URL + "/codes/"}); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := lookupOperator([]interface{}{server.URL + "/codes/{value}", "a"}); err != nil || found != true {
+		t.Errorf("expected the allowed lookup to be found, got %v %v", found, err)
+	}
+	// the value can't leave the allowed path
+	for _, template := range []string{server.URL + "/codes/{value}", server.URL + "/codes-other/{value}", server.URL + "/admin/{value}"} {
+		value := "a"
+		if strings.HasSuffix(template, "/codes/{value}") {
+			value = "../admin"
+		}
+		if _, err := lookupOperator([]interface{}{template, value}); err == nil {
+			t.Errorf("%s %s: expected the lookup denied", template, value)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected the allowed call only, got %d calls", n)
+	}
+	if err := SetLookupAllowlist([]string{"codes.internal/"}); err == nil {
+		t.Error("expected a prefix without a scheme to be rejected")
+	}
+}
+
+func TestLookupCircuitBreaker(t *testing.T) {
+	var calls int32
+	var failing int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer func(prefixes []string, threshold int) {
+		LookupAllowedURLPrefixes, LookupBreakerThreshold = prefixes, threshold
+	}(LookupAllowedURLPrefixes, LookupBreakerThreshold)
+	LookupAllowedURLPrefixes, LookupBreakerThreshold = []string{server.URL + "/"}, 2
+
+	template := server.URL + "/codes/{value}"
+	check := func() error {
+		_, err := lookup.check(template, "a")
+		return err
+	}
+	// the cooldown is over, the breaker is half-open
+	cooledDown := func() {
+		lookup.lock.Lock()
+		lookup.breakers[server.URL].openUntil = time.Now().Add(-time.Millisecond)
+		lookup.lock.Unlock()
+	}
+
+	check()
+	check()
+	if err := check(); !errors.Is(err, LookupCircuitOpenError) {
+		t.Fatalf("expected the breaker open after 2 failures, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected no call of the open breaker, got %d calls", n)
+	}
+
+	// a failed probe opens the breaker again
+	cooledDown()
+	if err := check(); err == nil || errors.Is(err, LookupCircuitOpenError) {
+		t.Errorf("expected the probe to fail, got %v", err)
+	}
+	if err := check(); !errors.Is(err, LookupCircuitOpenError) {
+		t.Errorf("expected the breaker open after the failed probe, got %v", err)
+	}
+
+	// a single probe at a time
+	cooledDown()
+	lookup.lock.Lock()
+	lookup.breakers[server.URL].probing = true
+	lookup.lock.Unlock()
+	if err := check(); !errors.Is(err, LookupCircuitOpenError) {
+		t.Errorf("expected the calls rejected while probing, got %v", err)
+	}
+	lookup.lock.Lock()
+	lookup.breakers[server.URL].probing = false
+	lookup.lock.Unlock()
+
+	// a successful probe closes the breaker
+	atomic.StoreInt32(&failing, 0)
+	for i := 0; i < 3; i++ {
+		if err := check(); err != nil {
+			t.Errorf("expected the breaker closed by the probe, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 6 {
+		t.Errorf("expected the probes and the calls of the closed breaker, got %d calls", n)
+	}
+}
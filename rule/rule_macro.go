@@ -0,0 +1,110 @@
+package rule
+
+import (
+	"fmt"
+	"sync"
+)
+
+// OperatorMacro is a named operator composed of the existing operators,
+//   { "name": "STRONG_PASSWORD", "params": 1,
+//     "body": { "operator": "AND", "operands": [ ... { "arg": 0 } ... ] } }
+// it is used in a rule like a built-in operator,
+//   { "operator": "STRONG_PASSWORD", "operands": [ { "field": "password" } ] }
+// and expanded at the rule parse time: each { "arg": i } placeholder in
+// the body is replaced by the i-th operand.
+type OperatorMacro struct {
+	Name        string `json:"name"`
+	Params      int    `json:"params"`
+	Body        Term   `json:"body"`
+	Description string `json:"description,omitempty"`
+}
+
+// MacroArgOperand is the macro argument placeholder, parsed from
+//     { "arg": _argument_index_ }
+// it never stays in a constructed rule.
+type MacroArgOperand struct {
+	Index int `json:"arg"`
+}
+
+func (*MacroArgOperand) GetOperator() *OperatorFn {
+	return nil
+}
+func (*MacroArgOperand) GetOperands() []Operand {
+	return nil
+}
+func (a *MacroArgOperand) Evaluate(cx EvalContext) (interface{}, error) {
+	return nil, fmt.Errorf("macro argument, %d, is not expanded", a.Index)
+}
+
+// all registered macros, macroName => OperatorMacro
+var registeredMacros = map[string]*OperatorMacro{}
+var macroLock = sync.RWMutex{}
+
+func getOperatorMacro(name string) *OperatorMacro {
+	macroLock.RLock()
+	defer macroLock.RUnlock()
+	return registeredMacros[name]
+}
+
+// expand constructs the macro body with args
+func (m *OperatorMacro) expand(args []Operand, fieldList map[string]int) (Operand, error) {
+	if len(args) != m.Params {
+		return nil, fmt.Errorf("macro, %s, expects %d operands, got %d", m.Name, m.Params, len(args))
+	}
+	return constructOperand(&m.Body, fieldList, args)
+}
+
+// resultType infers the value type of the expanded macro
+func (m *OperatorMacro) resultType() ValueType {
+	switch v := m.Body.Value.(type) {
+	case TermOperand:
+		if v.macro != nil {
+			return v.macro.resultType()
+		}
+		return resultType(&v)
+	case FieldOperand:
+		if v.Name == DocumentField {
+			return TypeDocument
+		}
+		return TypeAny
+	case ValueOperand:
+		return literalType(v.Value)
+	}
+	return TypeAny
+}
+
+// SaveMacroToRegister sanity checks the macro, then registers it.
+// A macro name can't shadow an operator or a registered macro.
+func SaveMacroToRegister(m *OperatorMacro) error {
+	if len(m.Name) == 0 {
+		return fmt.Errorf("macro: name is missing")
+	}
+	if _, exists := RegisteredOperators[OperatorType(m.Name)]; exists {
+		return fmt.Errorf("macro: name, %s, is a built-in operator", m.Name)
+	}
+	if m.Params < 0 {
+		return fmt.Errorf("macro: %s, negative params", m.Name)
+	}
+
+	// try the expansion with the argument placeholders, typed as any, the
+	// body can only refer to the arguments, not to a field
+	args := make([]Operand, m.Params)
+	for i := range args {
+		args[i] = &MacroArgOperand{Index: i}
+	}
+	fieldList := map[string]int{}
+	if _, err := m.expand(args, fieldList); err != nil {
+		return err
+	}
+	if len(fieldList) != 0 {
+		return fmt.Errorf("macro: %s, body refers to a field, use { \"arg\": ... } instead", m.Name)
+	}
+
+	macroLock.Lock()
+	defer macroLock.Unlock()
+	if _, exists := registeredMacros[m.Name]; exists {
+		return fmt.Errorf("macro: name, %s, is duplicated", m.Name)
+	}
+	registeredMacros[m.Name] = m
+	return nil
+}
@@ -0,0 +1,57 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOperatorMacro(t *testing.T) {
+	saveMacro := func(s string) error {
+		m := OperatorMacro{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			t.Fatal(err)
+		}
+		return SaveMacroToRegister(&m)
+	}
+	if err := saveMacro(`{"name": "MACRO_TEST_LENGTH_IN", "params": 3, "body": {"operator": "AND", "operands": [
+		{"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"arg": 0}]}, {"arg": 1}]},
+		{"operator": "GREATER_THAN", "operands": [{"arg": 2}, {"operator": "LENGTH", "operands": [{"arg": 0}]}]}]}}`); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		macroLock.Lock()
+		delete(registeredMacros, "MACRO_TEST_LENGTH_IN")
+		macroLock.Unlock()
+	}()
+
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "macro_test_code", "rule": {"operator": "MACRO_TEST_LENGTH_IN", "operands": [{"field": "macro_test_code"}, {"value": "2"}, {"value": "6"}]}}`), &node)
+	registerTestRule(t, &node)
+	for code, expected := range map[string]bool{"abcd": true, "ab": false, "abcdef": false} {
+		result, err := ValidateInputJSONByRules("", map[string]interface{}{"macro_test_code": code})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != expected {
+			t.Errorf("%s: expected %v, got %v", code, expected, result.flag)
+		}
+	}
+
+	// the arity is checked at the rule creation
+	wrong := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "macro_test_arity", "rule": {"operator": "MACRO_TEST_LENGTH_IN", "operands": [{"field": "macro_test_code"}, {"value": "2"}]}}`), &wrong)
+	if _, err := ConstructOperandListHelper(&wrong.RuleContent, map[string]int{}); err == nil {
+		t.Error("expected the missing macro operand rejected")
+	}
+
+	for name, macro := range map[string]string{
+		"duplicated":  `{"name": "MACRO_TEST_LENGTH_IN", "params": 0, "body": {"value": "true"}}`,
+		"built-in":    `{"name": "LENGTH", "params": 0, "body": {"value": "true"}}`,
+		"field":       `{"name": "MACRO_TEST_FIELD", "params": 0, "body": {"operator": "LENGTH", "operands": [{"field": "email"}]}}`,
+		"unknown arg": `{"name": "MACRO_TEST_ARG", "params": 1, "body": {"operator": "LENGTH", "operands": [{"arg": 1}]}}`,
+	} {
+		if err := saveMacro(macro); err == nil {
+			t.Errorf("%s: expected the macro rejected", name)
+		}
+	}
+}
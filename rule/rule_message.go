@@ -0,0 +1,73 @@
+package rule
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"text/template"
+)
+
+// RuleMessage is the rendered violation message of a failed rule
+type RuleMessage struct {
+	Rule    string `json:"rule"`
+	Code    string `json:"code,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ruleMessageData is the data of a message template,
+//   "{{.Field}} must be 5 digits, got {{.Value}}"
+// Value is redacted by the field's redaction, "" when it is omitted.
+type ruleMessageData struct {
+	Rule  string
+	Field string
+	Value string
+}
+
+// parseRuleMessage parses the "message" template of the rule, and
+// rejects an unknown placeholder at the rule creation
+func parseRuleMessage(ruleName string, text string) (*template.Template, error) {
+	tmpl, err := template.New(ruleName).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("rule message: rule name, %s, %s", ruleName, err.Error())
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ruleMessageData{}); err != nil {
+		return nil, fmt.Errorf("rule message: rule name, %s, %s", ruleName, err.Error())
+	}
+	return tmpl, nil
+}
+
+// renderRuleMessage renders the violation message of the rule on the field value
+func renderRuleMessage(tmpl *template.Template, ruleName string, field string, value interface{}) RuleMessage {
+	redacted, _ := Redaction.lookup(field).redact(fieldText(value))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ruleMessageData{Rule: ruleName, Field: field, Value: redacted}); err != nil {
+		return RuleMessage{Rule: ruleName, Field: field, Message: ruleName}
+	}
+	return RuleMessage{Rule: ruleName, Field: field, Message: buf.String()}
+}
+
+// errorCodePattern is the format of an error code, e.g. "E_PASSWORD_WEAK"
+var errorCodePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,63}$`)
+
+// checkErrorCode checks the "error-code" of the rule, "" is none
+func checkErrorCode(ruleName string, code string) error {
+	if len(code) > 0 && !errorCodePattern.MatchString(code) {
+		return fmt.Errorf("rule name, %s, invalid error code, %q", ruleName, code)
+	}
+	return nil
+}
+
+// addCode adds the error code of a failed rule to the result, once
+func (result *validationResult) addCode(code string) {
+	if len(code) == 0 {
+		return
+	}
+	for _, c := range result.codes {
+		if c == code {
+			return
+		}
+	}
+	result.codes = append(result.codes, code)
+}
@@ -0,0 +1,66 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRuleErrorCodes(t *testing.T) {
+	rules := []string{
+		`{"name": "error_code_test_length", "error-code": "E_PASSWORD_WEAK", "message": "too short",
+		  "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "error_code_test.password"}]}, {"value": 7}]}}`,
+		`{"name": "error_code_test_digit", "error-code": "E_PASSWORD_WEAK",
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "[0-9]"}, {"field": "error_code_test.password"}]}}`,
+		`{"name": "error_code_test_user", "error-code": "E_USER_REQUIRED", "required": true,
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "."}, {"field": "error_code_test.user"}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+	result, err := ValidateInputJSONByRules("", map[string]interface{}{"error_code_test": map[string]interface{}{"password": "abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := append([]string{}, result.codes...)
+	sort.Strings(codes)
+	if !reflect.DeepEqual(codes, []string{"E_PASSWORD_WEAK", "E_USER_REQUIRED"}) {
+		t.Errorf("expected the error codes once each, got %v", result.codes)
+	}
+	if len(result.messages) != 1 || result.messages[0].Code != "E_PASSWORD_WEAK" {
+		t.Errorf("expected the code of the message, got %v", result.messages)
+	}
+	bad := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "error_code_test_bad", "error-code": "weak password",
+	  "rule": {"operator": "MATCHES", "operands": [{"value": "."}, {"field": "error_code_test.bad"}]}}`), &bad)
+	if _, err := RegisterRuleNode(&bad); err == nil {
+		t.Error("expected an invalid error code to fail")
+	}
+}
+
+func TestRuleMessage(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "message_test_zip", "message": "{{.Field}} must be 5 digits, got {{.Value}}",
+		"rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "message_test_zip"}]}}`), &node)
+	registerTestRule(t, &node)
+	result, err := ValidateInputJSONByRules("", map[string]interface{}{"message_test_zip": "123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.messages) != 1 || result.messages[0].Rule != "message_test_zip" || result.messages[0].Field != "message_test_zip" ||
+		result.messages[0].Message != "message_test_zip must be 5 digits, got 123" {
+		t.Errorf("expected the rendered message, got %+v", result.messages)
+	}
+
+	bad := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "message_test_bad", "message": "{{.Unknown}} is invalid",
+		"rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "message_test_zip"}]}}`), &bad)
+	if _, err := RegisterRuleNode(&bad); err == nil {
+		t.Error("expected an unknown placeholder rejected")
+	}
+}
@@ -0,0 +1,39 @@
+package rule
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// RuleMetadata is the descriptive metadata of a rule, so the on-call
+// engineers can tell what "zx_31_chk" actually enforces
+type RuleMetadata struct {
+	Description   string `json:"description,omitempty"`
+	Owner         string `json:"owner,omitempty"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+// newRuleMetadata returns the metadata of the rule node, the documentation
+// link is an absolute http(s) URL
+func newRuleMetadata(node *RuleNode) (RuleMetadata, error) {
+	if len(node.Documentation) > 0 {
+		u, err := url.Parse(node.Documentation)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return RuleMetadata{}, fmt.Errorf("rule name, %s, documentation, %s, is not an http(s) URL", node.Name, node.Documentation)
+		}
+	}
+	return RuleMetadata{Description: node.Description, Owner: node.Owner, Documentation: node.Documentation}, nil
+}
+
+// ruleMetadataOf returns the metadata of the named rules with any
+func ruleMetadataOf(names []string) map[string]RuleMetadata {
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	metadata := map[string]RuleMetadata{}
+	for _, name := range names {
+		if entry := findRuleByName(name); entry != nil && entry.Metadata != (RuleMetadata{}) {
+			metadata[name] = entry.Metadata
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,38 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRuleMetadata(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "metadata_test_chk", "description": "the order reference is 8 digits",
+	  "owner": "payments-team", "documentation": "https://wiki.example.com/rules/metadata_test_chk",
+	  "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{8}$"}, {"field": "metadata_test.ref"}]}}`), &node)
+	registerTestRule(t, &node)
+	expected := RuleMetadata{Description: "the order reference is 8 digits", Owner: "payments-team",
+		Documentation: "https://wiki.example.com/rules/metadata_test_chk"}
+	for _, summary := range ListRulesByTag("") {
+		if summary.Name == "metadata_test_chk" && summary.RuleMetadata != expected {
+			t.Errorf("expected the metadata in the rule list, got %+v", summary)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	ValidateJSONData(w, httptest.NewRequest("POST", "/api/validation?rule-info=true", strings.NewReader(`{"metadata_test": {"ref": "x"}}`)))
+	fail := FailResponseMsg{}
+	json.Unmarshal(w.Body.Bytes(), &fail)
+	if w.Code != http.StatusBadRequest || fail.RuleInfo["metadata_test_chk"] != expected {
+		t.Errorf("expected the rule info in the failure, got %d %s", w.Code, w.Body.String())
+	}
+
+	bad := node
+	bad.Name, bad.Documentation = "metadata_test_bad", "wiki/metadata_test_bad"
+	if _, err := RegisterRuleNode(&bad); err == nil {
+		t.Error("expected a relative documentation link to fail")
+	}
+}
@@ -0,0 +1,124 @@
+package rule
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/richgrove/validation/util"
+)
+
+// ServiceMetrics is the telemetry backend, Prometheus by default, scraped
+// at GET /metrics.  util.NopMetrics disables the metrics.
+var ServiceMetrics util.Metrics = util.NewPrometheusMetrics()
+
+// the name of the configured metrics backend, for the features
+var metricsBackend = "prometheus"
+
+// ConfigureMetrics selects the metrics backend by name: prometheus, statsd
+// or datadog, sent to the agent at addr, or none
+func ConfigureMetrics(backend string, addr string) error {
+	var err error
+	switch backend {
+	case "prometheus":
+		ServiceMetrics = util.NewPrometheusMetrics()
+	case "statsd":
+		ServiceMetrics, err = util.NewStatsdMetrics(addr)
+	case "datadog":
+		ServiceMetrics, err = util.NewDatadogMetrics(addr)
+	case "none":
+		ServiceMetrics = util.NopMetrics{}
+	default:
+		return fmt.Errorf("unknown metrics backend, %s", backend)
+	}
+	if err != nil {
+		return err
+	}
+	metricsBackend = backend
+	return nil
+}
+
+// the metric names
+const (
+	metricHTTPRequests    = "validation_http_requests_total"
+	metricHTTPDuration    = "validation_http_request_duration_seconds"
+	metricRuleEvaluations = "validation_rule_evaluations_total"
+	metricRegisteredRules = "validation_registered_rules"
+
+	metricOperatorCacheHits      = "validation_operator_cache_hits_total"
+	metricOperatorCacheMisses    = "validation_operator_cache_misses_total"
+	metricOperatorCacheEvictions = "validation_operator_cache_evictions_total"
+	metricOperatorCacheEntries   = "validation_operator_cache_entries"
+
+	metricSweeperActions = "validation_rule_sweeper_actions_total"
+	metricPanics         = "validation_panics_total"
+
+	metricUnenforcedFailures = "validation_rule_unenforced_failures_total"
+
+	metricWebhookDeliveries = "validation_webhook_deliveries_total"
+)
+
+// statusWriter keeps the response status for the metrics
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the stream
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// metricsMiddleware counts the requests by route and status, and
+// observes their latency by route
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		// the route pattern, not the path, e.g. /admin/rule/{ruleName}
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && len(rctx.RoutePattern()) > 0 {
+			route = rctx.RoutePattern()
+		}
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		ServiceMetrics.Counter(metricHTTPRequests, util.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(sw.status)}, 1)
+		ServiceMetrics.Histogram(metricHTTPDuration, util.Labels{"route": route}, time.Since(start).Seconds())
+	})
+}
+
+// recordRuleMetrics counts one rule evaluation by its result
+func recordRuleMetrics(pass bool, err error) {
+	result := "pass"
+	if err != nil {
+		result = "error"
+	} else if !pass {
+		result = "fail"
+	}
+	ServiceMetrics.Counter(metricRuleEvaluations, util.Labels{"result": result}, 1)
+}
+
+// recordRegisteredRules sets the registered rule gauge, caller holds the
+// WRITE lock
+func recordRegisteredRules() {
+	ServiceMetrics.Gauge(metricRegisteredRules, nil, float64(len(AllRegisteredRuleIDs)))
+}
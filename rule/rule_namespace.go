@@ -0,0 +1,336 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+)
+
+// DefaultNamespace is the namespace of a rule without "namespace"
+const DefaultNamespace = "default"
+
+// NamespaceLimits caps the resources of the rules in a namespace, the
+// tenant of a multi-tenant deployment, 0 is unlimited.
+//   max-rules             - the registered rules
+//   max-registry-bytes    - the total size of the canonical rule contents
+//   max-regex-complexity  - the compiled program size of each regex
+//                           pattern literal, of MATCHES and REGEX_EXTRACT
+//   max-remote-operators  - the remote operator references, LOOKUP
+type NamespaceLimits struct {
+	MaxRules           int `json:"max-rules,omitempty"`
+	MaxRegistryBytes   int `json:"max-registry-bytes,omitempty"`
+	MaxRegexComplexity int `json:"max-regex-complexity,omitempty"`
+	MaxRemoteOperators int `json:"max-remote-operators,omitempty"`
+}
+
+// NamespaceConfig is the namespace limits, loaded from a JSON file like,
+//   { "default":    { "max-rules": 1000 },
+//     "namespaces": { "tenant_a": { "max-rules": 50, "max-remote-operators": 2 } },
+//     "principals": { "svc-tenant-a": "tenant_a" } }
+// The limits of a namespace replace the default ones.  "principals" maps
+// the authenticated caller, the UserHeader set by the proxy, to its
+// namespace, the others are in DefaultNamespace.  A rule of the API, the
+// admin and the ad hoc rules, is in the namespace of its caller, so it
+// can't escape the limits by declaring another namespace; the rules files
+// declare theirs.
+type NamespaceConfig struct {
+	Default    NamespaceLimits            `json:"default"`
+	Namespaces map[string]NamespaceLimits `json:"namespaces,omitempty"`
+	Principals map[string]string          `json:"principals,omitempty"`
+}
+
+// NamespaceUsage is the resource consumption of a namespace
+type NamespaceUsage struct {
+	Rules              int `json:"rules"`
+	RegistryBytes      int `json:"registry-bytes"`
+	MaxRegexComplexity int `json:"max-regex-complexity"`
+	RemoteOperators    int `json:"remote-operators"`
+}
+
+// the resources of a rule, measured when it is parsed
+type ruleResources struct {
+	bytes           int
+	regexComplexity int // the most complex pattern
+	remoteOperators int
+}
+
+// the regex operators, by the operand index of the pattern
+var regexOperators = map[OperatorType]int{
+	MatchesOperator:      0,
+	RegexExtractOperator: 0,
+}
+
+// the remote operators, calling an external service per evaluation
+var remoteOperators = map[OperatorType]bool{
+	LookupOperator: true,
+}
+
+var (
+	// the configured limits, guarded by RegRuleLock
+	namespaceConfig = NamespaceConfig{}
+	// the usage sums of each namespace, maintained with the register
+	namespaceUsage = map[string]*NamespaceUsage{}
+)
+
+var namespaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// normalizeNamespace checks the namespace name, "" is DefaultNamespace
+func normalizeNamespace(name string) (string, error) {
+	if len(name) == 0 {
+		return DefaultNamespace, nil
+	}
+	if !namespaceNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid namespace name, %q", name)
+	}
+	return name, nil
+}
+
+// LoadNamespaceConfig loads the namespace limits from the JSON file, the
+// registered rules are not checked again
+func LoadNamespaceConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := NamespaceConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	for name := range config.Namespaces {
+		if _, err := normalizeNamespace(name); err != nil {
+			return err
+		}
+	}
+	for principal, name := range config.Principals {
+		if _, err := normalizeNamespace(name); err != nil || len(name) == 0 {
+			return fmt.Errorf("namespace of the principal, %s, %q is invalid", principal, name)
+		}
+	}
+	RegRuleLock.Lock()
+	namespaceConfig = config
+	RegRuleLock.Unlock()
+	return nil
+}
+
+var RuleNamespaceForbiddenError = errors.New("namespace: the rule isn't in the namespace of the caller")
+
+// applyPrincipalNamespace puts the rule of the API on behalf of user in the
+// namespace of user, a rule declaring another namespace is rejected
+func applyPrincipalNamespace(node *RuleNode, user string) error {
+	RegRuleLock.RLock()
+	namespace := principalNamespace(user)
+	RegRuleLock.RUnlock()
+	if len(node.Namespace) == 0 {
+		if namespace != DefaultNamespace {
+			node.Namespace = namespace
+		}
+		return nil
+	}
+	declared, err := normalizeNamespace(node.Namespace)
+	if err != nil {
+		return err
+	}
+	if declared != namespace {
+		return fmt.Errorf("%w, rule name, %s, declares the namespace, %s, of another caller than %q", RuleNamespaceForbiddenError, node.Name, declared, user)
+	}
+	return nil
+}
+
+// principalNamespace returns the namespace of the caller user, caller
+// holds the READ lock
+func principalNamespace(user string) string {
+	if namespace, ok := namespaceConfig.Principals[user]; ok {
+		return namespace
+	}
+	return DefaultNamespace
+}
+
+// checkRuleNamespace checks the registered rule entry is in the namespace
+// of the caller user, who changes it, caller holds the READ lock
+func checkRuleNamespace(entry *RuleEntry, user string) error {
+	if namespace := principalNamespace(user); entry.Namespace != namespace {
+		return fmt.Errorf("%w, rule name, %s, is in the namespace, %s", RuleNamespaceForbiddenError, entry.Name, entry.Namespace)
+	}
+	return nil
+}
+
+// namespaceLimitsOf returns the limits of the namespace, caller holds the
+// READ lock
+func namespaceLimitsOf(namespace string) NamespaceLimits {
+	if limits, ok := namespaceConfig.Namespaces[namespace]; ok {
+		return limits
+	}
+	return namespaceConfig.Default
+}
+
+// measureRule measures the resources of the rule operand tree
+func measureRule(op Operand) (ruleResources, error) {
+	res := ruleResources{}
+	c, err := canonicalOperand(op)
+	if err != nil {
+		return res, err
+	}
+	content, err := marshalCanonical(c, "")
+	if err != nil {
+		return res, err
+	}
+	res.bytes = len(content)
+	err = measureOperand(op, &res)
+	return res, err
+}
+
+func measureOperand(op Operand, res *ruleResources) error {
+	term, ok := op.(*TermOperand)
+	if !ok {
+		return nil
+	}
+	operator := OperatorType(term.ParseOperator)
+	if remoteOperators[operator] {
+		res.remoteOperators++
+	}
+	if i, ok := regexOperators[operator]; ok && i < len(term.OperandList) {
+		// a pattern from a field is not known until the evaluation
+		if v, ok := term.OperandList[i].(*ValueOperand); ok {
+			if pattern, ok := v.Value.(string); ok {
+				complexity, err := regexComplexity(pattern)
+				if err != nil {
+					return err
+				}
+				if complexity > res.regexComplexity {
+					res.regexComplexity = complexity
+				}
+			}
+		}
+	}
+	for _, o := range term.OperandList {
+		if err := measureOperand(o, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// regexComplexity is the instruction count of the compiled pattern, the
+// matching cost grows with it, e.g. "a{1000}" is 1000 times "a"
+func regexComplexity(pattern string) (int, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return 0, err
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return 0, err
+	}
+	return len(prog.Inst), nil
+}
+
+// checkNamespaceLimits checks the namespace of entry has the room for it,
+// caller holds the WRITE lock
+func checkNamespaceLimits(entry *RuleEntry) error {
+	usage := namespaceUsage[entry.Namespace]
+	if usage == nil {
+		usage = &NamespaceUsage{}
+	}
+	return checkUsageLimits(entry, usage)
+}
+
+// checkUsageLimits checks entry fits in the limits of its namespace on top
+// of usage, caller holds the READ lock
+func checkUsageLimits(entry *RuleEntry, usage *NamespaceUsage) error {
+	limits := namespaceLimitsOf(entry.Namespace)
+	res := entry.resources
+	switch {
+	case limits.MaxRules > 0 && usage.Rules+1 > limits.MaxRules:
+		return fmt.Errorf("namespace, %s, has reached its limit of %d rules", entry.Namespace, limits.MaxRules)
+	case limits.MaxRegistryBytes > 0 && usage.RegistryBytes+res.bytes > limits.MaxRegistryBytes:
+		return fmt.Errorf("namespace, %s, rule name, %s, of %d bytes exceeds the registry limit of %d bytes, %d used",
+			entry.Namespace, entry.Name, res.bytes, limits.MaxRegistryBytes, usage.RegistryBytes)
+	case limits.MaxRegexComplexity > 0 && res.regexComplexity > limits.MaxRegexComplexity:
+		return fmt.Errorf("namespace, %s, rule name, %s, has a regex of complexity %d, more than %d",
+			entry.Namespace, entry.Name, res.regexComplexity, limits.MaxRegexComplexity)
+	case limits.MaxRemoteOperators > 0 && usage.RemoteOperators+res.remoteOperators > limits.MaxRemoteOperators:
+		return fmt.Errorf("namespace, %s, rule name, %s, exceeds the limit of %d remote operators, %d used",
+			entry.Namespace, entry.Name, limits.MaxRemoteOperators, usage.RemoteOperators)
+	}
+	return nil
+}
+
+// addNamespaceUsage adds the resources of entry to its namespace, sign is
+// 1 when it is registered, -1 when it is removed.  Caller holds the WRITE
+// lock.
+func addNamespaceUsage(entry *RuleEntry, sign int) {
+	usage := namespaceUsage[entry.Namespace]
+	if usage == nil {
+		usage = &NamespaceUsage{}
+		namespaceUsage[entry.Namespace] = usage
+	}
+	usage.add(entry, sign)
+	if usage.Rules <= 0 {
+		delete(namespaceUsage, entry.Namespace)
+	}
+}
+
+// add adds the resources of entry to the usage, sign is 1 or -1
+func (usage *NamespaceUsage) add(entry *RuleEntry, sign int) {
+	usage.Rules += sign
+	usage.RegistryBytes += sign * entry.resources.bytes
+	usage.RemoteOperators += sign * entry.resources.remoteOperators
+}
+
+// NamespaceInfo is the consumption and the limits of a namespace
+type NamespaceInfo struct {
+	Name   string          `json:"name"`
+	Usage  NamespaceUsage  `json:"usage"`
+	Limits NamespaceLimits `json:"limits"`
+}
+
+// GetNamespaceInfo reports the namespaces with the rules or the limits,
+// in the name order
+func GetNamespaceInfo() []NamespaceInfo {
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+
+	infos := map[string]*NamespaceInfo{}
+	info := func(name string) *NamespaceInfo {
+		if i, ok := infos[name]; ok {
+			return i
+		}
+		i := &NamespaceInfo{Name: name, Limits: namespaceLimitsOf(name)}
+		infos[name] = i
+		return i
+	}
+	info(DefaultNamespace)
+	for name := range namespaceConfig.Namespaces {
+		info(name)
+	}
+	for name, usage := range namespaceUsage {
+		info(name).Usage = *usage
+	}
+	// the maximum isn't maintained with the register
+	for _, entry := range AllRegisteredRuleIDs {
+		if i := info(entry.Namespace); entry.resources.regexComplexity > i.Usage.MaxRegexComplexity {
+			i.Usage.MaxRegexComplexity = entry.resources.regexComplexity
+		}
+	}
+
+	list := make([]NamespaceInfo, 0, len(infos))
+	for _, i := range infos {
+		list = append(list, *i)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// GET /admin/namespaces service implementation
+func GetNamespaces(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(GetNamespaceInfo())
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,165 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNamespaceLimits(t *testing.T) {
+	RegRuleLock.Lock()
+	saved := namespaceConfig
+	namespaceConfig = NamespaceConfig{Namespaces: map[string]NamespaceLimits{
+		"ns_test": {MaxRules: 1, MaxRegexComplexity: 100}}}
+	RegRuleLock.Unlock()
+	defer func() {
+		RegRuleLock.Lock()
+		namespaceConfig = saved
+		RegRuleLock.Unlock()
+	}()
+
+	register := func(name string, pattern string) (*RuleEntry, error) {
+		node := RuleNode{}
+		rule := `{"name": "` + name + `", "namespace": "ns_test",
+			"rule": {"operator": "MATCHES", "operands": [{"value": "` + pattern + `"}, {"field": "ns_test"}]}}`
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		return RegisterRuleNode(&node)
+	}
+
+	if _, err := register("ns_test_complex", "^a{500}$"); err == nil {
+		t.Error("expected an error for a complex regex")
+	}
+	entry, err := register("ns_test_simple", "^[a-z]+$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanupTestRule(t, entry.Name)
+	if _, err := register("ns_test_another", "^[0-9]+$"); err == nil {
+		t.Error("expected an error for the rule count limit")
+	}
+
+	for _, info := range GetNamespaceInfo() {
+		if info.Name != "ns_test" {
+			continue
+		}
+		if info.Usage.Rules != 1 || info.Usage.RegistryBytes != entry.resources.bytes || info.Usage.MaxRegexComplexity == 0 {
+			t.Errorf("unexpected usage, %+v", info.Usage)
+		}
+		return
+	}
+	t.Error("expected the namespace in the report")
+}
+
+func TestNamespaceOfPrincipal(t *testing.T) {
+	RegRuleLock.Lock()
+	saved := namespaceConfig
+	namespaceConfig = NamespaceConfig{Namespaces: map[string]NamespaceLimits{"ns_principal_test": {MaxRules: 1}},
+		Principals: map[string]string{"svc-principal-test": "ns_principal_test"}}
+	RegRuleLock.Unlock()
+	defer func() {
+		RegRuleLock.Lock()
+		namespaceConfig = saved
+		RegRuleLock.Unlock()
+	}()
+
+	router := Handlers()
+	request := func(method string, path string, body string, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(UserHeader, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	rule := func(name string, namespace string) string {
+		return `{"name": "` + name + `", "namespace": "` + namespace + `", "expression": "length(ns_principal_test) > 1"}`
+	}
+
+	// the rule is in the namespace of its caller
+	if w := request("POST", "/admin/rule", rule("ns_principal_test_a", ""), "svc-principal-test"); w.Code != http.StatusOK {
+		t.Fatalf("expected the rule, got %d %s", w.Code, w.Body.String())
+	}
+	cleanupTestRule(t, "ns_principal_test_a")
+	RegRuleLock.RLock()
+	namespace := findRuleByName("ns_principal_test_a").Namespace
+	RegRuleLock.RUnlock()
+	if namespace != "ns_principal_test" {
+		t.Errorf("expected the namespace of the caller, got %s", namespace)
+	}
+	// the limit can't be escaped by declaring another namespace
+	if w := request("POST", "/admin/rule", rule("ns_principal_test_b", ""), "svc-principal-test"); w.Code == http.StatusOK {
+		cleanupTestRule(t, "ns_principal_test_b")
+		t.Errorf("expected the rule count limit")
+	}
+	if w := request("POST", "/admin/rule", rule("ns_principal_test_b", DefaultNamespace), "svc-principal-test"); w.Code != http.StatusForbidden {
+		cleanupTestRule(t, "ns_principal_test_b")
+		t.Errorf("expected the other namespace to be forbidden, got %d %s", w.Code, w.Body.String())
+	}
+	if w := request("POST", "/admin/rule", rule("ns_principal_test_b", "ns_principal_test"), "another"); w.Code != http.StatusForbidden {
+		cleanupTestRule(t, "ns_principal_test_b")
+		t.Errorf("expected the namespace of another caller to be forbidden, got %d %s", w.Code, w.Body.String())
+	}
+	if w := request("PUT", "/admin/rule/ns_principal_test_a", rule("ns_principal_test_a", ""), "another"); w.Code != http.StatusForbidden {
+		t.Errorf("expected the update by another caller to be forbidden, got %d %s", w.Code, w.Body.String())
+	}
+
+	// the ad hoc rules too
+	adhoc := `{"document": {"ns_principal_test": "abc"}, "rules": [` + rule("ns_principal_test_x", "") + `, ` + rule("ns_principal_test_y", "") + `]}`
+	if w := request("POST", "/api/validation/adhoc", adhoc, "svc-principal-test"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "limit of 1 rules") {
+		t.Errorf("expected the rule count limit of the ad hoc rules, got %d %s", w.Code, w.Body.String())
+	}
+	if w := request("POST", "/api/validation/adhoc", adhoc, "another"); w.Code != http.StatusOK {
+		t.Errorf("expected the ad hoc rules of the default namespace, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNamespaceOfChangedRule(t *testing.T) {
+	RegRuleLock.Lock()
+	saved := namespaceConfig
+	namespaceConfig = NamespaceConfig{Principals: map[string]string{"svc-owner-test": "ns_owner_test"}}
+	RegRuleLock.Unlock()
+	defer func() {
+		RegRuleLock.Lock()
+		namespaceConfig = saved
+		RegRuleLock.Unlock()
+	}()
+	for _, name := range []string{"ns_owner_test_a", "ns_owner_test_b"} {
+		node := RuleNode{}
+		json.Unmarshal([]byte(`{"name": "`+name+`", "namespace": "ns_owner_test", "tags": ["ns_owner_test"],
+			"expression": "length(ns_owner_test) > 1"}`), &node)
+		registerTestRule(t, &node)
+	}
+
+	router := Handlers()
+	request := func(method string, path string, body string, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(UserHeader, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// another caller can't change the rules, the owner can
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{"PATCH", "/admin/rule/ns_owner_test_a/status", `{"enabled": false}`},
+		{"POST", "/admin/rule/ns_owner_test_a/retire", ``},
+		{"POST", "/admin/rules/merge", `{"keep": "ns_owner_test_a", "remove": ["ns_owner_test_b"]}`},
+		{"DELETE", "/admin/rules?tag=ns_owner_test", ``},
+	} {
+		if w := request(tc.method, tc.path, tc.body, "another"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "namespace") {
+			t.Errorf("%s %s: expected forbidden to another caller, got %d %s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+		if w := request(tc.method, tc.path, tc.body, "svc-owner-test"); w.Code != http.StatusOK {
+			t.Errorf("%s %s: expected the change by the owner, got %d %s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+	}
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	if findRuleByName("ns_owner_test_a") != nil || findRuleByName("ns_owner_test_b") != nil {
+		t.Error("expected the rules merged and deleted by the owner")
+	}
+}
@@ -0,0 +1,297 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The negative samples violate exactly one rule each, so the QA can check
+// the whole pipeline rejects every violation class,
+//   GET /admin/samples/negative?ruleset=<ruleset>&rule=<rule>&seed=1
+//   validation samples -negative [-ruleset=<ruleset>] [-seed=1]
+// A valid sample document is mutated at a field of the rule, by the
+// candidates of the rule, e.g. the off-by-one lengths and numbers, and by
+// the mutations of its value, until the rule is the only failed one.
+
+// the mutations of a field value, in the trial order
+const (
+	MutationCandidate = "candidate" // a value derived from the rule
+	MutationTruncate  = "truncate"  // the string without its last character
+	MutationExtend    = "extend"    // the string with one more character
+	MutationReplace   = "replace"   // the string with a symbol for its first character
+	MutationEmpty     = "empty"     // the empty string
+	MutationDecrement = "decrement" // the number minus 1
+	MutationIncrement = "increment" // the number plus 1
+	MutationNegate    = "negate"    // the negative number
+	MutationNull      = "null"      // null
+	MutationRemove    = "remove"    // the field is absent
+)
+
+// NegativeSample is a document failing only its rule
+type NegativeSample struct {
+	Rule     string                 `json:"rule"`
+	Field    string                 `json:"field"`
+	Mutation string                 `json:"mutation"`
+	Document map[string]interface{} `json:"document"`
+}
+
+// NegativeSampleReport is the negative samples, and the rules without one,
+// which can't be violated alone, e.g. a rule implied by another one
+type NegativeSampleReport struct {
+	Samples    []NegativeSample `json:"samples"`
+	Unviolated []string         `json:"unviolated,omitempty"`
+}
+
+// sampleSegment is a path segment, the member name and its array indices
+var sampleSegment = regexp.MustCompile(`^([^\[]*)((\[[0-9]+\])*)$`)
+
+// walkSamplePath calls fn with the parent container and the key, a member
+// name or an array index, of the field path in doc.  The missing members
+// are created when create is set, or ok is false.
+func walkSamplePath(doc map[string]interface{}, field string, create bool,
+	fn func(parent interface{}, key interface{})) (ok bool) {
+	var parent interface{} = doc
+	var key interface{}
+	step := func(next interface{}) bool {
+		if key != nil {
+			var child interface{}
+			switch p := parent.(type) {
+			case map[string]interface{}:
+				child = p[key.(string)]
+				if child == nil && create {
+					if _, isIndex := next.(int); !isIndex {
+						child = map[string]interface{}{}
+						p[key.(string)] = child
+					}
+				}
+			case []interface{}:
+				child = p[key.(int)]
+			}
+			parent = child
+		}
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			if _, isName := next.(string); !isName {
+				return false
+			}
+		case []interface{}:
+			if i, isIndex := next.(int); !isIndex || i >= len(p) {
+				return false
+			}
+		default:
+			return false
+		}
+		key = next
+		return true
+	}
+	for _, segment := range strings.Split(field, ".") {
+		m := sampleSegment.FindStringSubmatch(segment)
+		if m == nil {
+			return false
+		}
+		if len(m[1]) > 0 && !step(m[1]) {
+			return false
+		}
+		for _, index := range strings.Split(strings.Trim(m[2], "[]"), "][") {
+			if len(index) == 0 {
+				continue
+			}
+			i, _ := strconv.Atoi(index)
+			if !step(i) {
+				return false
+			}
+		}
+	}
+	if key == nil {
+		return false
+	}
+	fn(parent, key)
+	return true
+}
+
+// sampleAt returns the value at the field path of doc
+func sampleAt(doc map[string]interface{}, field string) (v interface{}, ok bool) {
+	found := walkSamplePath(doc, field, false, func(parent interface{}, key interface{}) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			v, ok = p[key.(string)]
+		case []interface{}:
+			v, ok = p[key.(int)], true
+		}
+	})
+	return v, found && ok
+}
+
+// mutateSample sets the value at the field path of doc, or removes it
+func mutateSample(doc map[string]interface{}, field string, v interface{}, remove bool) bool {
+	return walkSamplePath(doc, field, true, func(parent interface{}, key interface{}) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			if remove {
+				delete(p, key.(string))
+			} else {
+				p[key.(string)] = v
+			}
+		case []interface{}:
+			// an array item is nulled rather than removed
+			p[key.(int)] = v
+		}
+	})
+}
+
+// sampleMutation is a trial value of a field
+type sampleMutation struct {
+	kind   string
+	value  interface{}
+	remove bool
+}
+
+// mutations returns the trial values of the current value of the rule
+// field
+func (g *sampleGenerator) mutations(field string, current interface{}) []sampleMutation {
+	trials := []sampleMutation{}
+	for _, candidate := range g.candidates[field] {
+		trials = append(trials, sampleMutation{kind: MutationCandidate, value: candidate})
+	}
+	switch v := current.(type) {
+	case string:
+		runes := []rune(v)
+		if len(runes) > 0 {
+			trials = append(trials, sampleMutation{kind: MutationTruncate, value: string(runes[:len(runes)-1])})
+		}
+		trials = append(trials, sampleMutation{kind: MutationExtend, value: v + string(sampleAlphabet[g.rng.Intn(len(sampleAlphabet))])})
+		if len(runes) > 0 {
+			trials = append(trials, sampleMutation{kind: MutationReplace, value: "#" + string(runes[1:])})
+		}
+		trials = append(trials, sampleMutation{kind: MutationEmpty, value: ""})
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			trials = append(trials, sampleMutation{kind: MutationDecrement, value: json.Number(strconv.FormatInt(i-1, 10))},
+				sampleMutation{kind: MutationIncrement, value: json.Number(strconv.FormatInt(i+1, 10))},
+				sampleMutation{kind: MutationNegate, value: json.Number(strconv.FormatInt(-i-1, 10))})
+		} else if f, err := v.Float64(); err == nil {
+			trials = append(trials, sampleMutation{kind: MutationDecrement, value: json.Number(strconv.FormatFloat(f-1, 'f', -1, 64))},
+				sampleMutation{kind: MutationIncrement, value: json.Number(strconv.FormatFloat(f+1, 'f', -1, 64))},
+				sampleMutation{kind: MutationNegate, value: json.Number(strconv.FormatFloat(-f-1, 'f', -1, 64))})
+		}
+	}
+	trials = append(trials, sampleMutation{kind: MutationNull, value: nil}, sampleMutation{kind: MutationRemove, remove: true})
+	return trials
+}
+
+// concretePaths returns the paths of doc matching the field of a rule,
+// the field itself for a plain one, sorted
+func concretePaths(doc map[string]interface{}, field string) []string {
+	if !isWildcardPath(field) {
+		return []string{field}
+	}
+	fields, err := extractJSON(doc)
+	if err != nil {
+		return nil
+	}
+	paths := []string{}
+	for path := range fields {
+		if _, ok := matchWildcardPath(field, path); ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// negative mutates the valid doc until the rule is the only failed one
+func (g *sampleGenerator) negative(doc map[string]interface{}, name string) (*NegativeSample, bool) {
+	for _, field := range g.entries[name].Fields {
+		if field == DocumentField {
+			continue
+		}
+		for _, path := range concretePaths(doc, field) {
+			current, _ := sampleAt(doc, path)
+			for _, m := range g.mutations(field, current) {
+				trial := cloneSample(doc).(map[string]interface{})
+				if !mutateSample(trial, path, cloneSample(m.value), m.remove) {
+					continue
+				}
+				if failed, err := g.failedRules(trial); err == nil && len(failed) == 1 && failed[0] == name {
+					return &NegativeSample{Rule: name, Field: path, Mutation: m.kind, Document: trial}, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// GenerateNegativeSamples generates a document violating each active rule
+// in ruleset alone, or only the named rule
+func GenerateNegativeSamples(ruleset string, name string, seed int64) (*NegativeSampleReport, error) {
+	if err := CheckRuleset(ruleset); err != nil {
+		return nil, err
+	}
+	g := newSampleGenerator(ruleset, seed)
+	names, remote := []string{}, []string{}
+	for n := range g.entries {
+		if len(name) == 0 || n == name {
+			names = append(names, n)
+		}
+	}
+	for _, n := range g.remote {
+		if len(name) == 0 || n == name {
+			remote = append(remote, n)
+		}
+	}
+	if len(name) > 0 && len(names) == 0 && len(remote) == 0 {
+		return nil, fmt.Errorf("samples: rule name, %s, is not active in the ruleset, %s", name, ruleset)
+	}
+	sort.Strings(names)
+
+	// the rules using a remote operator are not evaluated
+	report := &NegativeSampleReport{Samples: []NegativeSample{}, Unviolated: remote}
+	for _, n := range names {
+		doc, failed := g.document()
+		if len(failed) > 0 {
+			// no valid document to mutate
+			report.Unviolated = append(report.Unviolated, n)
+			continue
+		}
+		if sample, ok := g.negative(doc, n); ok {
+			report.Samples = append(report.Samples, *sample)
+		} else {
+			report.Unviolated = append(report.Unviolated, n)
+		}
+	}
+	sort.Strings(report.Unviolated)
+	return report, nil
+}
+
+// GET /admin/samples/negative?ruleset=<ruleset>&rule=<rule>&seed=1
+// service implementation
+func GetNegativeSamples(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ruleset := r.URL.Query().Get("ruleset")
+	if err := CheckRuleset(ruleset); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	_, seed, err := sampleQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	report, err := GenerateNegativeSamples(ruleset, r.URL.Query().Get("rule"), seed)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(report)
+	io.WriteString(w, string(resStr))
+}
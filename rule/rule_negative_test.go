@@ -0,0 +1,41 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateNegativeSamples(t *testing.T) {
+	for _, data := range []string{
+		`{"name": "negative_test_zip", "rulesets": ["negative_test"], "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "negative_test.zip"}]}}`,
+		`{"name": "negative_test_name", "rulesets": ["negative_test"], "required": true, "expression": "length(negative_test.name) > 2"}`,
+		`{"name": "negative_test_qty", "rulesets": ["negative_test"], "rule": {"operator": "GREATER_THAN", "operands": [{"field": "negative_test.items[*].qty"}, {"value": 0}]}}`,
+	} {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(data), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	report, err := GenerateNegativeSamples("negative_test", "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Samples) != 3 || len(report.Unviolated) > 0 {
+		t.Fatalf("expected a sample of each rule, got %+v", report)
+	}
+	for _, sample := range report.Samples {
+		result, err := ValidateInputJSONByRules("negative_test", sample.Document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag || !reflect.DeepEqual(result.rules, []string{sample.Rule}) {
+			t.Errorf("expected the %s sample to fail it alone, got %v", sample.Rule, result.rules)
+		}
+	}
+	if _, err := GenerateNegativeSamples("negative_test", "negative_test_none", 3); err == nil {
+		t.Errorf("expected the unknown rule to fail")
+	}
+}
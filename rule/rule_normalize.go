@@ -0,0 +1,155 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Normalizer is the second rule kind of rules.json, it cleans a field
+// value rather than checking it,
+//   { "normalize": "email", "rulesets": [ "signup" ], "transforms": [ "trim", "lowercase" ] }
+// The string value of the field path, or of every path matching the
+// wildcard field name, is transformed in order before the validation, so
+// the rules check the normalized document.  The normalizers of a field
+// apply in the file order.
+type Normalizer struct {
+	Field      string   `json:"normalize"`
+	Rulesets   []string `json:"rulesets,omitempty"`
+	Transforms []string `json:"transforms"`
+}
+
+// the normalizer transforms, transformName => func
+var normalizeTransforms = map[string]func(string) string{
+	"trim":            strings.TrimSpace,
+	"lowercase":       strings.ToLower,
+	"uppercase":       strings.ToUpper,
+	"collapse-spaces": func(s string) string { return strings.Join(strings.Fields(s), " ") },
+	"digits":          func(s string) string { return strings.Map(keepDigit, s) },
+	"phone":           normalizePhone,
+}
+
+func keepDigit(r rune) rune {
+	if unicode.IsDigit(r) {
+		return r
+	}
+	return -1
+}
+
+// normalizePhone strips the phone punctuation, the spaces, dots, dashes
+// and parentheses, and keeps the digits and a leading "+"
+func normalizePhone(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "+") {
+		return "+" + strings.Map(keepDigit, s[1:])
+	}
+	return strings.Map(keepDigit, s)
+}
+
+func (n *Normalizer) check() error {
+	if len(n.Field) == 0 {
+		return fmt.Errorf("normalizer: field is missing")
+	}
+	if len(n.Transforms) == 0 {
+		return fmt.Errorf("normalizer: %s, transforms are missing", n.Field)
+	}
+	for _, name := range n.Transforms {
+		if _, ok := normalizeTransforms[name]; !ok {
+			return fmt.Errorf("normalizer: %s, unknown transform, %s", n.Field, name)
+		}
+	}
+	for _, ruleset := range n.Rulesets {
+		if err := checkRulesetName(ruleset); err != nil {
+			return fmt.Errorf("normalizer: %s, %s", n.Field, err.Error())
+		}
+	}
+	return nil
+}
+
+// matches reports the normalizer applies to the field path in ruleset
+func (n *Normalizer) matches(field string, ruleset string) bool {
+	if !inRulesets(n.Rulesets, ruleset) {
+		return false
+	}
+	if isWildcardPath(n.Field) {
+		_, ok := matchWildcardPath(n.Field, field)
+		return ok
+	}
+	return n.Field == field
+}
+
+// the normalizers of rules.json
+var normalizers = []Normalizer{}
+var normalizerLock = sync.RWMutex{}
+
+// SetNormalizers replaces the normalizers
+func SetNormalizers(list []Normalizer) error {
+	for i := range list {
+		if err := list[i].check(); err != nil {
+			return err
+		}
+	}
+	normalizerLock.Lock()
+	normalizers = list
+	normalizerLock.Unlock()
+	return nil
+}
+
+// normalizerCount is the number of the normalizers, for the features
+func normalizerCount() int {
+	normalizerLock.RLock()
+	defer normalizerLock.RUnlock()
+	return len(normalizers)
+}
+
+// NormalizeDocument returns a copy of the JSON document with the string
+// values transformed by the normalizers of ruleset, the document itself
+// when none applies
+func NormalizeDocument(doc map[string]interface{}, ruleset string) map[string]interface{} {
+	normalizerLock.RLock()
+	applied := []*Normalizer{}
+	for i := range normalizers {
+		if inRulesets(normalizers[i].Rulesets, ruleset) {
+			applied = append(applied, &normalizers[i])
+		}
+	}
+	normalizerLock.RUnlock()
+	if len(applied) == 0 {
+		return doc
+	}
+	return normalizeValue(doc, "", applied, ruleset).(map[string]interface{})
+}
+
+// normalizeValue copies the value at the path field, the path is named
+// like the input fields, e.g. "a.b[0]"
+func normalizeValue(v interface{}, field string, applied []*Normalizer, ruleset string) interface{} {
+	switch value := v.(type) {
+	case string:
+		for _, n := range applied {
+			if n.matches(field, ruleset) {
+				for _, name := range n.Transforms {
+					value = normalizeTransforms[name](value)
+				}
+			}
+		}
+		return value
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			name := k
+			if len(field) > 0 {
+				name = field + "." + k
+			}
+			m[k] = normalizeValue(item, name, applied, ruleset)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(value))
+		for i, item := range value {
+			a[i] = normalizeValue(item, fmt.Sprintf("%s[%d]", field, i), applied, ruleset)
+		}
+		return a
+	}
+	return v
+}
@@ -0,0 +1,51 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDocument(t *testing.T) {
+	if err := SetNormalizers([]Normalizer{{Field: "x", Transforms: []string{"reverse"}}}); err == nil {
+		t.Error("expected the unknown transform error")
+	}
+	defer SetNormalizers(nil)
+	err := SetNormalizers([]Normalizer{
+		{Field: "email", Transforms: []string{"trim", "lowercase"}},
+		{Field: "contacts[*].phone", Rulesets: []string{"signup"}, Transforms: []string{"phone"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{
+		"email":    " Jane@Example.COM ",
+		"age":      json.Number("30"),
+		"contacts": []interface{}{map[string]interface{}{"phone": "+1 (555) 010-9999"}},
+	}
+	normalized := NormalizeDocument(doc, "signup")
+	expected := map[string]interface{}{
+		"email":    "jane@example.com",
+		"age":      json.Number("30"),
+		"contacts": []interface{}{map[string]interface{}{"phone": "+15550109999"}},
+	}
+	if !reflect.DeepEqual(normalized, expected) {
+		t.Errorf("expected %v, got %v", expected, normalized)
+	}
+	if doc["email"] != " Jane@Example.COM " {
+		t.Errorf("expected the document unchanged, got %v", doc["email"])
+	}
+	common := NormalizeDocument(doc, "")
+	if common["email"] != "jane@example.com" || common["contacts"].([]interface{})[0].(map[string]interface{})["phone"] != "+1 (555) 010-9999" {
+		t.Errorf("expected the email normalized only, got %v", common)
+	}
+
+	w := httptest.NewRecorder()
+	ValidateJSONData(w, httptest.NewRequest("POST", "/api/validation?normalize=true", strings.NewReader(`{"email": " A@B.COM"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"document":{"email":"a@b.com"}`) {
+		t.Errorf("expected the normalized document, got %d %s", w.Code, w.Body.String())
+	}
+}
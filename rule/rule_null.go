@@ -0,0 +1,119 @@
+package rule
+
+import "fmt"
+
+// FieldPolicy defines how a rule treats a null or an absent field,
+//   pass     - the rule passes without evaluation
+//   fail     - the rule fails without evaluation
+//   empty    - the rule is evaluated with "" for the field
+//   evaluate - the rule is evaluated with the null value, the operators
+//              decide, e.g. EQUAL_TO null; for a null field only
+// The system policies are DefaultNullPolicy and DefaultMissingPolicy,
+// "null-policy" and "missing-policy" override them per rule.  The pass and
+// fail policies look at the primary field, the empty policy reads any
+// null or absent field of the rule as "".
+type FieldPolicy string
+
+const (
+	FieldPolicyPass     FieldPolicy = "pass"
+	FieldPolicyFail     FieldPolicy = "fail"
+	FieldPolicyEmpty    FieldPolicy = "empty"
+	FieldPolicyEvaluate FieldPolicy = "evaluate"
+)
+
+// DefaultNullPolicy is the null field policy of the rules without
+// "null-policy"
+var DefaultNullPolicy = FieldPolicyEvaluate
+
+// DefaultMissingPolicy is the absent primary field policy of the rules
+// without "missing-policy", a required rule always fails
+var DefaultMissingPolicy = FieldPolicyPass
+
+// ParseNullPolicy parses the null field policy
+func ParseNullPolicy(s string) (FieldPolicy, error) {
+	switch p := FieldPolicy(s); p {
+	case FieldPolicyPass, FieldPolicyFail, FieldPolicyEmpty, FieldPolicyEvaluate:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown null policy, %s", s)
+}
+
+// ParseMissingPolicy parses the absent field policy
+func ParseMissingPolicy(s string) (FieldPolicy, error) {
+	switch p := FieldPolicy(s); p {
+	case FieldPolicyPass, FieldPolicyFail, FieldPolicyEmpty:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown missing policy, %s", s)
+}
+
+// the number of the rules with "missing-policy", maintained with the
+// register
+var missingPolicyRuleCount = 0
+
+// nullPolicy is the null field policy of the rule
+func (entry *RuleEntry) nullPolicy() FieldPolicy {
+	if len(entry.NullPolicy) > 0 {
+		return entry.NullPolicy
+	}
+	return DefaultNullPolicy
+}
+
+// missingPolicy is the absent primary field policy of the rule
+func (entry *RuleEntry) missingPolicy() FieldPolicy {
+	if entry.Required {
+		return FieldPolicyFail
+	}
+	if len(entry.MissingPolicy) > 0 {
+		return entry.MissingPolicy
+	}
+	return DefaultMissingPolicy
+}
+
+// missingPolicyRules calls fn for the rules of the registry, which
+// missing policy may not be pass, all of them unless the system policy is
+// pass.  Caller holds the READ lock of the shared registry.
+func (reg ruleRegistry) missingPolicyRules(fn func(entry *RuleEntry)) {
+	if DefaultMissingPolicy == FieldPolicyPass && reg.missingPolicies == 0 {
+		return
+	}
+	for field, rules := range reg.rules {
+		if field == DocumentField {
+			continue
+		}
+		for _, entry := range rules {
+			if !entry.Required && entry.missingPolicy() != FieldPolicyPass {
+				fn(entry)
+			}
+		}
+	}
+}
+
+// primaryFieldAbsent checks the input has no value of the primary field
+// of the rule, or no match of its wildcard field name
+func primaryFieldAbsent(entry *RuleEntry, inputFields map[string]interface{}) bool {
+	if isWildcardPath(entry.Field) {
+		return !hasWildcardMatch(entry.Field, inputFields)
+	}
+	_, ok := inputFields[entry.Field]
+	return !ok
+}
+
+// nullPolicyResult returns the result of the rule of ctx for its null
+// primary field, false when the rule is evaluated.  An empty policy reads
+// the null fields as "".
+func (context *FieldEvalContext) nullPolicyResult() (bool, bool) {
+	if context.FieldValue != nil || context.Field == DocumentField {
+		return false, false
+	}
+	switch context.nullPolicy {
+	case FieldPolicyPass:
+		return true, true
+	case FieldPolicyFail:
+		return false, true
+	case FieldPolicyEmpty:
+		context.FieldValue = ""
+		context.emptyFields = true
+	}
+	return false, false
+}
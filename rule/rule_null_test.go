@@ -0,0 +1,60 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFieldPolicies(t *testing.T) {
+	rules := []string{
+		`{"name": "field_policy_test_code",
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "^[A-Z]*$"}, {"field": "field_policy_test.code"}]}}`,
+		`{"name": "field_policy_test_note", "null-policy": "fail", "missing-policy": "fail",
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "."}, {"field": "field_policy_test.note"}]}}`,
+		`{"name": "field_policy_test_tag", "null-policy": "pass", "missing-policy": "empty",
+		  "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "field_policy_test.tag"}]}, {"value": 0}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+	bad := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "field_policy_test_bad", "missing-policy": "evaluate",
+	  "rule": {"operator": "MATCHES", "operands": [{"value": "."}, {"field": "field_policy_test.bad"}]}}`), &bad)
+	if _, err := RegisterRuleNode(&bad); err == nil || !strings.Contains(err.Error(), "missing policy") {
+		t.Errorf("expected the evaluate missing policy to fail, got %v", err)
+	}
+
+	validate := func(doc string) []string {
+		var input map[string]interface{}
+		json.Unmarshal([]byte(doc), &input)
+		result, err := ValidateInputJSONByRules("", input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(result.rules)
+		return result.rules
+	}
+	defer func(policy FieldPolicy) { DefaultNullPolicy = policy }(DefaultNullPolicy)
+	for policy, expected := range map[FieldPolicy][]string{
+		FieldPolicyEvaluate: {"field_policy_test_note", "field_policy_test_tag"},
+		FieldPolicyFail:     {"field_policy_test_code", "field_policy_test_note", "field_policy_test_tag"},
+		FieldPolicyEmpty:    {"field_policy_test_note", "field_policy_test_tag"},
+	} {
+		DefaultNullPolicy = policy
+		// code is null, note is absent, tag is absent and read as ""
+		if rules := validate(`{"field_policy_test": {"code": null}}`); !reflect.DeepEqual(rules, expected) {
+			t.Errorf("%s: expected %v to fail, got %v", policy, expected, rules)
+		}
+	}
+	DefaultNullPolicy = FieldPolicyEvaluate
+	if rules := validate(`{"field_policy_test": {"code": "AB", "note": null, "tag": null}}`); !reflect.DeepEqual(rules, []string{"field_policy_test_note"}) {
+		t.Errorf("expected the null note to fail, and the null tag to pass, got %v", rules)
+	}
+}
@@ -0,0 +1,180 @@
+package rule
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// numericValue keeps an operand value as big.Int when it is integral,
+// so the comparison of two integers doesn't lose the precision in float64
+type numericValue struct {
+	isInt bool
+	i     *big.Int
+	f     float64
+}
+
+func intNumericValue(i *big.Int) numericValue {
+	f, _ := new(big.Float).SetInt(i).Float64()
+	return numericValue{isInt: true, i: i, f: f}
+}
+
+// toNumericValue converts the operand value, string or number, into numericValue
+func toNumericValue(operand interface{}) (numericValue, error) {
+	switch v := operand.(type) {
+	case int:
+		return intNumericValue(big.NewInt(int64(v))), nil
+	case int64:
+		return intNumericValue(big.NewInt(v)), nil
+	case *big.Int:
+		return intNumericValue(v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return numericValue{}, ParseRuleOperatorError
+		}
+		return numericValue{f: v}, nil
+	case json.Number:
+		return toNumericValue(string(v))
+	case string:
+		s := strings.TrimSpace(v)
+		if i, ok := new(big.Int).SetString(s, 10); ok {
+			return intNumericValue(i), nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return numericValue{}, err
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return numericValue{}, ParseRuleOperatorError
+		}
+		return numericValue{f: f}, nil
+	}
+	return numericValue{}, ParseRuleOperatorError
+}
+
+// compareNumeric returns -1, 0, +1 when v1 is lower, equal or higher than v2.
+// Two values within epsilon are equal.  Integers are compared exactly
+// when no epsilon is given.
+func compareNumeric(v1, v2 numericValue, epsilon float64) int {
+	if v1.isInt && v2.isInt && epsilon == 0 {
+		return v1.i.Cmp(v2.i)
+	}
+	switch d := v1.f - v2.f; {
+	case math.Abs(d) <= epsilon:
+		return 0
+	case d < 0:
+		return -1
+	}
+	return 1
+}
+
+// numericOperands converts the comparison operands, (v1, v2[, epsilon])
+func numericOperands(operands []interface{}) (numericValue, numericValue, float64, error) {
+	var v1, v2 numericValue
+	var epsilon float64
+	if len(operands) != 2 && len(operands) != 3 {
+		return v1, v2, epsilon, ParseRuleOperatorError
+	}
+	var err error
+	if v1, err = toNumericValue(operands[0]); err != nil {
+		return v1, v2, epsilon, err
+	}
+	if v2, err = toNumericValue(operands[1]); err != nil {
+		return v1, v2, epsilon, err
+	}
+	if len(operands) == 3 {
+		e, err := toNumericValue(operands[2])
+		if err != nil {
+			return v1, v2, epsilon, err
+		}
+		if epsilon = e.f; epsilon < 0 {
+			return v1, v2, epsilon, ParseRuleOperatorError
+		}
+	}
+	return v1, v2, epsilon, nil
+}
+
+// toDecimal converts the operand value, string or number, into an exact
+// decimal, e.g. "9007199254740993.01" without the float64 rounding
+func toDecimal(operand interface{}) (*big.Rat, error) {
+	switch v := operand.(type) {
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), nil
+	case int64:
+		return new(big.Rat).SetInt64(v), nil
+	case *big.Int:
+		return new(big.Rat).SetInt(v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, ParseRuleOperatorError
+		}
+		// use the shortest decimal representation of v, not its binary value
+		return toDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case json.Number:
+		return toDecimal(string(v))
+	case string:
+		if d, ok := parseDecimal(strings.TrimSpace(v)); ok {
+			return d, nil
+		}
+	}
+	return nil, ParseRuleOperatorError
+}
+
+// maxDecimalExponent caps the exponent of a decimal string, "1e1000000000"
+// would be expanded into an integer of a billion digits
+const maxDecimalExponent = 10000
+
+// parseDecimal parses the decimal string s, e.g. "12.5" or "1.2e-3", with
+// its exponent within maxDecimalExponent
+func parseDecimal(s string) (*big.Rat, bool) {
+	mantissa := strings.TrimLeft(s, "+-")
+	exponentMarks := "eEpP"
+	if strings.HasPrefix(mantissa, "0x") || strings.HasPrefix(mantissa, "0X") {
+		// the hex digits include e
+		exponentMarks = "pP"
+	}
+	if i := strings.IndexAny(s, exponentMarks); i >= 0 {
+		exponent, err := strconv.Atoi(s[i+1:])
+		if err != nil || exponent > maxDecimalExponent || exponent < -maxDecimalExponent {
+			return nil, false
+		}
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// compareDecimal returns -1, 0, +1 when d1 is lower, equal or higher than d2,
+// two values within epsilon are equal
+func compareDecimal(d1, d2 *big.Rat, epsilon *big.Rat) int {
+	diff := new(big.Rat).Sub(d1, d2)
+	if epsilon != nil && new(big.Rat).Abs(diff).Cmp(epsilon) <= 0 {
+		return 0
+	}
+	return diff.Sign()
+}
+
+// decimalOperands converts the comparison operands, (d1, d2[, epsilon])
+func decimalOperands(operands []interface{}) (*big.Rat, *big.Rat, *big.Rat, error) {
+	if len(operands) != 2 && len(operands) != 3 {
+		return nil, nil, nil, ParseRuleOperatorError
+	}
+	d1, err := toDecimal(operands[0])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	d2, err := toDecimal(operands[1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var epsilon *big.Rat
+	if len(operands) == 3 {
+		if epsilon, err = toDecimal(operands[2]); err != nil {
+			return nil, nil, nil, err
+		}
+		if epsilon.Sign() < 0 {
+			return nil, nil, nil, ParseRuleOperatorError
+		}
+	}
+	return d1, d2, epsilon, nil
+}
@@ -0,0 +1,92 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNumericComparison(t *testing.T) {
+	for _, tc := range []struct {
+		operator OperatorType
+		operands []interface{}
+		expected bool
+	}{
+		{GreaterThanOperator, []interface{}{"10.5", "10"}, true},
+		{GreaterThanOperator, []interface{}{" 3 ", 2.5}, true},
+		// integers are compared exactly, not in float64
+		{GreaterThanOperator, []interface{}{"9007199254740993", "9007199254740992"}, true},
+		{EqualToOperator, []interface{}{0.1 + 0.2, 0.3, 1e-9}, true},
+		{EqualToOperator, []interface{}{"1.0", "1.1", "0.05"}, false},
+		{GreaterThanOperator, []interface{}{"1.04", "1", "0.05"}, false},
+		{BetweenOperator, []interface{}{5.0, 1.0, 5.0}, true},
+		{BetweenOperator, []interface{}{5.5, 1.0, 5.0}, false},
+	} {
+		if res, err := RegisteredOperators[tc.operator](tc.operands); err != nil || res != tc.expected {
+			t.Errorf("%s%v: expected %v, got %v %v", tc.operator, tc.operands, tc.expected, res, err)
+		}
+	}
+	for _, operands := range [][]interface{}{{"1", "1", "-0.1"}, {"1", "NaN"}, {"1", "one"}} {
+		if _, err := RegisteredOperators[GreaterThanOperator](operands); err == nil {
+			t.Errorf("%v: expected the operands rejected", operands)
+		}
+	}
+}
+
+func TestToDecimalExponent(t *testing.T) {
+	for _, s := range []string{"1.5e3", "-2E-4", "0x1e", "0x1p4", "12.5"} {
+		if _, err := toDecimal(s); err != nil {
+			t.Errorf("%s: expected a decimal, got %v", s, err)
+		}
+	}
+	start := time.Now()
+	for _, s := range []string{"1e1000000000", "-1e-1000000000", "0x1p1000000000", "1e99999999999999999999"} {
+		if _, err := toDecimal(s); err != ParseRuleOperatorError {
+			t.Errorf("%s: expected the exponent rejected, got %v", s, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the exponents rejected without the expansion, took %v", elapsed)
+	}
+	if !patchValuesEqual(json.Number("1e1000000000"), json.Number("1e1000000000")) {
+		t.Error("expected the same numbers equal")
+	}
+}
+
+func TestDecimalOperators(t *testing.T) {
+	for _, tc := range []struct {
+		operator OperatorType
+		operands []interface{}
+		expected bool
+	}{
+		// 0.1 + 0.2 is not 0.3 in float64
+		{EqualToOperator, []interface{}{"0.30000000000000000001", "0.3"}, false},
+		{EqualToOperator, []interface{}{"0.30000000000000000001", "0.3", "0.0000000001"}, true},
+		{GreaterThanOperator, []interface{}{"12345678901234567890.01", "12345678901234567890"}, true},
+		{BetweenOperator, []interface{}{"19.99", "0", "19.99"}, true},
+		{BetweenOperator, []interface{}{"19.991", "0", "19.99"}, false},
+	} {
+		if res, err := RegisteredDecimalOperators[tc.operator](tc.operands); err != nil || res != tc.expected {
+			t.Errorf("%s%v: expected %v, got %v %v", tc.operator, tc.operands, tc.expected, res, err)
+		}
+	}
+}
+
+func TestDecimalInputNumber(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "decimal_input_test", "rulesets": ["decimal_input_test"], "rule": {"operator": "GREATER_THAN",
+		"mode": "decimal", "operands": [{"field": "amount3"}, {"value": "9007199254740993.6"}]}}`), &node)
+	registerTestRule(t, &node)
+
+	// 9007199254740993.5 is 9007199254740994 in float64
+	for _, input := range []string{`{"amount3": 9007199254740993.5}`, `{"amount3": "9007199254740993.5"}`, `{"amount3": 9007199254740993.6}`} {
+		result, err := ValidateInput("decimal_input_test", ValidationOptions{}, ContentTypeJSON, input)
+		if err != nil || result.flag {
+			t.Errorf("%s: expected to fail, got %v %v", input, result, err)
+		}
+	}
+	result, err := ValidateInput("decimal_input_test", ValidationOptions{}, ContentTypeJSON, `{"amount3": 9007199254740993.7}`)
+	if err != nil || !result.flag {
+		t.Errorf("expected to pass, got %v %v", result, err)
+	}
+}
@@ -0,0 +1,81 @@
+package rule
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// OperatorInfo describes an operator available in the rule definitions
+type OperatorInfo struct {
+	Name         string      `json:"name"`
+	Kind         string      `json:"kind"` // "operator", "alias" or "macro"
+	MinOperands  int         `json:"min-operands"`
+	MaxOperands  int         `json:"max-operands"` // -1 is unbounded
+	OperandTypes []ValueType `json:"operand-types"`
+	ResultType   ValueType   `json:"result-type"`
+	Modes        []string    `json:"modes,omitempty"`
+	Description  string      `json:"description"`
+	AliasOf      string      `json:"alias-of,omitempty"`
+	Deprecated   bool        `json:"deprecated,omitempty"`
+	Pack         string      `json:"pack,omitempty"` // the operator pack providing it
+}
+
+// operatorInfo describes a registered operator, an operator without the
+// signature, e.g. registered by a plugin, accepts any operands
+func operatorInfo(name OperatorType) OperatorInfo {
+	info := OperatorInfo{Name: string(name), Kind: "operator", MaxOperands: -1,
+		OperandTypes: []ValueType{TypeAny}, ResultType: TypeAny}
+	if sig, ok := OperatorSignatures[name]; ok {
+		info.MinOperands = sig.MinOperands
+		info.MaxOperands = sig.MaxOperands
+		info.OperandTypes = sig.OperandTypes
+		info.ResultType = sig.ResultType
+		info.Description = sig.Description
+	}
+	if _, ok := RegisteredDecimalOperators[name]; ok {
+		info.Modes = append(info.Modes, OperatorModeDecimal)
+	}
+	info.Pack = operatorPackOf(name)
+	return info
+}
+
+// ListOperators lists all operators, aliases and macros sorted by name
+func ListOperators() []OperatorInfo {
+	list := []OperatorInfo{}
+	for name := range RegisteredOperators {
+		list = append(list, operatorInfo(name))
+	}
+	for name, alias := range OperatorAliases {
+		info := operatorInfo(alias.Target)
+		info.Name = string(name)
+		info.Kind = "alias"
+		info.AliasOf = string(alias.Target)
+		info.Deprecated = alias.Deprecated
+		list = append(list, info)
+	}
+
+	macroLock.RLock()
+	for _, macro := range registeredMacros {
+		types := make([]ValueType, macro.Params)
+		for i := range types {
+			types[i] = TypeAny
+		}
+		list = append(list, OperatorInfo{Name: macro.Name, Kind: "macro",
+			MinOperands: macro.Params, MaxOperands: macro.Params,
+			OperandTypes: types, ResultType: macro.resultType(), Description: macro.Description})
+	}
+	macroLock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// GET /admin/operators service implementation
+func GetOperators(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(ListOperators())
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,48 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+func TestListOperators(t *testing.T) {
+	m := OperatorMacro{}
+	json.Unmarshal([]byte(`{"name": "OPERATOR_TEST_ZONE", "params": 1, "description": "time zone",
+		"body": {"operator": "IS_TIMEZONE", "operands": [{"arg": 0}]}}`), &m)
+	if err := SaveMacroToRegister(&m); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		macroLock.Lock()
+		delete(registeredMacros, "OPERATOR_TEST_ZONE")
+		macroLock.Unlock()
+	}()
+
+	w := httptest.NewRecorder()
+	GetOperators(w, httptest.NewRequest(http.MethodGet, "/admin/operators", nil))
+	list := []OperatorInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if !sort.SliceIsSorted(list, func(i, j int) bool { return list[i].Name < list[j].Name }) {
+		t.Error("expected the operators sorted by name")
+	}
+	byName := map[string]OperatorInfo{}
+	for _, info := range list {
+		byName[info.Name] = info
+	}
+
+	if between := byName["BETWEEN"]; between.Kind != "operator" || between.MinOperands != 3 || between.MaxOperands != 3 ||
+		between.ResultType != TypeBool || len(between.Modes) != 1 || between.Modes[0] != OperatorModeDecimal {
+		t.Errorf("expected the BETWEEN signature and the decimal mode, got %+v", between)
+	}
+	if alias := byName["REGEX_MATCH"]; alias.Kind != "alias" || alias.AliasOf != string(MatchesOperator) || !alias.Deprecated {
+		t.Errorf("expected the deprecated alias of MATCHES, got %+v", alias)
+	}
+	if macro := byName["OPERATOR_TEST_ZONE"]; macro.Kind != "macro" || macro.MinOperands != 1 || macro.ResultType != TypeBool || macro.Description != "time zone" {
+		t.Errorf("expected the macro, got %+v", macro)
+	}
+}
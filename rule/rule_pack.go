@@ -0,0 +1,109 @@
+package rule
+
+import (
+	"fmt"
+	"sort"
+)
+
+// OperatorPack is an optional group of the specialized operators, e.g.
+// "finance" or "identity".  A pack file registers its pack in init(), and
+// excluding the file by its build tag, e.g. "nopack_finance", leaves the
+// pack out of the binary.  The operators of a pack are available after
+// EnableOperatorPacks() turns the pack on, or at once for a Default pack,
+// e.g. "geo" which operators were core before the packs, so the existing
+// rules keep parsing.
+type OperatorPack struct {
+	Name        string
+	Description string
+	Default     bool // enabled when it is registered
+	Operators   map[OperatorType]OperatorFn
+	Signatures  map[OperatorType]OperatorSignature
+}
+
+// the operator packs built in the binary, and the enabled ones, by name
+var (
+	operatorPacks = map[string]*OperatorPack{}
+	enabledPacks  = map[string]bool{}
+)
+
+// RegisterOperatorPack makes pack available to enable, called by the
+// pack init()
+func RegisterOperatorPack(pack *OperatorPack) {
+	if _, exists := operatorPacks[pack.Name]; exists {
+		panic("operator pack registered twice, " + pack.Name)
+	}
+	operatorPacks[pack.Name] = pack
+	if pack.Default {
+		if err := enableOperatorPack(pack); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// EnableOperatorPacks adds the operators of the named packs to the
+// registered operators.  It is called before the rules are loaded, and an
+// unknown pack, or a pack operator conflicting with a registered one, is an
+// error.
+func EnableOperatorPacks(names []string) error {
+	for _, name := range names {
+		pack, ok := operatorPacks[name]
+		if !ok {
+			return fmt.Errorf("unknown operator pack, %s, available packs are %v", name, availableOperatorPacks())
+		}
+		if err := enableOperatorPack(pack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enableOperatorPack adds the operators of pack, once
+func enableOperatorPack(pack *OperatorPack) error {
+	if enabledPacks[pack.Name] {
+		return nil
+	}
+	for op := range pack.Operators {
+		if _, exists := RegisteredOperators[op]; exists {
+			return fmt.Errorf("operator pack, %s, operator %s is already registered", pack.Name, op)
+		}
+	}
+	for op, fn := range pack.Operators {
+		RegisteredOperators[op] = fn
+	}
+	for op, sig := range pack.Signatures {
+		OperatorSignatures[op] = sig
+	}
+	enabledPacks[pack.Name] = true
+	return nil
+}
+
+// availableOperatorPacks lists the packs built in the binary, sorted
+func availableOperatorPacks() []string {
+	list := []string{}
+	for name := range operatorPacks {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// enabledOperatorPacks lists the enabled packs, sorted
+func enabledOperatorPacks() []string {
+	list := []string{}
+	for name := range enabledPacks {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// operatorPackOf returns the name of the pack providing op, "" for a core
+// operator or an unknown one
+func operatorPackOf(op OperatorType) string {
+	for name, pack := range operatorPacks {
+		if _, ok := pack.Operators[op]; ok {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+//go:build !nopack_finance
+// +build !nopack_finance
+
+package rule
+
+import (
+	"strings"
+)
+
+// the IBAN length by the ISO 3166 country code
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22,
+	"BH": 22, "BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22,
+	"DK": 18, "DO": 28, "EE": 20, "EG": 29, "ES": 24, "FI": 18, "FO": 18, "FR": 27,
+	"GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28, "HR": 21, "HU": 28,
+	"IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20,
+	"LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24,
+	"ME": 22, "MK": 19, "MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24,
+	"PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "SA": 24, "SC": 31,
+	"SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28, "TL": 23, "TN": 24,
+	"TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+// isIBAN checks the length of the country and the ISO 7064 mod 97-10
+// check digits, the spaces of the printed form are ignored
+func isIBAN(s string) bool {
+	iban := strings.ToUpper(strings.Replace(s, " ", "", -1))
+	if len(iban) < 4 || ibanLengths[iban[:2]] != len(iban) {
+		return false
+	}
+	// move the country code and the check digits to the end, and convert
+	// the letters to 10..35
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for _, c := range rearranged {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// luhnValid checks the Luhn (mod 10) check digit of a card or an account
+// number, the spaces and dashes are ignored
+func luhnValid(s string) bool {
+	sum, digits := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits > 1 && sum%10 == 0
+}
+
+// the active ISO 4217 currency codes
+var currencyCodes = map[string]bool{}
+
+func init() {
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND
+		BOB BRL BSD BTN BWP BYN BZD CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF
+		DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD
+		HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW
+		KWD KYD KZT LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR
+		MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN
+		PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN
+		SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VES
+		VND VUV WST XAF XCD XOF XPF YER ZAR ZMW ZWL`) {
+		currencyCodes[code] = true
+	}
+
+	RegisterOperatorPack(&OperatorPack{
+		Name:        "finance",
+		Description: "IBAN, Luhn check digit and ISO 4217 currency codes",
+		Operators: map[OperatorType]OperatorFn{
+			IsIbanOperator: func(operands []interface{}) (interface{}, error) {
+				if len(operands) != 1 {
+					return nil, ParseRuleOperatorError
+				}
+				s, ok := operands[0].(string)
+				if !ok {
+					return nil, ParseRuleOperatorError
+				}
+				return isIBAN(s), nil
+			},
+
+			LuhnValidOperator: func(operands []interface{}) (interface{}, error) {
+				if len(operands) != 1 {
+					return nil, ParseRuleOperatorError
+				}
+				s, ok := operands[0].(string)
+				if !ok {
+					return nil, ParseRuleOperatorError
+				}
+				return luhnValid(s), nil
+			},
+
+			IsCurrencyCodeOperator: func(operands []interface{}) (interface{}, error) {
+				if len(operands) != 1 {
+					return nil, ParseRuleOperatorError
+				}
+				s, ok := operands[0].(string)
+				if !ok {
+					return nil, ParseRuleOperatorError
+				}
+				return currencyCodes[s], nil
+			},
+		},
+		Signatures: map[OperatorType]OperatorSignature{
+			IsIbanOperator:         {1, 1, []ValueType{TypeString}, TypeBool, "string is an IBAN with the valid length and check digits"},
+			LuhnValidOperator:      {1, 1, []ValueType{TypeString}, TypeBool, "digit string has a valid Luhn check digit"},
+			IsCurrencyCodeOperator: {1, 1, []ValueType{TypeString}, TypeBool, "string is an active ISO 4217 currency code"},
+		},
+	})
+}
@@ -0,0 +1,64 @@
+//go:build !nopack_geo
+// +build !nopack_geo
+
+package rule
+
+// the geo operator pack, the coordinates and the regions, enabled by
+// default as its operators were core before the packs
+func init() {
+	RegisterOperatorPack(&OperatorPack{
+		Name:        "geo",
+		Description: "coordinates and bounding box regions",
+		Default:     true,
+		Operators: map[OperatorType]OperatorFn{
+			// check a latitude or longitude value in decimal degrees
+			IsLatitudeOperator: func(operands []interface{}) (interface{}, error) {
+				if len(operands) != 1 {
+					return nil, ParseRuleOperatorError
+				}
+				_, err := toLatitude(operands[0])
+				return err == nil, nil
+			},
+
+			IsLongitudeOperator: func(operands []interface{}) (interface{}, error) {
+				if len(operands) != 1 {
+					return nil, ParseRuleOperatorError
+				}
+				_, err := toLongitude(operands[0])
+				return err == nil, nil
+			},
+
+			// check a coordinate in the bounding box, the last 4 operands
+			// (minLat, minLong, maxLat, maxLong).  The coordinate is either
+			// a "lat,long" string, or two operands lat and long.
+			WithinBboxOperator: func(operands []interface{}) (interface{}, error) {
+				var point geoPoint
+				var err error
+				switch len(operands) {
+				case 5:
+					s, ok := operands[0].(string)
+					if !ok {
+						return nil, ParseRuleOperatorError
+					}
+					point, err = parseGeoPoint(s)
+				case 6:
+					if point.lat, err = toLatitude(operands[0]); err == nil {
+						point.long, err = toLongitude(operands[1])
+					}
+				default:
+					return nil, ParseRuleOperatorError
+				}
+				box, boxErr := toGeoBox(operands[len(operands)-4:])
+				if boxErr != nil {
+					return nil, boxErr
+				}
+				return err == nil && box.contains(point), nil
+			},
+		},
+		Signatures: map[OperatorType]OperatorSignature{
+			IsLatitudeOperator:  {1, 1, []ValueType{TypeNumber}, TypeBool, "number is a latitude in [-90, 90] degrees"},
+			IsLongitudeOperator: {1, 1, []ValueType{TypeNumber}, TypeBool, "number is a longitude in [-180, 180] degrees"},
+			WithinBboxOperator:  {5, 6, []ValueType{TypeNumber}, TypeBool, `coordinate, "lat,long" or lat and long, is in the bounding box minLat, minLong, maxLat, maxLong`},
+		},
+	})
+}
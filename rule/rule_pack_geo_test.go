@@ -0,0 +1,37 @@
+//go:build !nopack_geo
+// +build !nopack_geo
+
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGeoOperatorPack(t *testing.T) {
+	if !enabledPacks["geo"] {
+		t.Fatal("expected the geo pack enabled by default")
+	}
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "geo_test_location",
+		"rule": {"operator": "WITHIN_BBOX", "operands": [{"field": "geo_test_location"}, {"value": 24.5}, {"value": -125}, {"value": 49.5}, {"value": -66.9}]}}`), &node)
+	registerTestRule(t, &node)
+	for location, expected := range map[string]bool{"40.7128,-74.0060": true, "51.5074,-0.1278": false, "north": false} {
+		result, err := ValidateInputJSONByRules("", map[string]interface{}{"geo_test_location": location})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != expected {
+			t.Errorf("%s: expected %v, got %v", location, expected, result.flag)
+		}
+	}
+	for _, tc := range []struct {
+		operator OperatorType
+		value    interface{}
+		expected bool
+	}{{IsLatitudeOperator, 90.0, true}, {IsLatitudeOperator, -90.5, false}, {IsLongitudeOperator, 180.0, true}, {IsLongitudeOperator, "x", false}} {
+		if res, err := RegisteredOperators[tc.operator]([]interface{}{tc.value}); err != nil || res != tc.expected {
+			t.Errorf("%s(%v): expected %v, got %v %v", tc.operator, tc.value, tc.expected, res, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+//go:build !nopack_identity
+// +build !nopack_identity
+
+package rule
+
+import (
+	"regexp"
+	"strings"
+)
+
+var ssnPattern = regexp.MustCompile(`^(\d{3})-?(\d{2})-?(\d{4})$`)
+
+// isSSN checks the US social security number format, "123-45-6789" or
+// "123456789".  The area 000, 666 and 900-999, the group 00 and the serial
+// 0000 are never assigned.
+func isSSN(s string) bool {
+	m := ssnPattern.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	area, group, serial := m[1], m[2], m[3]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// the passport number format by the ISO 3166 country code, a format check
+// only, the issuing authority is the source of truth
+var passportPatterns = map[string]*regexp.Regexp{
+	"US": regexp.MustCompile(`^([0-9]{9}|[A-Z][0-9]{8})$`),
+	"CA": regexp.MustCompile(`^[A-Z]{2}[0-9]{6}$`),
+	"GB": regexp.MustCompile(`^[0-9]{9}$`),
+	"IE": regexp.MustCompile(`^[A-Z]{2}[0-9]{7}$`),
+	"DE": regexp.MustCompile(`^[CFGHJKLMNPRTVWXYZ0-9]{9}$`),
+	"FR": regexp.MustCompile(`^[0-9]{2}[A-Z]{2}[0-9]{5}$`),
+	"ES": regexp.MustCompile(`^[A-Z]{3}[0-9]{6}$`),
+	"IT": regexp.MustCompile(`^[A-Z]{2}[0-9]{7}$`),
+	"NL": regexp.MustCompile(`^[A-NP-Z]{2}[A-NP-Z0-9]{6}[0-9]$`),
+	"IN": regexp.MustCompile(`^[A-Z][0-9]{7}$`),
+	"AU": regexp.MustCompile(`^[A-Z]{1,2}[0-9]{7}$`),
+	"JP": regexp.MustCompile(`^[A-Z]{2}[0-9]{7}$`),
+}
+
+func init() {
+	RegisterOperatorPack(&OperatorPack{
+		Name:        "identity",
+		Description: "US SSN and passport number formats",
+		Operators: map[OperatorType]OperatorFn{
+			IsSsnOperator: func(operands []interface{}) (interface{}, error) {
+				if len(operands) != 1 {
+					return nil, ParseRuleOperatorError
+				}
+				s, ok := operands[0].(string)
+				if !ok {
+					return nil, ParseRuleOperatorError
+				}
+				return isSSN(s), nil
+			},
+
+			// check the passport number operands[0] by the format of the
+			// country operands[1], an unsupported country is an error
+			PassportFormatOperator: func(operands []interface{}) (interface{}, error) {
+				if len(operands) != 2 {
+					return nil, ParseRuleOperatorError
+				}
+				s, ok1 := operands[0].(string)
+				country, ok2 := operands[1].(string)
+				if !ok1 || !ok2 {
+					return nil, ParseRuleOperatorError
+				}
+				pattern, ok := passportPatterns[strings.ToUpper(country)]
+				if !ok {
+					return nil, ParseRuleOperatorError
+				}
+				return pattern.MatchString(strings.ToUpper(s)), nil
+			},
+		},
+		Signatures: map[OperatorType]OperatorSignature{
+			IsSsnOperator:          {1, 1, []ValueType{TypeString}, TypeBool, "string is a US social security number"},
+			PassportFormatOperator: {2, 2, []ValueType{TypeString}, TypeBool, "passport number has the format of the country code"},
+		},
+	})
+}
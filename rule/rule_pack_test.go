@@ -0,0 +1,77 @@
+//go:build !nopack_finance && !nopack_identity
+// +build !nopack_finance,!nopack_identity
+
+package rule
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var packCheckTestCases = []struct {
+	description string
+	check       func(string) bool
+	value       string
+	expected    bool
+}{
+	{"IBAN", isIBAN, "GB82 WEST 1234 5698 7654 32", true},
+	{"IBAN with a bad check digit", isIBAN, "GB82 WEST 1234 5698 7654 33", false},
+	{"IBAN of another country", isIBAN, "DE89370400440532013000", true},
+	{"IBAN with a bad length", isIBAN, "DE8937040044053201300", false},
+	{"Luhn", luhnValid, "4111 1111 1111 1111", true},
+	{"Luhn with a bad check digit", luhnValid, "4111-1111-1111-1112", false},
+	{"Luhn with a letter", luhnValid, "4111a", false},
+	{"SSN", isSSN, "123-45-6789", true},
+	{"SSN without dashes", isSSN, "123456789", true},
+	{"SSN with the area 666", isSSN, "666-45-6789", false},
+	{"SSN with the group 00", isSSN, "123-00-6789", false},
+}
+
+func TestOperatorPackChecks(t *testing.T) {
+	for _, tc := range packCheckTestCases {
+		if got := tc.check(tc.value); got != tc.expected {
+			t.Errorf("%s: %q expected %v, got %v", tc.description, tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestEnableOperatorPacks(t *testing.T) {
+	if err := EnableOperatorPacks([]string{"no_such_pack"}); err == nil {
+		t.Error("expected an error for an unknown pack")
+	}
+
+	rule := `{"operator": "PASSPORT_FORMAT", "operands": [{"field": "passport"}, {"value": "US"}]}`
+	if enabledPacks["identity"] {
+		t.Skip("identity pack is enabled by another test")
+	}
+	if err := json.Unmarshal([]byte(rule), &Term{}); err == nil || !strings.Contains(err.Error(), "-operator-packs=identity") {
+		t.Errorf("expected an error naming the flag for an operator of a disabled pack, got %v", err)
+	}
+	if err := EnableOperatorPacks([]string{"identity"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { disableOperatorPack("identity") })
+	term := Term{}
+	if err := json.Unmarshal([]byte(rule), &term); err != nil {
+		t.Fatal(err)
+	}
+	op, err := ConstructOperandListHelper(&term, map[string]int{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := FieldEvalContext{Field: "passport", FieldValue: "A12345678", Rule: op}
+	if res, err := op.Evaluate(&ctx); err != nil || res != true {
+		t.Errorf("expected true, got %v, %v", res, err)
+	}
+}
+
+// disableOperatorPack removes the operators of the enabled pack, to restore
+// the registered operators after a test
+func disableOperatorPack(name string) {
+	for op := range operatorPacks[name].Operators {
+		delete(RegisteredOperators, op)
+		delete(OperatorSignatures, op)
+	}
+	delete(enabledPacks, name)
+}
@@ -0,0 +1,127 @@
+package rule
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/richgrove/validation/util"
+)
+
+// RecoverPanics turns a panic of a request, e.g. a bad type assertion of
+// an operator, into an HTTP 500 response with the request ID, and logs
+// the stack with the rule being evaluated.  Without it a panic crashes the
+// service, e.g. to debug it.
+var RecoverPanics = true
+
+// PanicDetails adds the panic value and the rule to the HTTP 500 response,
+// not only to the log, for the development instances
+var PanicDetails = false
+
+// the request ID header, the client's one is kept
+const requestIDHeader = "X-Request-ID"
+
+// RulePanic is a panic in the evaluation of a rule, with the rule context
+// and the stack of the panic
+type RulePanic struct {
+	RuleName string
+	RuleID   string
+	Field    string
+	Value    interface{}
+	Stack    []byte
+}
+
+func (p *RulePanic) Error() string {
+	return fmt.Sprintf("panic in the rule %s (id %s) of the field %s, %v", p.RuleName, p.RuleID, p.Field, p.Value)
+}
+
+// recoverRulePanic is deferred by the rule evaluation, it panics again
+// with the rule context of ctx
+func recoverRulePanic(ctx *FieldEvalContext) {
+	if !RecoverPanics {
+		return
+	}
+	if v := recover(); v != nil {
+		if p, ok := v.(*RulePanic); ok {
+			panic(p)
+		}
+		panic(&RulePanic{RuleName: ctx.RuleName, RuleID: ctx.RuleID, Field: ctx.Field, Value: v, Stack: debug.Stack()})
+	}
+}
+
+// PanicResponseMsg is the HTTP 500 response of a recovered panic
+type PanicResponseMsg struct {
+	Result    string `json:"result"`
+	ErrorMsg  string `json:"error-message"`
+	RequestID string `json:"request-id"`
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// reportPanic logs the recovered panic v of the request
+func reportPanic(requestID string, r *http.Request, v interface{}) {
+	logPanic(fmt.Sprintf("request %s %s %s", requestID, r.Method, r.URL.Path), v)
+}
+
+// logPanic logs the recovered panic v of the source with its stack, and
+// counts it
+func logPanic(source string, v interface{}) {
+	rule := ""
+	stack := debug.Stack()
+	if p, ok := v.(*RulePanic); ok {
+		rule = p.RuleName
+		stack = p.Stack
+	}
+	log.Printf("panic recovered, %s, %v\n%s", source, v, stack)
+	ServiceMetrics.Counter(metricPanics, util.Labels{"rule": rule}, 1)
+}
+
+// recoverMiddleware recovers the panic of the request, it responds HTTP
+// 500 with the request ID, unless the response is already started, then
+// the connection is aborted
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !RecoverPanics {
+			next.ServeHTTP(w, r)
+			return
+		}
+		requestID := r.Header.Get(requestIDHeader)
+		if len(requestID) == 0 {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			reportPanic(requestID, r, v)
+			if sw.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			msg := PanicResponseMsg{Result: ValidationStatusError, ErrorMsg: "internal error", RequestID: requestID}
+			if PanicDetails {
+				msg.ErrorMsg = fmt.Sprintf("internal error, %v", v)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			result, _ := json.Marshal(msg)
+			io.WriteString(w, string(result))
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,49 @@
+package rule
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	const panicOperator OperatorType = "PANIC_TEST"
+	RegisteredOperators[panicOperator] = func(operands []interface{}) (interface{}, error) {
+		return operands[0].(bool), nil
+	}
+	defer delete(RegisteredOperators, panicOperator)
+	node := RuleNode{Name: "panic_test_rule"}
+	json.Unmarshal([]byte(`{"operator": "PANIC_TEST", "operands": [{"field": "panic_test.value"}]}`), &node.RuleContent)
+	registerTestRule(t, &node)
+
+	server := httptest.NewServer(Handlers())
+	defer server.Close()
+	for _, path := range []string{"/api/validation", "/api/validation/stream"} {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(`{"panic_test": {"value": "x"}}`))
+		req.Header.Set(requestIDHeader, "panic-test-id")
+		res, err := http.DefaultClient.Do(req)
+		if path == "/api/validation/stream" {
+			// the stream is started, its connection is aborted
+			if err == nil {
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				if strings.Contains(string(body), `"result":"pass"`) {
+					t.Errorf("expected the stream to be aborted, got %s", body)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := PanicResponseMsg{}
+		json.NewDecoder(res.Body).Decode(&msg)
+		res.Body.Close()
+		if res.StatusCode != http.StatusInternalServerError || msg.RequestID != "panic-test-id" || res.Header.Get(requestIDHeader) != "panic-test-id" {
+			t.Errorf("%s: expected HTTP 500 with the request ID, got %d %+v", path, res.StatusCode, msg)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A JSON Patch, RFC 6902, is validated by the document it results in,
+//   POST /api/validation/patch?ruleset=<ruleset>
+//   { "document": { "email": "a@b.io" },
+//     "patch": [ { "op": "replace", "path": "/email", "value": "c@d.io" } ] }
+// the patch is applied in memory, and the patched document is validated
+// like POST /api/validation.  Each operation is validated as well by the
+// patch rules, which fields are the members of the operation under
+// $patch, "$patch.op", "$patch.path", "$patch.from" and "$patch.value",
+// e.g. "/email may not be removed",
+//   IF(EQUAL_TO($patch.path, "/email"), MATCHES("^(add|replace|test|copy)$", $patch.op))
+// A patch rule applies to the patch operations only.
+
+// PatchField is the field of the patch rules, the operation in a JSON Patch
+const PatchField = "$patch"
+
+// the operations of RFC 6902
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+	PatchOpMove    = "move"
+	PatchOpCopy    = "copy"
+	PatchOpTest    = "test"
+)
+
+// PatchRequest is the request of the patch validation
+type PatchRequest struct {
+	Document map[string]interface{}   `json:"document"`
+	Patch    []map[string]interface{} `json:"patch"`
+}
+
+// PatchOperationFailure is an operation failing the patch rules, by its
+// index in the patch
+type PatchOperationFailure struct {
+	Index    int           `json:"index"`
+	Op       string        `json:"op"`
+	Path     string        `json:"path"`
+	Rules    []string      `json:"rules"`
+	Messages []RuleMessage `json:"messages,omitempty"`
+}
+
+// PatchFailResponseMsg is the failure of the patched document, and of the
+// patch operations
+type PatchFailResponseMsg struct {
+	FailResponseMsg
+	Operations []PatchOperationFailure `json:"operations,omitempty"`
+}
+
+// isPatchField reports the field is a member of the patch operation
+func isPatchField(field string) bool {
+	return field == PatchField || strings.HasPrefix(field, PatchField+".")
+}
+
+// checkPatchRuleFields rejects a patch rule referencing the document
+// fields, or triggered by the absence of a field, which the documents never
+// have
+func checkPatchRuleFields(entry *RuleEntry) error {
+	if !isPatchField(entry.Field) {
+		return nil
+	}
+	for _, field := range entry.Fields {
+		if !isPatchField(field) {
+			return fmt.Errorf("system rule load: rule name, %s, is a patch rule referencing the document field, %s", entry.Name, field)
+		}
+	}
+	if entry.Required || len(entry.MissingPolicy) > 0 {
+		return fmt.Errorf("system rule load: rule name, %s, is a patch rule, which can't be required", entry.Name)
+	}
+	return nil
+}
+
+// patchOperation is a parsed operation of a JSON Patch
+type patchOperation struct {
+	op       string
+	path     []string
+	from     []string
+	value    interface{}
+	hasValue bool
+	// the operation as given, for the patch rules
+	raw map[string]interface{}
+}
+
+// parsePointerTokens splits the JSON Pointer into its unescaped reference
+// tokens, "" is the whole document
+func parsePointerTokens(ptr string) ([]string, error) {
+	if len(ptr) == 0 {
+		return []string{}, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("JSON pointer, %s, doesn't start with /", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 >= len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, fmt.Errorf("JSON pointer, %s, invalid escape in %q", ptr, token)
+			}
+		}
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// parsePatch parses the operations of the JSON Patch
+func parsePatch(patch []map[string]interface{}) ([]patchOperation, error) {
+	ops := make([]patchOperation, len(patch))
+	for i, raw := range patch {
+		op := patchOperation{raw: raw}
+		op.op, _ = raw["op"].(string)
+		path, ok := raw["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("json patch: operation %d, path is missing", i)
+		}
+		var err error
+		if op.path, err = parsePointerTokens(path); err != nil {
+			return nil, fmt.Errorf("json patch: operation %d, %s", i, err.Error())
+		}
+		op.value, op.hasValue = raw["value"]
+		switch op.op {
+		case PatchOpAdd, PatchOpReplace, PatchOpTest:
+			if !op.hasValue {
+				return nil, fmt.Errorf("json patch: operation %d, %s, value is missing", i, op.op)
+			}
+		case PatchOpMove, PatchOpCopy:
+			from, ok := raw["from"].(string)
+			if !ok {
+				return nil, fmt.Errorf("json patch: operation %d, %s, from is missing", i, op.op)
+			}
+			if op.from, err = parsePointerTokens(from); err != nil {
+				return nil, fmt.Errorf("json patch: operation %d, %s", i, err.Error())
+			}
+			if op.op == PatchOpMove && len(op.from) < len(op.path) && strings.HasPrefix(path+"/", from+"/") {
+				return nil, fmt.Errorf("json patch: operation %d, move from %s into its child %s", i, from, path)
+			}
+		case PatchOpRemove:
+		default:
+			return nil, fmt.Errorf("json patch: operation %d, unknown op, %v", i, raw["op"])
+		}
+		ops[i] = op
+	}
+	return ops, nil
+}
+
+// patchIndex parses the array index token, "-" is the end of the array
+// when appending
+func patchIndex(token string, length int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index, %s", token)
+	}
+	limit := length
+	if appending {
+		limit++
+	}
+	if i >= limit {
+		return 0, fmt.Errorf("array index, %s, is out of bounds", token)
+	}
+	return i, nil
+}
+
+// patchValueAt returns the value at the reference tokens of doc
+func patchValueAt(doc interface{}, tokens []string) (interface{}, error) {
+	value := doc
+	for _, token := range tokens {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member, %s, doesn't exist", token)
+			}
+			value = child
+		case []interface{}:
+			i, err := patchIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			value = node[i]
+		default:
+			return nil, fmt.Errorf("%s is not in an object or an array", token)
+		}
+	}
+	return value, nil
+}
+
+// updatePatchTarget calls update with the container of the last reference
+// token, and replaces the container by the returned one, e.g. an array
+// with an inserted item
+func updatePatchTarget(node interface{}, tokens []string,
+	update func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return update(node, tokens[0])
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("member, %s, doesn't exist", tokens[0])
+		}
+		updated, err := updatePatchTarget(child, tokens[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = updated
+		return n, nil
+	case []interface{}:
+		i, err := patchIndex(tokens[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updatePatchTarget(n[i], tokens[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	}
+	return nil, fmt.Errorf("%s is not in an object or an array", tokens[0])
+}
+
+// addPatchValue adds the value at the tokens, an array item is inserted
+func addPatchValue(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return updatePatchTarget(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			i, err := patchIndex(token, len(c), true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("%s is not in an object or an array", token)
+	})
+}
+
+// removePatchValue removes the existing value at the tokens, or replaces
+// it by value when replace is set
+func removePatchValue(doc interface{}, tokens []string, replace bool, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		if replace {
+			return value, nil
+		}
+		return nil, fmt.Errorf("the whole document can't be removed")
+	}
+	return updatePatchTarget(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("member, %s, doesn't exist", token)
+			}
+			if replace {
+				c[token] = value
+			} else {
+				delete(c, token)
+			}
+			return c, nil
+		case []interface{}:
+			i, err := patchIndex(token, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			if replace {
+				c[i] = value
+				return c, nil
+			}
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%s is not in an object or an array", token)
+	})
+}
+
+// patchValuesEqual compares two JSON values, the numbers by their value
+func patchValuesEqual(v1, v2 interface{}) bool {
+	switch a := v1.(type) {
+	case map[string]interface{}:
+		b, ok := v2.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, item := range a {
+			if other, ok := b[k]; !ok || !patchValuesEqual(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := v2.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !patchValuesEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := v2.(json.Number)
+		if !ok {
+			return false
+		}
+		x, ok1 := parseDecimal(string(a))
+		y, ok2 := parseDecimal(string(b))
+		return a == b || ok1 && ok2 && x.Cmp(y) == 0
+	}
+	return v1 == v2
+}
+
+// ApplyPatch applies the JSON Patch operations to a copy of doc, the
+// patch fails as a whole at the first failed operation
+func ApplyPatch(doc map[string]interface{}, patch []map[string]interface{}) (map[string]interface{}, error) {
+	ops, err := parsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	return applyPatchOperations(doc, ops)
+}
+
+func applyPatchOperations(doc map[string]interface{}, ops []patchOperation) (map[string]interface{}, error) {
+	var patched interface{} = cloneSample(doc)
+	for i, op := range ops {
+		var err error
+		switch op.op {
+		case PatchOpAdd:
+			patched, err = addPatchValue(patched, op.path, cloneSample(op.value))
+		case PatchOpRemove:
+			patched, err = removePatchValue(patched, op.path, false, nil)
+		case PatchOpReplace:
+			patched, err = removePatchValue(patched, op.path, true, cloneSample(op.value))
+		case PatchOpMove, PatchOpCopy:
+			var value interface{}
+			if value, err = patchValueAt(patched, op.from); err != nil {
+				break
+			}
+			if op.op == PatchOpMove {
+				if patched, err = removePatchValue(patched, op.from, false, nil); err != nil {
+					break
+				}
+			} else {
+				value = cloneSample(value)
+			}
+			patched, err = addPatchValue(patched, op.path, value)
+		case PatchOpTest:
+			var value interface{}
+			if value, err = patchValueAt(patched, op.path); err == nil && !patchValuesEqual(value, op.value) {
+				err = fmt.Errorf("test failed")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("json patch: operation %d, %s %s, %s", i, op.op, op.raw["path"], err.Error())
+		}
+	}
+	result, ok := patched.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("json patch: the patched document is not an object")
+	}
+	return result, nil
+}
+
+// patchRegistry copies the patch rules into an isolated registry
+func patchRegistry() ruleRegistry {
+	reg := newIsolatedRegistry()
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	for field, rules := range AllRegisteredRules {
+		if !isPatchField(field) {
+			continue
+		}
+		for _, entry := range rules {
+			// the state is guarded by the lock
+			copied := *entry
+			reg.add(&copied)
+		}
+	}
+	return reg
+}
+
+// validatePatchOperations validates each operation by the patch rules in
+// ruleset
+func validatePatchOperations(ops []patchOperation, ruleset string) ([]PatchOperationFailure, error) {
+	reg := patchRegistry()
+	failures := []PatchOperationFailure{}
+	if len(reg.rules) == 0 {
+		return failures, nil
+	}
+	for i, op := range ops {
+		doc := map[string]interface{}{PatchField: op.raw}
+		result, err := reg.validateIsolated(doc, ruleset)
+		if err != nil {
+			return nil, fmt.Errorf("json patch: operation %d, %s", i, err.Error())
+		}
+		if !result.flag {
+			path, _ := op.raw["path"].(string)
+			failures = append(failures, PatchOperationFailure{Index: i, Op: op.op, Path: path, Rules: result.rules, Messages: result.messages})
+		}
+	}
+	return failures, nil
+}
+
+// POST /api/validation/patch?ruleset=<ruleset>&tags=<tag,...>&strict=true
+// service implementation, the patched document is returned on success
+func ValidatePatchData(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept-Language")
+
+	decoder := json.NewDecoder(r.Body)
+	// the document numbers keep their exact value
+	decoder.UseNumber()
+	defer r.Body.Close()
+
+	writeError := func(status int, err error) {
+		w.WriteHeader(status)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+	}
+	ruleset := requestRuleset(r)
+	if err := CheckRuleset(ruleset); err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	tags, err := ParseTagFilter(r.URL.Query())
+	if err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	req := PatchRequest{}
+	if err := decoder.Decode(&req); err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	if req.Document == nil {
+		writeError(http.StatusBadRequest, fmt.Errorf("json patch: document is missing"))
+		return
+	}
+	ops, err := parsePatch(req.Patch)
+	if err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+	patched, err := applyPatchOperations(req.Document, ops)
+	if err != nil {
+		// e.g. a failed test, or a missing path
+		writeError(http.StatusConflict, err)
+		return
+	}
+
+	if len(ruleset) == 0 {
+		// the ruleset of the patched document type, by the discriminator
+		ruleset = discriminatedRuleset(patched)
+	}
+	failures, err := validatePatchOperations(ops, ruleset)
+	if err != nil {
+		writeError(http.StatusInternalServerError, err)
+		return
+	}
+	patched = NormalizeDocument(patched, ruleset)
+	options := ValidationOptions{Tags: tags, Strict: r.URL.Query().Get("strict") == "true",
+		Locales: parseAcceptLanguage(r.Header.Get("Accept-Language"))}
+	result, err := ValidateInput(ruleset, options, requestContentType(r, ruleset), patched)
+	if err != nil {
+		writeError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if policy := zeroRulePolicyOf(ruleset); result.noRuleMatched && len(failures) == 0 && policy != ZeroRulePass {
+		// no rule is evaluated, reply by the zero-rule policy
+		res := NoRuleResponseMsg{Result: ValidationStatusWarn, Message: NoRuleMatchedMessage}
+		if policy == ZeroRuleFail {
+			res.Result = ValidationStatusFail
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		resStr, _ := json.Marshal(res)
+		io.WriteString(w, string(resStr))
+	} else if result.flag && len(failures) == 0 {
+		w.WriteHeader(http.StatusOK)
+		res := NormalizedResponseMsg{Result: ValidationStatusSucc, Document: patched}
+		resStr, _ := json.Marshal(res)
+		io.WriteString(w, string(resStr))
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		fail := PatchFailResponseMsg{FailResponseMsg: FailResponseMsg{Result: ValidationStatusFail, Rules: result.rules, Codes: result.codes,
+			Messages: result.messages, Paths: result.paths, Unexpected: result.unexpected, Exclusive: result.exclusive}, Operations: failures}
+		failed := map[string]bool{}
+		for _, name := range fail.Rules {
+			failed[name] = true
+		}
+		for _, failure := range failures {
+			for _, name := range failure.Rules {
+				if !failed[name] {
+					failed[name] = true
+					fail.Rules = append(fail.Rules, name)
+				}
+			}
+		}
+		if fail.Rules == nil {
+			fail.Rules = []string{}
+		}
+		resStr, _ := json.Marshal(fail)
+		io.WriteString(w, string(resStr))
+	}
+}
@@ -0,0 +1,89 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidatePatch(t *testing.T) {
+	for _, rule := range []string{`{"name": "patch_test_keep_email",
+		"expression": "if($patch.path == '/patch_test_email', matches('^(add|replace|test|copy)$', $patch.op))"}`,
+		`{"name": "patch_test_email", "expression": "length(patch_test_email) > 3"}`} {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "patch_test_mixed", "expression": "$patch.op == patch_test_email"}`), &node)
+	if _, err := RegisterRuleNode(&node); err == nil {
+		t.Errorf("expected a patch rule referencing a document field to fail")
+	}
+
+	validate := func(patch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ValidatePatchData(w, httptest.NewRequest("POST", "/api/validation/patch", strings.NewReader(
+			`{"document": {"patch_test_email": "a@b.io", "tags": ["x"]}, "patch": `+patch+`}`)))
+		return w
+	}
+	w := validate(`[{"op": "replace", "path": "/patch_test_email", "value": "c@d.io"}, {"op": "add", "path": "/tags/-", "value": "y"}]`)
+	res := NormalizedResponseMsg{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.Document["patch_test_email"] != "c@d.io" || len(res.Document["tags"].([]interface{})) != 2 {
+		t.Errorf("expected the patched document, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = validate(`[{"op": "test", "path": "/tags/0", "value": "x"}, {"op": "replace", "path": "/patch_test_email", "value": "a"},
+		{"op": "remove", "path": "/patch_test_email"}]`)
+	fail := PatchFailResponseMsg{}
+	json.Unmarshal(w.Body.Bytes(), &fail)
+	if w.Code != http.StatusBadRequest || len(fail.Operations) != 1 || fail.Operations[0].Index != 2 ||
+		!reflect.DeepEqual(fail.Rules, []string{"patch_test_keep_email"}) {
+		t.Errorf("expected the removal to fail, got %d %s", w.Code, w.Body.String())
+	}
+
+	for patch, code := range map[string]int{
+		`[{"op": "test", "path": "/tags/0", "value": "y"}]`:             http.StatusConflict,
+		`[{"op": "remove", "path": "/missing"}]`:                        http.StatusConflict,
+		`[{"op": "move", "from": "/tags", "path": "/tags/0"}]`:          http.StatusBadRequest,
+		`[{"op": "inc", "path": "/tags"}]`:                              http.StatusBadRequest,
+		`[{"op": "add", "path": "/patch_test_email"}]`:                  http.StatusBadRequest,
+		`[{"op": "copy", "from": "/patch_test_email", "path": "/x/y"}]`: http.StatusConflict,
+	} {
+		if w := validate(patch); w.Code != code {
+			t.Errorf("%s: expected %d, got %d %s", patch, code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	doc := map[string]interface{}{"a": map[string]interface{}{"b": json.Number("1"), "c~/": "x"}, "list": []interface{}{"p", "q"}}
+	patched, err := ApplyPatch(doc, []map[string]interface{}{
+		{"op": "test", "path": "/a/b", "value": json.Number("1.0")},
+		{"op": "test", "path": "/a/c~0~1", "value": "x"},
+		{"op": "add", "path": "/list/1", "value": "r"},
+		{"op": "remove", "path": "/list/0"},
+		{"op": "copy", "from": "/a", "path": "/d"},
+		{"op": "move", "from": "/a/b", "path": "/list/-"},
+		{"op": "replace", "path": "/d/b", "value": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"a": map[string]interface{}{"c~/": "x"}, "list": []interface{}{"r", "q", json.Number("1")},
+		"d": map[string]interface{}{"b": true, "c~/": "x"}}
+	if !reflect.DeepEqual(patched, expected) {
+		t.Errorf("expected %v, got %v", expected, patched)
+	}
+	if _, ok := doc["d"]; ok || len(doc["list"].([]interface{})) != 2 {
+		t.Errorf("expected the document unchanged, got %v", doc)
+	}
+	if _, err := ApplyPatch(doc, []map[string]interface{}{{"op": "add", "path": "/list/3", "value": 1}}); err == nil {
+		t.Errorf("expected an out of bounds index to fail")
+	}
+}
@@ -0,0 +1,124 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the field addressing of a rule, "addressing", selects how its field
+// references and "primary-field" are written
+const (
+	AddressingPath    = "path"    // the flattened field names, or JSONPath, the default
+	AddressingPointer = "pointer" // the JSON Pointers, RFC 6901
+)
+
+// parseJSONPointer converts the JSON Pointer into the flattened field name
+// of the input fields,
+//   /address/zip_code      address.zip_code
+//   /addresses/0/zip_code  addresses[0].zip_code
+//   /a~1b/c~0d             a/b.c~d, "~1" is "/" and "~0" is "~"
+//   ""                     $document, the whole document
+// A numeric reference token after the first one is an array index.  A
+// token with ".", "[" or "]" is rejected, its flattened name would be
+// another path, e.g. /a.b/c would match {"a": {"b": {"c": ...}}}.
+func parseJSONPointer(ptr string) (string, error) {
+	if len(ptr) == 0 {
+		return DocumentField, nil
+	}
+	if ptr[0] != '/' {
+		return "", fmt.Errorf("JSON pointer, %s, doesn't start with /", ptr)
+	}
+	var b strings.Builder
+	for i, token := range strings.Split(ptr[1:], "/") {
+		// "~" is only valid as "~0" or "~1"
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 >= len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return "", fmt.Errorf("JSON pointer, %s, invalid escape in %q", ptr, token)
+			}
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch {
+		case len(token) == 0:
+			return "", fmt.Errorf("JSON pointer, %s, empty member name is not supported", ptr)
+		case strings.Contains(token, wildcardIndex) || strings.Contains(token, recursiveDescent):
+			return "", fmt.Errorf("JSON pointer, %s, member name, %s, is a wildcard field name", ptr, token)
+		case strings.ContainsAny(token, ".[]"):
+			return "", fmt.Errorf("JSON pointer, %s, member name, %s, with . or [] is not supported", ptr, token)
+		case i > 0 && isArrayIndex(token):
+			b.WriteString("[" + token + "]")
+		case i > 0:
+			b.WriteString("." + token)
+		default:
+			b.WriteString(token)
+		}
+	}
+	return b.String(), nil
+}
+
+// isArrayIndex checks the JSON Pointer array index, "0" or the digits
+// without a leading zero
+func isArrayIndex(token string) bool {
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return token == "0" || token[0] != '0'
+}
+
+// resolveAddressing returns the rule content and the primary field of
+// node in the flattened field names, node is not changed
+func resolveAddressing(node *RuleNode) (Term, string, error) {
+	switch node.Addressing {
+	case "", AddressingPath:
+		primaryField := node.PrimaryField
+		if isJSONPath(primaryField) {
+			var err error
+			if primaryField, err = parseJSONPath(primaryField); err != nil {
+				return Term{}, "", err
+			}
+		}
+		return node.RuleContent, primaryField, nil
+	case AddressingPointer:
+		content, err := pointerTerm(node.RuleContent)
+		if err != nil {
+			return Term{}, "", err
+		}
+		primaryField := node.PrimaryField
+		if len(primaryField) > 0 {
+			if primaryField, err = parseJSONPointer(primaryField); err != nil {
+				return Term{}, "", err
+			}
+		}
+		return content, primaryField, nil
+	}
+	return Term{}, "", fmt.Errorf("rule name, %s, unknown field addressing, %s", node.Name, node.Addressing)
+}
+
+// pointerTerm copies the rule content t with the JSON Pointer field
+// references converted
+func pointerTerm(t Term) (Term, error) {
+	switch v := t.Value.(type) {
+	case TermOperand:
+		operands := make([]Term, len(v.ParseOperands))
+		for i, o := range v.ParseOperands {
+			c, err := pointerTerm(o)
+			if err != nil {
+				return Term{}, err
+			}
+			operands[i] = c
+		}
+		v.ParseOperands = operands
+		return Term{Value: v}, nil
+	case FieldOperand:
+		if v.Name == DocumentField {
+			return t, nil
+		}
+		name, err := parseJSONPointer(v.Name)
+		if err != nil {
+			return Term{}, err
+		}
+		return Term{Value: FieldOperand{Name: name}}, nil
+	}
+	return t, nil
+}
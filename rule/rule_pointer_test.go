@@ -0,0 +1,86 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var jsonPointerTestCases = []struct {
+	ptr      string
+	expected string
+	valid    bool
+}{
+	{"/address/zip_code", "address.zip_code", true},
+	{"/addresses/0/zip_code", "addresses[0].zip_code", true},
+	{"/matrix/1/10", "matrix[1][10]", true},
+	{"/0", "0", true},
+	{"/versions/01", "versions.01", true},
+	{"/a~1b/c~0d", "a/b.c~d", true},
+	{"/~01", "~1", true},
+	{"", DocumentField, true},
+	{"address/zip_code", "", false},
+	{"/a/~2", "", false},
+	{"/a/b~", "", false},
+	{"/a//b", "", false},
+	{"/a/[*]", "", false},
+	// the flattened a.b.c is another document
+	{"/a.b/c", "", false},
+	{"/a/b[0]", "", false},
+}
+
+func TestParseJSONPointer(t *testing.T) {
+	for _, tc := range jsonPointerTestCases {
+		name, err := parseJSONPointer(tc.ptr)
+		if (err == nil) != tc.valid || name != tc.expected {
+			t.Errorf("%q: expected %q %v, got %q %v", tc.ptr, tc.expected, tc.valid, name, err)
+		}
+	}
+}
+
+func TestJSONPointerRule(t *testing.T) {
+	node := RuleNode{}
+	err := json.Unmarshal([]byte(`{"name": "pointer_test_zip", "addressing": "pointer", "primary-field": "/pointer_test/0/zip_code",
+		"rule": {"operator": "IF", "operands": [
+			{"operator": "EQUAL_TO", "operands": [{"field": "/pointer_test/0/country"}, {"value": "US"}]},
+			{"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "/pointer_test/0/zip_code"}]}]}}`), &node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted, err := FormatRuleNode(&node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(formatted.Canonical, `"primary-field": "pointer_test[0].zip_code"`) {
+		t.Errorf("expected the flattened primary field, got %s", formatted.Canonical)
+	}
+	entry := registerTestRule(t, &node)
+	if !reflect.DeepEqual(entry.Fields, []string{"pointer_test[0].zip_code", "pointer_test[0].country"}) {
+		t.Errorf("expected the flattened fields, got %v", entry.Fields)
+	}
+
+	doc := map[string]interface{}{}
+	json.Unmarshal([]byte(`{"pointer_test": [{"country": "US", "zip_code": "9006"}]}`), &doc)
+	result, err := ValidateInputJSONByRules("", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.flag || !reflect.DeepEqual(result.rules, []string{"pointer_test_zip"}) {
+		t.Errorf("expected the rule to fail, got %v %v", result.flag, result.rules)
+	}
+
+	node.Addressing = "xpath"
+	if _, err := FormatRuleNode(&node); err == nil {
+		t.Error("expected an error for an unknown addressing")
+	}
+
+	// /a.b/c can't select a.b.c of {"a": {"b": {"c": ...}}}
+	collision := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "pointer_test_dot", "addressing": "pointer",
+		"rule": {"operator": "EQUAL_TO", "operands": [{"field": "/pointer_test.b/c"}, {"value": "x"}]}}`), &collision)
+	if _, err := RegisterRuleNode(&collision); err == nil {
+		cleanupTestRule(t, "pointer_test_dot")
+		t.Error("expected the member name with . to be rejected")
+	}
+}
@@ -0,0 +1,129 @@
+package rule
+
+import (
+	"fmt"
+	"sort"
+)
+
+// the severity of a rule failure, a failure of either one fails the
+// validation, only an error one stops the global fail-fast evaluation
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// normalizeSeverity checks the rule severity, "" is SeverityError
+func normalizeSeverity(severity string) (string, error) {
+	switch severity {
+	case "":
+		return SeverityError, nil
+	case SeverityError, SeverityWarning:
+		return severity, nil
+	}
+	return "", fmt.Errorf("unknown rule severity, %s", severity)
+}
+
+// FailFastMode defines when the evaluation of an input stops, so the cheap
+// rules of a high priority gate the expensive ones, e.g. LOOKUP
+type FailFastMode string
+
+const (
+	// all the rules are evaluated
+	FailFastOff FailFastMode = "off"
+	// the rules of a field run in the priority order, and stop at the
+	// first failure of the field
+	FailFastField FailFastMode = "field"
+	// all the rules run in the priority order, and stop at the first
+	// failure of an error severity rule
+	FailFastGlobal FailFastMode = "global"
+)
+
+// the system fail-fast mode
+var DefaultFailFast = FailFastOff
+
+func ParseFailFastMode(s string) (FailFastMode, error) {
+	switch m := FailFastMode(s); m {
+	case FailFastOff, FailFastField, FailFastGlobal:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown fail-fast mode, %s", s)
+}
+
+// stops reports the failure of ctx ends its evaluation chain
+func (mode FailFastMode) stops(ctx *FieldEvalContext) bool {
+	switch mode {
+	case FailFastField:
+		return true
+	case FailFastGlobal:
+		return ctx.severity != SeverityWarning
+	}
+	return false
+}
+
+// skipsAll reports the missing required rules stop the evaluation before
+// any rule runs
+func (mode FailFastMode) skipsAll(missing []*RuleEntry) bool {
+	if mode != FailFastGlobal {
+		return false
+	}
+	for _, entry := range missing {
+		if entry.Severity != SeverityWarning {
+			return true
+		}
+	}
+	return false
+}
+
+// evalChains groups the contexts into the chains evaluated in order by the
+// mode, every context is a chain of its own when fail-fast is off.  A
+// chain runs in the priority order, the lower value first, then the field
+// and the rule name order.
+func evalChains(contexts []FieldEvalContext, mode FailFastMode) [][]FieldEvalContext {
+	if mode == FailFastOff {
+		chains := make([][]FieldEvalContext, len(contexts))
+		for i := range contexts {
+			chains[i] = contexts[i : i+1]
+		}
+		return chains
+	}
+	sort.SliceStable(contexts, func(i, j int) bool {
+		a, b := &contexts[i], &contexts[j]
+		if mode == FailFastField && a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		if a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		return a.RuleName < b.RuleName
+	})
+	if mode == FailFastGlobal {
+		return [][]FieldEvalContext{contexts}
+	}
+	chains := [][]FieldEvalContext{}
+	for start, i := 0, 1; i <= len(contexts); i++ {
+		if i == len(contexts) || contexts[i].Field != contexts[start].Field {
+			chains = append(chains, contexts[start:i])
+			start = i
+		}
+	}
+	return chains
+}
+
+// evaluateChain evaluates the contexts of chain in order by evaluate,
+// which reports the rule failed, and stops after the failure ending the
+// chain by the mode
+func evaluateChain(chain []FieldEvalContext, mode FailFastMode, evaluate func(*FieldEvalContext) (bool, error)) error {
+	for i := range chain {
+		failed, err := evaluate(&chain[i])
+		if err != nil {
+			return err
+		}
+		if failed && mode.stops(&chain[i]) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFailFast(t *testing.T) {
+	defer func(mode FailFastMode) { DefaultFailFast = mode }(DefaultFailFast)
+	rules := `[
+		{"name": "ff_length", "priority": -1, "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "phone"}]}, {"value": 9}]}},
+		{"name": "ff_pattern", "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]+$"}, {"field": "phone"}]}},
+		{"name": "ff_zip", "severity": "warning", "priority": -2, "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "zip"}]}},
+		{"name": "ff_email", "priority": 5, "rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "email"}]}}]`
+	testCases := []struct {
+		mode     FailFastMode
+		expected []string
+	}{
+		{FailFastOff, []string{"ff_email", "ff_length", "ff_pattern", "ff_zip"}},
+		// the first failure of each field
+		{FailFastField, []string{"ff_email", "ff_length", "ff_zip"}},
+		// the warning doesn't stop, ff_length does
+		{FailFastGlobal, []string{"ff_length", "ff_zip"}},
+	}
+	for _, tc := range testCases {
+		DefaultFailFast = tc.mode
+		req := AdhocRequest{}
+		if err := json.Unmarshal([]byte(`{"document": {"phone": "12-34", "zip": "9006", "email": "bob"}, "rules": `+rules+`}`), &req); err != nil {
+			t.Fatal(err)
+		}
+		result, err := ValidateAdhoc(&req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		failed := append([]string{}, result.rules...)
+		sort.Strings(failed)
+		if result.flag || !reflect.DeepEqual(failed, tc.expected) {
+			t.Errorf("%s: expected %v to fail, got %v", tc.mode, tc.expected, failed)
+		}
+	}
+
+	node := RuleNode{}
+	if err := json.Unmarshal([]byte(`{"name": "ff_bad", "severity": "fatal", "rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "email"}]}}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parseRuleNode(&node); err == nil {
+		t.Error("expected an error for an unknown severity")
+	}
+}
@@ -1,84 +1,273 @@
 package rule
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
-	"reflect"
 )
 
 // helper parses input JSON string map in fieldData, and collect
-// <fieldName, fieldValue> pairs in fields.
-func parseInputJSON(fields map[string]string, fieldPrefix string, fieldData map[string]interface{}) error {
+// <fieldName, fieldValue> pairs in fields.  The field name is the
+// unambiguous path of the value in the JSON document, e.g.
+//     { "a": { "b": [ "x", { "c": [ { "d": 7 } ] } ] } }
+// is collected as "a.b[0]" => "x", "a.b[1].c[0].d" => 7.  The value keeps
+// its JSON type like a value literal: string, int64 or *big.Int (integer),
+// json.Number (other numbers, in their exact decimal), bool or nil (null).
+func parseInputJSON(fields map[string]interface{}, fieldPrefix string, fieldData map[string]interface{}) error {
 	// process the collected fieldData
 	for k, v := range fieldData {
+		fieldName := k
+		if len(fieldPrefix) > 0 {
+			fieldName = fieldPrefix + "." + k
+		}
+		if e := parseInputJSONValue(fields, fieldName, v); e != nil {
+			return e
+		}
+	}
+	return nil
+}
 
-		if reflect.ValueOf(v).Kind() == reflect.String {
-			fieldName := fieldPrefix + k
-			if _, exists := fields[fieldName]; exists {
-				// there are duplicated field names
-				return fmt.Errorf("parse input JSON: duplicated field name, %s", fieldName)
-			} else {
-				fields[fieldName] = v.(string)
-			}
-		} else if reflect.ValueOf(v).Kind() == reflect.Map {
-			var prefix string
-			if len(fieldPrefix) == 0 {
-				prefix = k + "."
-			} else {
-				prefix = fieldPrefix + "." + k + "."
-			}
-			if e := parseInputJSON(fields, prefix, v.(map[string]interface{})); e != nil {
+// helper collects one JSON value at the path fieldName, and walks into
+// the nested JSON object and array
+func parseInputJSONValue(fields map[string]interface{}, fieldName string, v interface{}) error {
+	switch value := v.(type) {
+	case string, bool, nil, float64, json.Number:
+		if _, exists := fields[fieldName]; exists {
+			// there are duplicated field names
+			return fmt.Errorf("parse input JSON: duplicated field name, %s", fieldName)
+		}
+		typed, err := typedLiteral(value)
+		if err != nil {
+			return fmt.Errorf("parse input JSON: field, %s, %s", fieldName, err.Error())
+		}
+		fields[fieldName] = typed
+	case map[string]interface{}:
+		return parseInputJSON(fields, fieldName, value)
+	case []interface{}:
+		// array items keep their index in the path
+		for i, item := range value {
+			if e := parseInputJSONValue(fields, fmt.Sprintf("%s[%d]", fieldName, i), item); e != nil {
 				return e
 			}
-		} else if reflect.ValueOf(v).Kind() == reflect.Slice {
-			slc := v.([]interface{})
-			var prefix string
-			if len(fieldPrefix) == 0 {
-				prefix = k + "."
-			} else {
-				prefix = fieldPrefix + "." + k + "."
+		}
+	default:
+		// unknown type
+		return fmt.Errorf("parse input JSON: unknown field type, %s", fieldName)
+	}
+	return nil
+}
+
+// evaluateRule evaluates the rule of ctx, and counts the result.
+// A cross-field rule fails when a referenced field is missing in the input.
+func evaluateRule(ctx *FieldEvalContext) (interface{}, error) {
+	defer recoverRulePanic(ctx)
+	if res, ok := ctx.nullPolicyResult(); ok {
+		recordRuleEvaluation(ctx.RuleID, ctx.RuleName, res, nil)
+		return res, nil
+	}
+	if err := injectRuleFault(ctx.RuleName, ctx.Fields); err != nil {
+		recordRuleEvaluation(ctx.RuleID, ctx.RuleName, false, err)
+		return nil, err
+	}
+	res, err := ctx.Rule.Evaluate(ctx)
+	if err == EvalFieldMissingError {
+		res, err = false, nil
+	}
+	if _, ok := res.(bool); err == nil && !ok {
+		err = EvalResultTypeError
+	}
+	recordRuleEvaluation(ctx.RuleID, ctx.RuleName, err != nil || res.(bool), err)
+	return res, err
+}
+
+// ruleRegistry is the rules to evaluate, the shared rule register or an
+// isolated one, e.g. the rules of an ad hoc validation
+type ruleRegistry struct {
+	rules     map[string]RegisteredRule // field name => rules
+	required  map[string]*RuleEntry     // rule ID => required rule
+	wildcards map[string]bool           // the wildcard field names
+	tags      TagFilter                 // the rules selected by their tags
+
+	missingPolicies int  // the rules with "missing-policy"
+	isolated        bool // not the shared registry, e.g. an ad hoc one
+}
+
+// selects reports the rule of the registry is evaluated in ruleset
+func (reg ruleRegistry) selects(entry *RuleEntry, ruleset string) bool {
+	return entry.applies(ruleset) && reg.tags.selects(entry)
+}
+
+// sharedRegistry is the registered rules, caller holds the READ lock
+func sharedRegistry() ruleRegistry {
+	return ruleRegistry{rules: AllRegisteredRules, required: AllRequiredRules, wildcards: wildcardFields,
+		missingPolicies: missingPolicyRuleCount}
+}
+
+// evalContext creates the FieldEvalContext of the rule on the field value
+func (entry *RuleEntry) evalContext(field string, value interface{}, inputFields map[string]interface{}) FieldEvalContext {
+	return FieldEvalContext{RuleID: entry.ID, RuleName: entry.Name, Field: field, FieldValue: value, Fields: inputFields,
+		Rule: entry.Rule, message: entry.Message, priority: entry.Priority, severity: entry.Severity, nullPolicy: entry.nullPolicy(),
+		code: entry.ErrorCode, enforcement: entry.Enforcement, enforcementKey: entry.EnforcementKey}
+}
+
+// newEvalContexts creates the FieldEvalContext for each field which does
+// have at least one rule in ruleset defined, and for each document rule.
+// fieldRules counts the field rule contexts, for the zero-rule policy.
+// Caller holds the READ lock of the shared registry.
+func (reg ruleRegistry) newEvalContexts(inputFields map[string]interface{}, ruleset string) (contexts []FieldEvalContext, fieldRules int) {
+	contexts = make([]FieldEvalContext, 0)
+	for k, v := range inputFields {
+		if rules := reg.rules[k]; rules != nil {
+			for _, entry := range rules {
+				if !reg.selects(entry, ruleset) {
+					continue
+				}
+				contexts = append(contexts, entry.evalContext(k, v, inputFields))
+			}
+		}
+		// the wildcard rules matching the field path
+		for pattern := range reg.wildcards {
+			indices, ok := matchWildcardPath(pattern, k)
+			if !ok {
+				continue
 			}
-			for i := 0; i < len(slc); i++ {
-				if reflect.ValueOf(slc[i]).Kind() == reflect.Map {
-					if e := parseInputJSON(fields, prefix, slc[i].(map[string]interface{})); e != nil {
-						return e
-					}
-				} else {
-					// ignore
+			for _, entry := range reg.rules[pattern] {
+				if !reg.selects(entry, ruleset) {
+					continue
 				}
+				ctx := entry.evalContext(k, v, inputFields)
+				ctx.Pattern, ctx.indices = pattern, indices
+				contexts = append(contexts, ctx)
 			}
-		} else {
-			// unknown type
-			return errors.New("parse input JSON: unknown field type")
 		}
 	}
-	return nil
+	// the rules of the empty missing policy, which primary field is absent
+	reg.missingPolicyRules(func(entry *RuleEntry) {
+		if entry.missingPolicy() == FieldPolicyEmpty && reg.selects(entry, ruleset) && primaryFieldAbsent(entry, inputFields) {
+			ctx := entry.evalContext(entry.Field, "", inputFields)
+			ctx.emptyFields = true
+			contexts = append(contexts, ctx)
+		}
+	})
+	fieldRules = len(contexts)
+	// the document rules are triggered by every input
+	for _, entry := range reg.rules[DocumentField] {
+		if !reg.selects(entry, ruleset) {
+			continue
+		}
+		contexts = append(contexts, entry.evalContext(DocumentField, nil, inputFields))
+	}
+	if reg.isolated {
+		for i := range contexts {
+			contexts[i].isolated = true
+		}
+	}
+	return contexts, fieldRules
+}
+
+// missingRequiredRules returns the required rules in ruleset, and the
+// rules of the fail missing policy, which primary field is absent in the
+// input fields.
+// Caller holds the READ lock of the shared registry.
+func (reg ruleRegistry) missingRequiredRules(inputFields map[string]interface{}, ruleset string) []*RuleEntry {
+	missing := []*RuleEntry{}
+	for _, entry := range reg.required {
+		if !reg.selects(entry, ruleset) {
+			continue
+		}
+		if isWildcardPath(entry.Field) {
+			if !hasWildcardMatch(entry.Field, inputFields) {
+				missing = append(missing, entry)
+			}
+		} else if _, ok := inputFields[entry.Field]; !ok {
+			missing = append(missing, entry)
+		}
+	}
+	reg.missingPolicyRules(func(entry *RuleEntry) {
+		if entry.missingPolicy() == FieldPolicyFail && reg.selects(entry, ruleset) && primaryFieldAbsent(entry, inputFields) {
+			missing = append(missing, entry)
+		}
+	})
+	return missing
+}
+
+// recordMissingRequiredRules counts the missing required rules as failed
+func recordMissingRequiredRules(missing []*RuleEntry) {
+	for _, entry := range missing {
+		recordRuleEvaluation(entry.ID, entry.Name, false, nil)
+	}
+}
+
+// ZeroRulePolicy defines the validation result of an input, which none of
+// its fields matches a registered rule.  It is usually a misconfigured
+// field name, either in the input or in the rules.
+type ZeroRulePolicy string
+
+const (
+	ZeroRulePass ZeroRulePolicy = "pass" // validation success
+	ZeroRuleFail ZeroRulePolicy = "fail" // validation failure
+	ZeroRuleWarn ZeroRulePolicy = "warn" // validation success with a "warning" result
+)
+
+// the system zero-rule policy
+var DefaultZeroRulePolicy = ZeroRulePass
+
+func ParseZeroRulePolicy(s string) (ZeroRulePolicy, error) {
+	switch p := ZeroRulePolicy(s); p {
+	case ZeroRulePass, ZeroRuleFail, ZeroRuleWarn:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown zero-rule policy, %s", s)
 }
 
-// validation processing
-func ValidateInputJSONByRules(input interface{}) (*validationResult, error) {
-	result := validationResult{}
-	inputFields := make(map[string]string)
+// validation processing against ruleset, "" applies the common rules only
+func ValidateInputJSONByRules(ruleset string, input interface{}) (*validationResult, error) {
+	return ValidateInput(ruleset, ValidationOptions{}, ContentTypeJSON, input)
+}
+
+// validation processing with the per-request options, any input, which the
+// registered Extractor of contentType turns into the <fieldName, fieldValue>
+// collection
+func ValidateInput(ruleset string, options ValidationOptions, contentType string, input interface{}) (*validationResult, error) {
+	result := validationResult{locales: options.Locales, verbose: options.Details}
 
 	// generate the collection <fieldName, fieldValue> into inputFields
 	// from input, include the nested JSON block fields
-	if err := parseInputJSON(inputFields, "", input.(map[string]interface{})); err != nil {
+	extractor, err := GetExtractor(contentType)
+	if err != nil {
+		return nil, err
+	}
+	inputFields, err := extractor.Extract(input)
+	if err != nil {
 		return nil, err
 	}
 
 	// create the FieldEvalContext for each field which does have at least one rule defined
 	// inputRuntimeContexts with all data to fine the rule validation
-	inputRuntimeContexts := make([]FieldEvalContext, 0)
 	RegRuleLock.RLock()  // register rule READ lock
-	for k, v := range inputFields {
-		if rules := AllRegisteredRules[k]; rules != nil {
-			for name, rule := range rules {
-				ctx := FieldEvalContext{RuleName: name, FieldValue: v, Rule: rule}
-				inputRuntimeContexts = append(inputRuntimeContexts, ctx)
-			}
+	reg := sharedRegistry()
+	reg.tags = options.Tags
+	inputRuntimeContexts, fieldRules := reg.newEvalContexts(inputFields, ruleset)
+	if options.Previous != nil {
+		previousFields, err := extractor.Extract(options.Previous)
+		if err != nil {
+			RegRuleLock.RUnlock()
+			return nil, err
 		}
+		for i := range inputRuntimeContexts {
+			inputRuntimeContexts[i].previous = previousFields
+		}
+	}
+	missing := reg.missingRequiredRules(inputFields, ruleset)
+	if config := rulesetConfigOf(ruleset); options.Strict || config.Strict {
+		result.unexpected = reg.unexpectedFields(inputFields, ruleset, config.AllowedFields)
 	}
 	RegRuleLock.RUnlock() // READ unlock
+	claims := &uniqueClaims{}
+	for i := range inputRuntimeContexts {
+		inputRuntimeContexts[i].claims = claims
+	}
+	recordMissingRequiredRules(missing)
+	result.noRuleMatched = fieldRules == 0 && len(missing) == 0 && len(result.unexpected) == 0
 
 	// run JSON field evaluation
 	// all required validate fields are collected in inputRuntimeContexts, and
@@ -86,17 +275,95 @@ func ValidateInputJSONByRules(input interface{}) (*validationResult, error) {
 	//       <rule-name, field-value, Rule-func block(pointer)>
 	// result is aggregated to collect in the loop in validationResult struct for
 	// API response
-	result.flag = true
-	for i := 0; i < len(inputRuntimeContexts); i++ {
-		operand := inputRuntimeContexts[i].Rule
-		if res, err := operand.Evaluate(&inputRuntimeContexts[i]); err != nil {
-			fmt.Println(err)
-		} else {
-			if !res.(bool) {
-				result.flag = res.(bool)
-				result.rules = append(result.rules, inputRuntimeContexts[i].RuleName)
+	result.flag = len(result.unexpected) == 0
+	for _, entry := range missing {
+		if !entry.enforcedFor(inputFields) {
+			recordUnenforcedFailure(entry.ID, entry.Name)
+			continue
+		}
+		result.flag = false
+		result.rules = append(result.rules, entry.Name)
+		result.addCode(entry.ErrorCode)
+		var message *RuleMessage
+		if tmpl := Messages.localize(entry.Name, entry.Message, result.locales); tmpl != nil {
+			rendered := renderRuleMessage(tmpl, entry.Name, entry.Field, "")
+			rendered.Code = entry.ErrorCode
+			result.messages = append(result.messages, rendered)
+			message = &rendered
+		}
+		if result.verbose {
+			result.addDetail(entry.Name, entry.ErrorCode, entry.Field, nil, message, "the value is present")
+		}
+	}
+	mode := DefaultFailFast
+	if mode.skipsAll(missing) {
+		inputRuntimeContexts = nil
+	}
+	for _, chain := range evalChains(inputRuntimeContexts, mode) {
+		evaluateChain(chain, mode, func(ctx *FieldEvalContext) (bool, error) {
+			res, err := evaluateRule(ctx)
+			if err != nil {
+				fmt.Println(err)
+				return false, nil
+			}
+			if !res.(bool) && !ctx.enforced() {
+				recordUnenforcedFailure(ctx.RuleID, ctx.RuleName)
+				return false, nil
+			} else if !res.(bool) {
+				result.addFailure(ctx)
+				return true, nil
+			}
+			return false, nil
+		})
+	}
+	if result.flag {
+		// the unique values are recorded by the passed validation only
+		for _, ctx := range claims.record() {
+			if ctx.enforced() {
+				result.addFailure(ctx)
+			} else {
+				recordUnenforcedFailure(ctx.RuleID, ctx.RuleName)
 			}
 		}
 	}
+	sortFailedPaths(result.paths)
+	quarantineFailedInput(inputFields, result.rules)
 	return &result, nil
 }
+
+// addFailure adds the failed rule of ctx to the result
+func (result *validationResult) addFailure(ctx *FieldEvalContext) {
+	result.flag = false
+	if len(ctx.Pattern) == 0 {
+		result.rules = append(result.rules, ctx.RuleName)
+	} else {
+		// a wildcard rule is listed once, with its failing paths
+		if result.paths == nil {
+			result.paths = map[string][]string{}
+		}
+		if addFailedPath(result.paths, ctx.RuleName, ctx.Field) {
+			result.rules = append(result.rules, ctx.RuleName)
+		}
+	}
+	result.addCode(ctx.code)
+	if violation, ok := exclusiveViolation(ctx); ok {
+		if result.exclusive == nil {
+			result.exclusive = map[string]ExclusiveViolation{}
+		}
+		result.exclusive[ctx.RuleName] = violation
+	}
+	var message *RuleMessage
+	if tmpl := Messages.localize(ctx.RuleName, ctx.message, result.locales); tmpl != nil {
+		rendered := renderRuleMessage(tmpl, ctx.RuleName, ctx.Field, ctx.FieldValue)
+		rendered.Code = ctx.code
+		result.messages = append(result.messages, rendered)
+		message = &rendered
+	}
+	if result.verbose {
+		primary := ctx.Field
+		if len(ctx.Pattern) > 0 {
+			primary = ctx.Pattern
+		}
+		result.addDetail(ctx.RuleName, ctx.code, ctx.Field, ctx.FieldValue, message, describeOperand(ctx.Rule, primary))
+	}
+}
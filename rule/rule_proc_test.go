@@ -0,0 +1,106 @@
+package rule
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+var parseInputTestCases = []struct {
+	description string
+	jsonData    string
+	expected    map[string]interface{}
+	expectError bool
+}{
+	{
+		description: "flat and nested object fields",
+		jsonData:    `{"username": "bwillis", "address": {"city": "Los Angeles", "geo": {"zone": "PST"}}}`,
+		expected: map[string]interface{}{
+			"username":         "bwillis",
+			"address.city":     "Los Angeles",
+			"address.geo.zone": "PST",
+		},
+	},
+	{
+		description: "objects inside array keep the index",
+		jsonData:    `{"addresses": [{"zip_code": "90067"}, {"zip_code": "10001"}]}`,
+		expected: map[string]interface{}{
+			"addresses[0].zip_code": "90067",
+			"addresses[1].zip_code": "10001",
+		},
+	},
+	{
+		description: "scalar array items are collected",
+		jsonData:    `{"tags": ["a", "b"]}`,
+		expected: map[string]interface{}{
+			"tags[0]": "a",
+			"tags[1]": "b",
+		},
+	},
+	{
+		description: "objects inside arrays inside objects",
+		jsonData:    `{"a": {"b": [{"x": "0"}, {"x": "1"}, {"c": [{"d": "deep"}]}]}}`,
+		expected: map[string]interface{}{
+			"a.b[0].x":      "0",
+			"a.b[1].x":      "1",
+			"a.b[2].c[0].d": "deep",
+		},
+	},
+	{
+		description: "arrays inside arrays",
+		jsonData:    `{"matrix": [["a", "b"], [], ["c"]]}`,
+		expected: map[string]interface{}{
+			"matrix[0][0]": "a",
+			"matrix[0][1]": "b",
+			"matrix[2][0]": "c",
+		},
+	},
+	{
+		description: "empty object and array",
+		jsonData:    `{"a": {}, "b": []}`,
+		expected:    map[string]interface{}{},
+	},
+	{
+		description: "native JSON types are kept",
+		jsonData:    `{"age": 17, "big": 12345678901234567890, "ratio": 0.5, "active": true, "note": null, "ids": [1, 2]}`,
+		expected: map[string]interface{}{
+			"age":    int64(17),
+			"big":    bigInt("12345678901234567890"),
+			"ratio":  json.Number("0.5"),
+			"active": true,
+			"note":   nil,
+			"ids[0]": int64(1),
+			"ids[1]": int64(2),
+		},
+	},
+	{
+		description: "duplicated field name",
+		jsonData:    `{"a.b": "x", "a": {"b": "y"}}`,
+		expectError: true,
+	},
+}
+
+func bigInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 10)
+	return n
+}
+
+func TestParseInputJSON(t *testing.T) {
+	for _, tc := range parseInputTestCases {
+		fields, err := extractJSON([]byte(tc.jsonData))
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expected error, got %v", tc.description, fields)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error, %s", tc.description, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(fields, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.description, tc.expected, fields)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package rule
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default number of the kept quarantine records
+const defaultQuarantineCapacity = 1000
+
+// QuarantineConfig samples the payloads failing the listed rules into
+// the quarantine, loaded from a JSON file like,
+//   { "rules":    { "phone_pattern": 0.1, "zip_code_pattern": 1.0 },
+//     "capacity": 1000,
+//     "path":     "/var/lib/validation/quarantine.jsonl",
+//     "token":    "..." }
+// "rules" is the sample rate (0.0 to 1.0) by rule name, by the sampling
+// key of the input when -sampling-key is set, "capacity" the
+// kept records, the oldest are dropped, "path" the JSON Lines file
+// persisting the records, empty keeps them in memory, and "token" the
+// bearer token to retrieve them.  The file is rewritten with the kept
+// records when it reaches twice the capacity, and at the load when it is
+// over the capacity, so it holds at most 2 * capacity records.
+type QuarantineConfig struct {
+	Rules    map[string]float64 `json:"rules"`
+	Capacity int                `json:"capacity"`
+	Path     string             `json:"path"`
+	Token    string             `json:"token"`
+}
+
+// QuarantineRecord is a sampled failed payload.  The fields are redacted
+// by the redaction configuration before they are kept, and a field not
+// listed in it is masked when the default shows it, so a raw value is
+// stored only when its field is configured to show it.
+type QuarantineRecord struct {
+	Time   time.Time         `json:"time"`
+	Rules  []string          `json:"rules"` // the sampled failed rules
+	Fields map[string]string `json:"fields"`
+}
+
+type quarantineStore struct {
+	config  QuarantineConfig
+	lock    sync.Mutex
+	records []QuarantineRecord
+	// the records in the file, the kept and the dropped ones
+	fileRecords int
+}
+
+// nil when the quarantine is disabled
+var quarantine *quarantineStore
+
+// EnableQuarantine turns on the failure sampling with the config in the
+// JSON file, and restores the records persisted in the config path
+func EnableQuarantine(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := QuarantineConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if config.Capacity <= 0 {
+		config.Capacity = defaultQuarantineCapacity
+	}
+	store := &quarantineStore{config: config}
+	if len(config.Path) > 0 {
+		if err := store.load(); err != nil {
+			return err
+		}
+	}
+	quarantine = store
+	return nil
+}
+
+// load restores the last records of the file
+func (s *quarantineStore) load() error {
+	f, err := os.Open(s.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		record := QuarantineRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return err
+		}
+		s.append(record)
+		s.fileRecords++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if s.fileRecords > s.config.Capacity {
+		// the capacity may be lowered since the file was written
+		return s.compact()
+	}
+	return nil
+}
+
+// append keeps record, and drops the oldest over the capacity
+func (s *quarantineStore) append(record QuarantineRecord) {
+	s.records = append(s.records, record)
+	if over := len(s.records) - s.config.Capacity; over > 0 {
+		s.records = append([]QuarantineRecord{}, s.records[over:]...)
+	}
+}
+
+// add keeps and persists record
+func (s *quarantineStore) add(record QuarantineRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.append(record)
+	if len(s.config.Path) == 0 {
+		return nil
+	}
+	if s.fileRecords >= 2*s.config.Capacity {
+		return s.compact()
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.fileRecords++
+	return nil
+}
+
+// compact rewrites the file with the kept records only
+func (s *quarantineStore) compact() error {
+	var b bytes.Buffer
+	for _, record := range s.records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		b.Write(append(data, '\n'))
+	}
+	// write to a temporary file, then rename to keep the saved file intact
+	tmp := s.config.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b.Bytes(), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.config.Path); err != nil {
+		return err
+	}
+	s.fileRecords = len(s.records)
+	return nil
+}
+
+// list returns the records sampled for rule, all records when rule is ""
+func (s *quarantineStore) list(rule string) []QuarantineRecord {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	list := []QuarantineRecord{}
+	for _, record := range s.records {
+		if len(rule) == 0 {
+			list = append(list, record)
+			continue
+		}
+		for _, name := range record.Rules {
+			if name == rule {
+				list = append(list, record)
+				break
+			}
+		}
+	}
+	return list
+}
+
+// quarantineFailedInput samples the input failing the rules by the
+// per-rule sample rate, and quarantines the redacted fields
+func quarantineFailedInput(fields map[string]interface{}, failedRules []string) {
+	store := quarantine
+	if store == nil || len(failedRules) == 0 {
+		return
+	}
+	sampled := []string{}
+	for _, name := range failedRules {
+		if rate, ok := store.config.Rules[name]; ok && sampleInput("quarantine/"+name, fields, rate) {
+			sampled = append(sampled, name)
+		}
+	}
+	if len(sampled) == 0 {
+		return
+	}
+	record := QuarantineRecord{Time: time.Now(), Rules: sampled, Fields: redactStoredFields(fields)}
+	if err := store.add(record); err != nil {
+		log.Printf("quarantine save error, %s", err.Error())
+	}
+}
+
+// GET /admin/quarantine?rule=<rule-name> service implementation, the
+// caller is authorized by "Authorization: Bearer <token>"
+func GetQuarantine(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	store := quarantine
+	if store == nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(errors.New("quarantine is disabled")))
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if len(store.config.Token) == 0 ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(store.config.Token)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, generateCreateRuleErrorMessage(errors.New("quarantine access is not authorized")))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(store.list(r.URL.Query().Get("rule")))
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,101 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "quarantine.json")
+	path := filepath.Join(dir, "quarantine.jsonl")
+	if err := os.WriteFile(config, []byte(`{"rules": {"quarantine_test_phone": 1.0}, "token": "t0ken", "path": "`+path+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { quarantine = nil }()
+	if err := EnableQuarantine(config); err != nil {
+		t.Fatal(err)
+	}
+	defer func(config RedactionConfig) { Redaction = config }(Redaction)
+	Redaction = RedactionConfig{
+		Default: FieldRedaction{Mode: RedactionShow},
+		Fields:  map[string]FieldRedaction{"country": {Mode: RedactionShow}, "password": {Mode: RedactionOmit}},
+	}
+
+	// the fields not listed are masked, even when the default shows them
+	quarantineFailedInput(map[string]interface{}{"phone": "555-0100", "country": "US", "password": "secret"},
+		[]string{"quarantine_test_phone", "quarantine_test_other"})
+	expected := map[string]string{"phone": "********", "country": "US"}
+	records := quarantine.list("quarantine_test_phone")
+	if len(records) != 1 || !reflect.DeepEqual(records[0].Fields, expected) || !reflect.DeepEqual(records[0].Rules, []string{"quarantine_test_phone"}) {
+		t.Fatalf("expected the masked record, got %+v", records)
+	}
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/admin/quarantine?rule=quarantine_test_phone", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		GetQuarantine(w, req)
+		return w
+	}
+	if w := get("wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+	w := get("t0ken")
+	listed := []QuarantineRecord{}
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil || w.Code != http.StatusOK || len(listed) != 1 {
+		t.Errorf("expected the record, got %d %s", w.Code, w.Body.String())
+	}
+
+	// the records are restored from the path
+	if err := EnableQuarantine(config); err != nil {
+		t.Fatal(err)
+	}
+	if records := quarantine.list(""); len(records) != 1 || !reflect.DeepEqual(records[0].Fields, expected) {
+		t.Errorf("expected the restored record, got %+v", records)
+	}
+}
+
+func TestQuarantineFileCapacity(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "quarantine.json")
+	path := filepath.Join(dir, "quarantine.jsonl")
+	if err := os.WriteFile(config, []byte(`{"rules": {"quarantine_test_cap": 1.0}, "capacity": 3, "path": "`+path+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { quarantine = nil }()
+	if err := EnableQuarantine(config); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := quarantine.add(QuarantineRecord{Rules: []string{"quarantine_test_cap"}, Fields: map[string]string{"n": strconv.Itoa(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 6 {
+		t.Errorf("expected at most twice the capacity in the file, got %d records", lines)
+	}
+
+	// the last records are restored
+	if err := EnableQuarantine(config); err != nil {
+		t.Fatal(err)
+	}
+	records := quarantine.list("")
+	if len(records) != 3 || records[0].Fields["n"] != "7" || records[2].Fields["n"] != "9" {
+		t.Errorf("expected the last 3 records, got %+v", records)
+	}
+	if data, _ := os.ReadFile(path); bytes.Count(data, []byte("\n")) != 3 {
+		t.Errorf("expected the file compacted at the load, got %q", data)
+	}
+}
@@ -0,0 +1,121 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ReadinessConfig is the minimum rule coverage of a ready instance, loaded
+// from a JSON file like,
+//   { "rules":     [ "email_pattern", "card_luhn" ],
+//     "fields":    { "email": 1, "payment.card": 2 },
+//     "min-rules": 50 }
+// "rules" must be registered, published, enabled and in their activation
+// window, "fields" have at least the number of such rules of the primary
+// field, and "min-rules" is such rules in total.  So a truncated or empty rules file leaves the
+// instance out of the rotation rather than passing everything.
+type ReadinessConfig struct {
+	Rules    []string       `json:"rules,omitempty"`
+	Fields   map[string]int `json:"fields,omitempty"`
+	MinRules int            `json:"min-rules,omitempty"`
+}
+
+// the system readiness condition, none by default, guarded by RegRuleLock
+var Readiness = ReadinessConfig{}
+
+// LoadReadinessConfig replaces the readiness condition by the JSON file
+func LoadReadinessConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := ReadinessConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	for field, count := range config.Fields {
+		if count < 1 {
+			return fmt.Errorf("readiness: field, %s, expects %d rules", field, count)
+		}
+	}
+	if config.MinRules < 0 {
+		return fmt.Errorf("readiness: min-rules, %d, is negative", config.MinRules)
+	}
+	RegRuleLock.Lock()
+	Readiness = config
+	RegRuleLock.Unlock()
+	return nil
+}
+
+// CheckReadiness returns the unmet readiness conditions, sorted, none when
+// the instance is ready
+func CheckReadiness() []string {
+	unmet := []string{}
+	now := time.Now()
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	for _, name := range Readiness.Rules {
+		if entry := findRuleByName(name); entry == nil {
+			unmet = append(unmet, fmt.Sprintf("rule %s is not loaded", name))
+		} else if entry.Disabled {
+			unmet = append(unmet, fmt.Sprintf("rule %s is disabled", name))
+		} else if !entry.published() {
+			unmet = append(unmet, fmt.Sprintf("rule %s is %s", name, entry.State))
+		} else if !inActivationWindow(entry.ValidFrom, entry.ValidUntil, now) {
+			unmet = append(unmet, fmt.Sprintf("rule %s is out of its activation window", name))
+		}
+	}
+	for field, min := range Readiness.Fields {
+		if count := enabledRuleCount(AllRegisteredRules[field], now); count < min {
+			unmet = append(unmet, fmt.Sprintf("field %s has %d rules, expects %d", field, count, min))
+		}
+	}
+	if Readiness.MinRules > 0 {
+		count := 0
+		for _, rules := range AllRegisteredRules {
+			count += enabledRuleCount(rules, now)
+		}
+		if count < Readiness.MinRules {
+			unmet = append(unmet, fmt.Sprintf("%d rules are loaded, expects %d", count, Readiness.MinRules))
+		}
+	}
+	sort.Strings(unmet)
+	return unmet
+}
+
+// enabledRuleCount counts the published and enabled rules in their
+// activation window at now, caller holds the READ lock
+func enabledRuleCount(rules RegisteredRule, now time.Time) int {
+	count := 0
+	for _, entry := range rules {
+		if entry.live() && inActivationWindow(entry.ValidFrom, entry.ValidUntil, now) {
+			count++
+		}
+	}
+	return count
+}
+
+// ReadinessResponseMsg is the GET /readyz response
+type ReadinessResponseMsg struct {
+	Ready bool     `json:"ready"`
+	Unmet []string `json:"unmet,omitempty"`
+}
+
+// GET /readyz service implementation, HTTP 503 with the unmet conditions
+// when the instance isn't ready
+func GetReadiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	unmet := CheckReadiness()
+	if len(unmet) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	resStr, _ := json.Marshal(ReadinessResponseMsg{Ready: len(unmet) == 0, Unmet: unmet})
+	io.WriteString(w, string(resStr))
+}
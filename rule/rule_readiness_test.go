@@ -0,0 +1,70 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "readiness_test_email",
+	  "rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "readiness_test.email"}]}}`), &node)
+	entry := registerTestRule(t, &node)
+	defer func(config ReadinessConfig) { Readiness = config }(Readiness)
+
+	Readiness = ReadinessConfig{Rules: []string{"readiness_test_email"}, Fields: map[string]int{"readiness_test.email": 1}}
+	w := httptest.NewRecorder()
+	GetReadiness(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"ready":true}` {
+		t.Errorf("expected ready, got %d %s", w.Code, w.Body.String())
+	}
+
+	Readiness = ReadinessConfig{Rules: []string{"readiness_test_email", "readiness_test_card"},
+		Fields: map[string]int{"readiness_test.email": 2}, MinRules: 100000}
+	RegRuleLock.Lock()
+	entry.Disabled = true
+	RegRuleLock.Unlock()
+	expected := []string{
+		"field readiness_test.email has 0 rules, expects 2",
+		"rule readiness_test_card is not loaded",
+		"rule readiness_test_email is disabled",
+	}
+	unmet := CheckReadiness()
+	if len(unmet) != 4 || !reflect.DeepEqual(unmet[1:], expected) || !strings.HasSuffix(unmet[0], "rules are loaded, expects 100000") {
+		t.Errorf("expected the unmet conditions, got %v", unmet)
+	}
+	w = httptest.NewRecorder()
+	GetReadiness(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected HTTP 503, got %d", w.Code)
+	}
+
+	RegRuleLock.Lock()
+	entry.Disabled = false
+	RegRuleLock.Unlock()
+
+	// a rule out of its activation window doesn't count
+	from := time.Now().Add(time.Hour)
+	later := RuleNode{Name: "readiness_test_later", ValidFrom: &from}
+	json.Unmarshal([]byte(`{"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "readiness_test.email"}]}`), &later.RuleContent)
+	registerTestRule(t, &later)
+	path := filepath.Join(t.TempDir(), "readiness.json")
+	os.WriteFile(path, []byte(`{"rules": ["readiness_test_later"], "fields": {"readiness_test.email": 2}}`), 0644)
+	if err := LoadReadinessConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"field readiness_test.email has 1 rules, expects 2",
+		"rule readiness_test_later is out of its activation window",
+	}
+	if unmet := CheckReadiness(); !reflect.DeepEqual(unmet, expected) {
+		t.Errorf("expected the rule out of its window unmet, got %v", unmet)
+	}
+}
@@ -0,0 +1,30 @@
+package rule
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// ReadOnly disables the mutating admin endpoints, for the production
+// instances which rules only change by the deployed rule files.  The
+// validation and the read endpoints stay live.
+var ReadOnly = false
+
+const readOnlyMessage = "the instance is read-only, the rules change by the deployment only"
+
+// readOnlyGuard rejects the mutating request with HTTP 423 in read-only
+// mode
+func readOnlyGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ReadOnly {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusLocked)
+			errMsg := ErrResponseMsg{Result: RuleMgmtError, ErrorMsg: readOnlyMessage}
+			result, _ := json.Marshal(errMsg)
+			io.WriteString(w, string(result))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
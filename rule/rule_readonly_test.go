@@ -0,0 +1,35 @@
+package rule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	defer func(readOnly bool) { ReadOnly = readOnly }(ReadOnly)
+	ReadOnly = true
+	handler := Handlers()
+
+	for _, tc := range []struct {
+		method, path, body string
+		locked             bool
+	}{
+		{"POST", "/admin/rule", `{"name": "read_only_test", "rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "read_only_test"}]}}`, true},
+		{"PATCH", "/admin/rule/read_only_test/status", `{"enabled": false}`, true},
+		{"DELETE", "/admin/rule/read_only_test", ``, true},
+		{"POST", "/admin/macro", `{}`, true},
+		{"POST", "/admin/rules/merge", `{}`, true},
+		{"POST", "/admin/rule/format", `{"name": "read_only_test", "rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "read_only_test"}]}}`, false},
+		{"POST", "/admin/rule/dryrun", `{"rule": {"name": "read_only_test", "rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "read_only_test"}]}}, "document": {"read_only_test": "a@b"}}`, false},
+		{"POST", "/api/validation", `{"read_only_test": "a@b"}`, false},
+		{"GET", "/admin/stats", ``, false},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if locked := w.Code == http.StatusLocked; locked != tc.locked {
+			t.Errorf("%s %s: expected locked %v, got HTTP %d", tc.method, tc.path, tc.locked, w.Code)
+		}
+	}
+}
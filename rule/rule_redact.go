@@ -0,0 +1,170 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// RedactionMode defines how an input field value is echoed in a response
+type RedactionMode string
+
+const (
+	RedactionShow     RedactionMode = "show"     // echo the value as is
+	RedactionMask     RedactionMode = "mask"     // replace every character by "*"
+	RedactionTruncate RedactionMode = "truncate" // keep the first Length characters
+	RedactionOmit     RedactionMode = "omit"     // never echo the value
+)
+
+type FieldRedaction struct {
+	Mode   RedactionMode `json:"mode"`
+	Length int           `json:"length,omitempty"`
+}
+
+// RedactionConfig is the per-field redaction, loaded from a JSON file like,
+//   { "default": { "mode": "omit" },
+//     "fields":  { "email": { "mode": "truncate", "length": 3 }, "zip_code": { "mode": "show" } } }
+// A field name is the input field path, the array index can be written
+// as "[*]" to match any index, e.g. "addresses[*].zip_code".
+// "default" applies to the fields not listed, so "omit" as the default
+// turns "fields" into an allowlist.
+type RedactionConfig struct {
+	Default FieldRedaction            `json:"default"`
+	Fields  map[string]FieldRedaction `json:"fields"`
+}
+
+// the system redaction, echo all values except the password
+var Redaction = RedactionConfig{
+	Default: FieldRedaction{Mode: RedactionShow},
+	Fields: map[string]FieldRedaction{
+		"password": {Mode: RedactionOmit},
+	},
+}
+
+// LoadRedactionConfig replaces the system redaction by the JSON file
+func LoadRedactionConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := RedactionConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if err := config.Default.check(); err != nil {
+		return err
+	}
+	for _, r := range config.Fields {
+		if err := r.check(); err != nil {
+			return err
+		}
+	}
+	Redaction = config
+	return nil
+}
+
+func (r FieldRedaction) check() error {
+	switch r.Mode {
+	case RedactionShow, RedactionMask, RedactionOmit:
+		return nil
+	case RedactionTruncate:
+		if r.Length >= 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("redaction: invalid mode, %s", r.Mode)
+}
+
+var arrayIndexPattern = regexp.MustCompile(`\[[0-9]+\]`)
+
+// lookup the redaction of the input field path
+func (c RedactionConfig) lookup(field string) FieldRedaction {
+	if r, ok := c.listed(field); ok {
+		return r
+	}
+	if len(c.Default.Mode) == 0 {
+		return FieldRedaction{Mode: RedactionShow}
+	}
+	return c.Default
+}
+
+// listed returns the redaction of the input field path listed in "fields"
+func (c RedactionConfig) listed(field string) (FieldRedaction, bool) {
+	if r, ok := c.Fields[field]; ok {
+		return r, true
+	}
+	r, ok := c.Fields[arrayIndexPattern.ReplaceAllString(field, "[*]")]
+	return r, ok
+}
+
+// lookupStored the redaction of the input field path kept at rest, e.g.
+// in the quarantine: a field not listed is masked when the default shows
+// it, so the PII is kept as is only when a field says so
+func (c RedactionConfig) lookupStored(field string) FieldRedaction {
+	if r, ok := c.listed(field); ok {
+		return r
+	}
+	return c.storedDefault()
+}
+
+// storedDefault is the default redaction kept at rest, "show" is masked
+func (c RedactionConfig) storedDefault() FieldRedaction {
+	if len(c.Default.Mode) == 0 || c.Default.Mode == RedactionShow {
+		return FieldRedaction{Mode: RedactionMask}
+	}
+	return c.Default
+}
+
+// redact returns the value to echo, false when it is omitted
+func (r FieldRedaction) redact(value string) (string, bool) {
+	switch r.Mode {
+	case RedactionShow:
+		return value, true
+	case RedactionMask:
+		return strings.Repeat("*", len([]rune(value))), true
+	case RedactionTruncate:
+		if runes := []rune(value); len(runes) > r.Length {
+			return string(runes[:r.Length]) + "...", true
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// redactStoredFields returns the redacted text of the input fields kept
+// at rest, by their path, the omitted fields are left out
+func redactStoredFields(fields map[string]interface{}) map[string]string {
+	redacted := map[string]string{}
+	for field, value := range fields {
+		if text, ok := Redaction.lookupStored(field).redact(fieldText(value)); ok {
+			redacted[field] = text
+		}
+	}
+	return redacted
+}
+
+// RedactedValue is an input field value echoed in a response.  The value
+// is redacted by the field's redaction when it is JSON encoded, so no
+// response can leak a value against the configuration.
+type RedactedValue struct {
+	Field string
+	Value string
+}
+
+// NewRedactedValue returns nil when the field value is omitted, so an
+// `json:",omitempty"` response field drops it
+func NewRedactedValue(field string, value string) *RedactedValue {
+	if _, ok := Redaction.lookup(field).redact(value); !ok {
+		return nil
+	}
+	return &RedactedValue{Field: field, Value: value}
+}
+
+func (v RedactedValue) MarshalJSON() ([]byte, error) {
+	if value, ok := Redaction.lookup(v.Field).redact(v.Value); ok {
+		return json.Marshal(value)
+	}
+	return []byte("null"), nil
+}
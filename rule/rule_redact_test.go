@@ -0,0 +1,51 @@
+package rule
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedactedValue(t *testing.T) {
+	defer func(config RedactionConfig) { Redaction = config }(Redaction)
+	path := filepath.Join(t.TempDir(), "redaction.json")
+	os.WriteFile(path, []byte(`{"default": {"mode": "omit"}, "fields": {
+		"email": {"mode": "truncate", "length": 3}, "zip_code": {"mode": "show"},
+		"card": {"mode": "mask"}, "addresses[*].zip_code": {"mode": "show"}}}`), 0644)
+	if err := LoadRedactionConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		field    string
+		value    string
+		expected string
+	}{
+		{"email", "alice@example.com", `"ali..."`},
+		{"email", "al", `"al"`},
+		{"zip_code", "90067", `"90067"`},
+		{"card", "4111", `"****"`},
+		{"addresses[2].zip_code", "90067", `"90067"`},
+		{"addresses[2].street", "Main St", `null`},
+	} {
+		if data, err := json.Marshal(RedactedValue{tc.field, tc.value}); err != nil || string(data) != tc.expected {
+			t.Errorf("%s: expected %s, got %s %v", tc.field, tc.expected, data, err)
+		}
+	}
+	if v := NewRedactedValue("password", "secret"); v != nil {
+		t.Errorf("expected the omitted value dropped, got %v", v)
+	}
+
+	// the stored fields are masked unless listed
+	Redaction = RedactionConfig{Default: FieldRedaction{Mode: RedactionShow}, Fields: map[string]FieldRedaction{"zip_code": {Mode: RedactionShow}}}
+	stored := redactStoredFields(map[string]interface{}{"zip_code": "90067", "name": "alice"})
+	if stored["zip_code"] != "90067" || stored["name"] != "*****" {
+		t.Errorf("expected the unlisted field masked at rest, got %v", stored)
+	}
+
+	os.WriteFile(path, []byte(`{"fields": {"email": {"mode": "hide"}}}`), 0644)
+	if err := LoadRedactionConfig(path); err == nil {
+		t.Error("expected an invalid mode rejected")
+	}
+}
@@ -0,0 +1,209 @@
+package rule
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// RuleRefOperator embeds the rule content of another registered rule,
+//   { "operator": "RULE_REF", "operands": [ { "value": "email_basic" } ] }
+// e.g. "email_strict" is the AND of RULE_REF "email_basic" and a domain
+// check.  The reference is resolved when the rule is registered, its
+// operand tree and fields are copied into the rule, and resolved again
+// when the referenced rule is updated, see reresolveDependents.
+const RuleRefOperator OperatorType = "RULE_REF"
+
+// parseRuleRef checks the RULE_REF term, and returns the referenced name
+func parseRuleRef(term *TermOperand) (string, error) {
+	if len(term.ParseOperands) != 1 {
+		return "", fmt.Errorf("rule parser: %s expects 1 operand, got %d", RuleRefOperator, len(term.ParseOperands))
+	}
+	value, ok := term.ParseOperands[0].Value.(ValueOperand)
+	if !ok {
+		return "", fmt.Errorf("rule parser: %s expects a rule name value", RuleRefOperator)
+	}
+	name, ok := value.Value.(string)
+	if !ok || len(name) == 0 {
+		return "", fmt.Errorf("rule parser: %s expects a rule name value", RuleRefOperator)
+	}
+	return name, nil
+}
+
+// resolveRuleRef returns the rule content of the registered rule name, and
+// adds its fields to fieldList
+func resolveRuleRef(name string, fieldList map[string]int) (Operand, error) {
+	RegRuleLock.RLock()
+	entry := findRuleByName(name)
+	RegRuleLock.RUnlock()
+	if entry == nil {
+		return nil, fmt.Errorf("rule reference, %s, is not a registered rule", name)
+	}
+	for _, field := range entry.Fields {
+		if _, ok := fieldList[field]; !ok {
+			fieldList[field] = len(fieldList)
+		}
+	}
+	return entry.Rule, nil
+}
+
+// ruleReferences lists the rule names referenced by the parsed rule
+// content, sorted, without the duplicates
+func ruleReferences(t *Term) []string {
+	seen := map[string]bool{}
+	var walk func(t *Term)
+	walk = func(t *Term) {
+		term, ok := t.Value.(TermOperand)
+		if !ok {
+			return
+		}
+		if len(term.ruleRef) > 0 {
+			seen[term.ruleRef] = true
+			return
+		}
+		for i := range term.ParseOperands {
+			walk(&term.ParseOperands[i])
+		}
+	}
+	walk(t)
+	if len(seen) == 0 {
+		return nil
+	}
+	refs := make([]string, 0, len(seen))
+	for name := range seen {
+		refs = append(refs, name)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// orderByReferences sorts the rule nodes so a referenced rule is before
+// the rules which refer to it, otherwise in the given order.  A reference
+// outside of nodes is left to the registration, and a reference cycle is
+// an error.
+func orderByReferences(nodes []RuleNode) ([]RuleNode, error) {
+	index := map[string]int{}
+	for i := range nodes {
+		if len(nodes[i].Name) > 0 {
+			index[nodes[i].Name] = i
+		}
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(nodes))
+	ordered := make([]RuleNode, 0, len(nodes))
+	path := []string{}
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("rule reference cycle, %s -> %s", strings.Join(path, " -> "), nodes[i].Name)
+		}
+		state[i] = visiting
+		path = append(path, nodes[i].Name)
+		for _, ref := range ruleReferences(&nodes[i].RuleContent) {
+			if j, ok := index[ref]; ok {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		ordered = append(ordered, nodes[i])
+		return nil
+	}
+	for i := range nodes {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// ruleDependents lists the rules embedding the rule name by RULE_REF,
+// directly or not, a rule before the rules embedding it
+func ruleDependents(name string) []string {
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	embedders := map[string][]string{}
+	for _, rules := range AllRegisteredRules {
+		for _, entry := range rules {
+			for _, ref := range entry.References {
+				embedders[ref] = append(embedders[ref], entry.Name)
+			}
+		}
+	}
+	visited := map[string]bool{name: true}
+	var order []string
+	var visit func(name string)
+	visit = func(name string) {
+		dependents := embedders[name]
+		sort.Strings(dependents)
+		for _, dependent := range dependents {
+			if !visited[dependent] {
+				visited[dependent] = true
+				visit(dependent)
+				order = append(order, dependent)
+			}
+		}
+	}
+	visit(name)
+	// the post-order lists the embedding rules first
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// reresolveDependents resolves the rules embedding the updated rule name
+// again, so they evaluate its new content.  A rule which fails to resolve,
+// e.g. the new content breaks its field patches, keeps its content.
+func reresolveDependents(name string) {
+	for _, dependent := range ruleDependents(name) {
+		if err := reresolveRule(dependent); err != nil {
+			log.Printf("rule reference: rule name, %s, keeps the content of %s: %v", dependent, name, err)
+		}
+	}
+}
+
+// reresolveRule parses the registered rule name again from its definition,
+// and swaps its content, keeping the rest of the entry
+func reresolveRule(name string) error {
+	RegRuleLock.RLock()
+	current := findRuleByName(name)
+	RegRuleLock.RUnlock()
+	if current == nil || current.source == nil {
+		return nil
+	}
+	parsed, fieldList, err := parseRuleNode(current.source)
+	if err != nil {
+		return err
+	}
+	parsed.Name = current.Name
+	if err := resolveRuleFields(parsed, fieldList); err != nil {
+		return err
+	}
+
+	RegRuleLock.Lock()
+	defer RegRuleLock.Unlock()
+	if findRuleByName(name) != current {
+		// updated in between, with the new content already
+		return nil
+	}
+	entry := *current
+	entry.Field, entry.Fields, entry.Rule = parsed.Field, parsed.Fields, parsed.Rule
+	entry.Fingerprint, entry.resources = parsed.Fingerprint, parsed.resources
+	removeRuleFromRegister(current)
+	if err := saveRuleLocked(&entry); err != nil {
+		saveRuleLocked(current)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRuleRef(t *testing.T) {
+	rules := []string{
+		`{"name": "ref_test_email_basic",
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "^[^@]+@[^@]+$"}, {"field": "ref_test.email"}]}}`,
+		`{"name": "ref_test_email_strict",
+		  "rule": {"operator": "AND", "operands": [
+			{"operator": "RULE_REF", "operands": [{"value": "ref_test_email_basic"}]},
+			{"operator": "MATCHES", "operands": [{"value": "@example\\.com$"}, {"field": "ref_test.email"}]}]}}`,
+	}
+	nodes := []RuleNode{}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, node)
+	}
+	// the referring rule first, the loader registers the referenced one first
+	ordered, err := orderByReferences([]RuleNode{nodes[1], nodes[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ordered[0].Name != "ref_test_email_basic" || ordered[1].Name != "ref_test_email_strict" {
+		t.Fatalf("expected the referenced rule first, got %s, %s", ordered[0].Name, ordered[1].Name)
+	}
+	if _, err := RegisterRuleNode(&nodes[1]); err == nil {
+		t.Fatal("expected a reference to an unregistered rule to fail")
+	}
+	for i := range ordered {
+		entry := registerTestRule(t, &ordered[i])
+		if i == 1 && !reflect.DeepEqual(entry.References, []string{"ref_test_email_basic"}) {
+			t.Errorf("expected the references of the rule, got %v", entry.References)
+		}
+	}
+
+	for email, failed := range map[string][]string{
+		"a@example.com": nil,
+		"a@other.com":   {"ref_test_email_strict"},
+		"not-an-email":  {"ref_test_email_basic", "ref_test_email_strict"},
+	} {
+		doc := map[string]interface{}{"ref_test": map[string]interface{}{"email": email}}
+		result, err := ValidateInputJSONByRules("", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(result.rules)
+		if len(failed) == 0 && len(result.rules) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(result.rules, failed) {
+			t.Errorf("%s: expected the failed rules %v, got %v", email, failed, result.rules)
+		}
+	}
+
+	self := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "ref_test_self",
+		"rule": {"operator": "RULE_REF", "operands": [{"value": "ref_test_self"}]}}`), &self)
+	if _, err := RegisterRuleNode(&self); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected a self reference to fail, got %v", err)
+	}
+	cycle := []RuleNode{}
+	for _, rule := range []string{
+		`{"name": "ref_test_a", "rule": {"operator": "RULE_REF", "operands": [{"value": "ref_test_b"}]}}`,
+		`{"name": "ref_test_b", "rule": {"operator": "RULE_REF", "operands": [{"value": "ref_test_a"}]}}`,
+	} {
+		node := RuleNode{}
+		json.Unmarshal([]byte(rule), &node)
+		cycle = append(cycle, node)
+	}
+	if _, err := orderByReferences(cycle); err == nil || !strings.Contains(err.Error(), "ref_test_a -> ref_test_b -> ref_test_a") {
+		t.Errorf("expected the reference cycle, got %v", err)
+	}
+}
+
+func TestRuleRefUpdate(t *testing.T) {
+	rules := []string{
+		`{"name": "ref_update_basic",
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "^[^@]+@[^@]+$"}, {"field": "ref_update.email"}]}}`,
+		`{"name": "ref_update_strict",
+		  "rule": {"operator": "AND", "operands": [
+			{"operator": "RULE_REF", "operands": [{"value": "ref_update_basic"}]},
+			{"operator": "MATCHES", "operands": [{"value": "@example\\.com$"}, {"field": "ref_update.email"}]}]}}`,
+		`{"name": "ref_update_outer",
+		  "rule": {"operator": "RULE_REF", "operands": [{"value": "ref_update_strict"}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+	failed := func(email string) []string {
+		doc := map[string]interface{}{"ref_update": map[string]interface{}{"email": email}}
+		result, err := ValidateInputJSONByRules("", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(result.rules)
+		return result.rules
+	}
+	if rules := failed("b@example.com"); len(rules) != 0 {
+		t.Fatalf("expected no failed rule, got %v", rules)
+	}
+
+	// the embedding rules, directly or not, follow the update
+	update := RuleNode{}
+	json.Unmarshal([]byte(`{"rule": {"operator": "MATCHES", "operands": [{"value": "^a@"}, {"field": "ref_update.email"}]}}`), &update)
+	if _, err := UpdateRuleNode("ref_update_basic", &update, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ref_update_basic", "ref_update_outer", "ref_update_strict"}
+	if rules := failed("b@example.com"); !reflect.DeepEqual(rules, expected) {
+		t.Errorf("expected the failed rules %v, got %v", expected, rules)
+	}
+	if rules := failed("a@example.com"); len(rules) != 0 {
+		t.Errorf("expected no failed rule, got %v", rules)
+	}
+	RegRuleLock.RLock()
+	version := findRuleByName("ref_update_strict").Version
+	RegRuleLock.RUnlock()
+	if version != 1 {
+		t.Errorf("expected the embedding rule to keep its version, got %d", version)
+	}
+}
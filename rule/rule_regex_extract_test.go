@@ -0,0 +1,16 @@
+package rule
+
+import "testing"
+
+func TestRegexExtract(t *testing.T) {
+	for value, expected := range map[string]string{"order-42": "42", "invoice-42": ""} {
+		if res, err := RegisteredOperators[RegexExtractOperator]([]interface{}{`^order-(\d+)$`, value}); err != nil || res != expected {
+			t.Errorf("%s: expected %q, got %v %v", value, expected, res, err)
+		}
+	}
+	for _, pattern := range []string{`order-\d+`, `(order)-(\d+)`, `(`} {
+		if _, err := RegisteredOperators[RegexExtractOperator]([]interface{}{pattern, "order-42"}); err == nil {
+			t.Errorf("%s: expected the pattern rejected", pattern)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package rule
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// A rule change by the admin API is checked against a corpus of the
+// historical documents, configured by a JSON file like,
+//   { "corpus": "/var/lib/validation/regression.jsonl.gz",
+//     "ruleset": "signup",
+//     "max-new-failure-percent": 1 }
+// The corpus, JSON Lines, gzipped with ".gz", is streamed at each change,
+// and each document is validated by the rules before and after the
+// change.  The documents passing before and failing after are the new
+// failures, and the change is rejected when they are more than
+// "max-new-failure-percent" of the documents passing before, 0 by
+// default, unless it is forced.  A document is validated against
+// "ruleset", or the discriminated one without it.
+
+// RegressionConfig is the corpus of the rule change check
+type RegressionConfig struct {
+	Corpus               string  `json:"corpus"`
+	Ruleset              string  `json:"ruleset,omitempty"`
+	MaxNewFailurePercent float64 `json:"max-new-failure-percent,omitempty"`
+}
+
+// the rule change check, nil is none
+var Regression *RegressionConfig
+
+// the line numbers of the new failures in the report
+const regressionSampleLines = 10
+
+// LoadRegressionConfig enables the rule change check by the JSON file
+func LoadRegressionConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := RegressionConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if len(config.Corpus) == 0 {
+		return fmt.Errorf("regression: corpus is missing")
+	}
+	if _, err := os.Stat(config.Corpus); err != nil {
+		return fmt.Errorf("regression: %s", err.Error())
+	}
+	if config.MaxNewFailurePercent < 0 || config.MaxNewFailurePercent > 100 {
+		return fmt.Errorf("regression: max-new-failure-percent, %v, is not in [0, 100]", config.MaxNewFailurePercent)
+	}
+	if err := CheckRuleset(config.Ruleset); err != nil {
+		return fmt.Errorf("regression: %s", err.Error())
+	}
+	Regression = &config
+	return nil
+}
+
+// RegressionReport is the result of the corpus before and after a rule
+// change.  Lines are the line numbers of the first new failures.
+type RegressionReport struct {
+	Documents   int     `json:"documents"`
+	Passing     int     `json:"passing"`
+	NewFailures int     `json:"new-failures"`
+	Percent     float64 `json:"percent"`
+	Threshold   float64 `json:"threshold"`
+	Blocked     bool    `json:"blocked"`
+	Lines       []int64 `json:"lines,omitempty"`
+}
+
+// snapshotRegistry copies the registered rules into an isolated registry,
+// but the replaced one
+func snapshotRegistry(replaced *RuleEntry) ruleRegistry {
+	reg := newIsolatedRegistry()
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	for _, rules := range AllRegisteredRules {
+		for _, entry := range rules {
+			if entry != replaced {
+				// the state is guarded by the lock
+				copied := *entry
+				reg.add(&copied)
+			}
+		}
+	}
+	return reg
+}
+
+// regressionOf streams the corpus, and compares the results of the rules
+// before and after the change
+func (config *RegressionConfig) regressionOf(before ruleRegistry, after ruleRegistry) (*RegressionReport, error) {
+	f, err := os.Open(config.Corpus)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if strings.HasSuffix(config.Corpus, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	report := &RegressionReport{Threshold: config.MaxNewFailurePercent}
+	br := bufio.NewReaderSize(in, 1<<20)
+	var number int64
+	for {
+		text, err := br.ReadBytes('\n')
+		if len(text) > 0 {
+			number++
+		}
+		var doc map[string]interface{}
+		if len(bytes.TrimSpace(text)) > 0 && decodeJSONDocument(text, &doc) == nil && doc != nil {
+			ruleset, _ := discriminate(doc, config.Ruleset, "")
+			if res, e := before.validateIsolated(doc, ruleset); e == nil {
+				report.Documents++
+				if res.flag {
+					report.Passing++
+					if res, e := after.validateIsolated(doc, ruleset); e != nil || !res.flag {
+						report.NewFailures++
+						if len(report.Lines) < regressionSampleLines {
+							report.Lines = append(report.Lines, number)
+						}
+					}
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if report.Passing > 0 {
+		report.Percent = float64(report.NewFailures) * 100 / float64(report.Passing)
+	}
+	report.Blocked = report.NewFailures > 0 && report.Percent > config.MaxNewFailurePercent
+	return report, nil
+}
+
+// checkRuleRegression validates the corpus by the registered rules, and
+// by them with node in place of the replaced rule, nil for a new one.
+// The report is nil without the regression config.
+func checkRuleRegression(node *RuleNode, replaced *RuleEntry) (*RegressionReport, error) {
+	if Regression == nil {
+		return nil, nil
+	}
+	// the copy of node parsed for the check, the node itself is registered
+	copied := *node
+	entry, fieldList, err := parseRuleNode(&copied)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveRuleFields(entry, fieldList); err != nil {
+		return nil, err
+	}
+	return checkRuleRegressionOf(entry, replaced)
+}
+
+// checkRuleRegressionOf validates the corpus by the registered rules, and
+// by them with entry in place of the replaced rule, nil for a new one
+func checkRuleRegressionOf(entry *RuleEntry, replaced *RuleEntry) (*RegressionReport, error) {
+	before := snapshotRegistry(nil)
+	after := snapshotRegistry(replaced)
+	if err := after.add(entry); err != nil {
+		return nil, err
+	}
+	return Regression.regressionOf(before, after)
+}
+
+// RegressionErrorMsg is the response of the rule change rejected by the
+// regression check
+type RegressionErrorMsg struct {
+	Result     string            `json:"result"`
+	ErrorMsg   string            `json:"error-message"`
+	Regression *RegressionReport `json:"regression"`
+}
+
+// writeRegressionError writes the rejection of the rule change, which new
+// failures are above the threshold
+func writeRegressionError(w http.ResponseWriter, name string, report *RegressionReport) {
+	w.WriteHeader(http.StatusConflict)
+	msg := fmt.Sprintf("rule name, %s, fails %d of %d passing documents, %.2f%%, more than %v%%, ?force=true applies it",
+		name, report.NewFailures, report.Passing, report.Percent, report.Threshold)
+	resStr, _ := json.Marshal(RegressionErrorMsg{Result: RuleMgmtError, ErrorMsg: msg, Regression: report})
+	io.WriteString(w, string(resStr))
+}
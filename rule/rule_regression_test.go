@@ -0,0 +1,107 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRuleRegression(t *testing.T) {
+	corpus := filepath.Join(t.TempDir(), "corpus.jsonl")
+	lines := `{"regression_test_code": "ab1"}
+{"regression_test_code": "ab12"}
+
+not a document
+{"regression_test_code": "ab123"}
+{"other": 1}
+`
+	if err := os.WriteFile(corpus, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { Regression = nil }()
+	Regression = &RegressionConfig{Corpus: corpus, MaxNewFailurePercent: 20}
+
+	create := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		CreateRule(w, httptest.NewRequest("POST", "/admin/rule"+query, strings.NewReader(`{"name": "regression_test_code",
+			"expression": "length(regression_test_code) > 3"}`)))
+		return w
+	}
+	w := create("")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d %s", w.Code, w.Body.String())
+	}
+	msg := RegressionErrorMsg{}
+	json.Unmarshal(w.Body.Bytes(), &msg)
+	if r := msg.Regression; r.Documents != 4 || r.Passing != 4 || r.NewFailures != 1 || r.Percent != 25 || !reflect.DeepEqual(r.Lines, []int64{1}) {
+		t.Errorf("expected 1 of 4 new failures on the line 1, got %+v", r)
+	}
+
+	w = create("?force=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the forced rule, got %d %s", w.Code, w.Body.String())
+	}
+	RegRuleLock.Lock()
+	removeRuleFromRegister(findRuleByName("regression_test_code"))
+	RegRuleLock.Unlock()
+	res := CreateRuleResponseMsg{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.Regression == nil || !res.Regression.Blocked {
+		t.Errorf("expected the report of the forced rule, got %+v", res.Regression)
+	}
+}
+
+func TestRuleApprovalRegression(t *testing.T) {
+	corpus := filepath.Join(t.TempDir(), "corpus.jsonl")
+	if err := os.WriteFile(corpus, []byte("{\"approval_regression_test_code\": \"ab1\"}\n{\"approval_regression_test_code\": \"ab12\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { Regression = nil }()
+	Regression = &RegressionConfig{Corpus: corpus}
+	defer func(require bool) { RequireApproval = require }(RequireApproval)
+	RequireApproval = true
+
+	// the draft fails no document at its creation
+	router := Handlers()
+	request := func(path string, body string, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set(UserHeader, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := request("/admin/rule", `{"name": "approval_regression_test_code", "expression": "length(approval_regression_test_code) > 3"}`, "alice")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the draft, got %d %s", w.Code, w.Body.String())
+	}
+	cleanupTestRule(t, "approval_regression_test_code")
+
+	if w = request("/admin/rule/approval_regression_test_code/approve", "", "bob"); w.Code != http.StatusConflict {
+		t.Fatalf("expected the approval to fail the regression check, got %d %s", w.Code, w.Body.String())
+	}
+	msg := RegressionErrorMsg{}
+	json.Unmarshal(w.Body.Bytes(), &msg)
+	if r := msg.Regression; r == nil || r.Passing != 2 || r.NewFailures != 1 {
+		t.Errorf("expected 1 of 2 new failures, got %+v", r)
+	}
+	RegRuleLock.RLock()
+	state := findRuleByName("approval_regression_test_code").State
+	RegRuleLock.RUnlock()
+	if state != RuleStateDraft {
+		t.Errorf("expected the rule to stay a draft, got %s", state)
+	}
+
+	if w = request("/admin/rule/approval_regression_test_code/approve?force=true", "", "bob"); w.Code != http.StatusOK {
+		t.Fatalf("expected the forced approval, got %d %s", w.Code, w.Body.String())
+	}
+	res := RuleStateResponseMsg{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.State != RuleStatePublished || res.Regression == nil || !res.Regression.Blocked {
+		t.Errorf("expected the published rule with its report, got %+v", res)
+	}
+}
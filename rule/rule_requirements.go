@@ -0,0 +1,247 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// operatorPhrases describe the operators in English, args are the
+// described operands.  An operator without the phrase is described in
+// its expression form, e.g. LOOKUP("https://...", phone).
+var operatorPhrases = map[OperatorType]func(args []string) string{
+	LengthOperator: func(args []string) string {
+		return "the length of " + args[0]
+	},
+	EqualToOperator: func(args []string) string {
+		if len(args) == 3 {
+			return fmt.Sprintf("%s equals %s within %s", args[0], args[1], args[2])
+		}
+		return fmt.Sprintf("%s equals %s", args[0], args[1])
+	},
+	GreaterThanOperator: func(args []string) string {
+		if len(args) == 3 {
+			return fmt.Sprintf("%s is greater than %s by more than %s", args[0], args[1], args[2])
+		}
+		return fmt.Sprintf("%s is greater than %s", args[0], args[1])
+	},
+	OrOperator: func(args []string) string {
+		return fmt.Sprintf("either (%s) or (%s)", args[0], args[1])
+	},
+	AndOperator: func(args []string) string {
+		return fmt.Sprintf("%s, and %s", args[0], args[1])
+	},
+	MatchesOperator: func(args []string) string {
+		return fmt.Sprintf("%s matches the pattern %s", args[1], args[0])
+	},
+	IsSemverOperator: func(args []string) string {
+		return args[0] + " is a semantic version"
+	},
+	SemverGreaterThanOperator: func(args []string) string {
+		return fmt.Sprintf("%s is a version newer than %s", args[0], args[1])
+	},
+	Sha256EqualsOperator: func(args []string) string {
+		return fmt.Sprintf("the SHA-256 digest of %s is %s", args[0], args[1])
+	},
+	Crc32EqualsOperator: func(args []string) string {
+		return fmt.Sprintf("the CRC-32 checksum of %s is %s", args[0], args[1])
+	},
+	InDictionaryOperator: func(args []string) string {
+		return fmt.Sprintf("%s is in the word list %s", args[1], args[0])
+	},
+	NotInBlocklistOperator: func(args []string) string {
+		return fmt.Sprintf("%s is not in the word list %s", args[1], args[0])
+	},
+	IsTimezoneOperator: func(args []string) string {
+		return args[0] + " is an IANA time zone name"
+	},
+	BetweenOperator: func(args []string) string {
+		return fmt.Sprintf("%s is between %s and %s", args[0], args[1], args[2])
+	},
+	RegexExtractOperator: func(args []string) string {
+		return fmt.Sprintf("the part of %s captured by the pattern %s", args[1], args[0])
+	},
+	DateFormatOperator: func(args []string) string {
+		return fmt.Sprintf("%s is a date in the layout %s", args[1], args[0])
+	},
+	IsLatitudeOperator: func(args []string) string {
+		return args[0] + " is a latitude"
+	},
+	IsLongitudeOperator: func(args []string) string {
+		return args[0] + " is a longitude"
+	},
+	WithinBboxOperator: func(args []string) string {
+		point := args[0]
+		if len(args) == 6 {
+			point = args[0] + ", " + args[1]
+		}
+		box := args[len(args)-4:]
+		return fmt.Sprintf("%s is within latitude %s to %s and longitude %s to %s", point, box[0], box[2], box[1], box[3])
+	},
+	IsIbanOperator: func(args []string) string {
+		return args[0] + " is an IBAN"
+	},
+	LuhnValidOperator: func(args []string) string {
+		return args[0] + " has a valid Luhn check digit"
+	},
+	IsCurrencyCodeOperator: func(args []string) string {
+		return args[0] + " is an ISO 4217 currency code"
+	},
+	IsSsnOperator: func(args []string) string {
+		return args[0] + " is a US social security number"
+	},
+	PassportFormatOperator: func(args []string) string {
+		return fmt.Sprintf("%s is a passport number of the country %s", args[0], args[1])
+	},
+	IfOperator: func(args []string) string {
+		if len(args) == 3 {
+			return fmt.Sprintf("if %s then %s, otherwise %s", args[0], args[1], args[2])
+		}
+		return fmt.Sprintf("if %s then %s", args[0], args[1])
+	},
+	FieldCountOperator: func(args []string) string {
+		return "the number of fields in " + args[0]
+	},
+	DocumentDepthOperator: func(args []string) string {
+		return "the nesting depth of " + args[0]
+	},
+	DocumentLengthOperator: func(args []string) string {
+		return "the total characters of the values in " + args[0]
+	},
+	HasFieldOperator: func(args []string) string {
+		return fmt.Sprintf("%s has the field %s", args[0], args[1])
+	},
+	UniqueInScopeOperator: func(args []string) string {
+		return fmt.Sprintf("%s is not repeated in the scope %s within %s", args[2], args[0], args[1])
+	},
+	OldOperator: func(args []string) string {
+		return "the previous " + args[0]
+	},
+	ChangedOperator: func(args []string) string {
+		return args[0] + " is changed"
+	},
+	ChangePercentOperator: func(args []string) string {
+		return "the change of " + args[0] + " in percent"
+	},
+	RequiredIfOperator: func(args []string) string {
+		return fmt.Sprintf("%s has the field %s when %s", args[0], args[1], args[2])
+	},
+	ForbiddenIfOperator: func(args []string) string {
+		return fmt.Sprintf("%s doesn't have the field %s when %s", args[0], args[1], args[2])
+	},
+	ExactlyOneOfOperator: func(args []string) string {
+		return fmt.Sprintf("%s has exactly one of the fields %s", args[0], strings.Join(args[1:], ", "))
+	},
+	AtMostOneOfOperator: func(args []string) string {
+		return fmt.Sprintf("%s has at most one of the fields %s", args[0], strings.Join(args[1:], ", "))
+	},
+	SumOperator: func(args []string) string {
+		return fmt.Sprintf("the sum of %s in %s", args[1], args[0])
+	},
+	MinOperator: func(args []string) string {
+		return fmt.Sprintf("the lowest %s in %s", args[1], args[0])
+	},
+	MaxOperator: func(args []string) string {
+		return fmt.Sprintf("the highest %s in %s", args[1], args[0])
+	},
+	CountOperator: func(args []string) string {
+		return fmt.Sprintf("the number of %s in %s", args[1], args[0])
+	},
+	DateAfterOperator: func(args []string) string {
+		return fmt.Sprintf("%s is after %s", args[0], args[1])
+	},
+	RequiredOperator: func(args []string) string {
+		return args[0] + " is present"
+	},
+	ContentTypeIsOperator: func(args []string) string {
+		return fmt.Sprintf("%s is base64 content of type %s", args[0], strings.Join(args[1:], " or "))
+	},
+}
+
+// describeOperand describes the operand tree in English, the primary
+// field is "the value"
+func describeOperand(op Operand, primaryField string) string {
+	switch v := op.(type) {
+	case *FieldOperand:
+		if v.Name == DocumentField {
+			return "the document"
+		} else if v.Name == primaryField {
+			return "the value"
+		}
+		return "field " + v.Name
+	case *ValueOperand:
+		data, _ := marshalCanonical(v.Value, "")
+		return string(data)
+	case *TermOperand:
+		args := make([]string, len(v.OperandList))
+		for i, o := range v.OperandList {
+			args[i] = describeOperand(o, primaryField)
+		}
+		phrase, ok := operatorPhrases[OperatorType(v.ParseOperator)]
+		if !ok || len(args) == 0 {
+			return fmt.Sprintf("%s(%s)", v.ParseOperator, strings.Join(args, ", "))
+		}
+		return phrase(args)
+	}
+	return fmt.Sprint(op)
+}
+
+// FieldRequirement is a constraint on a field, derived from a rule
+type FieldRequirement struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+}
+
+// FieldRequirements lists the constraints enforced on one input field
+type FieldRequirements struct {
+	Field        string             `json:"field"`
+	Requirements []FieldRequirement `json:"requirements"`
+}
+
+// GetFieldRequirements describes the active rules in ruleset per field,
+// sorted by the field and the rule name
+func GetFieldRequirements(ruleset string) []FieldRequirements {
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+
+	list := []FieldRequirements{}
+	for field, rules := range AllRegisteredRules {
+		reqs := FieldRequirements{Field: field}
+		for name, entry := range rules {
+			if !entry.applies(ruleset) {
+				continue
+			}
+			description := describeOperand(entry.Rule, field)
+			if entry.Required && !isRequiredOperand(entry.Rule) {
+				description = "the value is present, and " + description
+			}
+			reqs.Requirements = append(reqs.Requirements, FieldRequirement{Rule: name, Description: description})
+		}
+		if len(reqs.Requirements) == 0 {
+			continue
+		}
+		sort.Slice(reqs.Requirements, func(i, j int) bool { return reqs.Requirements[i].Rule < reqs.Requirements[j].Rule })
+		list = append(list, reqs)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Field < list[j].Field })
+	return list
+}
+
+// GET /api/validation/requirements?ruleset=<ruleset> service
+// implementation, the public read-only constraints per field for the API
+// consumers, enforced by the validation against the ruleset
+func GetRequirements(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ruleset := requestRuleset(r)
+	if err := CheckRuleset(ruleset); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(GetFieldRequirements(ruleset))
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,38 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFieldRequirements(t *testing.T) {
+	rules := []string{
+		`{"name": "requirements_test_length", "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "requirements_test_code"}]}, {"value": 4}]}}`,
+		`{"name": "requirements_test_zone", "required": true, "rule": {"operator": "IS_TIMEZONE", "operands": [{"field": "requirements_test_zone"}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	expected := map[string]string{
+		"requirements_test_code": "the length of the value is greater than 4",
+		"requirements_test_zone": "the value is present, and the value is an IANA time zone name",
+	}
+	for _, reqs := range GetFieldRequirements("") {
+		description, ok := expected[reqs.Field]
+		if !ok {
+			continue
+		}
+		delete(expected, reqs.Field)
+		if len(reqs.Requirements) != 1 || reqs.Requirements[0].Description != description {
+			t.Errorf("%s: expected %q, got %v", reqs.Field, description, reqs.Requirements)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("expected the requirements of %v", expected)
+	}
+}
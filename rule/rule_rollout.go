@@ -0,0 +1,70 @@
+package rule
+
+import (
+	"fmt"
+
+	"github.com/richgrove/validation/util"
+)
+
+// A stricter rule is ramped by its "enforcement" percentage: the rule is
+// evaluated for every matching input, but its failure fails only the
+// enforced share of the inputs, e.g. 5, and the other failures are counted
+// as unenforced, in the rule statistics and the metrics, so the impact is
+// known before the rule is enforced for all.  The decision is made by the
+// hash of the "enforcement-key" field, or of the -sampling-key field, so
+// an entity is enforced on every replica, and the ramp from 5 to 20 keeps
+// the enforced entities enforced.  An input without the key is decided by
+// the hash of its document, the same on every replica but per document
+// rather than per entity, and a partly enforced rule without a key warns
+// at its registration.  Without "enforcement" the rule is enforced, and 0
+// only counts the failures.
+
+// checkEnforcement checks the "enforcement" percentage of the rule, nil is
+// fully enforced
+func checkEnforcement(ruleName string, percent *float64) error {
+	if percent != nil && (*percent < 0 || *percent > 100) {
+		return fmt.Errorf("rule, %s, enforcement, %v, is out of 0 to 100", ruleName, *percent)
+	}
+	return nil
+}
+
+// enforcementWarning warns of the partly enforced rule decided without
+// an entity key
+func enforcementWarning(percent *float64, keyField string) string {
+	if percent == nil || *percent >= 100 || *percent <= 0 || len(keyField) > 0 || len(SamplingKeyField) > 0 {
+		return ""
+	}
+	return "the enforcement is decided per document without the enforcement-key or -sampling-key field"
+}
+
+// enforcedFor decides the failure of the rule ruleID is enforced for the
+// input fields by the enforcement percentage, nil is enforced
+func enforcedFor(ruleID string, percent *float64, keyField string, fields map[string]interface{}) bool {
+	if percent == nil {
+		return true
+	}
+	if len(keyField) == 0 {
+		keyField = SamplingKeyField
+	}
+	return sampleInputBy("enforcement/"+ruleID, keyField, fields, *percent/100)
+}
+
+func (entry *RuleEntry) enforcedFor(fields map[string]interface{}) bool {
+	return enforcedFor(entry.ID, entry.Enforcement, entry.EnforcementKey, fields)
+}
+
+func (context *FieldEvalContext) enforced() bool {
+	return enforcedFor(context.RuleID, context.enforcement, context.enforcementKey, context.Fields)
+}
+
+// recordUnenforcedFailure counts a failure of the rule the enforcement
+// percentage let pass
+func recordUnenforcedFailure(ruleID string, ruleName string) {
+	ServiceMetrics.Counter(metricUnenforcedFailures, util.Labels{"rule": ruleName}, 1)
+
+	ruleCounterLock.Lock()
+	defer ruleCounterLock.Unlock()
+	if c, ok := ruleCounters[ruleID]; ok {
+		c.Unenforced++
+	}
+}
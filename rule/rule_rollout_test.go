@@ -0,0 +1,63 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRuleEnforcement(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "enforcement_test_zip", "enforcement": 50, "enforcement-key": "enforcement_test.user_id",
+		"rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "enforcement_test.zip"}]}}`), &node)
+	formatted, err := FormatRuleNode(&node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(formatted.Canonical, `"enforcement": 50`) {
+		t.Errorf("expected the enforcement in the canonical form, got %s", formatted.Canonical)
+	}
+	entry := registerTestRule(t, &node)
+
+	enforced, unenforced := 0, 0
+	for i := 0; i < 200; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		doc := map[string]interface{}{"enforcement_test": map[string]interface{}{"user_id": user, "zip": "9006"}}
+		expected := samplingBucket(SamplingSeed, "enforcement/"+entry.ID, user) >= 0.5
+		for j := 0; j < 2; j++ {
+			result, err := ValidateInputJSONByRules("", doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.flag != expected {
+				t.Fatalf("%s: expected %v, got %v", user, expected, result.flag)
+			}
+		}
+		if expected {
+			unenforced++
+		} else {
+			enforced++
+		}
+	}
+	if enforced == 0 || unenforced == 0 {
+		t.Errorf("expected both enforced and unenforced inputs, got %d %d", enforced, unenforced)
+	}
+	if c := GetRuleCounters()[entry.ID]; c.Unenforced != uint64(2*unenforced) {
+		t.Errorf("expected %d unenforced failures, got %d", 2*unenforced, c.Unenforced)
+	}
+
+	// without a key the rule warns
+	unkeyed := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "enforcement_test_unkeyed", "enforcement": 50,
+		"rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "enforcement_test.zip"}]}}`), &unkeyed)
+	if entry := registerTestRule(t, &unkeyed); len(entry.Warnings) != 1 || !strings.Contains(entry.Warnings[0], "enforcement-key") {
+		t.Errorf("expected the warning of the missing key, got %v", entry.Warnings)
+	}
+
+	node.Enforcement = new(float64)
+	*node.Enforcement = 101
+	if _, err := FormatRuleNode(&node); err == nil {
+		t.Errorf("expected an error of the enforcement out of range")
+	}
+}
@@ -0,0 +1,240 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RulesetConfig is the settings of a named ruleset, loaded from a JSON
+// file like,
+//   { "signup":         { "zero-rule-policy": "fail", "strict": true, "allowed-fields": [ "metadata" ] },
+//     "profile_update": { "envelope": "jsonapi" } }
+// "zero-rule-policy" overrides the system policy for the validation
+// against the ruleset, "envelope", "jsonapi" or "hal", unwraps the
+// validated documents of any Content-Type, and "strict" fails the input
+// fields which neither a rule nor "allowed-fields" covers.
+type RulesetConfig struct {
+	ZeroRulePolicy ZeroRulePolicy `json:"zero-rule-policy,omitempty"`
+	Envelope       string         `json:"envelope,omitempty"`
+	Strict         bool           `json:"strict,omitempty"`
+	AllowedFields  []string       `json:"allowed-fields,omitempty"`
+}
+
+// the configured rulesets, by the ruleset name
+var RulesetConfigs = map[string]RulesetConfig{}
+
+// RulesetHeader selects the rulesets of a request without ?ruleset=
+const RulesetHeader = "X-Ruleset"
+
+// the number of the rules in each ruleset, maintained with the register.
+// A ruleset is known when it is configured, or a rule belongs to it.
+var rulesetRuleCount = map[string]int{}
+
+// LoadRulesetConfig loads the ruleset settings from the JSON file
+func LoadRulesetConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	configs := map[string]RulesetConfig{}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return err
+	}
+	for name, config := range configs {
+		if err := checkRulesetName(name); err != nil {
+			return err
+		}
+		if len(config.ZeroRulePolicy) > 0 {
+			if _, err := ParseZeroRulePolicy(string(config.ZeroRulePolicy)); err != nil {
+				return fmt.Errorf("ruleset, %s, %s", name, err.Error())
+			}
+		}
+		if _, ok := envelopeContentTypes[config.Envelope]; len(config.Envelope) > 0 && !ok {
+			return fmt.Errorf("ruleset, %s, unknown envelope, %s", name, config.Envelope)
+		}
+		for _, field := range config.AllowedFields {
+			if len(strings.TrimSpace(field)) == 0 {
+				return fmt.Errorf("ruleset, %s, empty allowed field", name)
+			}
+		}
+	}
+	RegRuleLock.Lock()
+	RulesetConfigs = configs
+	RegRuleLock.Unlock()
+	return nil
+}
+
+// checkRulesetName rejects an empty name, and a name with a comma, which
+// separates the names in a list
+func checkRulesetName(name string) error {
+	if len(strings.TrimSpace(name)) == 0 || strings.Contains(name, ",") {
+		return fmt.Errorf("invalid ruleset name, %q", name)
+	}
+	return nil
+}
+
+// normalizeRulesets checks the ruleset names of a rule, and returns them
+// sorted without the duplicates
+func normalizeRulesets(rulesets []string) ([]string, error) {
+	if len(rulesets) == 0 {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	list := []string{}
+	for _, name := range rulesets {
+		if err := checkRulesetName(name); err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// splitRulesets returns the ruleset names of a selection, e.g.
+// "signup,common", a single name is a list of one
+func splitRulesets(ruleset string) []string {
+	if !strings.Contains(ruleset, ",") {
+		return []string{ruleset}
+	}
+	return strings.Split(ruleset, ",")
+}
+
+// requestRuleset returns the rulesets the request selects, by ?ruleset=,
+// or else by the X-Ruleset header, a comma-separated list without the
+// duplicates, in the request order
+func requestRuleset(r *http.Request) string {
+	ruleset := r.URL.Query().Get("ruleset")
+	if len(ruleset) == 0 {
+		ruleset = r.Header.Get(RulesetHeader)
+	}
+	if len(ruleset) == 0 {
+		return ""
+	}
+	seen := map[string]bool{}
+	names := []string{}
+	for _, name := range splitRulesets(ruleset) {
+		if name = strings.TrimSpace(name); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// rulesetKey is the ruleset selection as it is reported, in the events and
+// the job reports, the list sorted, so "common,signup" and "signup,common"
+// are reported the same.  The validation keeps the request order, which
+// picks the merged settings.
+func rulesetKey(ruleset string) string {
+	names := splitRulesets(ruleset)
+	if len(names) == 1 {
+		return ruleset
+	}
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// inRulesets checks a rule of rulesets applies to the validation against
+// ruleset, "" is the validation without a ruleset, and a list applies the
+// rules of each of its rulesets.  A rule without rulesets is a common
+// rule, which applies to every validation.
+func inRulesets(rulesets []string, ruleset string) bool {
+	if len(rulesets) == 0 {
+		return true
+	}
+	for _, selected := range splitRulesets(ruleset) {
+		for _, name := range rulesets {
+			if name == selected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (entry *RuleEntry) inRuleset(ruleset string) bool {
+	return inRulesets(entry.Rulesets, ruleset)
+}
+
+// CheckRuleset returns an error when ruleset, or a ruleset of the list,
+// is unknown, "" is always known
+func CheckRuleset(ruleset string) error {
+	if len(ruleset) == 0 {
+		return nil
+	}
+	names := splitRulesets(ruleset)
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	for _, name := range names {
+		if len(names) > 1 {
+			if err := checkRulesetName(name); err != nil {
+				return err
+			}
+		}
+		if _, ok := RulesetConfigs[name]; !ok && rulesetRuleCount[name] == 0 {
+			return fmt.Errorf("unknown ruleset, %s", name)
+		}
+	}
+	return nil
+}
+
+// rulesetConfigOf returns the settings of the validation against ruleset.
+// The settings of a list are merged: the zero-rule policy and the envelope
+// of the first ruleset setting them, strict when one ruleset is, and all
+// the allowed fields.  Caller holds the READ lock.
+func rulesetConfigOf(ruleset string) RulesetConfig {
+	names := splitRulesets(ruleset)
+	if len(names) == 1 {
+		return RulesetConfigs[ruleset]
+	}
+	merged := RulesetConfig{}
+	for _, name := range names {
+		config := RulesetConfigs[name]
+		if len(merged.ZeroRulePolicy) == 0 {
+			merged.ZeroRulePolicy = config.ZeroRulePolicy
+		}
+		if len(merged.Envelope) == 0 {
+			merged.Envelope = config.Envelope
+		}
+		merged.Strict = merged.Strict || config.Strict
+		merged.AllowedFields = append(merged.AllowedFields, config.AllowedFields...)
+	}
+	return merged
+}
+
+// zeroRulePolicyOf returns the zero-rule policy of the validation against
+// ruleset, the system policy unless the ruleset overrides it
+func zeroRulePolicyOf(ruleset string) ZeroRulePolicy {
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	if config := rulesetConfigOf(ruleset); len(config.ZeroRulePolicy) > 0 {
+		return config.ZeroRulePolicy
+	}
+	return DefaultZeroRulePolicy
+}
+
+// knownRulesets lists the known rulesets, sorted
+func knownRulesets() []string {
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	list := []string{}
+	for name := range RulesetConfigs {
+		list = append(list, name)
+	}
+	for name := range rulesetRuleCount {
+		if _, ok := RulesetConfigs[name]; !ok {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
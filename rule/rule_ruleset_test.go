@@ -0,0 +1,90 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRulesetSelection(t *testing.T) {
+	nodes := []RuleNode{}
+	json.Unmarshal([]byte(`[{"name": "select_test_signup", "rulesets": ["select_test_signup"],
+		"rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "select_test.username"}]}, {"value": 4}]}},
+		{"name": "select_test_marketing", "rulesets": ["select_test_marketing"],
+		"rule": {"operator": "EQUAL_TO", "operands": [{"field": "select_test.consent"}, {"value": true}]}},
+		{"name": "select_test_common",
+		"rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "select_test.country"}]}, {"value": 1}]}}]`), &nodes)
+	for i := range nodes {
+		registerTestRule(t, &nodes[i])
+	}
+	validate := func(query string, header string) (int, FailResponseMsg) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/validation"+query,
+			strings.NewReader(`{"select_test": {"username": "bob", "consent": false, "country": "x"}}`))
+		if len(header) > 0 {
+			r.Header.Set(RulesetHeader, header)
+		}
+		ValidateJSONData(w, r)
+		res := FailResponseMsg{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		sort.Strings(res.Rules)
+		return w.Code, res
+	}
+	if _, res := validate("", ""); !reflect.DeepEqual(res.Rules, []string{"select_test_common"}) {
+		t.Errorf("expected only the common rules, got %v", res.Rules)
+	}
+	if _, res := validate("?ruleset=select_test_signup", ""); !reflect.DeepEqual(res.Rules, []string{"select_test_common", "select_test_signup"}) {
+		t.Errorf("expected the signup rules, got %v", res.Rules)
+	}
+	all := []string{"select_test_common", "select_test_marketing", "select_test_signup"}
+	if _, res := validate("?ruleset=select_test_signup,select_test_marketing", ""); !reflect.DeepEqual(res.Rules, all) {
+		t.Errorf("expected the rules of both rulesets, got %v", res.Rules)
+	}
+	if _, res := validate("", "select_test_marketing, select_test_signup"); !reflect.DeepEqual(res.Rules, all) {
+		t.Errorf("expected the rulesets of the header, got %v", res.Rules)
+	}
+	if _, res := validate("?ruleset=select_test_marketing", "select_test_signup"); !reflect.DeepEqual(res.Rules, []string{"select_test_common", "select_test_marketing"}) {
+		t.Errorf("expected the query to win over the header, got %v", res.Rules)
+	}
+	// the other validation endpoints select the rulesets the same way
+	batch := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/validation/batch",
+		strings.NewReader(`[{"select_test": {"username": "bob", "consent": false, "country": "x"}}]`))
+	r.Header.Set(RulesetHeader, "select_test_signup, select_test_marketing")
+	ValidateBatchData(batch, r)
+	res := BatchResponseMsg{}
+	json.Unmarshal(batch.Body.Bytes(), &res)
+	if len(res.Results) != 1 {
+		t.Fatalf("expected a batch result, got %s", batch.Body.String())
+	}
+	rules := res.Results[0].Rules
+	sort.Strings(rules)
+	if !reflect.DeepEqual(rules, all) {
+		t.Errorf("expected the rulesets of the header in the batch, got %v", rules)
+	}
+	if key := rulesetKey("select_test_signup,select_test_marketing"); key != "select_test_marketing,select_test_signup" {
+		t.Errorf("expected the reported list sorted, got %s", key)
+	}
+	for _, header := range []string{"select_test_signup,select_test_unknown", "select_test_signup,,select_test_marketing"} {
+		if code, res := validate("", header); code != http.StatusBadRequest || res.Result != ValidationStatusError {
+			t.Errorf("expected %q to be rejected, got %d %+v", header, code, res)
+		}
+	}
+
+	defer func(configs map[string]RulesetConfig) { RulesetConfigs = configs }(RulesetConfigs)
+	RulesetConfigs = map[string]RulesetConfig{"select_test_signup": {ZeroRulePolicy: ZeroRuleFail},
+		"select_test_marketing": {ZeroRulePolicy: ZeroRulePass, Strict: true, AllowedFields: []string{"select_test.extra"}}}
+	if policy := zeroRulePolicyOf("select_test_signup,select_test_marketing"); policy != ZeroRuleFail {
+		t.Errorf("expected the policy of the first ruleset, got %s", policy)
+	}
+	RegRuleLock.RLock()
+	config := rulesetConfigOf("select_test_signup,select_test_marketing")
+	RegRuleLock.RUnlock()
+	if !config.Strict || !reflect.DeepEqual(config.AllowedFields, []string{"select_test.extra"}) {
+		t.Errorf("expected the merged settings, got %+v", config)
+	}
+}
@@ -0,0 +1,556 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The sample documents of a ruleset are generated from the registry, for
+// the load tests and the contract tests of the downstream services,
+//   GET /admin/samples?ruleset=<ruleset>&count=10&seed=1
+//   validation samples [-ruleset=<ruleset>] [-count=10] [-seed=1]
+// The document skeleton is the exported constraints of the rules, the
+// enumerations, the regex patterns, the length and the number ranges,
+// and the document is then evaluated by the rules.  The fields of a
+// failed rule are retried with the candidates derived from the rule, its
+// literals, the lengths and the numbers around them, and its "pass"
+// examples.  The rules a document still fails are reported, as the rules
+// like a checksum aren't reverse-engineered.  The rules calling out by
+// LOOKUP are never evaluated on the generated documents, and reported
+// unsatisfied.
+
+// the maximum documents of one generation
+var MaxSampleCount = 1000
+
+const (
+	// the repair rounds of a generated document
+	sampleRepairRounds = 3
+	// the attempts to generate a value matching all the patterns
+	samplePatternAttempts = 20
+	// the characters of the generated strings
+	sampleAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// SampleReport is the generated documents, and the rules they fail
+type SampleReport struct {
+	Documents   []map[string]interface{} `json:"documents"`
+	Unsatisfied []string                 `json:"unsatisfied,omitempty"`
+}
+
+// sampleGenerator generates the documents of a ruleset by a seeded source
+type sampleGenerator struct {
+	rng     *rand.Rand
+	ruleset string
+	root    *exportNode
+	// the active rules of the ruleset, copied, by the rule name
+	entries map[string]*RuleEntry
+	// the names of the active rules using a remote operator, left out
+	remote []string
+	reg    ruleRegistry
+	// the candidate values by the field
+	candidates map[string][]interface{}
+}
+
+// newSampleGenerator snapshots the active rules of ruleset
+func newSampleGenerator(ruleset string, seed int64) *sampleGenerator {
+	g := &sampleGenerator{rng: rand.New(rand.NewSource(seed)), ruleset: ruleset, root: exportRules(ruleset),
+		entries: map[string]*RuleEntry{}, reg: newIsolatedRegistry(), candidates: map[string][]interface{}{}}
+	RegRuleLock.RLock()
+	for _, rules := range AllRegisteredRules {
+		for _, entry := range rules {
+			if !entry.applies(ruleset) || isPatchField(entry.Field) {
+				continue
+			}
+			if _, ok := usedOperator(entry.Rule, remoteOperators); ok {
+				g.remote = append(g.remote, entry.Name)
+				continue
+			}
+			// the state is guarded by the lock
+			copied := *entry
+			g.entries[entry.Name] = &copied
+		}
+	}
+	RegRuleLock.RUnlock()
+	sort.Strings(g.remote)
+
+	names := make([]string, 0, len(g.entries))
+	for name := range g.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := g.entries[name]
+		g.reg.add(entry)
+		for _, field := range entry.Fields {
+			if field != DocumentField {
+				// the fields without a constraint are in the skeleton too
+				g.root.node(field)
+			}
+		}
+		g.addCandidates(entry)
+	}
+	// the fields of a cross-field rule take the candidates of each other,
+	// e.g. "limit" the ones of "age" for GREATER_THAN(limit, age)
+	own := map[string][]interface{}{}
+	for field, values := range g.candidates {
+		own[field] = values
+	}
+	for _, name := range names {
+		fields := g.entries[name].Fields
+		for _, field := range fields {
+			for _, other := range fields {
+				if other != field && isPlainSamplePath(field) {
+					g.candidates[field] = append(g.candidates[field], own[other]...)
+				}
+			}
+		}
+	}
+	return g
+}
+
+// sampleValue converts a typed literal to the value of a document
+func sampleValue(v interface{}) interface{} {
+	if isNumber(v) {
+		data, _ := marshalCanonical(v, "")
+		return json.Number(data)
+	}
+	return v
+}
+
+// addCandidates collects the candidate values of the plain fields of the
+// rule, its literals, the numbers around them, the strings of the lengths
+// around them, and its "pass" examples of the primary field
+func (g *sampleGenerator) addCandidates(entry *RuleEntry) {
+	values := []interface{}{}
+	if entry.Examples != nil {
+		for _, example := range entry.Examples.Pass {
+			var v interface{}
+			if decodeJSONDocument(example, &v) == nil {
+				if _, isDocument := v.(map[string]interface{}); !isDocument {
+					g.candidates[entry.Field] = append(g.candidates[entry.Field], v)
+				}
+			}
+		}
+	}
+	walkOperands(entry.Rule, func(op Operand) {
+		v, ok := op.(*ValueOperand)
+		if !ok {
+			return
+		}
+		switch value := v.Value.(type) {
+		case string, bool, nil:
+			values = append(values, value)
+		}
+		if n, ok := lengthLiteral(op); ok {
+			for _, k := range []int64{n - 1, n, n + 1} {
+				values = append(values, json.Number(strconv.FormatInt(k, 10)))
+				if k >= 0 && k <= 1024 {
+					values = append(values, strings.Repeat("a", int(k)))
+				}
+			}
+		} else if isNumber(v.Value) {
+			values = append(values, sampleValue(v.Value))
+		}
+	})
+	for _, field := range entry.Fields {
+		if isPlainSamplePath(field) {
+			g.candidates[field] = append(g.candidates[field], values...)
+		}
+	}
+}
+
+// walkOperands calls fn for op and all its operands
+func walkOperands(op Operand, fn func(Operand)) {
+	fn(op)
+	if term, ok := op.(*TermOperand); ok {
+		for _, o := range term.OperandList {
+			walkOperands(o, fn)
+		}
+	}
+}
+
+// isPlainSamplePath reports the field is a path of the object members
+func isPlainSamplePath(field string) bool {
+	return field != DocumentField && !isWildcardPath(field) && !strings.ContainsAny(field, "[]") && !strings.Contains(field, "..")
+}
+
+// setSamplePath sets the value at the plain field path of doc
+func setSamplePath(doc map[string]interface{}, field string, v interface{}) {
+	names := strings.Split(field, ".")
+	for _, name := range names[:len(names)-1] {
+		child, ok := doc[name].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			doc[name] = child
+		}
+		doc = child
+	}
+	doc[names[len(names)-1]] = v
+}
+
+// cloneSample deep copies the generated value
+func cloneSample(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			copied[k] = cloneSample(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = cloneSample(item)
+		}
+		return copied
+	}
+	return v
+}
+
+// value generates the value of the constraints n
+func (g *sampleGenerator) value(n *exportNode) interface{} {
+	switch {
+	case n.properties != nil:
+		names := make([]string, 0, len(n.properties))
+		for name := range n.properties {
+			names = append(names, name)
+		}
+		// the source is consumed in a stable order for the seed
+		sort.Strings(names)
+		object := map[string]interface{}{}
+		for _, name := range names {
+			object[name] = g.value(n.properties[name])
+		}
+		return object
+	case n.items != nil:
+		items := make([]interface{}, 1+g.rng.Intn(3))
+		for i := range items {
+			items[i] = g.value(n.items)
+		}
+		return items
+	case len(n.enum) > 0:
+		return sampleValue(n.enum[g.rng.Intn(len(n.enum))])
+	case len(n.patterns) > 0:
+		return g.patternString(n)
+	case n.kind == "number":
+		return g.number(n)
+	}
+	return g.lengthString(n)
+}
+
+// lengthBounds returns the length range of the string of n
+func lengthBounds(n *exportNode) (int, int) {
+	low, high := 1, -1
+	if n.minLength != nil {
+		low = int(*n.minLength)
+	}
+	if n.maxLength != nil {
+		high = int(*n.maxLength)
+	}
+	if high < low {
+		high = low + 8
+	}
+	return low, high
+}
+
+// lengthString generates a string in the length range of n
+func (g *sampleGenerator) lengthString(n *exportNode) string {
+	low, high := lengthBounds(n)
+	b := make([]byte, low+g.rng.Intn(high-low+1))
+	for i := range b {
+		b[i] = sampleAlphabet[g.rng.Intn(len(sampleAlphabet))]
+	}
+	return string(b)
+}
+
+// patternString generates a string matching all the patterns of n, in its
+// length range, or the last attempt
+func (g *sampleGenerator) patternString(n *exportNode) string {
+	low, high := lengthBounds(n)
+	s := ""
+	for attempt := 0; attempt < samplePatternAttempts; attempt++ {
+		s = g.regexString(n.patterns[0])
+		if length := len([]rune(s)); length < low || (n.maxLength != nil && length > high) {
+			continue
+		}
+		matched := true
+		for _, pattern := range n.patterns[1:] {
+			if ok, err := regexp.MatchString(pattern, s); err != nil || !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			break
+		}
+	}
+	return s
+}
+
+// regexString generates a string matched by the pattern
+func (g *sampleGenerator) regexString(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	g.writeRegex(&b, re.Simplify())
+	return b.String()
+}
+
+func (g *sampleGenerator) writeRegex(b *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(g.classRune(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte(sampleAlphabet[g.rng.Intn(len(sampleAlphabet))])
+	case syntax.OpCapture:
+		g.writeRegex(b, re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, 3
+		case syntax.OpPlus:
+			min, max = 1, 3
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < min {
+			max = min + 3
+		}
+		for i := min + g.rng.Intn(max-min+1); i > 0; i-- {
+			g.writeRegex(b, re.Sub[0])
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			g.writeRegex(b, sub)
+		}
+	case syntax.OpAlternate:
+		g.writeRegex(b, re.Sub[g.rng.Intn(len(re.Sub))])
+	}
+}
+
+// classRune picks a rune of the character class ranges, a printable ASCII
+// one when the class has any
+func (g *sampleGenerator) classRune(ranges []rune) rune {
+	if len(ranges) == 0 {
+		return 'a'
+	}
+	printable := func(i int) (rune, rune) {
+		lo, hi := ranges[i], ranges[i+1]
+		if lo < '!' {
+			lo = '!'
+		}
+		if hi > '~' {
+			hi = '~'
+		}
+		return lo, hi
+	}
+	total := 0
+	for i := 0; i < len(ranges); i += 2 {
+		if lo, hi := printable(i); lo <= hi {
+			total += int(hi-lo) + 1
+		}
+	}
+	if total == 0 {
+		return ranges[0]
+	}
+	k := g.rng.Intn(total)
+	for i := 0; i < len(ranges); i += 2 {
+		lo, hi := printable(i)
+		if lo > hi {
+			continue
+		}
+		if k <= int(hi-lo) {
+			return lo + rune(k)
+		}
+		k -= int(hi-lo) + 1
+	}
+	return ranges[0]
+}
+
+// boundFloat returns the number bound as a float64
+func boundFloat(v interface{}) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	data, err := marshalCanonical(v, "")
+	if err != nil {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	return f, err == nil
+}
+
+// number generates an integer in the number range of n, or the lower
+// bound when the range has no integer
+func (g *sampleGenerator) number(n *exportNode) json.Number {
+	low, hasLow := boundFloat(n.minimum)
+	if excl, ok := boundFloat(n.exclusiveMinimum); ok && (!hasLow || excl >= low) {
+		low, hasLow = math.Floor(excl)+1, true
+	}
+	high, hasHigh := boundFloat(n.maximum)
+	switch {
+	case !hasLow && !hasHigh:
+		low, high = 0, 100
+	case !hasLow:
+		low = high - 100
+	case !hasHigh:
+		high = low + 100
+	}
+	lo, hi := int64(math.Ceil(low)), int64(math.Floor(high))
+	if hi < lo {
+		return json.Number(strconv.FormatFloat(low, 'f', -1, 64))
+	}
+	return json.Number(strconv.FormatInt(lo+g.rng.Int63n(hi-lo+1), 10))
+}
+
+// failedRules returns the names of the rules doc fails, sorted, or an
+// error when the evaluation fails
+func (g *sampleGenerator) failedRules(doc map[string]interface{}) ([]string, error) {
+	result, err := g.reg.validateIsolated(doc, g.ruleset)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	failed := []string{}
+	for _, name := range result.rules {
+		if !seen[name] {
+			seen[name] = true
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed, nil
+}
+
+// fewerFailures reports the failures of a trial are fewer than the
+// current ones, an evaluation error is the most
+func fewerFailures(trial []string, trialErr error, current []string, currentErr error) bool {
+	if trialErr != nil {
+		return false
+	}
+	return currentErr != nil || len(trial) < len(current)
+}
+
+// document generates a document, and returns the rules it still fails
+func (g *sampleGenerator) document() (map[string]interface{}, []string) {
+	doc, ok := g.value(g.root).(map[string]interface{})
+	if !ok {
+		doc = map[string]interface{}{}
+	}
+	failed, err := g.failedRules(doc)
+	for round := 0; round < sampleRepairRounds && (err != nil || len(failed) > 0); round++ {
+		targets := failed
+		if err != nil {
+			// all the rules are suspected
+			targets = make([]string, 0, len(g.entries))
+			for name := range g.entries {
+				targets = append(targets, name)
+			}
+			sort.Strings(targets)
+		}
+		for _, name := range targets {
+			for _, field := range g.entries[name].Fields {
+				for _, candidate := range g.candidates[field] {
+					trial := cloneSample(doc).(map[string]interface{})
+					setSamplePath(trial, field, cloneSample(candidate))
+					trialFailed, trialErr := g.failedRules(trial)
+					if fewerFailures(trialFailed, trialErr, failed, err) {
+						doc, failed, err = trial, trialFailed, nil
+						break
+					}
+				}
+			}
+		}
+	}
+	if err != nil {
+		return doc, []string{err.Error()}
+	}
+	return doc, failed
+}
+
+// GenerateSamples generates count documents of the active rules in
+// ruleset by the seed, the same seed generates the same documents
+func GenerateSamples(ruleset string, count int, seed int64) (*SampleReport, error) {
+	if err := CheckRuleset(ruleset); err != nil {
+		return nil, err
+	}
+	if count < 1 || count > MaxSampleCount {
+		return nil, fmt.Errorf("samples: count, %d, is not in [1, %d]", count, MaxSampleCount)
+	}
+	g := newSampleGenerator(ruleset, seed)
+	report := &SampleReport{Documents: []map[string]interface{}{}}
+	unsatisfied := map[string]bool{}
+	for _, name := range g.remote {
+		unsatisfied[name] = true
+	}
+	for i := 0; i < count; i++ {
+		doc, failed := g.document()
+		report.Documents = append(report.Documents, doc)
+		for _, name := range failed {
+			unsatisfied[name] = true
+		}
+	}
+	for name := range unsatisfied {
+		report.Unsatisfied = append(report.Unsatisfied, name)
+	}
+	sort.Strings(report.Unsatisfied)
+	return report, nil
+}
+
+// sampleQuery parses the count and the seed of the samples request, 1 and
+// 0 by default
+func sampleQuery(r *http.Request) (count int, seed int64, err error) {
+	count = 1
+	if s := r.URL.Query().Get("count"); len(s) > 0 {
+		if count, err = strconv.Atoi(s); err != nil {
+			return 0, 0, fmt.Errorf("samples: invalid count, %s", s)
+		}
+	}
+	if s := r.URL.Query().Get("seed"); len(s) > 0 {
+		if seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("samples: invalid seed, %s", s)
+		}
+	}
+	return count, seed, nil
+}
+
+// GET /admin/samples?ruleset=<ruleset>&count=10&seed=1 service
+// implementation
+func GetSamples(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ruleset := r.URL.Query().Get("ruleset")
+	if err := CheckRuleset(ruleset); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	count, seed, err := sampleQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	report, err := GenerateSamples(ruleset, count, seed)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(report)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,83 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGenerateSamples(t *testing.T) {
+	for _, data := range []string{
+		`{"name": "samples_test_zip", "rulesets": ["samples_test"], "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}(-[0-9]{4})?$"}, {"field": "samples_test.zip"}]}}`,
+		`{"name": "samples_test_plan", "rulesets": ["samples_test"], "expression": "samples_test.plan == 'free' or samples_test.plan == 'pro'"}`,
+		`{"name": "samples_test_age", "rulesets": ["samples_test"], "rule": {"operator": "BETWEEN", "operands": [{"field": "samples_test.age"}, {"value": 18}, {"value": 130}]}}`,
+		`{"name": "samples_test_password", "rulesets": ["samples_test"], "expression": "length(samples_test.password) == 0 or length(samples_test.password) > 12"}`,
+		`{"name": "samples_test_limit", "rulesets": ["samples_test"], "expression": "samples_test.limit > samples_test.age"}`,
+	} {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(data), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	report, err := GenerateSamples("samples_test", 5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Documents) != 5 || len(report.Unsatisfied) > 0 {
+		t.Fatalf("expected 5 documents satisfying the rules, got %d, unsatisfied %v", len(report.Documents), report.Unsatisfied)
+	}
+	for _, doc := range report.Documents {
+		result, err := ValidateInputJSONByRules("samples_test", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.flag {
+			t.Errorf("expected the document to pass, %v fails %v", doc, result.rules)
+		}
+	}
+	again, _ := GenerateSamples("samples_test", 5, 7)
+	if !reflect.DeepEqual(report, again) {
+		t.Errorf("expected the same documents of the same seed")
+	}
+	if _, err := GenerateSamples("samples_test", 0, 7); err == nil {
+		t.Errorf("expected the count 0 to fail")
+	}
+}
+
+func TestGenerateSamplesLookup(t *testing.T) {
+	calls := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+	defer func(prefixes []string) { LookupAllowedURLPrefixes = prefixes }(LookupAllowedURLPrefixes)
+	LookupAllowedURLPrefixes = []string{server.URL + "/"}
+
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "samples_test_code", "rulesets": ["samples_test_lookup"],
+		"rule": {"operator": "LOOKUP", "operands": [{"value": "`+server.URL+`/codes/{value}"}, {"field": "samples_test_code"}]}}`), &node)
+	registerTestRule(t, &node)
+
+	report, err := GenerateSamples("samples_test_lookup", 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Unsatisfied, []string{"samples_test_code"}) {
+		t.Errorf("expected the lookup rule to be unsatisfied, got %v", report.Unsatisfied)
+	}
+	negative, err := GenerateNegativeSamples("samples_test_lookup", "samples_test_code", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(negative.Unviolated, []string{"samples_test_code"}) {
+		t.Errorf("expected the lookup rule to be unviolated, got %v", negative.Unviolated)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("expected no lookup call, got %d", n)
+	}
+}
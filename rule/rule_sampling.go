@@ -0,0 +1,81 @@
+package rule
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// The probabilistic decisions, e.g. the quarantine sampling, are made by
+// the hash of the sampling key, the input field SamplingKeyField, so an
+// entity lands in the same bucket on every replica and after a restart.
+// SamplingSeed reshuffles the buckets, the replicas must share it.  An
+// input without the key is sampled by the hash of its canonical document,
+// so a retried input gets the same decision.
+var (
+	SamplingSeed     = ""
+	SamplingKeyField = ""
+)
+
+// samplingBucket maps the key to [0, 1) by the seeded hash, the purpose,
+// e.g. "quarantine/phone_pattern", makes the decisions of the purposes
+// independent of each other
+func samplingBucket(seed string, purpose string, key string) float64 {
+	h := sha256.New()
+	for _, s := range []string{seed, purpose, key} {
+		// length prefixed, "a"+"bc" and "ab"+"c" don't collide
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+		h.Write(n[:])
+		h.Write([]byte(s))
+	}
+	sum := h.Sum(nil)
+	// the top 53 bits, the precision of a float64
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
+
+// samplingKey returns the sampling key of the input fields, the value of
+// keyField
+func samplingKey(keyField string, fields map[string]interface{}) (string, bool) {
+	if len(keyField) == 0 || fields == nil {
+		return "", false
+	}
+	value, ok := fields[keyField]
+	if !ok || value == nil {
+		return "", false
+	}
+	return fieldText(value), true
+}
+
+// sampleInput decides the purpose at rate (0.0 to 1.0) for the input fields,
+// by the sampling key when the input has it
+func sampleInput(purpose string, fields map[string]interface{}, rate float64) bool {
+	return sampleInputBy(purpose, SamplingKeyField, fields, rate)
+}
+
+// canonicalSamplingKey returns the key of the input fields without the
+// sampling key, their JSON with the sorted field names
+func canonicalSamplingKey(fields map[string]interface{}) string {
+	if data, err := json.Marshal(fields); err == nil {
+		return string(data)
+	}
+	// fmt sorts the map keys too
+	return fmt.Sprint(fields)
+}
+
+// sampleInputBy decides the purpose at rate by the hash of the input field
+// keyField, or of the canonical input without it
+func sampleInputBy(purpose string, keyField string, fields map[string]interface{}, rate float64) bool {
+	switch {
+	case rate <= 0:
+		return false
+	case rate >= 1:
+		return true
+	}
+	key, ok := samplingKey(keyField, fields)
+	if !ok {
+		key = canonicalSamplingKey(fields)
+	}
+	return samplingBucket(SamplingSeed, purpose, key) < rate
+}
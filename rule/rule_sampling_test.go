@@ -0,0 +1,58 @@
+package rule
+
+import (
+	"testing"
+)
+
+func TestSampledByKey(t *testing.T) {
+	defer func(seed, key string) { SamplingSeed, SamplingKeyField = seed, key }(SamplingSeed, SamplingKeyField)
+	SamplingKeyField = "user_id"
+
+	hits := 0
+	for i := 0; i < 1000; i++ {
+		fields := map[string]interface{}{"user_id": int64(i)}
+		first := sampleInput("quarantine/phone_pattern", fields, 0.3)
+		for j := 0; j < 3; j++ {
+			if sampleInput("quarantine/phone_pattern", fields, 0.3) != first {
+				t.Fatalf("user_id %d: expected the same decision", i)
+			}
+		}
+		if first {
+			hits++
+		}
+	}
+	if hits < 250 || hits > 350 {
+		t.Errorf("expected about 300 of 1000 keys sampled at 0.3, got %d", hits)
+	}
+
+	a := samplingBucket("", "quarantine/phone_pattern", "42")
+	if b := samplingBucket("", "quarantine/phone_pattern", "42"); a != b {
+		t.Errorf("expected a stable bucket, got %v and %v", a, b)
+	}
+	if b := samplingBucket("reshuffled", "quarantine/phone_pattern", "42"); a == b {
+		t.Errorf("expected the seed to move the bucket, got %v", b)
+	}
+	if b := samplingBucket("", "quarantine/zip_code_pattern", "42"); a == b {
+		t.Errorf("expected the purposes independent, got %v", b)
+	}
+	if sampleInput("quarantine/phone_pattern", map[string]interface{}{"user_id": "1"}, 0) ||
+		!sampleInput("quarantine/phone_pattern", map[string]interface{}{"user_id": "1"}, 1) {
+		t.Errorf("expected rate 0 never and rate 1 always sampled")
+	}
+
+	// without the key, the same document gets the same decision
+	hits = 0
+	for i := 0; i < 1000; i++ {
+		fields := map[string]interface{}{"order_id": int64(i), "zip": "9006"}
+		first := sampleInput("quarantine/phone_pattern", fields, 0.3)
+		if sampleInput("quarantine/phone_pattern", map[string]interface{}{"zip": "9006", "order_id": int64(i)}, 0.3) != first {
+			t.Fatalf("order_id %d: expected the same decision", i)
+		}
+		if first {
+			hits++
+		}
+	}
+	if hits < 250 || hits > 350 {
+		t.Errorf("expected about 300 of 1000 documents sampled at 0.3, got %d", hits)
+	}
+}
@@ -0,0 +1,103 @@
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// semver 2.0.0 pattern, https://semver.org
+//   MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD]
+var semverPattern = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)` +
+	`(?:-((?:0|[1-9][0-9]*|[0-9]*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9][0-9]*|[0-9]*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// semanticVersion keeps the parsed version parts used for the precedence
+// comparison.  The build metadata is ignored in the precedence.
+type semanticVersion struct {
+	major, minor, patch uint64
+	preRelease          []string
+}
+
+// parseSemver parses a semantic version string, e.g. "1.10.0-rc.1+build.5"
+func parseSemver(s string) (*semanticVersion, error) {
+	m := semverPattern.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("rule operator: invalid semantic version, %s", s)
+	}
+
+	v := semanticVersion{}
+	var err error
+	if v.major, err = strconv.ParseUint(m[1], 10, 64); err != nil {
+		return nil, err
+	}
+	if v.minor, err = strconv.ParseUint(m[2], 10, 64); err != nil {
+		return nil, err
+	}
+	if v.patch, err = strconv.ParseUint(m[3], 10, 64); err != nil {
+		return nil, err
+	}
+	if len(m[4]) > 0 {
+		v.preRelease = strings.Split(m[4], ".")
+	}
+	return &v, nil
+}
+
+// compare returns -1, 0, +1 when v is lower, equal or higher than o
+// in the semver precedence.
+func (v *semanticVersion) compare(o *semanticVersion) int {
+	if c := compareUint(v.major, o.major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.minor, o.minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.patch, o.patch); c != 0 {
+		return c
+	}
+
+	// a normal version has the higher precedence than a pre-release version
+	switch {
+	case len(v.preRelease) == 0 && len(o.preRelease) == 0:
+		return 0
+	case len(v.preRelease) == 0:
+		return 1
+	case len(o.preRelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.preRelease) && i < len(o.preRelease); i++ {
+		if c := comparePreReleaseIdentifier(v.preRelease[i], o.preRelease[i]); c != 0 {
+			return c
+		}
+	}
+	// a larger set of pre-release fields has the higher precedence
+	return compareUint(uint64(len(v.preRelease)), uint64(len(o.preRelease)))
+}
+
+// numeric identifiers are compared numerically, and always have lower
+// precedence than the alphanumeric identifiers compared in ASCII order
+func comparePreReleaseIdentifier(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return compareUint(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,31 @@
+package rule
+
+import "testing"
+
+func TestSemverOperators(t *testing.T) {
+	for v, expected := range map[string]bool{"1.10.0": true, "1.0.0-rc.1+build.5": true, "1.0": false, "01.0.0": false, "v1.0.0": false} {
+		if res, err := RegisteredOperators[IsSemverOperator]([]interface{}{v}); err != nil || res != expected {
+			t.Errorf("IS_SEMVER(%s): expected %v, got %v %v", v, expected, res, err)
+		}
+	}
+	// the semver.org precedence examples, the build metadata is ignored
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.2.0", "1.10.0"}
+	for i := 1; i < len(ordered); i++ {
+		if res, err := RegisteredOperators[SemverGreaterThanOperator]([]interface{}{ordered[i], ordered[i-1]}); err != nil || res != true {
+			t.Errorf("%s > %s: expected true, got %v %v", ordered[i], ordered[i-1], res, err)
+		}
+		if res, _ := RegisteredOperators[SemverGreaterThanOperator]([]interface{}{ordered[i-1], ordered[i]}); res != false {
+			t.Errorf("%s > %s: expected false", ordered[i-1], ordered[i])
+		}
+	}
+	if res, err := RegisteredOperators[SemverGreaterThanOperator]([]interface{}{"1.0.0+build.2", "1.0.0+build.1"}); err != nil || res != false {
+		t.Errorf("expected the build metadata ignored, got %v %v", res, err)
+	}
+	// an invalid field value is false, an invalid literal is an error
+	if res, err := RegisteredOperators[SemverGreaterThanOperator]([]interface{}{"latest", "1.0.0"}); err != nil || res != false {
+		t.Errorf("expected an invalid version false, got %v %v", res, err)
+	}
+	if _, err := RegisteredOperators[SemverGreaterThanOperator]([]interface{}{"1.0.0", "latest"}); err == nil {
+		t.Error("expected an invalid literal version rejected")
+	}
+}
@@ -0,0 +1,162 @@
+package rule
+
+import (
+	"fmt"
+)
+
+// ValueType is the type of an operand value in the operator signature
+type ValueType string
+
+const (
+	TypeString ValueType = "string"
+	TypeNumber ValueType = "number"
+	TypeBool   ValueType = "bool"
+	TypeArray  ValueType = "array"
+	// the whole input document, the field target $document
+	TypeDocument ValueType = "document"
+	// a field reference rather than its value, e.g. OLD(price)
+	TypeField ValueType = "field"
+	TypeAny   ValueType = "any"
+)
+
+// OperatorSignature is the operator metadata to typecheck a rule when it
+// is parsed, instead of failing at the evaluation time.
+// OperandTypes lists the expected type per operand position, the last
+// type applies to the rest operands.  MaxOperands -1 is unbounded.
+type OperatorSignature struct {
+	MinOperands  int
+	MaxOperands  int
+	OperandTypes []ValueType
+	ResultType   ValueType
+	Description  string
+}
+
+// all registered operator signatures, an operator without the signature
+// is not typechecked
+var OperatorSignatures = map[OperatorType]OperatorSignature{
+	LengthOperator:            {1, 1, []ValueType{TypeString}, TypeNumber, "length of a string"},
+	EqualToOperator:           {2, 3, []ValueType{TypeAny, TypeAny, TypeNumber}, TypeBool, "two values are equal, as numbers within the optional epsilon"},
+	GreaterThanOperator:       {2, 3, []ValueType{TypeNumber}, TypeBool, "number is greater than the other, with the optional epsilon"},
+	OrOperator:                {2, 2, []ValueType{TypeBool}, TypeBool, "logic OR of two bool values"},
+	AndOperator:               {2, 2, []ValueType{TypeBool}, TypeBool, "logic AND of two bool values"},
+	MatchesOperator:           {2, 2, []ValueType{TypeString}, TypeBool, "regex pattern matches a string"},
+	IsSemverOperator:          {1, 1, []ValueType{TypeString}, TypeBool, "string is a semantic version"},
+	SemverGreaterThanOperator: {2, 2, []ValueType{TypeString}, TypeBool, "semantic version is greater than the other"},
+	Sha256EqualsOperator:      {2, 2, []ValueType{TypeString}, TypeBool, "SHA-256 of a string equals the hex digest"},
+	Crc32EqualsOperator:       {2, 2, []ValueType{TypeString}, TypeBool, "CRC-32 of a string equals the hex checksum"},
+	LookupOperator:            {2, 2, []ValueType{TypeString}, TypeBool, "external HTTP endpoint (URL template) answers 200 for the value"},
+	UniqueInScopeOperator:     {3, 3, []ValueType{TypeString, TypeString, TypeAny}, TypeBool, "value is not seen in the scope within the TTL, and is recorded"},
+	InDictionaryOperator:      {2, 2, []ValueType{TypeString}, TypeBool, "value is in the named word list"},
+	NotInBlocklistOperator:    {2, 2, []ValueType{TypeString}, TypeBool, "value is not in the named word list"},
+	IsTimezoneOperator:        {1, 1, []ValueType{TypeString}, TypeBool, "string is an IANA time zone name"},
+	BetweenOperator:           {3, 3, []ValueType{TypeNumber}, TypeBool, "number is in the inclusive range"},
+	RegexExtractOperator:      {2, 2, []ValueType{TypeString}, TypeString, "substring captured by a regex pattern with one capture group"},
+	DateFormatOperator:        {2, 2, []ValueType{TypeString}, TypeBool, "string parses with the Go time layout"},
+	ContentTypeIsOperator:     {2, -1, []ValueType{TypeString}, TypeBool, "sniffed MIME type of a base64 payload is one of the media types"},
+	IfOperator:                {2, 3, []ValueType{TypeBool}, TypeBool, "then branch when the condition is true, otherwise the else branch or true"},
+	RequiredOperator:          {1, 1, []ValueType{TypeAny}, TypeBool, "field is present in the input, the rule fails when it is absent"},
+	FieldCountOperator:        {1, 1, []ValueType{TypeDocument}, TypeNumber, "number of the fields in the document"},
+	HasFieldOperator:          {2, 2, []ValueType{TypeDocument, TypeString}, TypeBool, "document has the field, or the object or array block at the path"},
+	DocumentDepthOperator:     {1, 1, []ValueType{TypeDocument}, TypeNumber, "nesting depth of the document, 1 for the root fields"},
+	DocumentLengthOperator:    {1, 1, []ValueType{TypeDocument}, TypeNumber, "total characters of the field values in the document"},
+	RequiredIfOperator:        {3, 3, []ValueType{TypeDocument, TypeString, TypeBool}, TypeBool, "document has the field when the condition is true"},
+	ForbiddenIfOperator:       {3, 3, []ValueType{TypeDocument, TypeString, TypeBool}, TypeBool, "document doesn't have the field when the condition is true"},
+	OldOperator:               {1, 1, []ValueType{TypeField}, TypeAny, "value of the field in the old version of the document"},
+	ChangedOperator:           {1, 1, []ValueType{TypeField}, TypeBool, "field value differs from the old version of the document"},
+	ChangePercentOperator:     {1, 1, []ValueType{TypeField}, TypeNumber, "change of the number from the old version of the document, in percent"},
+	ExactlyOneOfOperator:      {3, -1, []ValueType{TypeDocument, TypeString}, TypeBool, "document has exactly one of the fields"},
+	AtMostOneOfOperator:       {3, -1, []ValueType{TypeDocument, TypeString}, TypeBool, "document has at most one of the fields"},
+	SumOperator:               {2, 2, []ValueType{TypeDocument, TypeString}, TypeNumber, "sum of the numbers at the (wildcard) path of the document"},
+	MinOperator:               {2, 2, []ValueType{TypeDocument, TypeString}, TypeNumber, "lowest number at the (wildcard) path of the document"},
+	MaxOperator:               {2, 2, []ValueType{TypeDocument, TypeString}, TypeNumber, "highest number at the (wildcard) path of the document"},
+	CountOperator:             {2, 2, []ValueType{TypeDocument, TypeString}, TypeNumber, "number of the non-null fields at the (wildcard) path of the document"},
+	DateAfterOperator:         {2, 2, []ValueType{TypeString}, TypeBool, "RFC 3339 timestamp or date is after the other"},
+}
+
+// checkArity checks the operand count of the operator
+func (sig OperatorSignature) checkArity(operator string, count int) error {
+	if count < sig.MinOperands || (sig.MaxOperands >= 0 && count > sig.MaxOperands) {
+		if sig.MinOperands == sig.MaxOperands {
+			return fmt.Errorf("rule parser: operator %s expects %d operands, got %d", operator, sig.MinOperands, count)
+		}
+		return fmt.Errorf("rule parser: operator %s expects %d to %d operands, got %d", operator, sig.MinOperands, sig.MaxOperands, count)
+	}
+	return nil
+}
+
+// operandType returns the expected type of the i-th operand
+func (sig OperatorSignature) operandType(i int) ValueType {
+	if len(sig.OperandTypes) == 0 {
+		return TypeAny
+	}
+	if i >= len(sig.OperandTypes) {
+		return sig.OperandTypes[len(sig.OperandTypes)-1]
+	}
+	return sig.OperandTypes[i]
+}
+
+// accepts checks a value of type got can be the operand of type want.
+// A string is accepted as a number, a numeric string field value or
+// literal is parsed by the numeric operators.
+func (want ValueType) accepts(got ValueType) bool {
+	switch {
+	case want == TypeAny || got == TypeAny || want == got:
+		return true
+	case want == TypeNumber && got == TypeString:
+		return true
+	}
+	return false
+}
+
+// resultType infers the value type of an evaluated operand
+func resultType(op Operand) ValueType {
+	switch v := op.(type) {
+	case *FieldOperand:
+		if v.Name == DocumentField {
+			return TypeDocument
+		}
+		// a field value has the JSON type of the input
+		return TypeAny
+	case *ValueOperand:
+		return literalType(v.Value)
+	case *TermOperand:
+		if sig, ok := OperatorSignatures[OperatorType(v.ParseOperator)]; ok {
+			return sig.ResultType
+		}
+	}
+	return TypeAny
+}
+
+// checkRuleResult checks the root operand of the rule evaluates to bool,
+// e.g. a bare field or a LENGTH is not a rule.  An operator of any result,
+// like IF, is checked at the evaluation.
+func checkRuleResult(ruleName string, op Operand) error {
+	got := resultType(op)
+	if _, ok := op.(*TermOperand); ok && (got == TypeBool || got == TypeAny) {
+		return nil
+	}
+	return fmt.Errorf("%w, rule name, %s, evaluates to %s", ParseRuleResultTypeError, ruleName, got)
+}
+
+// typecheckTerm checks the constructed operands of t against its operator signature
+func typecheckTerm(t *TermOperand) error {
+	sig, ok := OperatorSignatures[OperatorType(t.ParseOperator)]
+	if !ok {
+		return nil
+	}
+	if err := sig.checkArity(t.ParseOperator, len(t.OperandList)); err != nil {
+		return err
+	}
+	for i, o := range t.OperandList {
+		if sig.operandType(i) == TypeField {
+			if _, ok := o.(*FieldOperand); !ok {
+				return fmt.Errorf("rule parser: operator %s operand %d expects a field", t.ParseOperator, i)
+			}
+			continue
+		}
+		if want, got := sig.operandType(i), resultType(o); !want.accepts(got) {
+			return fmt.Errorf("rule parser: operator %s operand %d expects %s, got %s", t.ParseOperator, i, want, got)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOperatorSignatures(t *testing.T) {
+	for _, tc := range []struct {
+		rule string
+		err  string
+	}{
+		{`{"operator": "LENGTH", "operands": [{"field": "a"}, {"field": "b"}]}`, "operator LENGTH expects 1 operands, got 2"},
+		{`{"operator": "BETWEEN", "operands": [{"field": "a"}, {"value": 1}]}`, "operator BETWEEN expects 3 operands, got 2"},
+		{`{"operator": "GREATER_THAN", "operands": [{"operator": "IS_SEMVER", "operands": [{"field": "a"}]}, {"value": 1}]}`, "operator GREATER_THAN operand 0 expects number, got bool"},
+		{`{"operator": "LENGTH", "operands": [{"value": true}]}`, "expects"},
+		{`{"operator": "IS_TIMEZONE", "operands": [{"field": "a"}]}`, ""},
+		// a numeric string is accepted as a number
+		{`{"operator": "GREATER_THAN", "operands": [{"field": "a"}, {"value": "10"}]}`, ""},
+	} {
+		term := Term{}
+		err := json.Unmarshal([]byte(tc.rule), &term)
+		if err == nil {
+			_, err = ConstructOperandListHelper(&term, map[string]int{})
+		}
+		if len(tc.err) == 0 && err != nil {
+			t.Errorf("%s: expected the rule to typecheck, got %v", tc.rule, err)
+		} else if len(tc.err) > 0 && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: expected %q, got %v", tc.rule, tc.err, err)
+		}
+	}
+}
+
+func TestRuleResultType(t *testing.T) {
+	router := Handlers()
+	for _, rule := range []string{
+		`{"name": "result_test_length", "rule": {"operator": "LENGTH", "operands": [{"field": "result_test"}]}}`,
+		`{"name": "result_test_field", "expression": "result_test"}`,
+		`{"name": "result_test_dsl", "expression": "length(result_test)"}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/rule", strings.NewReader(rule)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "doesn't evaluate to bool") {
+			t.Errorf("%s: expected 400, got %d %s", rule, w.Code, w.Body.String())
+		}
+	}
+
+	// an operator of any result, e.g. OLD, is checked at the evaluation
+	ctx := FieldEvalContext{RuleID: "result_test", RuleName: "result_test", Field: "result_test", FieldValue: "x",
+		Rule: &ValueOperand{Value: int64(1)}}
+	if _, err := evaluateRule(&ctx); !errors.Is(err, EvalResultTypeError) {
+		t.Errorf("expected the evaluation error, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package rule
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// RuleCounter keeps the evaluation statistics of one rule
+type RuleCounter struct {
+	Name          string    `json:"name"`
+	Evaluations   uint64    `json:"evaluations"`
+	Failures      uint64    `json:"failures"`
+	Errors        uint64    `json:"errors"`
+	Unenforced    uint64    `json:"unenforced,omitempty"`
+	LastEvaluated time.Time `json:"last-evaluated"`
+}
+
+// CounterStore persists the per-rule counters, ruleID => RuleCounter,
+// so the statistics survive the service restarts
+type CounterStore interface {
+	Load() (map[string]RuleCounter, error)
+	Save(map[string]RuleCounter) error
+}
+
+// FileCounterStore saves the counters in a JSON file
+type FileCounterStore struct {
+	Path string
+}
+
+func (s *FileCounterStore) Load() (map[string]RuleCounter, error) {
+	counters := map[string]RuleCounter{}
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		// first start, nothing saved yet
+		return counters, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+func (s *FileCounterStore) Save(counters map[string]RuleCounter) error {
+	data, err := json.Marshal(counters)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file, then rename to keep the saved file intact
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+var ruleCounters = map[string]*RuleCounter{}
+var ruleCounterLock = sync.Mutex{}
+
+// set when the counters are persisted by StartRuleCounterFlush()
+var counterStoreEnabled = false
+
+// recordRuleEvaluation counts one evaluation result of the rule
+func recordRuleEvaluation(ruleID string, ruleName string, pass bool, err error) {
+	recordRuleMetrics(pass, err)
+
+	ruleCounterLock.Lock()
+	defer ruleCounterLock.Unlock()
+
+	c, ok := ruleCounters[ruleID]
+	if !ok {
+		c = &RuleCounter{}
+		ruleCounters[ruleID] = c
+	}
+	// keep the current name of a renamed rule
+	c.Name = ruleName
+	c.Evaluations++
+	if err != nil {
+		c.Errors++
+	} else if !pass {
+		c.Failures++
+	}
+	c.LastEvaluated = time.Now()
+}
+
+// mergeRuleCounters folds the counters of the rule fromID into the rule
+// toID, e.g. when the duplicate rule fromID is merged
+func mergeRuleCounters(toID string, fromID string) {
+	ruleCounterLock.Lock()
+	defer ruleCounterLock.Unlock()
+
+	from, ok := ruleCounters[fromID]
+	if !ok {
+		return
+	}
+	delete(ruleCounters, fromID)
+	to, ok := ruleCounters[toID]
+	if !ok {
+		to = &RuleCounter{Name: from.Name}
+		ruleCounters[toID] = to
+	}
+	to.Evaluations += from.Evaluations
+	to.Failures += from.Failures
+	to.Errors += from.Errors
+	if from.LastEvaluated.After(to.LastEvaluated) {
+		to.LastEvaluated = from.LastEvaluated
+	}
+}
+
+// GetRuleCounters returns a snapshot of all per-rule counters, by the rule ID
+func GetRuleCounters() map[string]RuleCounter {
+	ruleCounterLock.Lock()
+	defer ruleCounterLock.Unlock()
+
+	snapshot := make(map[string]RuleCounter, len(ruleCounters))
+	for name, c := range ruleCounters {
+		snapshot[name] = *c
+	}
+	return snapshot
+}
+
+// StartRuleCounterFlush restores the counters saved in store, then flushes
+// the counters into store every interval in background, until the returned
+// stop is called, which flushes them a last time
+func StartRuleCounterFlush(store CounterStore, interval time.Duration) (stop func(), err error) {
+	store = chaosCounterStore{store}
+	saved, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	ruleCounterLock.Lock()
+	for id, c := range saved {
+		if current, ok := ruleCounters[id]; ok {
+			// merge what is counted before the restore
+			current.Evaluations += c.Evaluations
+			current.Failures += c.Failures
+			current.Errors += c.Errors
+			current.Unenforced += c.Unenforced
+		} else {
+			restored := c
+			ruleCounters[id] = &restored
+		}
+	}
+	ruleCounterLock.Unlock()
+	counterStoreEnabled = true
+
+	flush := func() {
+		if err := store.Save(GetRuleCounters()); err != nil {
+			log.Printf("rule counter flush error, %s", err.Error())
+		}
+	}
+	ticker := time.NewTicker(interval)
+	done, flushed := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(flushed)
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case <-done:
+				ticker.Stop()
+				flush()
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-flushed
+		})
+	}, nil
+}
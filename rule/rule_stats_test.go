@@ -0,0 +1,64 @@
+package rule
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryCounterStore keeps the saved counters, and counts the saves
+type memoryCounterStore struct {
+	lock  sync.Mutex
+	saved map[string]RuleCounter
+	saves int
+}
+
+func (s *memoryCounterStore) Load() (map[string]RuleCounter, error) {
+	return map[string]RuleCounter{}, nil
+}
+
+func (s *memoryCounterStore) Save(counters map[string]RuleCounter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.saved, s.saves = counters, s.saves+1
+	return nil
+}
+
+func TestRuleCounterFlushStop(t *testing.T) {
+	defer func(enabled bool) { counterStoreEnabled = enabled }(counterStoreEnabled)
+	store := &memoryCounterStore{}
+	// no tick within the test, the stop flushes
+	stop, err := StartRuleCounterFlush(store, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	store.lock.Lock()
+	saves := store.saves
+	store.lock.Unlock()
+	if saves != 1 {
+		t.Errorf("expected the counters flushed by the stop, got %d saves", saves)
+	}
+	// stopping twice doesn't flush again
+	stop()
+	if store.saves != 1 {
+		t.Errorf("expected one flush, got %d", store.saves)
+	}
+}
+
+func TestFileCounterStore(t *testing.T) {
+	store := &FileCounterStore{Path: filepath.Join(t.TempDir(), "counters.json")}
+	// nothing saved at the first start
+	if counters, err := store.Load(); err != nil || len(counters) != 0 {
+		t.Fatalf("expected no counters, got %v %v", counters, err)
+	}
+	saved := map[string]RuleCounter{"rule-id": {Name: "phone_pattern", Evaluations: 3, Failures: 1, LastEvaluated: time.Now().UTC().Truncate(time.Second)}}
+	if err := store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	if counters, err := store.Load(); err != nil || !reflect.DeepEqual(counters, saved) {
+		t.Errorf("expected the saved counters %v, got %v %v", saved, counters, err)
+	}
+}
@@ -0,0 +1,119 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// RuleStatus is the PATCH /admin/rule/{ruleName}/status request,
+// { "enabled": false } switches the rule off
+type RuleStatus struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type RuleStatusResponseMsg struct {
+	Result  string `json:"result"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// applies reports the rule is evaluated in ruleset, a published and
+// enabled rule of the ruleset in its activation window
+func (entry *RuleEntry) applies(ruleset string) bool {
+	return entry.live() && inActivationWindow(entry.ValidFrom, entry.ValidUntil, time.Now()) && entry.inRuleset(ruleset)
+}
+
+// inActivationWindow reports now is in [from, until), a nil bound is
+// unbounded
+func inActivationWindow(from *time.Time, until *time.Time, now time.Time) bool {
+	if from != nil && now.Before(*from) {
+		return false
+	}
+	if until != nil && !now.Before(*until) {
+		return false
+	}
+	return true
+}
+
+// formatActivationWindow formats the window in RFC 3339, "from/until", a
+// nil bound is empty
+func formatActivationWindow(from *time.Time, until *time.Time) string {
+	bound := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return bound(from) + "/" + bound(until)
+}
+
+// checkActivationWindow checks the window of a rule isn't empty
+func checkActivationWindow(name string, from *time.Time, until *time.Time) error {
+	if from != nil && until != nil && !from.Before(*until) {
+		return fmt.Errorf("rule name, %s, is valid until %s, not after its valid-from %s", name,
+			until.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// SetRuleEnabled switches the registered rule named name on or off on
+// behalf of user, the definition and the counters of a disabled rule are
+// kept
+func SetRuleEnabled(name string, enabled bool, user string) error {
+	RegRuleLock.Lock()
+	defer RegRuleLock.Unlock()
+	entry := findRuleByName(name)
+	if entry == nil {
+		return fmt.Errorf("rule status: rule name, %s, is not found", name)
+	}
+	if err := checkRuleNamespace(entry, user); err != nil {
+		return err
+	}
+	entry.Disabled = !enabled
+	return nil
+}
+
+// PATCH /admin/rule/{ruleName}/status service implementation
+func SetRuleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	status := RuleStatus{}
+	if err := decoder.Decode(&status); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	if status.Enabled == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(fmt.Errorf("rule status: \"enabled\" is missing")))
+		return
+	}
+	name := chi.URLParam(r, "ruleName")
+	if err := SetRuleEnabled(name, *status.Enabled, r.Header.Get(UserHeader)); err != nil {
+		if errors.Is(err, RuleNamespaceForbiddenError) {
+			w.WriteHeader(http.StatusForbidden)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	action := AuditActionDisable
+	if *status.Enabled {
+		action = AuditActionEnable
+	}
+	RecordAudit(action, name, r.Header.Get(UserHeader), 0)
+	w.WriteHeader(http.StatusOK)
+	res := RuleStatusResponseMsg{Result: RuleMgmtSucc, Name: name, Enabled: *status.Enabled}
+	resStr, _ := json.Marshal(res)
+	io.WriteString(w, string(resStr))
+}
@@ -0,0 +1,100 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRuleEnabled(t *testing.T) {
+	node := RuleNode{}
+	if err := json.Unmarshal([]byte(`{"name": "status_test_email", "required": true,
+		"rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "status_test.email"}]}}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	registerTestRule(t, &node)
+
+	failed := func(input string) bool {
+		result, err := ValidateInputJSONByRules("", []byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range result.rules {
+			if name == "status_test_email" {
+				return true
+			}
+		}
+		return false
+	}
+	if !failed(`{"status_test": {"email": "bob"}}`) || !failed(`{"other": "x"}`) {
+		t.Fatal("expected the enabled rule to fail")
+	}
+	if err := SetRuleEnabled("status_test_email", false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if failed(`{"status_test": {"email": "bob"}}`) || failed(`{"other": "x"}`) {
+		t.Error("expected the disabled rule, and its required field, to be skipped")
+	}
+	if err := SetRuleEnabled("status_test_email", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !failed(`{"status_test": {"email": "bob"}}`) {
+		t.Error("expected the re-enabled rule to fail")
+	}
+	if err := SetRuleEnabled("status_test_unknown", false, ""); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+}
+
+func TestActivationWindow(t *testing.T) {
+	now := time.Now()
+	hour := time.Hour
+	for _, tc := range []struct {
+		from, until *time.Duration
+		active      bool
+	}{
+		{nil, nil, true},
+		{&hour, nil, false},
+		{nil, &hour, true},
+		{durationPtr(-hour), durationPtr(-time.Minute), false},
+		{durationPtr(-hour), &hour, true},
+	} {
+		var from, until *time.Time
+		if tc.from != nil {
+			v := now.Add(*tc.from)
+			from = &v
+		}
+		if tc.until != nil {
+			v := now.Add(*tc.until)
+			until = &v
+		}
+		if active := inActivationWindow(from, until, now); active != tc.active {
+			t.Errorf("%s: expected active %v, got %v", formatActivationWindow(from, until), tc.active, active)
+		}
+	}
+
+	node := RuleNode{}
+	if err := json.Unmarshal([]byte(`{"name": "window_test", "valid-from": "2026-12-01T00:00:00Z", "valid-until": "2026-11-27T00:00:00Z",
+		"rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "window_test"}]}}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parseRuleNode(&node); err == nil {
+		t.Error("expected an error for an empty window")
+	}
+
+	// an expired rule is kept, but not evaluated
+	expired := now.Add(-time.Minute)
+	node.ValidFrom, node.ValidUntil = nil, &expired
+	registerTestRule(t, &node)
+	result, err := ValidateInputJSONByRules("", []byte(`{"window_test": "bob"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.flag {
+		t.Errorf("expected the expired rule not to apply, got %v", result.rules)
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
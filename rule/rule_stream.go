@@ -0,0 +1,240 @@
+package rule
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+)
+
+// the streaming pipeline settings: StreamBufferSize bounds the documents
+// parsed ahead of the evaluation, and StreamWorkers evaluate them
+var (
+	StreamBufferSize = 16
+	StreamWorkers    = runtime.NumCPU()
+)
+
+// StreamResult is the validation result of one document of a stream,
+// Index is its position in the stream
+type StreamResult struct {
+	Index      int                           `json:"index"`
+	Result     string                        `json:"result"`
+	Rules      []string                      `json:"rules,omitempty"`
+	Codes      []string                      `json:"codes,omitempty"`
+	Messages   []RuleMessage                 `json:"messages,omitempty"`
+	Paths      map[string][]string           `json:"paths,omitempty"`
+	Unexpected []string                      `json:"unexpected-fields,omitempty"`
+	Exclusive  map[string]ExclusiveViolation `json:"exclusive,omitempty"`
+	Message    string                        `json:"message,omitempty"`
+	ErrorMsg   string                        `json:"error-message,omitempty"`
+}
+
+// streamJob is a parsed document on its way to an evaluator, the result
+// is sent to the buffered done channel
+type streamJob struct {
+	index int
+	doc   map[string]interface{}
+	done  chan StreamResult
+	panic interface{} // a recovered panic of the evaluation, set before done
+}
+
+// newStreamResult converts the validation result of a document, by the
+// zero-rule policy like POST /api/validation
+func newStreamResult(index int, result *validationResult, policy ZeroRulePolicy) StreamResult {
+	if result.noRuleMatched && policy != ZeroRulePass {
+		res := StreamResult{Index: index, Result: ValidationStatusWarn, Message: NoRuleMatchedMessage}
+		if policy == ZeroRuleFail {
+			res.Result = ValidationStatusFail
+		}
+		return res
+	} else if result.flag {
+		return StreamResult{Index: index, Result: ValidationStatusSucc}
+	}
+	return StreamResult{Index: index, Result: ValidationStatusFail, Rules: result.rules, Codes: result.codes, Messages: result.messages,
+		Paths: result.paths, Unexpected: result.unexpected, Exclusive: result.exclusive}
+}
+
+// decodeDocuments reads the documents of r, either one JSON array of
+// objects or a stream of JSON objects like NDJSON, and calls next for each
+// document in order.  next blocks when the pipeline is full, so r is read
+// only as fast as the documents are evaluated.
+func decodeDocuments(r io.Reader, next func(doc map[string]interface{}) bool) error {
+	br := bufio.NewReader(r)
+	// peek the first non-space byte for the array form
+	array := false
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			br.UnreadByte()
+			array = b == '['
+			break
+		}
+	}
+	decoder := json.NewDecoder(br)
+	decoder.UseNumber()
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	for decoder.More() {
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			return err
+		}
+		if !next(doc) {
+			return nil
+		}
+	}
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateStream validates the documents of r against ruleset in a bounded
+// pipeline:
+//   parser => jobs => StreamWorkers evaluators => pending => emit
+// Both channels hold at most StreamBufferSize documents, so a slow
+// evaluation or a slow emit blocks the parser, and the reading of r,
+// rather than buffering the whole input.  emit is called for each
+// document in the input order, and the stream stops when it fails.
+// A document failing to parse ends the stream with the error.
+func ValidateStream(r io.Reader, ruleset string, emit func(StreamResult) error) error {
+	buffer := StreamBufferSize
+	if buffer < 1 {
+		buffer = 1
+	}
+	workers := StreamWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	policy := zeroRulePolicyOf(ruleset)
+	jobs := make(chan *streamJob, buffer)
+	pending := make(chan *streamJob, buffer)
+	stop := make(chan struct{})
+
+	jobID := newBatchJobID("stream")
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				runBatchWork(jobID, func() { job.done <- evaluateStreamJob(job, ruleset, policy) })
+			}
+		}()
+	}
+
+	// the parser, closes both channels when the input ends
+	parseErr := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		index := 0
+		parseErr <- decodeDocuments(r, func(doc map[string]interface{}) bool {
+			job := &streamJob{index: index, doc: doc, done: make(chan StreamResult, 1)}
+			index++
+			// pending first, it keeps the order and bounds the documents
+			// in flight
+			select {
+			case pending <- job:
+			case <-stop:
+				return false
+			}
+			jobs <- job
+			return true
+		})
+	}()
+
+	var emitErr error
+	var panicked interface{}
+	for job := range pending {
+		result := <-job.done
+		if job.panic != nil && panicked == nil {
+			// raised by the request, once the pipeline is drained
+			panicked = job.panic
+			if emitErr == nil {
+				emitErr = fmt.Errorf("stream validation: panic in the evaluation")
+				close(stop)
+			}
+		}
+		if emitErr == nil {
+			if emitErr = emit(result); emitErr != nil {
+				close(stop)
+			}
+		}
+	}
+	if panicked != nil {
+		<-parseErr
+		panic(panicked)
+	}
+	if emitErr != nil {
+		return emitErr
+	}
+	return <-parseErr
+}
+
+// evaluateStreamJob validates the document of job, a panic is recorded in
+// job for the request goroutine
+func evaluateStreamJob(job *streamJob, ruleset string, policy ZeroRulePolicy) (result StreamResult) {
+	if RecoverPanics {
+		defer func() {
+			if v := recover(); v != nil {
+				job.panic = v
+				result = StreamResult{Index: job.index, Result: ValidationStatusError, ErrorMsg: "internal error"}
+			}
+		}()
+	}
+	ruleset, policy = discriminate(job.doc, ruleset, policy)
+	res, err := ValidateInputJSONByRules(ruleset, job.doc)
+	if err != nil {
+		return StreamResult{Index: job.index, Result: ValidationStatusError, ErrorMsg: err.Error()}
+	}
+	return newStreamResult(job.index, res, policy)
+}
+
+// POST /api/validation/stream?ruleset=<ruleset> service implementation.
+// The body is a JSON array of documents or NDJSON, and the response is
+// NDJSON, one result per document in the input order, flushed as the
+// documents are evaluated.  An input error ends the stream with an error
+// line.
+func ValidateJSONStream(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ruleset := requestRuleset(r)
+	if err := CheckRuleset(ruleset); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		errMsg := ErrResponseMsg{Result: ValidationStatusError, ErrorMsg: err.Error()}
+		result, _ := json.Marshal(errMsg)
+		io.WriteString(w, string(result))
+		return
+	}
+	// the body is read while the results are written
+	rc := http.NewResponseController(w)
+	rc.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	count := 0
+	err := ValidateStream(r.Body, ruleset, func(result StreamResult) error {
+		count++
+		line, _ := json.Marshal(result)
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if err != nil {
+		log.Printf("stream validation error, %s", err.Error())
+		line, _ := json.Marshal(StreamResult{Index: count, Result: ValidationStatusError, ErrorMsg: err.Error()})
+		w.Write(append(line, '\n'))
+	}
+}
@@ -0,0 +1,91 @@
+package rule
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDecodeDocuments(t *testing.T) {
+	for _, input := range []string{
+		`[{"a": "1"}, {"a": "2"}, {"a": "3"}]`,
+		"{\"a\": \"1\"}\n{\"a\": \"2\"}\n{\"a\": \"3\"}\n",
+	} {
+		docs := []string{}
+		err := decodeDocuments(strings.NewReader(input), func(doc map[string]interface{}) bool {
+			docs = append(docs, doc["a"].(string))
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(docs, []string{"1", "2", "3"}) {
+			t.Errorf("%q: expected 3 documents in order, got %v", input, docs)
+		}
+	}
+	if err := decodeDocuments(strings.NewReader(`[{"a": "1"}, "x"]`), func(map[string]interface{}) bool { return true }); err == nil {
+		t.Error("expected an error for a non-object document")
+	}
+}
+
+// countingReader counts the bytes read from the input, and closes
+// overread, when set, once more than limit bytes are read
+type countingReader struct {
+	r        io.Reader
+	read     int64
+	limit    int64
+	overread chan struct{}
+	once     sync.Once
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if read := atomic.AddInt64(&c.read, int64(n)); c.overread != nil && read > c.limit {
+		c.once.Do(func() { close(c.overread) })
+	}
+	return n, err
+}
+
+func TestValidateStreamBackPressure(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&input, "{\"stream_test_field\": \"%080d\"}\n", i)
+	}
+	reader := &countingReader{r: strings.NewReader(input.String()), limit: int64(input.Len()) / 4, overread: make(chan struct{})}
+	blocked, release := make(chan struct{}), make(chan struct{})
+	next := 0
+	errs := make(chan error, 1)
+	go func() {
+		errs <- ValidateStream(reader, "", func(result StreamResult) error {
+			if next == 0 {
+				close(blocked)
+				<-release // a slow consumer
+			}
+			if result.Index != next {
+				return fmt.Errorf("expected result %d, got %d", next, result.Index)
+			}
+			next++
+			return nil
+		})
+	}()
+	<-blocked
+	// the reading stops while the consumer is blocked, the overread fails
+	// at once, the quiet period passes
+	select {
+	case <-reader.overread:
+		t.Errorf("expected the reading to block, read %d of %d bytes", atomic.LoadInt64(&reader.read), input.Len())
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if next != 5000 {
+		t.Errorf("expected 5000 results, got %d", next)
+	}
+}
@@ -0,0 +1,79 @@
+package rule
+
+import (
+	"sort"
+	"strings"
+)
+
+// In the strict mode the input fields are the API contract: a field
+// which no rule of the ruleset references, nor the "allowed-fields" of
+// the ruleset config, is unexpected, and fails the validation with its
+// path.  The mode is on for a ruleset with "strict": true, or for a
+// request with ?strict=true.
+
+// ValidationOptions is the per-request options of a validation
+type ValidationOptions struct {
+	Tags    TagFilter // the rules selected by their tags
+	Strict  bool      // the unexpected fields fail the validation
+	Locales []string  // the message locales, in the preference order
+	// the old version of the document, for OLD and CHANGED
+	Previous map[string]interface{}
+	// the failure details are listed
+	Details bool
+}
+
+// fieldAllowed checks the field path is the allowed path, nested below it,
+// e.g. "metadata" allows "metadata.source" and "metadata.tags[0]", or
+// matches it as a wildcard field name
+func fieldAllowed(allowed string, field string) bool {
+	if strings.HasPrefix(field, allowed) &&
+		(len(field) == len(allowed) || field[len(allowed)] == '.' || field[len(allowed)] == '[') {
+		return true
+	}
+	if isWildcardPath(allowed) {
+		if _, ok := matchWildcardPath(allowed, field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// unexpectedFields returns the input fields, sorted, which no rule in
+// ruleset references and allowed doesn't list.
+// Caller holds the READ lock of the shared registry.
+func (reg ruleRegistry) unexpectedFields(inputFields map[string]interface{}, ruleset string, allowed []string) []string {
+	covered := map[string]bool{}
+	patterns := append([]string{}, allowed...)
+	for _, rules := range reg.rules {
+		for _, entry := range rules {
+			if !entry.applies(ruleset) {
+				continue
+			}
+			for _, field := range entry.Fields {
+				if isWildcardPath(field) {
+					patterns = append(patterns, field)
+				} else {
+					covered[field] = true
+				}
+			}
+		}
+	}
+	unexpected := []string{}
+	for field := range inputFields {
+		if covered[field] {
+			continue
+		}
+		ok := false
+		for _, pattern := range patterns {
+			if fieldAllowed(pattern, field) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			unexpected = append(unexpected, field)
+		}
+	}
+	sort.Strings(unexpected)
+	return unexpected
+}
@@ -0,0 +1,54 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStrictMode(t *testing.T) {
+	rules := []string{
+		`{"name": "strict_test_email", "rulesets": ["strict_test"],
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "@"}, {"field": "strict_test.email"}]}}`,
+		`{"name": "strict_test_phone", "rulesets": ["strict_test"],
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]+$"}, {"field": "strict_test.phones[*]"}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	doc := map[string]interface{}{"strict_test": map[string]interface{}{
+		"email":    "a@b.c",
+		"phones":   []interface{}{"123"},
+		"metadata": map[string]interface{}{"source": "web"},
+		"nickname": "x",
+	}}
+	result, err := ValidateInput("strict_test", ValidationOptions{}, ContentTypeJSON, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.flag || result.unexpected != nil {
+		t.Errorf("expected the extra fields ignored without the strict mode, got %v %v", result.flag, result.unexpected)
+	}
+	result, err = ValidateInput("strict_test", ValidationOptions{Strict: true}, ContentTypeJSON, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.flag || !reflect.DeepEqual(result.unexpected, []string{"strict_test.metadata.source", "strict_test.nickname"}) {
+		t.Errorf("expected the unexpected fields, got %v %v", result.flag, result.unexpected)
+	}
+
+	defer func(configs map[string]RulesetConfig) { RulesetConfigs = configs }(RulesetConfigs)
+	RulesetConfigs = map[string]RulesetConfig{"strict_test": {Strict: true, AllowedFields: []string{"strict_test.metadata", "..nickname"}}}
+	result, err = ValidateInput("strict_test", ValidationOptions{}, ContentTypeJSON, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.flag || len(result.unexpected) != 0 {
+		t.Errorf("expected the allowed fields to pass, got %v %v", result.flag, result.unexpected)
+	}
+}
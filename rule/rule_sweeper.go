@@ -0,0 +1,123 @@
+package rule
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/richgrove/validation/util"
+)
+
+// The expired rules, past their "valid-until", are never evaluated, but
+// they stay registered.  "on-expiry" tells the sweeper what to do with
+// the rule once it is expired,
+//   keep    - nothing, the default
+//   disable - switch the rule off, so it is listed as disabled
+//   delete  - remove the rule, after ExpiredRuleRetention
+// The sweeper prunes the replaced rule versions and the audit entries past
+// their retention too, see rule_history.go.
+const (
+	OnExpiryKeep    = "keep"
+	OnExpiryDisable = "disable"
+	OnExpiryDelete  = "delete"
+)
+
+// ExpiredRuleRetention keeps an expired "delete" rule registered for the
+// duration after its "valid-until", e.g. for its counters
+var ExpiredRuleRetention time.Duration
+
+// normalizeOnExpiry checks the "on-expiry" action of a rule, "" is keep
+func normalizeOnExpiry(action string) (string, error) {
+	switch action {
+	case "", OnExpiryKeep:
+		return OnExpiryKeep, nil
+	case OnExpiryDisable, OnExpiryDelete:
+		return action, nil
+	}
+	return "", fmt.Errorf("unknown on-expiry action, %s", action)
+}
+
+// SweepReport is the actions of a sweep, the rule names, sorted, and the
+// numbers of the pruned versions and audit entries
+type SweepReport struct {
+	Disabled       []string `json:"disabled"`
+	Deleted        []string `json:"deleted"`
+	PrunedVersions int      `json:"pruned-versions"`
+	PrunedAudit    int      `json:"pruned-audit"`
+}
+
+// SweepExpiredRules applies the "on-expiry" action of the rules expired at
+// now, and prunes the history past its retention
+func SweepExpiredRules(now time.Time) SweepReport {
+	report := SweepReport{Disabled: []string{}, Deleted: []string{}}
+	RegRuleLock.Lock()
+	removed := []*RuleEntry{}
+	for _, entry := range AllRegisteredRuleIDs {
+		if entry.ValidUntil == nil || now.Before(*entry.ValidUntil) {
+			continue
+		}
+		switch entry.OnExpiry {
+		case OnExpiryDisable:
+			if !entry.Disabled {
+				entry.Disabled = true
+				report.Disabled = append(report.Disabled, entry.Name)
+			}
+		case OnExpiryDelete:
+			if !now.Before(entry.ValidUntil.Add(ExpiredRuleRetention)) {
+				removed = append(removed, entry)
+			}
+		}
+	}
+	for _, entry := range removed {
+		removeRuleFromRegister(entry)
+		report.Deleted = append(report.Deleted, entry.Name)
+	}
+	RegRuleLock.Unlock()
+
+	sort.Strings(report.Disabled)
+	sort.Strings(report.Deleted)
+	for action, names := range map[string][]string{OnExpiryDisable: report.Disabled, OnExpiryDelete: report.Deleted} {
+		for _, name := range names {
+			log.Printf("rule sweeper: %s the expired rule, %s", action, name)
+			RecordAudit(action, name, "", 0)
+		}
+		if len(names) > 0 {
+			ServiceMetrics.Counter(metricSweeperActions, util.Labels{"action": action}, float64(len(names)))
+		}
+	}
+
+	report.PrunedVersions, report.PrunedAudit = pruneHistory(now)
+	for action, n := range map[string]int{"prune-versions": report.PrunedVersions, "prune-audit": report.PrunedAudit} {
+		if n > 0 {
+			log.Printf("rule sweeper: %s, %d past the retention", action, n)
+			ServiceMetrics.Counter(metricSweeperActions, util.Labels{"action": action}, float64(n))
+		}
+	}
+	return report
+}
+
+// StartRuleSweeper sweeps the expired rules every interval in background,
+// until the returned stop is called
+func StartRuleSweeper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				SweepExpiredRules(now)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
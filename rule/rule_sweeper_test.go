@@ -0,0 +1,93 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSweepExpiredRules(t *testing.T) {
+	until := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	names := map[string]string{
+		"sweep_test_keep":    "",
+		"sweep_test_disable": OnExpiryDisable,
+		"sweep_test_delete":  OnExpiryDelete,
+	}
+	for name, action := range names {
+		node := RuleNode{Name: name, ValidUntil: &until, OnExpiry: action}
+		json.Unmarshal([]byte(`{"operator": "MATCHES", "operands": [{"value": "^[0-9]+$"}, {"field": "sweep_test.code"}]}`), &node.RuleContent)
+		registerTestRule(t, &node)
+	}
+	bad := RuleNode{Name: "sweep_test_bad", OnExpiry: "archive"}
+	json.Unmarshal([]byte(`{"operator": "MATCHES", "operands": [{"value": "^[0-9]+$"}, {"field": "sweep_test.code"}]}`), &bad.RuleContent)
+	if _, err := RegisterRuleNode(&bad); err == nil {
+		t.Error("expected an unknown on-expiry action to fail")
+	}
+
+	defer func(retention time.Duration) { ExpiredRuleRetention = retention }(ExpiredRuleRetention)
+	ExpiredRuleRetention = time.Hour
+
+	if report := SweepExpiredRules(until.Add(-time.Minute)); len(report.Disabled)+len(report.Deleted) != 0 {
+		t.Errorf("expected no action before the expiry, got %+v", report)
+	}
+	report := SweepExpiredRules(until.Add(time.Minute))
+	if !reflect.DeepEqual(report.Disabled, []string{"sweep_test_disable"}) || len(report.Deleted) != 0 {
+		t.Errorf("expected the rule disabled, and the deletion retained, got %+v", report)
+	}
+	report = SweepExpiredRules(until.Add(2 * time.Hour))
+	if len(report.Disabled) != 0 || !reflect.DeepEqual(report.Deleted, []string{"sweep_test_delete"}) {
+		t.Errorf("expected the rule deleted after the retention, got %+v", report)
+	}
+	RegRuleLock.RLock()
+	kept := findRuleByName("sweep_test_keep")
+	RegRuleLock.RUnlock()
+	if kept == nil || kept.Disabled {
+		t.Errorf("expected the keep rule untouched, got %+v", kept)
+	}
+}
+
+func TestSweepHistory(t *testing.T) {
+	node := RuleNode{Name: "sweep_test_history"}
+	json.Unmarshal([]byte(`{"operator": "MATCHES", "operands": [{"value": "^[0-9]+$"}, {"field": "sweep_test.code"}]}`), &node.RuleContent)
+	registerTestRule(t, &node)
+	update := RuleNode{}
+	json.Unmarshal([]byte(`{"operator": "MATCHES", "operands": [{"value": "^[0-9]{4}$"}, {"field": "sweep_test.code"}]}`), &update.RuleContent)
+	if _, err := UpdateRuleNode("sweep_test_history", &update, nil); err != nil {
+		t.Fatal(err)
+	}
+	RecordAudit(AuditActionUpdate, "sweep_test_history", "sweep_test_user", 2)
+	versions := GetRuleVersions("sweep_test_history")
+	if len(versions) != 1 || versions[0].Version != 1 || versions[0].Rule.Name != "sweep_test_history" {
+		t.Fatalf("expected the replaced version 1, got %+v", versions)
+	}
+
+	defer func(versions, audit time.Duration) {
+		RuleVersionRetention, AuditRetention = versions, audit
+	}(RuleVersionRetention, AuditRetention)
+	RuleVersionRetention, AuditRetention = 0, 0
+	if report := SweepExpiredRules(time.Now().Add(time.Hour)); report.PrunedVersions+report.PrunedAudit != 0 {
+		t.Errorf("expected the history kept without a retention, got %+v", report)
+	}
+	RuleVersionRetention, AuditRetention = time.Minute, time.Minute
+	if report := SweepExpiredRules(time.Now()); report.PrunedVersions+report.PrunedAudit != 0 {
+		t.Errorf("expected the history kept within the retention, got %+v", report)
+	}
+	report := SweepExpiredRules(time.Now().Add(time.Hour))
+	if report.PrunedVersions < 1 || report.PrunedAudit < 1 {
+		t.Errorf("expected the history pruned past the retention, got %+v", report)
+	}
+	if versions := GetRuleVersions("sweep_test_history"); len(versions) != 0 {
+		t.Errorf("expected no version left, got %+v", versions)
+	}
+	if audit := GetAuditLog(); len(audit) != 0 {
+		t.Errorf("expected no audit entry left, got %+v", audit)
+	}
+}
+
+func TestStartRuleSweeperStop(t *testing.T) {
+	stop := StartRuleSweeper(time.Hour)
+	stop()
+	// stopping twice is harmless
+	stop()
+}
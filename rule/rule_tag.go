@@ -0,0 +1,218 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// the number of the rules with each tag, maintained with the register
+var tagRuleCount = map[string]int{}
+
+// normalizeTags checks the tags of a rule, and returns them sorted without
+// the duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	list := []string{}
+	for _, tag := range tags {
+		if err := checkRulesetName(tag); err != nil {
+			return nil, fmt.Errorf("invalid tag, %q", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			list = append(list, tag)
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// hasTag checks the rule has tag, every rule has the "" tag
+func (entry *RuleEntry) hasTag(tag string) bool {
+	if len(tag) == 0 {
+		return true
+	}
+	for _, t := range entry.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// TagFilter selects the rules of a validation by their tags, a rule with
+// any tag of Include, all rules when it is empty, and without a tag of
+// Exclude
+type TagFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// ParseTagFilter parses the tag hints of a validation request, the
+// comma-separated tags of "tags" and "exclude-tags", and the single "tag".
+// An unknown included tag is an error, an unknown excluded tag is ignored.
+func ParseTagFilter(query url.Values) (TagFilter, error) {
+	filter := TagFilter{Include: splitTags(query.Get("tags")), Exclude: splitTags(query.Get("exclude-tags"))}
+	if tag := query.Get("tag"); len(tag) > 0 {
+		filter.Include = append(filter.Include, tag)
+	}
+	for _, tag := range filter.Include {
+		if err := CheckTag(tag); err != nil {
+			return TagFilter{}, err
+		}
+	}
+	return filter, nil
+}
+
+// splitTags splits the comma-separated tags, dropping the empty ones
+func splitTags(s string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// selects reports the filter selects the rule
+func (filter TagFilter) selects(entry *RuleEntry) bool {
+	for _, tag := range filter.Exclude {
+		if entry.hasTag(tag) {
+			return false
+		}
+	}
+	if len(filter.Include) == 0 {
+		return true
+	}
+	for _, tag := range filter.Include {
+		if entry.hasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// addTagUsage counts the tags of entry, sign is 1 when it is registered,
+// -1 when it is removed.  Caller holds the WRITE lock.
+func addTagUsage(entry *RuleEntry, sign int) {
+	for _, tag := range entry.Tags {
+		if tagRuleCount[tag] += sign; tagRuleCount[tag] <= 0 {
+			delete(tagRuleCount, tag)
+		}
+	}
+}
+
+// CheckTag returns an error when no rule has the tag, "" is always known
+func CheckTag(tag string) error {
+	if len(tag) == 0 {
+		return nil
+	}
+	RegRuleLock.RLock()
+	defer RegRuleLock.RUnlock()
+	if tagRuleCount[tag] > 0 {
+		return nil
+	}
+	return fmt.Errorf("unknown tag, %s", tag)
+}
+
+// RuleSummary is a registered rule in the rule list
+type RuleSummary struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Field    string   `json:"field"`
+	Rulesets []string `json:"rulesets,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Enabled  bool     `json:"enabled"`
+	State    string   `json:"state"`
+	RuleMetadata
+}
+
+// summary returns the summary of the rule.
+// Caller holds the READ lock, the state is guarded by it.
+func (entry *RuleEntry) summary() RuleSummary {
+	return RuleSummary{ID: entry.ID, Name: entry.Name, Field: entry.Field,
+		Rulesets: entry.Rulesets, Tags: entry.Tags, Enabled: !entry.Disabled, State: entry.State, RuleMetadata: entry.Metadata}
+}
+
+// ListRulesByTag lists the registered rules with the tag, "" lists all of
+// them, sorted by name
+func ListRulesByTag(tag string) []RuleSummary {
+	RegRuleLock.RLock()
+	list := []RuleSummary{}
+	for _, entry := range AllRegisteredRuleIDs {
+		if entry.hasTag(tag) {
+			list = append(list, entry.summary())
+		}
+	}
+	RegRuleLock.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// DeleteRulesByTag removes the registered rules with the tag, and returns
+// their names, sorted
+func DeleteRulesByTag(tag string, user string) ([]string, error) {
+	if len(tag) == 0 {
+		return nil, fmt.Errorf("delete rules: tag is missing")
+	}
+	RegRuleLock.Lock()
+	removed := []*RuleEntry{}
+	for _, entry := range AllRegisteredRuleIDs {
+		if entry.hasTag(tag) {
+			if err := checkRuleNamespace(entry, user); err != nil {
+				RegRuleLock.Unlock()
+				return nil, err
+			}
+			removed = append(removed, entry)
+		}
+	}
+	names := []string{}
+	for _, entry := range removed {
+		removeRuleFromRegister(entry)
+		names = append(names, entry.Name)
+	}
+	RegRuleLock.Unlock()
+	sort.Strings(names)
+	return names, nil
+}
+
+// DeleteRulesResponseMsg is the DELETE /admin/rules?tag=<tag> response
+type DeleteRulesResponseMsg struct {
+	Result  string   `json:"result"`
+	Deleted []string `json:"deleted"`
+}
+
+// GET /admin/rules?tag=<tag> service implementation
+func GetRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(ListRulesByTag(r.URL.Query().Get("tag")))
+	io.WriteString(w, string(resStr))
+}
+
+// DELETE /admin/rules?tag=<tag> service implementation
+func DeleteRulesByTagHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	names, err := DeleteRulesByTag(r.URL.Query().Get("tag"), r.Header.Get(UserHeader))
+	if err != nil {
+		if errors.Is(err, RuleNamespaceForbiddenError) {
+			w.WriteHeader(http.StatusForbidden)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resStr, _ := json.Marshal(DeleteRulesResponseMsg{Result: RuleMgmtSucc, Deleted: names})
+	io.WriteString(w, string(resStr))
+}
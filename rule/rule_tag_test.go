@@ -0,0 +1,102 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRuleTags(t *testing.T) {
+	rules := []string{
+		`{"name": "tag_test_card", "tags": ["pci", "payments", "pci"],
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{16}$"}, {"field": "tag_test.card"}]}}`,
+		`{"name": "tag_test_name", "tags": ["profile"],
+		  "rule": {"operator": "GREATER_THAN", "operands": [{"operator": "LENGTH", "operands": [{"field": "tag_test.name"}]}, {"value": 2}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	list := ListRulesByTag("pci")
+	if len(list) != 1 || list[0].Name != "tag_test_card" || !reflect.DeepEqual(list[0].Tags, []string{"payments", "pci"}) {
+		t.Fatalf("expected the pci rule with the sorted tags, got %+v", list)
+	}
+	if err := CheckTag("pci"); err != nil {
+		t.Error(err)
+	}
+	if err := CheckTag("tag_test_unknown"); err == nil {
+		t.Error("expected an unknown tag to fail")
+	}
+
+	doc := map[string]interface{}{"tag_test": map[string]interface{}{"card": "1234", "name": "x"}}
+	result, err := ValidateInput("", ValidationOptions{Tags: TagFilter{Include: []string{"pci"}}}, ContentTypeJSON, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.flag || !reflect.DeepEqual(result.rules, []string{"tag_test_card"}) {
+		t.Errorf("expected only the pci rule to fail, got %v %v", result.flag, result.rules)
+	}
+
+	deleted, err := DeleteRulesByTag("pci", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"tag_test_card"}) {
+		t.Errorf("expected the pci rule deleted, got %v", deleted)
+	}
+	if err := CheckTag("pci"); err == nil {
+		t.Error("expected the pci tag to be gone with its rules")
+	}
+	if _, err := DeleteRulesByTag("", ""); err == nil {
+		t.Error("expected a delete without tag to fail")
+	}
+}
+
+func TestTagFilter(t *testing.T) {
+	rules := []string{
+		`{"name": "tag_filter_test_email", "tags": ["pii", "format"],
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "^[^@]+@[^@]+$"}, {"field": "tag_filter_test.email"}]}}`,
+		`{"name": "tag_filter_test_mx", "tags": ["format", "expensive"],
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "^x$"}, {"field": "tag_filter_test.email"}]}}`,
+		`{"name": "tag_filter_test_name",
+		  "rule": {"operator": "MATCHES", "operands": [{"value": "^x$"}, {"field": "tag_filter_test.name"}]}}`,
+	}
+	for _, rule := range rules {
+		node := RuleNode{}
+		if err := json.Unmarshal([]byte(rule), &node); err != nil {
+			t.Fatal(err)
+		}
+		registerTestRule(t, &node)
+	}
+
+	doc := map[string]interface{}{"tag_filter_test": map[string]interface{}{"email": "bad", "name": "y"}}
+	for query, expected := range map[string][]string{
+		"tags=pii,format":                        {"tag_filter_test_email", "tag_filter_test_mx"},
+		"tags=format&exclude-tags=expensive":     {"tag_filter_test_email"},
+		"exclude-tags=expensive,tag_filter_none": {"tag_filter_test_email", "tag_filter_test_name"},
+		"tag=pii":                                {"tag_filter_test_email"},
+	} {
+		values, _ := url.ParseQuery(query)
+		filter, err := ParseTagFilter(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ValidateInput("", ValidationOptions{Tags: filter}, ContentTypeJSON, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(result.rules)
+		if !reflect.DeepEqual(result.rules, expected) {
+			t.Errorf("%s: expected %v to fail, got %v", query, expected, result.rules)
+		}
+	}
+	if _, err := ParseTagFilter(url.Values{"tags": {"pii,tag_filter_none"}}); err == nil {
+		t.Error("expected an unknown included tag to fail")
+	}
+}
@@ -0,0 +1,12 @@
+package rule
+
+import "testing"
+
+func TestIsTimezone(t *testing.T) {
+	// "" and "Local" are loaded by time.LoadLocation, but are not zone names
+	for zone, expected := range map[string]bool{"America/Los_Angeles": true, "UTC": true, "Local": false, "": false, "Mars/Olympus": false} {
+		if res, err := RegisteredOperators[IsTimezoneOperator]([]interface{}{zone}); err != nil || res != expected {
+			t.Errorf("%q: expected %v, got %v %v", zone, expected, res, err)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package rule
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UNIQUE_IN_SCOPE operator fails a value already seen in its scope within
+// the TTL, e.g. no duplicate order_id within 24h,
+//   { "operator": "UNIQUE_IN_SCOPE", "operands": [ { "value": "orders" }, { "value": "24h" }, { "field": "order_id" } ] }
+// the first value is recorded for the TTL and evaluates to true, a repeat
+// of it in the TTL to false.  The seen values are kept by UniqueValues, in
+// memory by default, in Redis shared by the instances, or in SQLite.  The
+// evaluation looks the value up, and the value is recorded only when the
+// whole validation passes, so a document failing another rule doesn't
+// consume its value; a value recorded meanwhile by another validation
+// fails it then.  The isolated evaluations, e.g. the rule examples and the
+// regression check, look up the values without recording them.
+
+// UniqueStore keeps the seen values of UNIQUE_IN_SCOPE.  Seen reports the
+// value was recorded in the scope and not expired, and records it for ttl
+// unless peek is set, atomically.
+type UniqueStore interface {
+	Seen(scope string, value string, ttl time.Duration, peek bool) (bool, error)
+}
+
+// the seen value store, replaced by -unique-store
+var UniqueValues UniqueStore = NewMemoryUniqueStore()
+
+var (
+	// per-call timeout of the Redis store
+	UniqueStoreTimeout = 2 * time.Second
+	// the key prefix of the Redis store
+	UniqueKeyPrefix = "validation:unique:"
+)
+
+// the operators keeping a state across the evaluations, which results
+// can't be cached
+var statefulOperators = map[OperatorType]bool{
+	UniqueInScopeOperator: true,
+}
+
+// OpenUniqueStore opens the seen value store by its URL, "memory",
+// "redis://[:password@]host:port[/db][?pool=8]" or
+// "sqlite:///path/to/file.db"
+func OpenUniqueStore(rawURL string) (UniqueStore, error) {
+	if rawURL == "memory" {
+		return NewMemoryUniqueStore(), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("unique store: %s", err.Error())
+	}
+	if u.Scheme == "sqlite" && len(u.Path) > 0 {
+		return OpenSQLiteUniqueStore(u.Path)
+	}
+	if u.Scheme != "redis" || len(u.Host) == 0 {
+		return nil, fmt.Errorf("unique store: unsupported URL, %s", rawURL)
+	}
+	store := &RedisUniqueStore{Addr: u.Host}
+	if u.User != nil {
+		store.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); len(db) > 0 {
+		if store.DB, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("unique store: invalid database, %s", db)
+		}
+	}
+	if pool := u.Query().Get("pool"); len(pool) > 0 {
+		if store.PoolSize, err = strconv.Atoi(pool); err != nil || store.PoolSize < 1 {
+			return nil, fmt.Errorf("unique store: invalid pool size, %s", pool)
+		}
+	}
+	return store, nil
+}
+
+// uniqueInScopeOperator is the UNIQUE_IN_SCOPE OperatorFn, operands are
+// (scope, TTL, value)
+func uniqueInScopeOperator(operands []interface{}) (interface{}, error) {
+	return uniqueInScope(operands, false)
+}
+
+// evaluateUniqueInScope evaluates UNIQUE_IN_SCOPE(scope, TTL, value), it
+// looks the value up, and claims an unseen value for the validation of
+// the context
+func evaluateUniqueInScope(cx EvalContext, operands []Operand) (interface{}, error) {
+	values := make([]interface{}, len(operands))
+	for i, o := range operands {
+		v, err := o.Evaluate(cx)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	claim, err := parseUniqueClaim(values)
+	if err != nil {
+		return nil, err
+	}
+	seen, err := UniqueValues.Seen(claim.scope, claim.value, claim.ttl, true)
+	if err != nil {
+		return nil, err
+	}
+	if ctx, ok := cx.(*FieldEvalContext); ok && !seen && ctx.claims != nil {
+		claim.ctx = ctx
+		ctx.claims.add(claim)
+	}
+	return !seen, nil
+}
+
+func uniqueInScope(operands []interface{}, peek bool) (interface{}, error) {
+	claim, err := parseUniqueClaim(operands)
+	if err != nil {
+		return nil, err
+	}
+	seen, err := UniqueValues.Seen(claim.scope, claim.value, claim.ttl, peek)
+	if err != nil {
+		return nil, err
+	}
+	return !seen, nil
+}
+
+// uniqueClaim is a value of UNIQUE_IN_SCOPE to record
+type uniqueClaim struct {
+	scope string
+	value string
+	ttl   time.Duration
+	ctx   *FieldEvalContext
+}
+
+// parseUniqueClaim checks the (scope, TTL, value) operands
+func parseUniqueClaim(operands []interface{}) (uniqueClaim, error) {
+	if len(operands) != 3 {
+		return uniqueClaim{}, ParseRuleOperatorError
+	}
+	scope, ok1 := operands[0].(string)
+	literal, ok2 := operands[1].(string)
+	if !ok1 || !ok2 || operands[2] == nil {
+		return uniqueClaim{}, ParseRuleOperatorError
+	}
+	ttl, err := time.ParseDuration(literal)
+	if err != nil || ttl <= 0 {
+		return uniqueClaim{}, fmt.Errorf("unique operator: invalid TTL, %s", literal)
+	}
+	return uniqueClaim{scope: scope, value: fieldText(operands[2]), ttl: ttl}, nil
+}
+
+// uniqueClaims collects the claims of a validation, its rules may be
+// evaluated concurrently
+type uniqueClaims struct {
+	lock   sync.Mutex
+	claims []uniqueClaim
+}
+
+func (c *uniqueClaims) add(claim uniqueClaim) {
+	c.lock.Lock()
+	c.claims = append(c.claims, claim)
+	c.lock.Unlock()
+}
+
+// record records the claimed values of a passed validation in the claim
+// order, and returns the contexts of the values recorded meanwhile, e.g.
+// by a concurrent validation or twice in the document
+func (c *uniqueClaims) record() []*FieldEvalContext {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	failed := []*FieldEvalContext{}
+	for _, claim := range c.claims {
+		seen, err := UniqueValues.Seen(claim.scope, claim.value, claim.ttl, false)
+		if err != nil {
+			log.Printf("rule name, %s, unique value record error, %s", claim.ctx.RuleName, err.Error())
+			continue
+		}
+		if seen {
+			failed = append(failed, claim.ctx)
+		}
+	}
+	return failed
+}
+
+// MemoryUniqueStore keeps the seen values in the process, the expired ones
+// are dropped when the store doubles its size since the last sweep
+type MemoryUniqueStore struct {
+	lock      sync.Mutex
+	expiries  map[string]time.Time
+	sweepSize int
+}
+
+// the store size of the first sweep
+const uniqueSweepSize = 1024
+
+func NewMemoryUniqueStore() *MemoryUniqueStore {
+	return &MemoryUniqueStore{expiries: map[string]time.Time{}, sweepSize: uniqueSweepSize}
+}
+
+func (s *MemoryUniqueStore) Seen(scope string, value string, ttl time.Duration, peek bool) (bool, error) {
+	key := scope + "\x00" + value
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if expiry, ok := s.expiries[key]; ok && now.Before(expiry) {
+		return true, nil
+	}
+	if peek {
+		return false, nil
+	}
+	s.expiries[key] = now.Add(ttl)
+	if len(s.expiries) >= s.sweepSize {
+		for k, expiry := range s.expiries {
+			if !now.Before(expiry) {
+				delete(s.expiries, k)
+			}
+		}
+		s.sweepSize = 2 * len(s.expiries)
+		if s.sweepSize < uniqueSweepSize {
+			s.sweepSize = uniqueSweepSize
+		}
+	}
+	return false, nil
+}
+
+var UniqueStoreReplyError = errors.New("unique store: unexpected Redis reply")
+
+var UniqueStoreBusyError = errors.New("unique store: no free Redis connection")
+
+// the Redis connections of a store, by default
+const DefaultUniquePoolSize = 8
+
+// RedisUniqueStore keeps the seen values in Redis, with the TTL of each
+// key, so the instances share them.  The value is recorded by SET NX PX,
+// looked up by EXISTS.  The connections are pooled, at most PoolSize are
+// open, and a connection is dropped after an error.
+type RedisUniqueStore struct {
+	Addr     string
+	Password string
+	DB       int
+	PoolSize int // DefaultUniquePoolSize when 0
+
+	once  sync.Once
+	slots chan struct{}   // a token per open or opening connection
+	idle  chan *redisConn // the open connections not in use
+}
+
+// redisConn is a pooled connection
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (s *RedisUniqueStore) Seen(scope string, value string, ttl time.Duration, peek bool) (bool, error) {
+	key := UniqueKeyPrefix + scope + ":" + value
+	if peek {
+		reply, err := s.command("EXISTS", key)
+		if err != nil {
+			return false, err
+		}
+		return reply == ":1", nil
+	}
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	reply, err := s.command("SET", key, "1", "NX", "PX", strconv.FormatInt(ms, 10))
+	if err != nil {
+		return false, err
+	}
+	switch reply {
+	case "+OK":
+		return false, nil
+	case "$-1":
+		// not set, the key exists
+		return true, nil
+	}
+	return false, UniqueStoreReplyError
+}
+
+// command sends the command on a pooled connection, and returns the
+// first line of the reply
+func (s *RedisUniqueStore) command(args ...string) (string, error) {
+	c, err := s.get()
+	if err != nil {
+		return "", err
+	}
+	reply, err := c.roundTrip(args)
+	s.put(c, err != nil)
+	if err != nil {
+		return "", fmt.Errorf("unique store: %s", err.Error())
+	}
+	if strings.HasPrefix(reply, "-") {
+		return "", fmt.Errorf("unique store: %s", reply[1:])
+	}
+	return reply, nil
+}
+
+// get takes an idle connection, or opens one when less than PoolSize are
+// open, waiting for UniqueStoreTimeout at most
+func (s *RedisUniqueStore) get() (*redisConn, error) {
+	s.once.Do(func() {
+		size := s.PoolSize
+		if size < 1 {
+			size = DefaultUniquePoolSize
+		}
+		s.slots, s.idle = make(chan struct{}, size), make(chan *redisConn, size)
+	})
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+	timer := time.NewTimer(UniqueStoreTimeout)
+	defer timer.Stop()
+	select {
+	case c := <-s.idle:
+		return c, nil
+	case s.slots <- struct{}{}:
+	case <-timer.C:
+		return nil, UniqueStoreBusyError
+	}
+	c, err := s.connect()
+	if err != nil {
+		<-s.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// put returns the connection to the pool, or closes a broken one
+func (s *RedisUniqueStore) put(c *redisConn, broken bool) {
+	if broken {
+		c.conn.Close()
+		<-s.slots
+		return
+	}
+	s.idle <- c
+}
+
+// connect opens a connection, and authenticates and selects the database
+func (s *RedisUniqueStore) connect() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", s.Addr, UniqueStoreTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unique store: %s", err.Error())
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	setup := [][]string{}
+	if len(s.Password) > 0 {
+		setup = append(setup, []string{"AUTH", s.Password})
+	}
+	if s.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.DB)})
+	}
+	for _, args := range setup {
+		if reply, err := c.roundTrip(args); err != nil || reply != "+OK" {
+			conn.Close()
+			if err == nil {
+				err = fmt.Errorf("%s, %s", args[0], reply)
+			}
+			return nil, fmt.Errorf("unique store: %s", err.Error())
+		}
+	}
+	return c, nil
+}
+
+// roundTrip writes the command in RESP, and reads the reply line
+func (c *redisConn) roundTrip(args []string) (string, error) {
+	c.conn.SetDeadline(time.Now().Add(UniqueStoreTimeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,88 @@
+package rule
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// SQLiteDriverName is the database/sql driver of the SQLite store.  The
+// driver isn't vendored, a build linking it, e.g. by a file importing
+// github.com/mattn/go-sqlite3, enables "sqlite:///path/to/file.db".
+var SQLiteDriverName = "sqlite3"
+
+// SQLiteUniqueStore keeps the seen values in a SQLite table, with the
+// expiry of each value, for a single instance which keeps them across the
+// restarts.  A value is recorded by one upsert which only replaces an
+// expired value, so the check and the record are atomic.
+type SQLiteUniqueStore struct {
+	db *sql.DB
+	// the records since the last sweep of the expired values
+	records int64
+}
+
+// the records between two sweeps of the expired values
+const sqliteSweepRecords = 1024
+
+// OpenSQLiteUniqueStore opens the database file, and creates the table
+func OpenSQLiteUniqueStore(path string) (*SQLiteUniqueStore, error) {
+	linked := false
+	for _, name := range sql.Drivers() {
+		linked = linked || name == SQLiteDriverName
+	}
+	if !linked {
+		return nil, fmt.Errorf("unique store: the %s database driver isn't linked in the build", SQLiteDriverName)
+	}
+	db, err := sql.Open(SQLiteDriverName, path)
+	if err != nil {
+		return nil, fmt.Errorf("unique store: %s", err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), UniqueStoreTimeout)
+	defer cancel()
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS unique_values (
+		scope TEXT NOT NULL, value TEXT NOT NULL, expiry INTEGER NOT NULL, PRIMARY KEY (scope, value))`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unique store: %s", err.Error())
+	}
+	return &SQLiteUniqueStore{db: db}, nil
+}
+
+func (s *SQLiteUniqueStore) Seen(scope string, value string, ttl time.Duration, peek bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), UniqueStoreTimeout)
+	defer cancel()
+	now := time.Now()
+	if peek {
+		var n int
+		err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM unique_values WHERE scope = ? AND value = ? AND expiry > ?`,
+			scope, value, now.UnixNano()).Scan(&n)
+		if err != nil {
+			return false, fmt.Errorf("unique store: %s", err.Error())
+		}
+		return n > 0, nil
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO unique_values (scope, value, expiry) VALUES (?, ?, ?)
+		ON CONFLICT (scope, value) DO UPDATE SET expiry = excluded.expiry WHERE unique_values.expiry <= ?`,
+		scope, value, now.Add(ttl).UnixNano(), now.UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("unique store: %s", err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("unique store: %s", err.Error())
+	}
+	if atomic.AddInt64(&s.records, 1)%sqliteSweepRecords == 0 {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM unique_values WHERE expiry <= ?`, now.UnixNano()); err != nil {
+			log.Printf("unique store: sweep error, %s", err.Error())
+		}
+	}
+	// no row changed, the value is recorded and not expired
+	return n == 0, nil
+}
+
+func (s *SQLiteUniqueStore) Close() error {
+	return s.db.Close()
+}
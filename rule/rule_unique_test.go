@@ -0,0 +1,195 @@
+package rule
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUniqueInScope(t *testing.T) {
+	defer func(store UniqueStore) { UniqueValues = store }(UniqueValues)
+	UniqueValues = NewMemoryUniqueStore()
+	node := RuleNode{}
+	if err := json.Unmarshal([]byte(`{"name": "unique_test_order_id", "examples": {"pass": ["o-1"]},
+		"expression": "unique_in_scope('orders', '24h', unique_test_order_id)"}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	registerTestRule(t, &node)
+	amount := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "unique_test_amount", "expression": "unique_test_amount > 0"}`), &amount)
+	registerTestRule(t, &amount)
+	// the example run doesn't record o-1
+	for i, c := range []struct {
+		id       interface{}
+		expected bool
+		amount   int
+	}{{"o-1", true, 1}, {"o-2", true, 1}, {"o-1", false, 1}, {json.Number("7"), true, 1}, {"7", false, 1},
+		// a failed validation doesn't record its value
+		{"o-3", false, -1}, {"o-3", true, 1}, {"o-3", false, 1}} {
+		result, err := ValidateInputJSONByRules("", map[string]interface{}{"unique_test_order_id": c.id, "unique_test_amount": json.Number(strconv.Itoa(c.amount))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.flag != c.expected {
+			t.Errorf("%d, %v: expected %v, got %v", i, c.id, c.expected, result.flag)
+		}
+	}
+
+	// a value twice in the document is recorded once, and fails
+	wildcard := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "unique_test_line_id", "expression": "unique_in_scope('lines', '1h', unique_test_lines[*].id)"}`), &wildcard)
+	registerTestRule(t, &wildcard)
+	var doc map[string]interface{}
+	json.Unmarshal([]byte(`{"unique_test_lines": [{"id": "l-1"}, {"id": "l-1"}]}`), &doc)
+	if result, _ := ValidateInputJSONByRules("", doc); result.flag || !reflect.DeepEqual(result.rules, []string{"unique_test_line_id"}) {
+		t.Errorf("expected the duplicated line to fail, got %v %v", result.flag, result.rules)
+	}
+
+	store := NewMemoryUniqueStore()
+	if seen, _ := store.Seen("s", "v", time.Millisecond, false); seen {
+		t.Errorf("expected the first value unseen")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if seen, _ := store.Seen("s", "v", time.Hour, false); seen {
+		t.Errorf("expected the expired value unseen")
+	}
+	if _, err := uniqueInScope([]interface{}{"s", "1 day", "v"}, false); err == nil {
+		t.Errorf("expected an invalid TTL to fail")
+	}
+}
+
+// fakeRedis is a Redis stand-in of SET NX and EXISTS, it sends the
+// commands to commands, and counts the connections
+type fakeRedis struct {
+	l        net.Listener
+	commands chan []string
+	lock     sync.Mutex
+	keys     map[string]bool
+	conns    int32
+}
+
+func newFakeRedis(t *testing.T, commands chan []string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{l: l, commands: commands, keys: map[string]bool{}}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&f.conns, 1)
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			r.ReadString('\n')
+			arg, _ := r.ReadString('\n')
+			args[i] = strings.TrimRight(arg, "\r\n")
+		}
+		if f.commands != nil {
+			f.commands <- args
+		}
+		f.lock.Lock()
+		switch {
+		case args[0] == "SET" && f.keys[args[1]]:
+			io.WriteString(conn, "$-1\r\n")
+		case args[0] == "SET":
+			f.keys[args[1]] = true
+			io.WriteString(conn, "+OK\r\n")
+		case args[0] == "EXISTS" && f.keys[args[1]]:
+			io.WriteString(conn, ":1\r\n")
+		case args[0] == "EXISTS":
+			io.WriteString(conn, ":0\r\n")
+		default:
+			io.WriteString(conn, "+OK\r\n")
+		}
+		f.lock.Unlock()
+	}
+}
+
+func TestRedisUniqueStore(t *testing.T) {
+	commands := make(chan []string, 16)
+	f := newFakeRedis(t, commands)
+	store, err := OpenUniqueStore("redis://:secret@" + f.l.Addr().String() + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range []struct {
+		peek     bool
+		expected bool
+	}{{true, false}, {false, false}, {false, true}, {true, true}} {
+		if seen, err := store.Seen("orders", "o-1", 24*time.Hour, c.peek); err != nil || seen != c.expected {
+			t.Errorf("%d: expected %v, got %v %v", i, c.expected, seen, err)
+		}
+	}
+	close(commands)
+	got := []string{}
+	for args := range commands {
+		got = append(got, strings.Join(args, " "))
+	}
+	expected := []string{"AUTH secret", "SELECT 2", "EXISTS validation:unique:orders:o-1",
+		"SET validation:unique:orders:o-1 1 NX PX 86400000", "SET validation:unique:orders:o-1 1 NX PX 86400000", "EXISTS validation:unique:orders:o-1"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the commands %q, got %q", expected, got)
+	}
+
+	if _, err := OpenUniqueStore("sqlite:///tmp/unique.db"); err == nil || !strings.Contains(err.Error(), "driver") {
+		t.Errorf("expected the SQLite store to fail without its driver, got %v", err)
+	}
+	if _, err := OpenUniqueStore("mysql://localhost/unique"); err == nil {
+		t.Errorf("expected an unsupported store to fail")
+	}
+
+	// the concurrent calls share the pool connections
+	f = newFakeRedis(t, nil)
+	store, err = OpenUniqueStore("redis://" + f.l.Addr().String() + "?pool=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	var unseen int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			seen, err := store.Seen("orders", strconv.Itoa(i%10), time.Hour, false)
+			if err != nil {
+				t.Error(err)
+			} else if !seen {
+				atomic.AddInt32(&unseen, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&f.conns); n < 1 || n > 2 {
+		t.Errorf("expected at most 2 connections, got %d", n)
+	}
+	if unseen != 10 {
+		t.Errorf("expected 10 values recorded, got %d", unseen)
+	}
+}
@@ -0,0 +1,238 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// A rule is updated in place by its name,
+//   PUT /admin/rule/<rule-name>
+//   If-Match: "3"
+// the new definition is parsed and checked like a created rule, and
+// swapped with the registered one atomically, keeping its ID, so its
+// statistics, and its creation time.  The version of a rule starts at 1,
+// and is incremented by each update.  GET /admin/rule/<rule-name> returns
+// it as the ETag, and an update with If-Match, or ?version=, of another
+// version is rejected, so two admins don't overwrite each other.  The
+// rules embedding the rule by RULE_REF are resolved again with the new
+// content.
+
+var (
+	RuleNotFoundError        = errors.New("rule update: rule is not found")
+	RuleVersionConflictError = errors.New("rule update: version conflict")
+)
+
+// ruleETag is the entity tag of the rule version
+func ruleETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// expectedRuleVersion parses the If-Match header, or the version query,
+// 0 accepts any version.  If-Match lists the entity tags, "*" is any.
+func expectedRuleVersion(r *http.Request) ([]int, error) {
+	versions := []int{}
+	if s := r.URL.Query().Get("version"); len(s) > 0 {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("rule update: invalid version, %s", s)
+		}
+		versions = append(versions, v)
+	}
+	for _, tag := range strings.Split(r.Header.Get("If-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if len(tag) == 0 {
+			continue
+		}
+		if tag == "*" {
+			versions = append(versions, 0)
+			continue
+		}
+		s, err := strconv.Unquote(tag)
+		v, e := strconv.Atoi(s)
+		if err != nil || e != nil || v < 1 {
+			return nil, fmt.Errorf("rule update: invalid If-Match, %s", tag)
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// matchesVersion reports one of the expected versions, none or 0 is any,
+// is the version
+func matchesVersion(expected []int, version int) bool {
+	if len(expected) == 0 {
+		return true
+	}
+	for _, v := range expected {
+		if v == 0 || v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateRuleNode replaces the named rule by node, when its version is one
+// of the expected ones.  The node keeps the name and the ID of the rule.
+func UpdateRuleNode(name string, node *RuleNode, expected []int) (*RuleEntry, error) {
+	entry, err := updateRuleNode(name, node, expected)
+	if err != nil {
+		return nil, err
+	}
+	reresolveDependents(name)
+	return entry, nil
+}
+
+// updateRuleNode swaps the named rule by node
+func updateRuleNode(name string, node *RuleNode, expected []int) (*RuleEntry, error) {
+	RegRuleLock.RLock()
+	existing := findRuleByName(name)
+	RegRuleLock.RUnlock()
+	if existing == nil {
+		return nil, fmt.Errorf("%w, %s", RuleNotFoundError, name)
+	}
+	if len(node.Name) == 0 {
+		node.Name = name
+	} else if node.Name != name {
+		return nil, fmt.Errorf("rule update: rule name, %s, can't be renamed to %s", name, node.Name)
+	}
+	if len(node.ID) == 0 {
+		node.ID = existing.ID
+	} else if node.ID != existing.ID {
+		return nil, fmt.Errorf("rule update: rule ID, %s, of rule name, %s, can't be changed", existing.ID, name)
+	}
+
+	entry, fieldList, err := parseRuleNode(node)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEnvironment(entry.Name, entry.Environments); err != nil {
+		return nil, err
+	}
+	if err := checkRuleExamples(entry, fieldList); err != nil {
+		return nil, err
+	}
+	// the replaced version's examples hold, the state is guarded by the lock
+	RegRuleLock.RLock()
+	replaced := *existing
+	RegRuleLock.RUnlock()
+	if err := checkReplacedRuleExamples(entry, fieldList, &replaced); err != nil {
+		return nil, err
+	}
+	if err := resolveRuleFields(entry, fieldList); err != nil {
+		return nil, err
+	}
+
+	RegRuleLock.Lock()
+	defer RegRuleLock.Unlock()
+	// the rule may be changed since it was read
+	current := findRuleByName(name)
+	if current == nil {
+		return nil, fmt.Errorf("%w, %s", RuleNotFoundError, name)
+	}
+	if !matchesVersion(expected, current.Version) {
+		return nil, fmt.Errorf("%w, rule name, %s, is at version %d", RuleVersionConflictError, name, current.Version)
+	}
+	entry.Version, entry.Created = current.Version+1, current.Created
+	removeRuleFromRegister(current)
+	if err := saveRuleLocked(entry); err != nil {
+		// the registered rule is kept
+		saveRuleLocked(current)
+		return nil, err
+	}
+	recordRuleVersion(current, time.Now())
+	return entry, nil
+}
+
+// PUT /admin/rule/{ruleName}?version=<version>&force=true service
+// implementation
+func UpdateRule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	name := chi.URLParam(r, "ruleName")
+	expected, err := expectedRuleVersion(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	rule := RuleNode{}
+	if err := decoder.Decode(&rule); err != nil {
+		// failed to decode a JSON block
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+
+	// the author of the update, a draft when the rules require the approval
+	if err := prepareRuleCreation(&rule, r.Header.Get(UserHeader)); err != nil {
+		if errors.Is(err, RuleUserMissingError) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+
+	// the corpus by the rules before and after the update
+	RegRuleLock.RLock()
+	existing := findRuleByName(name)
+	RegRuleLock.RUnlock()
+	if existing == nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(fmt.Errorf("%w, %s", RuleNotFoundError, name)))
+		return
+	}
+	// the caller updates the rules of its namespace only
+	if namespace, _ := normalizeNamespace(rule.Namespace); namespace != existing.Namespace {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, generateCreateRuleErrorMessage(fmt.Errorf("%w, rule name, %s, is in the namespace, %s", RuleNamespaceForbiddenError, name, existing.Namespace)))
+		return
+	}
+	if len(rule.Name) == 0 {
+		rule.Name = name
+	}
+	report, err := checkRuleRegression(&rule, existing)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+		return
+	}
+	if report != nil && report.Blocked && r.URL.Query().Get("force") != "true" {
+		writeRegressionError(w, name, report)
+		return
+	}
+
+	entry, err := UpdateRuleNode(name, &rule, expected)
+	switch {
+	case errors.Is(err, RuleNotFoundError):
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+	case errors.Is(err, RuleVersionConflictError):
+		w.WriteHeader(http.StatusPreconditionFailed)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+	case err != nil:
+		// parse or save failed
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, generateCreateRuleErrorMessage(err))
+	default:
+		RecordAudit(AuditActionUpdate, entry.Name, r.Header.Get(UserHeader), entry.Version)
+		w.Header().Set("ETag", ruleETag(entry.Version))
+		w.WriteHeader(http.StatusOK)
+		res := CreateRuleResponseMsg{Result: RuleMgmtSucc, ID: entry.ID, Name: entry.Name, State: entry.State, Warnings: entry.Warnings,
+			Version: entry.Version, Regression: report}
+		resStr, _ := json.Marshal(res)
+		io.WriteString(w, string(resStr))
+	}
+}
@@ -0,0 +1,68 @@
+package rule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpdateRule(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "update_test_zip", "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "update_test_zip"}]}}`), &node)
+	entry := registerTestRule(t, &node)
+	handler := Handlers()
+	put := func(name string, ifMatch string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/admin/rule/"+name, strings.NewReader(body))
+		if len(ifMatch) > 0 {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/rule/update_test_zip", nil))
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("expected the ETag of version 1, got %s", etag)
+	}
+
+	body := `{"rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{4}$"}, {"field": "update_test_zip"}]}}`
+	w = put("update_test_zip", `"1"`, body)
+	res := CreateRuleResponseMsg{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.Version != 2 || res.ID != entry.ID || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected version 2, got %d %s", w.Code, w.Body.String())
+	}
+	updated := findRuleByName("update_test_zip")
+	if v, _ := updated.Rule.Evaluate(&FieldEvalContext{Field: "update_test_zip", FieldValue: "1234"}); v != true {
+		t.Errorf("expected the updated rule to pass 1234")
+	}
+	if !updated.Created.Equal(entry.Created) {
+		t.Errorf("expected the creation time to be kept")
+	}
+
+	// the second admin still has version 1
+	if w := put("update_test_zip", `"1"`, body); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412, got %d %s", w.Code, w.Body.String())
+	}
+	if w := put("update_test_zip", `W/"1", "2"`, body); w.Code != http.StatusOK {
+		t.Errorf("expected a matching tag of the list, got %d %s", w.Code, w.Body.String())
+	}
+	if w := put("update_test_zip", "*", body); w.Code != http.StatusOK {
+		t.Errorf("expected any version, got %d %s", w.Code, w.Body.String())
+	}
+	if w := put("update_test_zip", "", `{"name": "update_test_other", "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{4}$"}, {"field": "update_test_zip"}]}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a renaming to fail, got %d", w.Code)
+	}
+	if w := put("update_test_zip", "", `{"rule": {"operator": "NO_SUCH_OPERATOR"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid rule to fail, got %d", w.Code)
+	}
+	if current := findRuleByName("update_test_zip"); current == nil || current.Version != 4 {
+		t.Errorf("expected the rule to be kept at version 4")
+	}
+	if w := put("update_test_missing", "", body); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package rule
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// build info, set at the build time by
+//   go build -ldflags "-X github.com/richgrove/validation/rule.BuildVersion=1.2.0 -X github.com/richgrove/validation/rule.BuildCommit=$(git rev-parse HEAD)"
+var (
+	BuildVersion = "dev"
+	BuildCommit  = "unknown"
+)
+
+// VersionInfo is the GET /version response
+type VersionInfo struct {
+	Version      string                 `json:"version"`
+	Commit       string                 `json:"commit"`
+	GoVersion    string                 `json:"go-version"`
+	RegistryHash string                 `json:"registry-hash"`
+	RuleCount    int                    `json:"rule-count"`
+	Features     map[string]interface{} `json:"features"`
+}
+
+func GetVersionInfo() VersionInfo {
+	hash, count := registryHash()
+	return VersionInfo{
+		Version:      BuildVersion,
+		Commit:       BuildCommit,
+		GoVersion:    runtime.Version(),
+		RegistryHash: hash,
+		RuleCount:    count,
+		Features:     enabledFeatures(),
+	}
+}
+
+// registryHash returns the SHA-256 of the registered rules, and the rule count.
+// Two instances with the same hash have the same active rules.
+func registryHash() (string, int) {
+	RegRuleLock.RLock()
+	keys := []string{}
+	for field, rules := range AllRegisteredRules {
+		for name, entry := range rules {
+			key := field + "\x00" + name + "\x00" + entry.ID + "\x00" + entry.Fingerprint + "\x00" + strings.Join(entry.Rulesets, ",")
+			if entry.Disabled {
+				key += "\x00disabled"
+			}
+			if !entry.published() {
+				key += "\x00" + entry.State
+			}
+			if entry.ValidFrom != nil || entry.ValidUntil != nil {
+				key += "\x00" + formatActivationWindow(entry.ValidFrom, entry.ValidUntil)
+			}
+			keys = append(keys, key)
+		}
+	}
+	RegRuleLock.RUnlock()
+
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)), len(keys)
+}
+
+// enabledFeatures reports the configured optional features
+func enabledFeatures() map[string]interface{} {
+	wordLists := []string{}
+	for name := range WordListFiles {
+		wordLists = append(wordLists, name)
+	}
+	sort.Strings(wordLists)
+
+	macroLock.RLock()
+	macroCount := len(registeredMacros)
+	macroLock.RUnlock()
+
+	return map[string]interface{}{
+		"chaos":                  chaosEnabled(),
+		"zero-rule-policy":       DefaultZeroRulePolicy,
+		"counter-store":          counterStoreEnabled,
+		"word-lists":             wordLists,
+		"macros":                 macroCount,
+		"lookup-url-allowlist":   len(LookupAllowedURLPrefixes) > 0,
+		"redaction-default-mode": Redaction.Default.Mode,
+		"quarantine":             quarantine != nil,
+		"rulesets":               knownRulesets(),
+		"operator-packs":         enabledOperatorPacks(),
+		"metrics":                metricsBackend,
+		"read-only":              ReadOnly,
+		"operator-caches":        cachedOperators(),
+		"fragments":              fragmentCount(),
+		"normalizers":            normalizerCount(),
+		"environment":            Environment,
+	}
+}
@@ -0,0 +1,31 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVersionInfo(t *testing.T) {
+	before := GetVersionInfo()
+	if before.Version != BuildVersion || before.Commit != BuildCommit || len(before.GoVersion) == 0 {
+		t.Errorf("expected the build info, got %+v", before)
+	}
+
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "version_test_code", "rule": {"operator": "IS_TIMEZONE", "operands": [{"field": "version_test_code"}]}}`), &node)
+	entry := registerTestRule(t, &node)
+	after := GetVersionInfo()
+	if after.RuleCount != before.RuleCount+1 || after.RegistryHash == before.RegistryHash {
+		t.Errorf("expected the registered rule counted and hashed, got %d %s", after.RuleCount, after.RegistryHash)
+	}
+	if again := GetVersionInfo(); again.RegistryHash != after.RegistryHash {
+		t.Errorf("expected the same hash of the same rules, got %s %s", after.RegistryHash, again.RegistryHash)
+	}
+
+	RegRuleLock.Lock()
+	entry.Disabled = true
+	RegRuleLock.Unlock()
+	if disabled := GetVersionInfo(); disabled.RegistryHash == after.RegistryHash {
+		t.Error("expected the disabled rule to change the hash")
+	}
+}
@@ -0,0 +1,378 @@
+package rule
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/richgrove/validation/util"
+)
+
+// The outcome of POST /api/validation is posted to the webhooks of the
+// -webhook-config file, e.g. the failures to an alerting service,
+//   { "hooks": [ { "url": "https://alerts.internal/validation", "events": [ "failure" ], "rulesets": [ "signup" ] } ],
+//     "secret": "s3cr3t", "callback-url-prefixes": [ "https://etl.internal/" ],
+//     "max-attempts": 5, "backoff": "1s", "timeout": "5s" }
+// A hook receives the "failure" events, the failed validations, or with
+// "completion" every validation, of its "rulesets", or of all without
+// them.  A request names its own callback by the X-Callback-URL header,
+// which receives its outcome whatever it is, when the URL is under one of
+// "callback-url-prefixes", the callbacks are disabled without them.
+// The event is posted after the response, signed by the HMAC-SHA256 of
+// the secret, and retried with an exponential backoff on a network error,
+// HTTP 408, 429 and 5xx.  The document itself isn't posted.
+
+// the webhook events
+const (
+	WebhookEventCompletion = "completion"
+	WebhookEventFailure    = "failure"
+)
+
+// the webhook headers, the callback URL of a request, and the signature
+// and the time of the posted event
+const (
+	CallbackURLHeader      = "X-Callback-URL"
+	WebhookSignatureHeader = "X-Validation-Signature"
+	WebhookTimestampHeader = "X-Validation-Timestamp"
+	WebhookEventHeader     = "X-Validation-Event"
+)
+
+// the delivery settings, the queue of the pending deliveries, and the
+// workers posting them
+var (
+	WebhookQueueSize = 1000
+	WebhookWorkers   = 4
+)
+
+// WebhookHook is a webhook of the server config, Secret overrides the
+// config secret
+type WebhookHook struct {
+	URL      string   `json:"url"`
+	Events   []string `json:"events,omitempty"`
+	Rulesets []string `json:"rulesets,omitempty"`
+	Secret   string   `json:"secret,omitempty"`
+}
+
+// WebhookConfig is the webhooks and the delivery policy, the backoff is
+// doubled by each retry
+type WebhookConfig struct {
+	Hooks               []WebhookHook `json:"hooks"`
+	CallbackURLPrefixes []string      `json:"callback-url-prefixes,omitempty"`
+	Secret              string        `json:"secret,omitempty"`
+	MaxAttempts         int           `json:"max-attempts,omitempty"`
+	Backoff             string        `json:"backoff,omitempty"`
+	Timeout             string        `json:"timeout,omitempty"`
+
+	backoff time.Duration
+	timeout time.Duration
+}
+
+// the webhooks, nil is none
+var Webhooks *WebhookConfig
+
+// the delivery defaults
+const (
+	defaultWebhookAttempts = 5
+	defaultWebhookBackoff  = time.Second
+	defaultWebhookTimeout  = 5 * time.Second
+	maxWebhookBackoff      = 5 * time.Minute
+)
+
+// LoadWebhookConfig enables the webhooks by the JSON file
+func LoadWebhookConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := WebhookConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if err := config.check(); err != nil {
+		return err
+	}
+	Webhooks = &config
+	startWebhookWorkers()
+	return nil
+}
+
+func (config *WebhookConfig) check() error {
+	for i := range config.Hooks {
+		hook := &config.Hooks[i]
+		if err := checkWebhookURL(hook.URL); err != nil {
+			return err
+		}
+		if len(hook.Events) == 0 {
+			hook.Events = []string{WebhookEventFailure}
+		}
+		for _, event := range hook.Events {
+			if event != WebhookEventCompletion && event != WebhookEventFailure {
+				return fmt.Errorf("webhook: unknown event, %s", event)
+			}
+		}
+		for _, ruleset := range hook.Rulesets {
+			if err := CheckRuleset(ruleset); err != nil {
+				return fmt.Errorf("webhook: %s", err.Error())
+			}
+		}
+	}
+	for _, prefix := range config.CallbackURLPrefixes {
+		if err := checkWebhookURL(prefix); err != nil {
+			return err
+		}
+	}
+	if config.MaxAttempts < 0 {
+		return fmt.Errorf("webhook: invalid max-attempts, %d", config.MaxAttempts)
+	} else if config.MaxAttempts == 0 {
+		config.MaxAttempts = defaultWebhookAttempts
+	}
+	var err error
+	if config.backoff, err = parseWebhookDuration(config.Backoff, defaultWebhookBackoff); err != nil {
+		return err
+	}
+	if config.timeout, err = parseWebhookDuration(config.Timeout, defaultWebhookTimeout); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkWebhookURL accepts an absolute http(s) URL
+func checkWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("webhook: %s is not an http(s) URL", rawURL)
+	}
+	return nil
+}
+
+func parseWebhookDuration(s string, defaultValue time.Duration) (time.Duration, error) {
+	if len(s) == 0 {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("webhook: invalid duration, %s", s)
+	}
+	return d, nil
+}
+
+// webhookCallback returns the callback URL of the request, "" without it
+func webhookCallback(r *http.Request) (string, error) {
+	callback := r.Header.Get(CallbackURLHeader)
+	if len(callback) == 0 {
+		return "", nil
+	}
+	if Webhooks == nil || len(Webhooks.CallbackURLPrefixes) == 0 {
+		return "", fmt.Errorf("webhook: the callbacks are disabled")
+	}
+	if err := checkWebhookURL(callback); err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(callback)
+	for _, prefix := range Webhooks.CallbackURLPrefixes {
+		if urlUnderPrefix(u, prefix) {
+			return callback, nil
+		}
+	}
+	return "", fmt.Errorf("webhook: callback URL not allowed, %s", callback)
+}
+
+// urlUnderPrefix reports u is under the prefix URL: the same scheme and
+// host, and its path in the prefix path, by the path segments, so
+// "https://etl.internal@evil.example/" or
+// "https://etl.internal.evil.example/" isn't under "https://etl.internal/".
+// The callbacks and LOOKUP are allowed by it.
+func urlUnderPrefix(u *url.URL, prefix string) bool {
+	p, err := url.Parse(prefix)
+	if err != nil || u.User != nil || len(u.Opaque) > 0 {
+		return false
+	}
+	if !strings.EqualFold(u.Scheme, p.Scheme) || !strings.EqualFold(u.Host, p.Host) {
+		return false
+	}
+	prefixPath := strings.TrimSuffix(path.Clean("/"+p.Path), "/")
+	callbackPath := path.Clean("/" + u.Path)
+	return callbackPath == prefixPath || strings.HasPrefix(callbackPath, prefixPath+"/")
+}
+
+// WebhookEvent is the posted outcome of a validation, ID is the same for
+// each URL and each retry, for the receivers to drop the duplicates
+type WebhookEvent struct {
+	Event     string        `json:"event"`
+	ID        string        `json:"id"`
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"request-id,omitempty"`
+	Ruleset   string        `json:"ruleset,omitempty"`
+	Result    string        `json:"result"`
+	Rules     []string      `json:"rules,omitempty"`
+	Codes     []string      `json:"codes,omitempty"`
+	Messages  []RuleMessage `json:"messages,omitempty"`
+}
+
+// webhookDelivery is an event on its way to a URL, by the config of its
+// validation
+type webhookDelivery struct {
+	config  *WebhookConfig
+	url     string
+	secret  string
+	event   string
+	body    []byte
+	attempt int
+}
+
+var (
+	webhookQueue     chan *webhookDelivery
+	webhookStartOnce sync.Once
+	// the redirects aren't followed, a receiver can't send the events to
+	// another URL
+	webhookClient = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+)
+
+func startWebhookWorkers() {
+	webhookStartOnce.Do(func() {
+		webhookQueue = make(chan *webhookDelivery, WebhookQueueSize)
+		workers := WebhookWorkers
+		if workers < 1 {
+			workers = 1
+		}
+		for i := 0; i < workers; i++ {
+			go func() {
+				for d := range webhookQueue {
+					deliverWebhook(d)
+				}
+			}()
+		}
+	})
+}
+
+// notifyWebhooks posts the outcome of the validation to the hooks it
+// matches, and to the callback of the request, if any
+func notifyWebhooks(requestID string, callback string, ruleset string, outcome StreamResult) {
+	config := Webhooks
+	if config == nil {
+		return
+	}
+	event := WebhookEventCompletion
+	if outcome.Result == ValidationStatusFail {
+		event = WebhookEventFailure
+	}
+	var payload []byte
+	send := func(u string, secret string) {
+		if payload == nil {
+			payload, _ = json.Marshal(WebhookEvent{Event: event, ID: newRequestID(), Time: time.Now().UTC(), RequestID: requestID,
+				Ruleset: rulesetKey(ruleset), Result: outcome.Result, Rules: outcome.Rules, Codes: outcome.Codes, Messages: outcome.Messages})
+		}
+		enqueueWebhook(&webhookDelivery{config: config, url: u, secret: secret, event: event, body: payload})
+	}
+	if len(callback) > 0 {
+		send(callback, config.Secret)
+	}
+	for i := range config.Hooks {
+		hook := &config.Hooks[i]
+		if !hook.matches(event, ruleset) {
+			continue
+		}
+		secret := hook.Secret
+		if len(secret) == 0 {
+			secret = config.Secret
+		}
+		send(hook.URL, secret)
+	}
+}
+
+// matches reports the hook receives the event of the ruleset
+func (hook *WebhookHook) matches(event string, ruleset string) bool {
+	if !inRulesets(hook.Rulesets, ruleset) {
+		return false
+	}
+	for _, e := range hook.Events {
+		if e == WebhookEventCompletion || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueWebhook queues the delivery, it is dropped when the queue is full
+func enqueueWebhook(d *webhookDelivery) {
+	select {
+	case webhookQueue <- d:
+	default:
+		recordWebhookDelivery("dropped")
+	}
+}
+
+// deliverWebhook posts the event, and schedules its retry
+func deliverWebhook(d *webhookDelivery) {
+	config := d.config
+	d.attempt++
+	retry, err := postWebhook(d, config.timeout)
+	if err == nil {
+		recordWebhookDelivery("delivered")
+		return
+	}
+	if !retry || d.attempt >= config.MaxAttempts {
+		log.Printf("webhook: delivery to %s failed after %d attempts, %s", d.url, d.attempt, err.Error())
+		recordWebhookDelivery("failed")
+		return
+	}
+	backoff := config.backoff << uint(d.attempt-1)
+	if backoff <= 0 || backoff > maxWebhookBackoff {
+		backoff = maxWebhookBackoff
+	}
+	time.AfterFunc(backoff, func() { enqueueWebhook(d) })
+}
+
+// postWebhook posts the event once, and reports a failure is retried.
+// The signature is the HMAC-SHA256 of "<timestamp>.<body>".
+func postWebhook(d *webhookDelivery, timeout time.Duration) (bool, error) {
+	req, err := http.NewRequest("POST", d.url, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, d.event)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if len(d.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+webhookSignature(d.secret, timestamp, d.body))
+	}
+	client := *webhookClient
+	client.Timeout = timeout
+	res, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry := res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected HTTP status %d", res.StatusCode)
+}
+
+// webhookSignature is the hex HMAC-SHA256 of the timestamp and the body
+func webhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func recordWebhookDelivery(outcome string) {
+	ServiceMetrics.Counter(metricWebhookDeliveries, util.Labels{"outcome": outcome}, 1)
+}
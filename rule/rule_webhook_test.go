@@ -0,0 +1,147 @@
+package rule
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "webhook_test_zip", "rule": {"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "webhook_test_zip"}]}}`), &node)
+	registerTestRule(t, &node)
+
+	type received struct {
+		path  string
+		event WebhookEvent
+	}
+	events := make(chan received, 10)
+	attempts := 0
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		attempts++
+		first := attempts == 1
+		lock.Unlock()
+		if first {
+			// the first delivery is retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		expected := "sha256=" + webhookSignature("webhook-secret", r.Header.Get(WebhookTimestampHeader), body)
+		if r.Header.Get(WebhookSignatureHeader) != expected {
+			t.Errorf("expected the signature %s, got %s", expected, r.Header.Get(WebhookSignatureHeader))
+		}
+		event := WebhookEvent{}
+		json.Unmarshal(body, &event)
+		events <- received{r.URL.Path, event}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	os.WriteFile(path, []byte(`{"hooks": [{"url": "`+server.URL+`/alerts"}], "secret": "webhook-secret",
+		"callback-url-prefixes": ["`+server.URL+`/callbacks/"], "backoff": "1ms"}`), 0644)
+	if err := LoadWebhookConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { Webhooks = nil }()
+
+	validate := func(body string, callback string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/validation", strings.NewReader(body))
+		if len(callback) > 0 {
+			r.Header.Set(CallbackURLHeader, callback)
+		}
+		ValidateJSONData(w, r)
+		return w.Code
+	}
+	next := func() received {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a webhook event")
+		}
+		return received{}
+	}
+
+	// a failure, posted to the alert hook after a retry
+	if code := validate(`{"webhook_test_zip": "1234"}`, ""); code != http.StatusBadRequest {
+		t.Fatalf("expected a failure, got %d", code)
+	}
+	if e := next(); e.path != "/alerts" || e.event.Event != WebhookEventFailure || e.event.Result != ValidationStatusFail ||
+		!reflect.DeepEqual(e.event.Rules, []string{"webhook_test_zip"}) || len(e.event.ID) == 0 {
+		t.Errorf("expected the failure event, got %+v", e)
+	}
+	// a success, posted to the callback only
+	if code := validate(`{"webhook_test_zip": "12345"}`, server.URL+"/callbacks/job-7"); code != http.StatusOK {
+		t.Fatalf("expected a success, got %d", code)
+	}
+	if e := next(); e.path != "/callbacks/job-7" || e.event.Event != WebhookEventCompletion || e.event.Result != ValidationStatusSucc {
+		t.Errorf("expected the completion event of the callback, got %+v", e)
+	}
+	if code := validate(`{"webhook_test_zip": "12345"}`, "https://elsewhere.example/hook"); code != http.StatusBadRequest {
+		t.Errorf("expected a callback URL not allowed, got %d", code)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("expected no more events, got %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestURLUnderPrefix(t *testing.T) {
+	prefix := "https://etl.internal/callbacks/"
+	for callback, allowed := range map[string]bool{
+		"https://etl.internal/callbacks/job-7":         true,
+		"https://ETL.internal/callbacks/job-7":         true,
+		"https://etl.internal/callbacks":               true,
+		"https://etl.internal/callbacks-other/job-7":   false,
+		"https://etl.internal/callbacks/../admin":      false,
+		"https://etl.internal.evil.example/callbacks/": false,
+		"https://etl.internal@evil.example/callbacks/": false,
+		"https://etl.internal:8443/callbacks/job-7":    false,
+		"http://etl.internal/callbacks/job-7":          false,
+		"https://user:pw@etl.internal/callbacks/job-7": false,
+	} {
+		u, err := url.Parse(callback)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if urlUnderPrefix(u, prefix) != allowed {
+			t.Errorf("%s: expected allowed %v", callback, allowed)
+		}
+	}
+}
+
+func TestWebhookNoRedirect(t *testing.T) {
+	followed := make(chan bool, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed <- true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	retry, err := postWebhook(&webhookDelivery{url: server.URL, event: WebhookEventFailure, body: []byte("{}")}, time.Second)
+	if err == nil || retry {
+		t.Errorf("expected the redirect to fail without a retry, got %v, %v", retry, err)
+	}
+	select {
+	case <-followed:
+		t.Error("expected the redirect not followed")
+	default:
+	}
+}
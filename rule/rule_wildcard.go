@@ -0,0 +1,146 @@
+package rule
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// wildcardIndex in a field name matches any array index, so a rule of
+// "addresses[*].zip_code" is evaluated for the zip code of every address
+const wildcardIndex = "[*]"
+
+// recursiveDescent in a field name matches any depth, so a rule of
+// "..email" is evaluated for every "email" member, e.g. "email",
+// "user.email" and "contacts[0].email", see the JSONPath "$..email"
+const recursiveDescent = ".."
+
+// the registered wildcard field names, maintained with the register
+var wildcardFields = map[string]bool{}
+
+func isWildcardPath(name string) bool {
+	return strings.Contains(name, wildcardIndex) || strings.Contains(name, recursiveDescent)
+}
+
+// the compiled wildcard field names, reset when it reaches
+// maxWildcardPatterns, the ad hoc rules may have any field names
+var (
+	wildcardPatternsLock sync.RWMutex
+	wildcardPatterns     = map[string]*regexp.Regexp{}
+)
+
+const maxWildcardPatterns = 1024
+
+// compileWildcardPath compiles the wildcard field name into the regexp of
+// the matching field paths, a [*] is captured as its array index
+func compileWildcardPath(pattern string) *regexp.Regexp {
+	wildcardPatternsLock.RLock()
+	re, ok := wildcardPatterns[pattern]
+	wildcardPatternsLock.RUnlock()
+	if ok {
+		return re
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for rest := pattern; len(rest) > 0; {
+		switch {
+		case strings.HasPrefix(rest, wildcardIndex):
+			b.WriteString(`\[([0-9]+)\]`)
+			rest = rest[len(wildcardIndex):]
+		case strings.HasPrefix(rest, recursiveDescent):
+			// any path in between, the next name is a member
+			if b.Len() == 1 {
+				b.WriteString(`(?:.*\.)?`)
+			} else {
+				b.WriteString(`(?:[.\[].*)?\.`)
+			}
+			rest = rest[len(recursiveDescent):]
+		default:
+			end := len(rest)
+			if i := strings.Index(rest, wildcardIndex); i >= 0 {
+				end = i
+			}
+			if i := strings.Index(rest, recursiveDescent); i >= 0 && i < end {
+				end = i
+			}
+			b.WriteString(regexp.QuoteMeta(rest[:end]))
+			rest = rest[end:]
+		}
+	}
+	b.WriteString("$")
+	re = regexp.MustCompile(b.String())
+
+	wildcardPatternsLock.Lock()
+	if len(wildcardPatterns) >= maxWildcardPatterns {
+		wildcardPatterns = map[string]*regexp.Regexp{}
+	}
+	wildcardPatterns[pattern] = re
+	wildcardPatternsLock.Unlock()
+	return re
+}
+
+// matchWildcardPath matches the input field path to the wildcard pattern,
+// and returns the array indices bound to the [*] in order, e.g.
+// "a[*].b[*].c" matches "a[1].b[0].c" with the indices "1", "0"
+func matchWildcardPath(pattern, field string) ([]string, bool) {
+	m := compileWildcardPath(pattern).FindStringSubmatch(field)
+	if m == nil {
+		return nil, false
+	}
+	return m[1:], true
+}
+
+// bindWildcardPath replaces the [*] of name with the indices in order, so
+// a cross-field reference resolves in the same array item, e.g.
+// "addresses[*].country" with "1" is "addresses[1].country"
+func bindWildcardPath(name string, indices []string) string {
+	for _, index := range indices {
+		i := strings.Index(name, wildcardIndex)
+		if i < 0 {
+			break
+		}
+		name = name[:i] + "[" + index + "]" + name[i+len(wildcardIndex):]
+	}
+	return name
+}
+
+// hasWildcardMatch checks any input field matches the wildcard pattern
+func hasWildcardMatch(pattern string, inputFields map[string]interface{}) bool {
+	for field := range inputFields {
+		if _, ok := matchWildcardPath(pattern, field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// firstWildcardMatch returns the first input field, in the path order,
+// matching the wildcard pattern, for a cross-field reference not bound by
+// the array indices of the rule
+func firstWildcardMatch(pattern string, inputFields map[string]interface{}) (string, bool) {
+	first, found := "", false
+	for field := range inputFields {
+		if _, ok := matchWildcardPath(pattern, field); ok && (!found || field < first) {
+			first, found = field, true
+		}
+	}
+	return first, found
+}
+
+// addFailedPath records the failing field path of a wildcard rule, and
+// returns true when it is the first failure of the rule
+func addFailedPath(paths map[string][]string, rule string, field string) bool {
+	_, seen := paths[rule]
+	paths[rule] = append(paths[rule], field)
+	return !seen
+}
+
+// sortFailedPaths sorts the failing paths of each rule, the evaluation
+// order is random
+func sortFailedPaths(paths map[string][]string) {
+	for _, list := range paths {
+		sort.Strings(list)
+	}
+}
@@ -0,0 +1,70 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var wildcardPathTestCases = []struct {
+	pattern string
+	field   string
+	indices []string
+	match   bool
+}{
+	{"addresses[*].zip_code", "addresses[1].zip_code", []string{"1"}, true},
+	{"addresses[*].zip_code", "addresses[12].zip_code", []string{"12"}, true},
+	{"a[*].b[*].c", "a[1].b[0].c", []string{"1", "0"}, true},
+	{"matrix[0][*]", "matrix[0][3]", []string{"3"}, true},
+	{"addresses[*].zip_code", "addresses.zip_code", nil, false},
+	{"addresses[*].zip_code", "addresses[x].zip_code", nil, false},
+	{"addresses[*].zip_code", "addresses[1].zip_code_2", nil, false},
+	{"tags[*]", "tags[]", nil, false},
+	{"..email", "email", []string{}, true},
+	{"..email", "user.contacts[2].email", []string{}, true},
+	{"..email", "user.email_2", nil, false},
+	{"user..email", "user.email", []string{}, true},
+	{"user..email", "user[0].email", []string{}, true},
+	{"user..email", "username.email", nil, false},
+	{"..items[*].id", "order.items[4].id", []string{"4"}, true},
+}
+
+func TestMatchWildcardPath(t *testing.T) {
+	for _, tc := range wildcardPathTestCases {
+		indices, ok := matchWildcardPath(tc.pattern, tc.field)
+		if ok != tc.match || (ok && !reflect.DeepEqual(indices, tc.indices)) {
+			t.Errorf("%s ~ %s: expected %v %v, got %v %v", tc.pattern, tc.field, tc.match, tc.indices, ok, indices)
+		}
+	}
+}
+
+func TestWildcardRule(t *testing.T) {
+	// the US zip code of every address is 5 digits
+	node := RuleNode{Name: "wildcard_test_us_zip"}
+	rule := `{"operator": "IF", "operands": [
+		{"operator": "EQUAL_TO", "operands": [{"field": "wildcard_test[*].country"}, {"value": "US"}]},
+		{"operator": "MATCHES", "operands": [{"value": "^[0-9]{5}$"}, {"field": "wildcard_test[*].zip_code"}]}]}`
+	if err := json.Unmarshal([]byte(rule), &node.RuleContent); err != nil {
+		t.Fatal(err)
+	}
+	node.PrimaryField = "wildcard_test[*].zip_code"
+	registerTestRule(t, &node)
+
+	doc := map[string]interface{}{}
+	json.Unmarshal([]byte(`{"wildcard_test": [
+		{"country": "US", "zip_code": "9006"},
+		{"country": "CA", "zip_code": "K1A 0B1"},
+		{"country": "US", "zip_code": "90067"},
+		{"country": "US", "zip_code": "1234"}]}`), &doc)
+	expectedPaths := map[string][]string{"wildcard_test_us_zip": {"wildcard_test[0].zip_code", "wildcard_test[3].zip_code"}}
+	result, err := ValidateInputJSONByRules("", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.flag || !reflect.DeepEqual(result.rules, []string{"wildcard_test_us_zip"}) {
+		t.Errorf("expected the rule to fail once, got %v %v", result.flag, result.rules)
+	}
+	if !reflect.DeepEqual(result.paths, expectedPaths) {
+		t.Errorf("expected the failing paths %v, got %v", expectedPaths, result.paths)
+	}
+}
@@ -0,0 +1,93 @@
+package rule
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// WordListFiles configures the word lists used by IN_DICTIONARY and
+// NOT_IN_BLOCKLIST operators, listName => file path.
+// The file has one word per line, blank lines and "#" comment lines
+// are skipped.  Words are matched case-insensitive.
+var WordListFiles = map[string]string{}
+
+type wordList map[string]struct{}
+
+var loadedWordLists = map[string]wordList{}
+var wordListLock = sync.RWMutex{}
+
+// LoadWordLists (re-)loads all configured word lists.  The loaded lists
+// are swapped in only when every file is read successfully.
+func LoadWordLists() error {
+	lists := make(map[string]wordList, len(WordListFiles))
+	for name, path := range WordListFiles {
+		words, err := readWordListFile(path)
+		if err != nil {
+			return fmt.Errorf("word list %s: %s", name, err.Error())
+		}
+		lists[name] = words
+	}
+
+	wordListLock.Lock()
+	loadedWordLists = lists
+	wordListLock.Unlock()
+	return nil
+}
+
+func readWordListFile(path string) (wordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := wordList{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if len(word) == 0 || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words[strings.ToLower(word)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// wordListContains checks the word in the loaded list, listName
+func wordListContains(listName string, word string) (bool, error) {
+	wordListLock.RLock()
+	defer wordListLock.RUnlock()
+
+	words, ok := loadedWordLists[listName]
+	if !ok {
+		return false, fmt.Errorf("rule operator: unknown word list, %s", listName)
+	}
+	_, found := words[strings.ToLower(word)]
+	return found, nil
+}
+
+// wordListOperator creates the OperatorFn with operands (listName, value),
+// and evaluates as true when the word is found in the list as expected.
+func wordListOperator(expectFound bool) OperatorFn {
+	return func(operands []interface{}) (interface{}, error) {
+		if len(operands) != 2 {
+			return nil, ParseRuleOperatorError
+		}
+		listName, ok1 := operands[0].(string)
+		word, ok2 := operands[1].(string)
+		if !ok1 || !ok2 {
+			return nil, ParseRuleOperatorError
+		}
+		found, err := wordListContains(listName, word)
+		if err != nil {
+			return nil, err
+		}
+		return found == expectFound, nil
+	}
+}
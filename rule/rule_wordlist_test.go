@@ -0,0 +1,49 @@
+package rule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWordListOperators(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "blocked.txt")
+	os.WriteFile(path, []byte("# reserved names\nAdmin\n\n  root  \n"), 0644)
+	defer func(files map[string]string) {
+		WordListFiles = files
+		LoadWordLists()
+	}(WordListFiles)
+	WordListFiles = map[string]string{"blocked": path}
+	if err := LoadWordLists(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		operator OperatorType
+		word     string
+		expected bool
+	}{
+		{InDictionaryOperator, "admin", true},
+		{InDictionaryOperator, "ROOT", true},
+		{InDictionaryOperator, "# reserved names", false},
+		{NotInBlocklistOperator, "alice", true},
+		{NotInBlocklistOperator, "Admin", false},
+	} {
+		if res, err := RegisteredOperators[tc.operator]([]interface{}{"blocked", tc.word}); err != nil || res != tc.expected {
+			t.Errorf("%s(%q): expected %v, got %v %v", tc.operator, tc.word, tc.expected, res, err)
+		}
+	}
+	if _, err := RegisteredOperators[InDictionaryOperator]([]interface{}{"unknown", "admin"}); err == nil {
+		t.Error("expected an unknown word list rejected")
+	}
+
+	// a failed reload keeps the loaded lists
+	WordListFiles = map[string]string{"blocked": filepath.Join(dir, "missing.txt")}
+	if err := LoadWordLists(); err == nil {
+		t.Error("expected the missing file reported")
+	}
+	if res, err := RegisteredOperators[InDictionaryOperator]([]interface{}{"blocked", "admin"}); err != nil || res != true {
+		t.Errorf("expected the loaded list kept, got %v %v", res, err)
+	}
+}
@@ -0,0 +1,28 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestZeroRuleMatched(t *testing.T) {
+	node := RuleNode{}
+	json.Unmarshal([]byte(`{"name": "zero_rule_test_zone", "rule": {"operator": "IS_TIMEZONE", "operands": [{"field": "zero_rule_test_zone"}]}}`), &node)
+	registerTestRule(t, &node)
+	for input, expected := range map[string]bool{`{"zero_rule_test_zone": "UTC"}`: false, `{"zero_rule_test_zonee": "UTC"}`: true} {
+		doc := map[string]interface{}{}
+		json.Unmarshal([]byte(input), &doc)
+		result, err := ValidateInputJSONByRules("", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.noRuleMatched != expected || !result.flag {
+			t.Errorf("%s: expected no rule matched %v, got %v %v", input, expected, result.noRuleMatched, result.flag)
+		}
+	}
+	for s, expected := range map[string]ZeroRulePolicy{"pass": ZeroRulePass, "fail": ZeroRuleFail, "warn": ZeroRuleWarn, "ignore": ""} {
+		if policy, err := ParseZeroRulePolicy(s); policy != expected || (err != nil) != (len(expected) == 0) {
+			t.Errorf("%s: expected %q, got %q %v", s, expected, policy, err)
+		}
+	}
+}
@@ -34,24 +34,36 @@ func ExecutAppTask(task AppTaskExecutor, result ExecutorResult) (ExecutorResult,
 
 	var wg sync.WaitGroup
 
+	// a ScheduledTask runs its executors in DefaultScheduler workers
+	scheduler := DefaultScheduler
+	scheduled, isScheduled := task.(ScheduledTask)
+
 	wg.Add(count)
 	for _, executor := range task.GetAllExecutors() {
 		// put the task in fan-out N executors, each runs a small processing unit.
 		// Once complete, pass result to reducer
-		go func(fn Executor, in <-chan interface{}, out chan<- ExecutorResult, done <-chan interface{}) {
-			//wg.Add(1)
-			defer wg.Done()
+		run := func(fn Executor, in <-chan interface{}, out chan<- ExecutorResult, done <-chan interface{}) func() {
+			return func() {
+				//wg.Add(1)
+				defer wg.Done()
 
-			select {
-			case data := <-in:
-				// call executor on data, and send result to out
-				// executor() runs to complete
-				out <- fn(data)
-			case <-done:
-				// cancellation occurs at close(done)
-				return
+				select {
+				case data := <-in:
+					// call executor on data, and send result to out
+					// executor() runs to complete
+					out <- fn(data)
+				case <-done:
+					// cancellation occurs at close(done)
+					return
+				}
 			}
 		}(executor, in, out, done)
+
+		if isScheduled && scheduler != nil {
+			scheduler.Submit(scheduled.GetPriority(), scheduled.GetJobID(), run)
+		} else {
+			go run()
+		}
 	}
 
 	cancelFlag := false
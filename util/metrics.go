@@ -0,0 +1,49 @@
+package util
+
+import (
+	"sort"
+	"strings"
+)
+
+// Labels are the dimensions of a metric sample, e.g. {"result": "failure"}
+type Labels map[string]string
+
+// Metrics is the telemetry backend of the service.  The name is in the
+// Prometheus convention, e.g. "validation_requests_total", an adapter
+// converts it to its own.
+type Metrics interface {
+	// Counter adds delta to the monotonic counter
+	Counter(name string, labels Labels, delta float64)
+	// Histogram observes the value, e.g. a latency in seconds
+	Histogram(name string, labels Labels, value float64)
+	// Gauge sets the current value
+	Gauge(name string, labels Labels, value float64)
+}
+
+// NopMetrics discards the samples, the metrics are disabled
+type NopMetrics struct{}
+
+func (NopMetrics) Counter(name string, labels Labels, delta float64)   {}
+func (NopMetrics) Histogram(name string, labels Labels, value float64) {}
+func (NopMetrics) Gauge(name string, labels Labels, value float64)     {}
+
+// sortedKeys returns the label names in order, so a label set has one
+// series key and one wire format
+func (l Labels) sortedKeys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// join formats the labels as k<sep>v pairs separated by comma, in the key
+// order, and quotes the values by quote
+func (l Labels) join(sep string, quote func(string) string) string {
+	pairs := make([]string, 0, len(l))
+	for _, k := range l.sortedKeys() {
+		pairs = append(pairs, k+sep+quote(l[k]))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,155 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram upper bounds, for the latencies in
+// seconds
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics keeps the samples in memory, and serves them in the
+// Prometheus text exposition format to the scraper
+type PrometheusMetrics struct {
+	lock     sync.Mutex
+	buckets  []float64
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	kind   string // counter, gauge or histogram
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels string // formatted, e.g. result="failure"
+	value  float64
+	// histogram only, the cumulative counts are computed by the exposition
+	counts []uint64
+	count  uint64
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{buckets: DefaultBuckets, families: map[string]*metricFamily{}}
+}
+
+// series returns the series of the metric, the first sample of a name
+// sets its kind
+func (m *PrometheusMetrics) series(name string, kind string, labels Labels) *metricSeries {
+	f, ok := m.families[name]
+	if !ok {
+		f = &metricFamily{kind: kind, series: map[string]*metricSeries{}}
+		m.families[name] = f
+	}
+	key := labels.join("=", strconv.Quote)
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labels: key}
+		if kind == "histogram" {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (m *PrometheusMetrics) Counter(name string, labels Labels, delta float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.series(name, "counter", labels).value += delta
+}
+
+func (m *PrometheusMetrics) Gauge(name string, labels Labels, value float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.series(name, "gauge", labels).value = value
+}
+
+func (m *PrometheusMetrics) Histogram(name string, labels Labels, value float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s := m.series(name, "histogram", labels)
+	if s.counts == nil {
+		// the name is registered as another kind
+		return
+	}
+	for i, le := range m.buckets {
+		if value <= le {
+			s.counts[i]++
+			break
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// WriteTo writes the samples in the text exposition format, the metric
+// names and the series in order
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	m.lock.Lock()
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := m.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", name, braced(s.labels), formatSample(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, le := range m.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, braced(withLabel(s.labels, "le", formatSample(le))), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, braced(withLabel(s.labels, "le", "+Inf")), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, braced(s.labels), formatSample(s.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, braced(s.labels), s.count)
+		}
+	}
+	m.lock.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the scrape, GET /metrics
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	m.WriteTo(w)
+}
+
+func braced(labels string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func withLabel(labels string, name string, value string) string {
+	label := name + "=" + strconv.Quote(value)
+	if len(labels) == 0 {
+		return label
+	}
+	return labels + "," + label
+}
+
+func formatSample(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// StatsdMetrics sends the samples to a StatsD agent over UDP, fire and
+// forget, a lost sample never blocks the service.  The plain StatsD has
+// no labels, so the label values are appended to the metric name in the
+// label name order, e.g. "validation_rule_evaluations_total.fail".  The
+// Datadog flavor, DogStatsD, sends them as the tags, "|#result:fail".
+type StatsdMetrics struct {
+	conn    net.Conn
+	datadog bool
+}
+
+// NewStatsdMetrics connects to the StatsD agent at addr, "host:port"
+func NewStatsdMetrics(addr string) (*StatsdMetrics, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdMetrics{conn: conn}, nil
+}
+
+// NewDatadogMetrics connects to the DogStatsD agent at addr, "host:port"
+func NewDatadogMetrics(addr string) (*StatsdMetrics, error) {
+	m, err := NewStatsdMetrics(addr)
+	if err != nil {
+		return nil, err
+	}
+	m.datadog = true
+	return m, nil
+}
+
+func (m *StatsdMetrics) Counter(name string, labels Labels, delta float64) {
+	m.send(name, labels, delta, "c")
+}
+
+func (m *StatsdMetrics) Histogram(name string, labels Labels, value float64) {
+	m.send(name, labels, value, "h")
+}
+
+func (m *StatsdMetrics) Gauge(name string, labels Labels, value float64) {
+	m.send(name, labels, value, "g")
+}
+
+func (m *StatsdMetrics) send(name string, labels Labels, value float64, kind string) {
+	m.conn.Write([]byte(m.format(name, labels, value, kind)))
+}
+
+// format builds the StatsD line, "<name>:<value>|<kind>[|#<tags>]"
+func (m *StatsdMetrics) format(name string, labels Labels, value float64, kind string) string {
+	if !m.datadog {
+		for _, k := range labels.sortedKeys() {
+			name += "." + statsdName(labels[k])
+		}
+	}
+	line := name + ":" + strconv.FormatFloat(value, 'g', -1, 64) + "|" + kind
+	if m.datadog && len(labels) > 0 {
+		line += "|#" + labels.join(":", statsdName)
+	}
+	return line
+}
+
+// statsdName replaces the characters of the StatsD line format
+func statsdName(s string) string {
+	return strings.Map(func(c rune) rune {
+		switch c {
+		case ':', '|', '@', '#', ',', ' ', '\n':
+			return '_'
+		}
+		return c
+	}, s)
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.Counter("requests_total", Labels{"status": "200", "route": "/api/validation"}, 1)
+	m.Counter("requests_total", Labels{"route": "/api/validation", "status": "200"}, 2)
+	m.Gauge("rules", nil, 5)
+	m.Histogram("duration_seconds", Labels{"route": "/version"}, 0.003)
+	m.Histogram("duration_seconds", Labels{"route": "/version"}, 20)
+
+	var b strings.Builder
+	m.WriteTo(&b)
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE requests_total counter\n",
+		`requests_total{route="/api/validation",status="200"} 3` + "\n",
+		"# TYPE rules gauge\nrules 5\n",
+		`duration_seconds_bucket{route="/version",le="0.0025"} 0` + "\n",
+		`duration_seconds_bucket{route="/version",le="0.005"} 1` + "\n",
+		`duration_seconds_bucket{route="/version",le="10"} 1` + "\n",
+		`duration_seconds_bucket{route="/version",le="+Inf"} 2` + "\n",
+		`duration_seconds_count{route="/version"} 2` + "\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected %q in\n%s", line, out)
+		}
+	}
+}
+
+func TestStatsdFormat(t *testing.T) {
+	labels := Labels{"result": "fail", "route": "/a b"}
+	statsd := &StatsdMetrics{}
+	if line := statsd.format("evaluations_total", labels, 1, "c"); line != "evaluations_total.fail./a_b:1|c" {
+		t.Errorf("unexpected StatsD line, %s", line)
+	}
+	datadog := &StatsdMetrics{datadog: true}
+	if line := datadog.format("evaluations_total", labels, 1, "c"); line != "evaluations_total:1|c|#result:fail,route:/a_b" {
+		t.Errorf("unexpected DogStatsD line, %s", line)
+	}
+	if line := datadog.format("rules", nil, 2.5, "g"); line != "rules:2.5|g" {
+		t.Errorf("unexpected DogStatsD line, %s", line)
+	}
+}
@@ -0,0 +1,152 @@
+package util
+
+import (
+	"sync"
+)
+
+// Priority of the scheduled work
+type Priority int
+
+const (
+	// interactive single-document requests, always run first
+	PriorityInteractive Priority = iota
+	// batch jobs, interleaved round-robin by job ID in the spare workers
+	PriorityBatch
+)
+
+// Scheduler runs the submitted work on a fixed worker pool.
+// The interactive work is always picked first, so a huge batch job
+// can't inflate the online latency.  The batch work is picked from
+// the batch jobs in round-robin, and it is limited by two quotas:
+//   maxBatchWorkers - workers running batch work at the same time,
+//                     the rest workers are kept for interactive work
+//   maxPerJob       - workers running the work of one batch job
+type Scheduler struct {
+	lock sync.Mutex
+	cond *sync.Cond
+
+	maxBatchWorkers int
+	maxPerJob       int
+
+	interactive  []func()
+	batchQueues  map[string][]func()
+	batchRunning map[string]int
+	batchOrder   []string // round-robin ring of job IDs with queued work
+	batchNext    int
+	batchWorkers int
+}
+
+// NewScheduler starts the worker pool of workers
+func NewScheduler(workers int, maxBatchWorkers int, maxPerJob int) *Scheduler {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxBatchWorkers < 1 || maxBatchWorkers > workers {
+		maxBatchWorkers = workers
+	}
+	if maxPerJob < 1 || maxPerJob > maxBatchWorkers {
+		maxPerJob = maxBatchWorkers
+	}
+	s := &Scheduler{
+		maxBatchWorkers: maxBatchWorkers,
+		maxPerJob:       maxPerJob,
+		batchQueues:     map[string][]func(){},
+		batchRunning:    map[string]int{},
+	}
+	s.cond = sync.NewCond(&s.lock)
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+	return s
+}
+
+// Submit queues fn to run in the priority, jobID groups the batch work
+// for the round-robin and the per-job quota
+func (s *Scheduler) Submit(priority Priority, jobID string, fn func()) {
+	s.lock.Lock()
+	if priority == PriorityInteractive {
+		s.interactive = append(s.interactive, fn)
+	} else {
+		if len(s.batchQueues[jobID]) == 0 {
+			s.batchOrder = append(s.batchOrder, jobID)
+		}
+		s.batchQueues[jobID] = append(s.batchQueues[jobID], fn)
+	}
+	s.lock.Unlock()
+	s.cond.Signal()
+}
+
+// next picks the next work to run, caller holds the lock.
+// It returns the batch job ID of the work, "" for interactive work.
+func (s *Scheduler) next() (func(), string, bool) {
+	if len(s.interactive) > 0 {
+		fn := s.interactive[0]
+		s.interactive = s.interactive[1:]
+		return fn, "", true
+	}
+	if s.batchWorkers >= s.maxBatchWorkers {
+		return nil, "", false
+	}
+	for i := 0; i < len(s.batchOrder); i++ {
+		k := (s.batchNext + i) % len(s.batchOrder)
+		jobID := s.batchOrder[k]
+		if s.batchRunning[jobID] >= s.maxPerJob {
+			continue
+		}
+		queue := s.batchQueues[jobID]
+		fn := queue[0]
+		if len(queue) == 1 {
+			// no more queued work of the job, drop it from the ring
+			delete(s.batchQueues, jobID)
+			s.batchOrder = append(s.batchOrder[:k], s.batchOrder[k+1:]...)
+			s.batchNext = k
+		} else {
+			s.batchQueues[jobID] = queue[1:]
+			s.batchNext = k + 1
+		}
+		if len(s.batchOrder) > 0 {
+			s.batchNext %= len(s.batchOrder)
+		} else {
+			s.batchNext = 0
+		}
+		s.batchRunning[jobID]++
+		s.batchWorkers++
+		return fn, jobID, true
+	}
+	return nil, "", false
+}
+
+func (s *Scheduler) worker() {
+	for {
+		s.lock.Lock()
+		fn, jobID, ok := s.next()
+		for !ok {
+			s.cond.Wait()
+			fn, jobID, ok = s.next()
+		}
+		s.lock.Unlock()
+
+		fn()
+
+		if len(jobID) > 0 {
+			s.lock.Lock()
+			s.batchWorkers--
+			if s.batchRunning[jobID]--; s.batchRunning[jobID] == 0 {
+				delete(s.batchRunning, jobID)
+			}
+			s.lock.Unlock()
+			// a quota is released, other workers may pick batch work
+			s.cond.Broadcast()
+		}
+	}
+}
+
+// DefaultScheduler runs the executors of a ScheduledTask, nil runs each
+// executor in its own goroutine
+var DefaultScheduler *Scheduler
+
+// ScheduledTask is an AppTaskExecutor run by DefaultScheduler
+type ScheduledTask interface {
+	GetPriority() Priority
+	GetJobID() string
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerRunsAllWork(t *testing.T) {
+	s := NewScheduler(4, 2, 1)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	done := map[string]int{}
+	for _, job := range []string{"a", "b", "c"} {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			jobID := job
+			s.Submit(PriorityBatch, jobID, func() {
+				defer wg.Done()
+				lock.Lock()
+				done[jobID]++
+				lock.Unlock()
+			})
+		}
+	}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		s.Submit(PriorityInteractive, "", func() {
+			defer wg.Done()
+			lock.Lock()
+			done[""]++
+			lock.Unlock()
+		})
+	}
+	wg.Wait()
+
+	for _, job := range []string{"", "a", "b", "c"} {
+		if done[job] != 10 {
+			t.Errorf("job %q: expected 10 runs, got %d", job, done[job])
+		}
+	}
+}
+
+func TestSchedulerInteractiveNotBlockedByBatch(t *testing.T) {
+	// one worker is kept for interactive work
+	s := NewScheduler(2, 1, 1)
+
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		s.Submit(PriorityBatch, "huge", func() { <-release })
+	}
+	defer close(release)
+
+	ran := make(chan struct{})
+	s.Submit(PriorityInteractive, "", func() { close(ran) })
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Error("interactive work is blocked by the batch job")
+	}
+}